@@ -0,0 +1,316 @@
+package cascade
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kokutas/gb28181/media/rtp"
+	"github.com/kokutas/gb28181/media/sdp"
+	"github.com/kokutas/gb28181/platform"
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// DeviceResolver returns where a device is reached, false when it is not
+// registered.
+type DeviceResolver func(deviceID string) (*platform.Device, bool)
+
+// Proxy bridges the INVITE sessions of an upper-level platform to our
+// devices as a back-to-back user agent: an INVITE of a shared channel
+// becomes an INVITE of its device, whose media the built-in forwarder
+// relays to the address of the upstream offer under the upstream SSRC.
+// A BYE on either side ends both, as do a CANCEL of the upstream INVITE
+// and a 2xx the upstream never acknowledges.
+type Proxy struct {
+	client    *Client
+	platform  *platform.Platform
+	policy    *SharePolicy
+	resolve   DeviceResolver
+	mediaHost string // address media is received and sent on
+
+	mutex    sync.Mutex
+	sessions map[string]*ProxySession
+	sequence int
+}
+
+// ProxySession is an upstream dialog and the device call it is bridged to.
+type ProxySession struct {
+	channelID string
+	upstream  *ua.Dialog
+	call      *platform.Call
+	forwarder *rtp.Forwarder
+}
+
+func (session *ProxySession) GetChannelID() string {
+	return session.channelID
+}
+func (session *ProxySession) GetUpstreamDialog() *ua.Dialog {
+	return session.upstream
+}
+func (session *ProxySession) GetCall() *platform.Call {
+	return session.call
+}
+func (session *ProxySession) GetForwarder() *rtp.Forwarder {
+	return session.forwarder
+}
+
+// NewProxy serves the INVITE and BYE requests of the client's user agent.
+// mediaHost is the local IP address announced to both sides for media.
+func NewProxy(client *Client, upstreamPlatform *platform.Platform, policy *SharePolicy, resolve DeviceResolver, mediaHost string) *Proxy {
+	proxy := &Proxy{
+		client:    client,
+		platform:  upstreamPlatform,
+		policy:    policy,
+		resolve:   resolve,
+		mediaHost: mediaHost,
+		sessions:  make(map[string]*ProxySession),
+	}
+	userAgent := client.GetUserAgent()
+	userAgent.Handle("INVITE", proxy.serveInvite)
+	userAgent.Handle("ACK", func(*ua.ServerTransaction) {})
+	userAgent.Handle("BYE", proxy.serveBye)
+	return proxy
+}
+
+// GetSessions returns the sessions in progress.
+func (proxy *Proxy) GetSessions() []*ProxySession {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	sessions := make([]*ProxySession, 0, len(proxy.sessions))
+	for _, session := range proxy.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+func (proxy *Proxy) serveInvite(tx *ua.ServerTransaction) {
+	request := tx.GetRequest()
+	channelID := request.GetRequestLine().GetReqUri().GetUser()
+	deviceID, ok := proxy.policy.Lookup(channelID, proxy.platform.GetCatalogStore())
+	if !ok {
+		respond(tx, 404)
+		return
+	}
+	device, ok := proxy.resolve(deviceID)
+	if !ok {
+		respond(tx, 480)
+		return
+	}
+	offer := new(sdp.Session)
+	if err := offer.Parse(string(request.GetBody())); err != nil {
+		log.Printf("upstream invite of %s sdp error : %s", channelID, err.Error())
+		respond(tx, 400)
+		return
+	}
+	media := videoMedia(offer)
+	if media == nil {
+		respond(tx, 488)
+		return
+	}
+	respond(tx, 100)
+	session, answer, err := proxy.bridge(device, channelID, offer, media)
+	if cancelled(tx) {
+		// the ua answered 487 while the device was invited
+		if err == nil {
+			proxy.hangUp(session)
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("upstream invite of %s error : %s", channelID, err.Error())
+		code := 500
+		var sipError *lib.SipError
+		if errors.As(err, &sipError) && sipError.Code >= 400 {
+			code = sipError.Code
+		}
+		respond(tx, code)
+		return
+	}
+	body, _ := answer.Raw()
+	response := message.NewResponseTo(request, 200)
+	response.GetHeader().Contact = header.NewContact("", proxy.client.GetUserAgent().GetContactUri(), nil)
+	response.GetHeader().ContentType = header.NewContentType(sdp.ContentType)
+	response.SetBody([]byte(body))
+	session.upstream = ua.NewServerDialog(request, response)
+	key := callKey(session.upstream.GetCallID(), session.upstream.GetLocalTag())
+	proxy.mutex.Lock()
+	proxy.sessions[key] = session
+	proxy.mutex.Unlock()
+	if err := tx.Respond(response); err != nil {
+		log.Printf("upstream invite of %s response error : %s", channelID, err.Error())
+		proxy.end(key, false)
+		return
+	}
+	go func() {
+		<-session.call.Done()
+		// the device hung up
+		proxy.end(key, true)
+	}()
+	if !tx.WaitAck() {
+		log.Printf("upstream invite of %s error : the 200 was not acknowledged", channelID)
+		proxy.end(key, true)
+	}
+}
+
+// cancelled reports whether a CANCEL ended the INVITE transaction.
+func cancelled(tx *ua.ServerTransaction) bool {
+	select {
+	case <-tx.Cancelled():
+		return true
+	default:
+		return false
+	}
+}
+
+// bridge invites the device with an offer mirroring the upstream one and
+// starts relaying its media. It returns the answer to the upstream offer.
+func (proxy *Proxy) bridge(device *platform.Device, channelID string, offer *sdp.Session, media *sdp.Media) (*ProxySession, *sdp.Session, error) {
+	sender, err := rtp.NewSenderForOffer(offer, media, net.JoinHostPort(proxy.mediaHost, "0"), 96)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := sender.Start(); err != nil {
+		return nil, nil, fmt.Errorf("media to upstream error : %s", err.Error())
+	}
+	network := "udp"
+	if media.IsTCP() {
+		network = "tcp"
+	}
+	forwarder := rtp.NewForwarder(network, net.JoinHostPort(proxy.mediaHost, "0"), sender)
+	if err := forwarder.Listen(); err != nil {
+		sender.Close()
+		return nil, nil, err
+	}
+	_, port, _ := net.SplitHostPort(forwarder.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	call, err := proxy.platform.Invite(device, channelID, proxy.downstreamOffer(offer, media, uint16(portNumber)))
+	if err != nil {
+		forwarder.Close()
+		return nil, nil, err
+	}
+	session := &ProxySession{channelID: channelID, call: call, forwarder: forwarder}
+	return session, proxy.upstreamAnswer(offer, media, sender), nil
+}
+
+// downstreamOffer asks the device for what the upstream offer asks for,
+// received by the forwarder at port. Over TCP we are passive so the device
+// connects; the SSRC is ours, the forwarder replaces it anyway.
+func (proxy *Proxy) downstreamOffer(offer *sdp.Session, media *sdp.Media, port uint16) *sdp.Session {
+	down := sdp.NewMedia(media.GetMediaType(), port, media.GetProto(), media.GetFormats()...)
+	down.AddAttribute("recvonly", "")
+	for _, format := range media.GetFormats() {
+		if encoding, rate, ok := media.GetRtpmap(format); ok {
+			down.AddAttribute("rtpmap", fmt.Sprintf("%s %s/%d", format, encoding, rate))
+		}
+	}
+	if media.IsTCP() {
+		down.AddAttribute("setup", sdp.SetupPassive)
+		down.AddAttribute("connection", "new")
+	}
+	session := sdp.NewSession(sdp.NewOrigin(proxy.client.upstream.LocalID, proxy.mediaHost), offer.GetSessionName(),
+		sdp.NewConnection(proxy.mediaHost), proxy.nextSSRC(!strings.EqualFold(offer.GetSessionName(), "Play")), down)
+	session.SetUri(offer.GetUri())
+	session.SetTime(offer.GetTime())
+	session.SetFormat(offer.GetFormat())
+	return session
+}
+
+// upstreamAnswer announces where the media comes from, under the SSRC of
+// the upstream offer.
+func (proxy *Proxy) upstreamAnswer(offer *sdp.Session, media *sdp.Media, sender *rtp.Sender) *sdp.Session {
+	port := 0
+	if local := sender.LocalAddr(); local != nil {
+		_, localPort, _ := net.SplitHostPort(local.String())
+		port, _ = strconv.Atoi(localPort)
+	}
+	up := sdp.NewMedia(media.GetMediaType(), uint16(port), media.GetProto(), "96")
+	up.AddAttribute("sendonly", "")
+	up.AddAttribute("rtpmap", "96 PS/90000")
+	if media.IsTCP() {
+		up.AddAttribute("setup", sender.GetSetup())
+		up.AddAttribute("connection", "new")
+	}
+	return sdp.NewSession(sdp.NewOrigin(proxy.client.upstream.LocalID, proxy.mediaHost), offer.GetSessionName(),
+		sdp.NewConnection(proxy.mediaHost), offer.GetSSRC(), up)
+}
+
+// nextSSRC returns a GB28181 SSRC: 0 for live or 1 for history, digits 4
+// to 8 of our domain and a sequence number.
+func (proxy *Proxy) nextSSRC(history bool) string {
+	proxy.mutex.Lock()
+	proxy.sequence = (proxy.sequence + 1) % 10000
+	sequence := proxy.sequence
+	proxy.mutex.Unlock()
+	prefix := "0"
+	if history {
+		prefix = "1"
+	}
+	domain := "00000"
+	if localID := proxy.client.upstream.LocalID; len(localID) >= 8 {
+		domain = localID[3:8]
+	}
+	return fmt.Sprintf("%s%s%04d", prefix, domain, sequence)
+}
+
+func (proxy *Proxy) serveBye(tx *ua.ServerTransaction) {
+	head := tx.GetRequest().GetHeader()
+	key := callKey(head.CallID.GetId(), head.To.GetTag())
+	proxy.mutex.Lock()
+	_, ok := proxy.sessions[key]
+	proxy.mutex.Unlock()
+	if !ok {
+		respond(tx, 481)
+		return
+	}
+	respond(tx, 200)
+	proxy.end(key, false)
+}
+
+// end stops the relay and hangs up the device call, and the upstream
+// dialog when byeUpstream is set.
+func (proxy *Proxy) end(key string, byeUpstream bool) {
+	proxy.mutex.Lock()
+	session, ok := proxy.sessions[key]
+	delete(proxy.sessions, key)
+	proxy.mutex.Unlock()
+	if !ok {
+		return
+	}
+	proxy.hangUp(session)
+	if byeUpstream {
+		userAgent := proxy.client.GetUserAgent()
+		request := userAgent.NewDialogRequest(session.upstream, "BYE", nil, "")
+		if _, err := userAgent.Request(request, proxy.client.upstream.Address); err != nil {
+			log.Printf("bye to upstream %s error : %s", proxy.client.upstream.RemoteID, err.Error())
+		}
+	}
+}
+
+// hangUp stops the relay of a session and hangs up its device call.
+func (proxy *Proxy) hangUp(session *ProxySession) {
+	session.forwarder.Close()
+	if err := proxy.platform.Bye(session.call); err != nil && err != platform.ErrCallEnded {
+		log.Printf("bye to %s error : %s", session.channelID, err.Error())
+	}
+}
+
+// videoMedia returns the first video media of offer, or nil.
+func videoMedia(offer *sdp.Session) *sdp.Media {
+	for _, media := range offer.GetMedia() {
+		if strings.EqualFold(media.GetMediaType(), "video") && media.GetPort() > 0 {
+			return media
+		}
+	}
+	return nil
+}
+
+func callKey(callId, localTag string) string {
+	return callId + "/" + localTag
+}
@@ -0,0 +1,315 @@
+package cascade
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/media/rtp"
+	"github.com/kokutas/gb28181/media/sdp"
+	"github.com/kokutas/gb28181/platform"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+const testChannelID = "34020000001320000001"
+
+// testDevice answers INVITE and streams a few packets to the offered port.
+type testDevice struct {
+	userAgent *ua.UserAgent
+
+	mutex  sync.Mutex
+	offer  *sdp.Session
+	dialog *ua.Dialog
+	byes   chan struct{}
+}
+
+func newTestDevice(t *testing.T) *testDevice {
+	device := &testDevice{
+		userAgent: ua.NewUserAgent(testDeviceID, "3402000000", "udp", "127.0.0.1:0"),
+		byes:      make(chan struct{}, 1),
+	}
+	device.userAgent.SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	device.userAgent.Handle("INVITE", device.serveInvite)
+	device.userAgent.Handle("ACK", func(*ua.ServerTransaction) {})
+	device.userAgent.Handle("BYE", func(tx *ua.ServerTransaction) {
+		tx.RespondCode(200)
+		device.byes <- struct{}{}
+	})
+	if err := device.userAgent.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { device.userAgent.Close() })
+	return device
+}
+
+func (device *testDevice) serveInvite(tx *ua.ServerTransaction) {
+	request := tx.GetRequest()
+	offer := new(sdp.Session)
+	if err := offer.Parse(string(request.GetBody())); err != nil {
+		tx.RespondCode(400)
+		return
+	}
+	media := sdp.NewMedia("video", 15060, sdp.ProtoUDP, "96")
+	media.AddAttribute("sendonly", "")
+	answer := sdp.NewSession(sdp.NewOrigin(testDeviceID, "127.0.0.1"), offer.GetSessionName(), sdp.NewConnection("127.0.0.1"), offer.GetSSRC(), media)
+	body, _ := answer.Raw()
+	response := message.NewResponseTo(request, 200)
+	response.GetHeader().Contact = header.NewContact("", device.userAgent.GetContactUri(), nil)
+	response.GetHeader().ContentType = header.NewContentType(sdp.ContentType)
+	response.SetBody([]byte(body))
+	device.mutex.Lock()
+	device.offer = offer
+	device.dialog = ua.NewServerDialog(request, response)
+	device.mutex.Unlock()
+	tx.Respond(response)
+}
+
+// stream sends packets with the device's own SSRC to the offered port.
+func (device *testDevice) stream(t *testing.T) {
+	device.mutex.Lock()
+	offer := device.offer
+	device.mutex.Unlock()
+	media := offer.GetMedia()[0]
+	conn, err := net.Dial("udp", net.JoinHostPort(offer.GetMediaConnection(media).Address, strconv.Itoa(int(media.GetPort()))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		raw, _ := rtp.NewPacket(96, uint16(i), uint32(3600*i), 77, true, []byte{byte(i)}).Raw()
+		conn.Write(raw)
+	}
+}
+
+// testBridge wires an upstream, the cascade client with its proxy, our
+// platform and a device.
+type testBridge struct {
+	upstream *testUpstream
+	client   *Client
+	proxy    *Proxy
+	device   *testDevice
+	platform *platform.Platform
+	upBye    chan struct{}
+}
+
+func newTestBridge(t *testing.T) *testBridge {
+	bridge := &testBridge{upstream: newTestUpstream(t), device: newTestDevice(t), upBye: make(chan struct{}, 1)}
+	bridge.upstream.userAgent.Handle("BYE", func(tx *ua.ServerTransaction) {
+		tx.RespondCode(200)
+		bridge.upBye <- struct{}{}
+	})
+	bridge.upstream.userAgent.Handle("ACK", func(*ua.ServerTransaction) {})
+	bridge.client = newTestClient(t, bridge.upstream, &Upstream{})
+	userAgent := ua.NewUserAgent(testLocalID, "3402000000", "udp", "127.0.0.1:0")
+	userAgent.SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := userAgent.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { userAgent.Close() })
+	bridge.platform = platform.NewPlatform(userAgent)
+	bridge.platform.GetCatalogStore().Replace(testDeviceID, []*manscdp.CatalogItem{{DeviceID: testChannelID, Name: "gate"}})
+	policy := NewSharePolicy()
+	policy.ShareDevice(testDeviceID)
+	deviceAddress := bridge.device.userAgent.Addr().String()
+	bridge.proxy = NewProxy(bridge.client, bridge.platform, policy, func(deviceID string) (*platform.Device, bool) {
+		return &platform.Device{ID: deviceID, Address: deviceAddress}, deviceID == testDeviceID
+	}, "127.0.0.1")
+	return bridge
+}
+
+// newInvite returns the upstream INVITE of channelID, receiving media at
+// receiver.
+func (bridge *testBridge) newInvite(channelID string, receiver *rtp.Receiver) *message.Request {
+	_, port, _ := net.SplitHostPort(receiver.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	media := sdp.NewMedia("video", uint16(portNumber), sdp.ProtoUDP, "96", "98")
+	media.AddAttribute("recvonly", "")
+	media.AddAttribute("rtpmap", "96 PS/90000")
+	media.AddAttribute("rtpmap", "98 H264/90000")
+	offer := sdp.NewSession(sdp.NewOrigin(testRemoteID, "127.0.0.1"), "Play", sdp.NewConnection("127.0.0.1"), "0440100001", media)
+	body, _ := offer.Raw()
+	userAgent := bridge.client.GetUserAgent()
+	target := header.NewUri("sip", channelID, userAgent.GetHost(), userAgent.GetPort(), nil)
+	return bridge.upstream.userAgent.NewRequest("INVITE", target, []byte(body), sdp.ContentType)
+}
+
+// invite invites channelID from the upstream, receiving media at receiver.
+func (bridge *testBridge) invite(t *testing.T, channelID string, receiver *rtp.Receiver) (*message.Request, *message.Response) {
+	userAgent := bridge.client.GetUserAgent()
+	request := bridge.newInvite(channelID, receiver)
+	response, err := bridge.upstream.userAgent.Request(request, userAgent.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.GetStatusCode() == 200 {
+		if err := bridge.upstream.userAgent.Ack(request, response, userAgent.Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return request, response
+}
+
+func newFrameReceiver(t *testing.T) (*rtp.Receiver, chan *rtp.Frame) {
+	frames := make(chan *rtp.Frame, 16)
+	receiver := rtp.NewReceiver("udp", "127.0.0.1:0", 16, func(frame *rtp.Frame) { frames <- frame })
+	if err := receiver.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { receiver.Close() })
+	return receiver, frames
+}
+
+func TestProxy_InviteUpstreamBye(t *testing.T) {
+	bridge := newTestBridge(t)
+	receiver, frames := newFrameReceiver(t)
+	request, response := bridge.invite(t, testChannelID, receiver)
+	if response.GetStatusCode() != 200 {
+		t.Fatalf("unexpected response %s", response)
+	}
+	answer := new(sdp.Session)
+	if err := answer.Parse(string(response.GetBody())); err != nil {
+		t.Fatal(err)
+	}
+	if answer.GetSSRC() != "0440100001" || answer.GetMedia()[0].GetDirection() != "sendonly" {
+		t.Fatalf("unexpected answer %s", answer)
+	}
+	bridge.device.mutex.Lock()
+	downOffer := bridge.device.offer
+	bridge.device.mutex.Unlock()
+	if downOffer.GetSSRC() == "0440100001" || downOffer.GetSSRC() != "0200000001" || downOffer.GetMedia()[0].GetDirection() != "recvonly" {
+		t.Fatalf("unexpected downstream offer %s", downOffer)
+	}
+
+	bridge.device.stream(t)
+	for i := 0; i < 3; i++ {
+		select {
+		case frame := <-frames:
+			if frame.SSRC != 440100001 || frame.Data[0] != byte(i) {
+				t.Fatalf("unexpected frame %+v", frame)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no media relayed")
+		}
+	}
+	if len(bridge.proxy.GetSessions()) != 1 || len(bridge.platform.GetCalls()) != 1 {
+		t.Fatal("the session is not tracked")
+	}
+
+	upstreamUA := bridge.upstream.userAgent
+	bye := upstreamUA.NewDialogRequest(ua.NewDialog(request, response), "BYE", nil, "")
+	byeResponse, err := upstreamUA.Request(bye, bridge.client.GetUserAgent().Addr().String())
+	if err != nil || byeResponse.GetStatusCode() != 200 {
+		t.Fatalf("unexpected bye response %v %v", byeResponse, err)
+	}
+	select {
+	case <-bridge.device.byes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the device call was not ended")
+	}
+	if len(bridge.proxy.GetSessions()) != 0 || len(bridge.platform.GetCalls()) != 0 {
+		t.Fatal("the session is still tracked")
+	}
+}
+
+func TestProxy_DeviceBye(t *testing.T) {
+	bridge := newTestBridge(t)
+	receiver, _ := newFrameReceiver(t)
+	if _, response := bridge.invite(t, testChannelID, receiver); response.GetStatusCode() != 200 {
+		t.Fatalf("unexpected response %s", response)
+	}
+	bridge.device.mutex.Lock()
+	dialog := bridge.device.dialog
+	bridge.device.mutex.Unlock()
+	deviceUA := bridge.device.userAgent
+	response, err := deviceUA.Request(deviceUA.NewDialogRequest(dialog, "BYE", nil, ""), bridge.platform.GetUserAgent().Addr().String())
+	if err != nil || response.GetStatusCode() != 200 {
+		t.Fatalf("unexpected bye response %v %v", response, err)
+	}
+	select {
+	case <-bridge.upBye:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the upstream dialog was not ended")
+	}
+	if len(bridge.proxy.GetSessions()) != 0 {
+		t.Fatal("the session is still tracked")
+	}
+}
+
+func TestProxy_Rejects(t *testing.T) {
+	bridge := newTestBridge(t)
+	receiver, _ := newFrameReceiver(t)
+	if _, response := bridge.invite(t, "34020000001320000099", receiver); response.GetStatusCode() != 404 {
+		t.Fatalf("an unshared channel must be answered 404, got %s", response)
+	}
+	bridge.device.userAgent.Handle("INVITE", func(tx *ua.ServerTransaction) { tx.RespondCode(486) })
+	if _, response := bridge.invite(t, testChannelID, receiver); response.GetStatusCode() != 486 {
+		t.Fatalf("the device answer must be relayed, got %s", response)
+	}
+}
+
+func TestProxy_Cancel(t *testing.T) {
+	bridge := newTestBridge(t)
+	receiver, _ := newFrameReceiver(t)
+	invited, release := make(chan struct{}, 1), make(chan struct{})
+	bridge.device.userAgent.Handle("INVITE", func(tx *ua.ServerTransaction) {
+		invited <- struct{}{}
+		<-release
+		bridge.device.serveInvite(tx)
+	})
+	request := bridge.newInvite(testChannelID, receiver)
+	address := bridge.client.GetUserAgent().Addr().String()
+	responses := make(chan int, 1)
+	go func() {
+		response, err := bridge.upstream.userAgent.Request(request, address)
+		if err != nil {
+			t.Error(err)
+			responses <- 0
+			return
+		}
+		responses <- response.GetStatusCode()
+	}()
+	<-invited
+	response, err := bridge.upstream.userAgent.Cancel(request, address)
+	if err != nil || response.GetStatusCode() != 200 {
+		t.Fatalf("unexpected cancel response %v %v", response, err)
+	}
+	if code := <-responses; code != 487 {
+		t.Fatalf("the cancelled invite must be answered 487, got %d", code)
+	}
+	// the device answers once the upstream gave up
+	close(release)
+	select {
+	case <-bridge.device.byes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the device call was not ended")
+	}
+	if len(bridge.proxy.GetSessions()) != 0 || len(bridge.platform.GetCalls()) != 0 {
+		t.Fatal("the session is still tracked")
+	}
+}
+
+func TestProxy_Unacknowledged(t *testing.T) {
+	bridge := newTestBridge(t)
+	receiver, _ := newFrameReceiver(t)
+	request := bridge.newInvite(testChannelID, receiver)
+	response, err := bridge.upstream.userAgent.Request(request, bridge.client.GetUserAgent().Addr().String())
+	if err != nil || response.GetStatusCode() != 200 {
+		t.Fatalf("unexpected response %v %v", response, err)
+	}
+	// the ACK never comes, so both calls end
+	for _, byes := range []chan struct{}{bridge.upBye, bridge.device.byes} {
+		select {
+		case <-byes:
+		case <-time.After(3 * time.Second):
+			t.Fatal("the session was not ended")
+		}
+	}
+	if len(bridge.proxy.GetSessions()) != 0 || len(bridge.platform.GetCalls()) != 0 {
+		t.Fatal("the session is still tracked")
+	}
+}
@@ -0,0 +1,200 @@
+package cascade
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/civil"
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/platform"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// DefaultCatalogPerPacket keeps Response/Catalog packets well within a UDP
+// datagram.
+const DefaultCatalogPerPacket = 2
+
+// PlatformInfo describes our platform in Response/DeviceInfo.
+type PlatformInfo struct {
+	Name         string
+	Manufacturer string
+	Model        string
+	Firmware     string
+}
+
+// Responder answers the Catalog, DeviceInfo and DeviceStatus queries of an
+// upper-level platform from the shared catalog. Queries are accepted with
+// 200 and answered in separate MESSAGE requests.
+type Responder struct {
+	client   *Client
+	policy   *SharePolicy
+	catalogs *platform.CatalogStore
+
+	mutex     sync.Mutex
+	perPacket int
+	info      PlatformInfo
+}
+
+// NewResponder serves the MESSAGE requests of the client's user agent.
+func NewResponder(client *Client, policy *SharePolicy, catalogs *platform.CatalogStore) *Responder {
+	responder := &Responder{
+		client:    client,
+		policy:    policy,
+		catalogs:  catalogs,
+		perPacket: DefaultCatalogPerPacket,
+	}
+	client.GetUserAgent().Handle("MESSAGE", responder.serveMessage)
+	return responder
+}
+
+// SetPerPacket sets the number of catalog items per Response packet.
+func (responder *Responder) SetPerPacket(perPacket int) {
+	responder.mutex.Lock()
+	defer responder.mutex.Unlock()
+	responder.perPacket = perPacket
+}
+func (responder *Responder) GetPerPacket() int {
+	responder.mutex.Lock()
+	defer responder.mutex.Unlock()
+	return responder.perPacket
+}
+func (responder *Responder) SetInfo(info PlatformInfo) {
+	responder.mutex.Lock()
+	defer responder.mutex.Unlock()
+	responder.info = info
+}
+func (responder *Responder) GetInfo() PlatformInfo {
+	responder.mutex.Lock()
+	defer responder.mutex.Unlock()
+	return responder.info
+}
+
+func (responder *Responder) serveMessage(tx *ua.ServerTransaction) {
+	body := tx.GetRequest().GetBody()
+	envelope, err := manscdp.Decode(body)
+	if err != nil {
+		log.Printf("upstream message from %s error : %s", tx.GetSource(), err.Error())
+		respond(tx, 400)
+		return
+	}
+	if envelope.GetRoot() != manscdp.RootQuery {
+		// responses to our keepalives and notifications need no answer
+		respond(tx, 200)
+		return
+	}
+	var answer func() []interface{}
+	switch envelope.CmdType {
+	case manscdp.CmdTypeCatalog:
+		query := new(manscdp.CatalogQuery)
+		if err = manscdp.Unmarshal(body, query); err == nil {
+			answer = func() []interface{} { return responder.catalog(query) }
+		}
+	case manscdp.CmdTypeDeviceInfo:
+		query := new(manscdp.DeviceInfoQuery)
+		if err = manscdp.Unmarshal(body, query); err == nil {
+			answer = func() []interface{} { return responder.deviceInfo(query) }
+		}
+	case manscdp.CmdTypeDeviceStatus:
+		query := new(manscdp.DeviceStatusQuery)
+		if err = manscdp.Unmarshal(body, query); err == nil {
+			answer = func() []interface{} { return responder.deviceStatus(query) }
+		}
+	default:
+		respond(tx, 200)
+		return
+	}
+	if err != nil {
+		log.Printf("upstream %s query error : %s", envelope.CmdType, err.Error())
+		respond(tx, 400)
+		return
+	}
+	if !responder.knows(envelope.DeviceID) {
+		respond(tx, 404)
+		return
+	}
+	respond(tx, 200)
+	go func() {
+		for _, response := range answer() {
+			if err := responder.client.Send(response); err != nil {
+				log.Printf("upstream %s response error : %s", envelope.CmdType, err.Error())
+				return
+			}
+		}
+	}()
+}
+
+// knows reports whether id is our platform or a shared channel.
+func (responder *Responder) knows(id string) bool {
+	if id == responder.client.upstream.LocalID {
+		return true
+	}
+	_, ok := responder.policy.Lookup(id, responder.catalogs)
+	return ok
+}
+
+// catalog answers with the whole shared catalog; queries of a channel get
+// just that channel.
+func (responder *Responder) catalog(query *manscdp.CatalogQuery) []interface{} {
+	items := responder.policy.Items(responder.client.upstream.LocalID, responder.catalogs)
+	if query.DeviceID != responder.client.upstream.LocalID {
+		var selected []*manscdp.CatalogItem
+		for _, item := range items {
+			if item.DeviceID == query.DeviceID {
+				selected = append(selected, item)
+			}
+		}
+		items = selected
+	}
+	var responses []interface{}
+	for _, response := range manscdp.NewCatalogResponses(query.SN, query.DeviceID, items, responder.GetPerPacket()) {
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func (responder *Responder) deviceInfo(query *manscdp.DeviceInfoQuery) []interface{} {
+	response := manscdp.NewDeviceInfoResponse(query)
+	info := responder.GetInfo()
+	if query.DeviceID == responder.client.upstream.LocalID {
+		response.DeviceName = info.Name
+		response.Manufacturer = info.Manufacturer
+		response.Model = info.Model
+		response.Firmware = info.Firmware
+		for _, item := range responder.policy.Items(query.DeviceID, responder.catalogs) {
+			if _, region := civil.Normalize(item.DeviceID); !region && !responder.policy.IsNode(item.DeviceID) {
+				response.Channel++
+			}
+		}
+	} else if channel := responder.channel(query.DeviceID); channel != nil {
+		response.DeviceName = channel.Name
+		response.Manufacturer = channel.Manufacturer
+		response.Model = channel.Model
+		response.Channel = 1
+	}
+	return []interface{}{response}
+}
+
+func (responder *Responder) deviceStatus(query *manscdp.DeviceStatusQuery) []interface{} {
+	online := true
+	if query.DeviceID != responder.client.upstream.LocalID {
+		channel := responder.channel(query.DeviceID)
+		online = channel != nil && channel.IsOnline()
+	}
+	return []interface{}{manscdp.NewDeviceStatusResponse(query, online, time.Now())}
+}
+
+// channel returns a shared channel, or nil.
+func (responder *Responder) channel(channelID string) *manscdp.CatalogItem {
+	deviceID, ok := responder.policy.Lookup(channelID, responder.catalogs)
+	if !ok {
+		return nil
+	}
+	return responder.catalogs.Get(deviceID, channelID)
+}
+
+func respond(tx *ua.ServerTransaction, statusCode int) {
+	if err := tx.RespondCode(statusCode); err != nil {
+		log.Printf("sip response to %s error : %s", tx.GetSource(), err.Error())
+	}
+}
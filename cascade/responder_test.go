@@ -0,0 +1,106 @@
+package cascade
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/message/header"
+)
+
+func newTestResponder(t *testing.T, upstream *testUpstream) *Responder {
+	client := newTestClient(t, upstream, &Upstream{})
+	policy := NewSharePolicy()
+	policy.ShareDevice(testDeviceID)
+	policy.AddNode(&manscdp.CatalogItem{DeviceID: testGroupID, Name: "traffic", ParentID: testLocalID})
+	responder := NewResponder(client, policy, newTestCatalogs())
+	responder.SetInfo(PlatformInfo{Name: "city", Manufacturer: "kokutas", Model: "gb28181"})
+	return responder
+}
+
+// query sends body from the upstream to the client and returns the status
+// code of the MESSAGE.
+func query(t *testing.T, upstream *testUpstream, responder *Responder, body interface{}) int {
+	raw, err := manscdp.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userAgent := responder.client.GetUserAgent()
+	target := header.NewUri("sip", testLocalID, userAgent.GetHost(), userAgent.GetPort(), nil)
+	response, err := upstream.userAgent.Request(upstream.userAgent.NewRequest("MESSAGE", target, raw, manscdp.ContentType), userAgent.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.GetStatusCode()
+}
+
+func nextResponse(t *testing.T, upstream *testUpstream, v interface{}) {
+	select {
+	case raw := <-upstream.responses:
+		if err := manscdp.Unmarshal(raw, v); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no response")
+	}
+}
+
+func TestResponder_Catalog(t *testing.T) {
+	upstream := newTestUpstream(t)
+	responder := newTestResponder(t, upstream)
+	responder.SetPerPacket(3)
+	if code := query(t, upstream, responder, manscdp.NewCatalogQuery(17, testLocalID)); code != 200 {
+		t.Fatalf("unexpected status %d", code)
+	}
+	var ids []string
+	for packet := 0; packet < 2; packet++ {
+		response := new(manscdp.CatalogResponse)
+		nextResponse(t, upstream, response)
+		if response.SN != 17 || response.DeviceID != testLocalID || response.SumNum != 4 || response.DeviceList.Num != len(response.GetItems()) {
+			t.Fatalf("unexpected packet %+v", response)
+		}
+		for _, item := range response.GetItems() {
+			ids = append(ids, item.DeviceID)
+		}
+	}
+	if len(ids) != 4 || ids[3] != testGroupID {
+		t.Fatalf("unexpected items %v", ids)
+	}
+
+	if code := query(t, upstream, responder, manscdp.NewCatalogQuery(18, "34020000001320000011")); code != 404 {
+		t.Fatalf("an unshared channel must be answered 404, got %d", code)
+	}
+}
+
+func TestResponder_DeviceInfoStatus(t *testing.T) {
+	upstream := newTestUpstream(t)
+	responder := newTestResponder(t, upstream)
+
+	query(t, upstream, responder, manscdp.NewDeviceInfoQuery(20, testLocalID))
+	info := new(manscdp.DeviceInfoResponse)
+	nextResponse(t, upstream, info)
+	if info.SN != 20 || info.DeviceName != "city" || info.Channel != 3 || info.Result != manscdp.ResultOK {
+		t.Fatalf("unexpected device info %+v", info)
+	}
+
+	query(t, upstream, responder, manscdp.NewDeviceInfoQuery(21, "34020000001320000001"))
+	info = new(manscdp.DeviceInfoResponse)
+	nextResponse(t, upstream, info)
+	if info.DeviceID != "34020000001320000001" || info.DeviceName != "gate" || info.Channel != 1 {
+		t.Fatalf("unexpected channel info %+v", info)
+	}
+
+	query(t, upstream, responder, manscdp.NewDeviceStatusQuery(22, "34020000001320000002"))
+	status := new(manscdp.DeviceStatusResponse)
+	nextResponse(t, upstream, status)
+	if status.SN != 22 || status.IsOnline() {
+		t.Fatalf("unexpected channel status %+v", status)
+	}
+
+	query(t, upstream, responder, manscdp.NewDeviceStatusQuery(23, testLocalID))
+	status = new(manscdp.DeviceStatusResponse)
+	nextResponse(t, upstream, status)
+	if !status.IsOnline() || status.Status != manscdp.ResultOK {
+		t.Fatalf("unexpected platform status %+v", status)
+	}
+}
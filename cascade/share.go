@@ -0,0 +1,183 @@
+package cascade
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/platform"
+)
+
+// SharePolicy selects what an upper-level platform sees of our catalog:
+// whole devices or single channels, and the business groups and virtual
+// organizations the shared channels are arranged in.
+type SharePolicy struct {
+	mutex    sync.RWMutex
+	devices  map[string]bool            // devices shared with all their channels
+	channels map[string]map[string]bool // device id -> shared channel ids
+	nodes    map[string]*manscdp.CatalogItem
+	parents  map[string]string // channel id -> node id
+}
+
+func NewSharePolicy() *SharePolicy {
+	return &SharePolicy{
+		devices:  make(map[string]bool),
+		channels: make(map[string]map[string]bool),
+		nodes:    make(map[string]*manscdp.CatalogItem),
+		parents:  make(map[string]string),
+	}
+}
+
+// ShareDevice shares all channels of deviceID, including those added later.
+func (policy *SharePolicy) ShareDevice(deviceID string) {
+	policy.mutex.Lock()
+	defer policy.mutex.Unlock()
+	policy.devices[deviceID] = true
+}
+
+// ShareChannel shares one channel of deviceID.
+func (policy *SharePolicy) ShareChannel(deviceID, channelID string) {
+	policy.mutex.Lock()
+	defer policy.mutex.Unlock()
+	channels, ok := policy.channels[deviceID]
+	if !ok {
+		channels = make(map[string]bool)
+		policy.channels[deviceID] = channels
+	}
+	channels[channelID] = true
+}
+
+// UnshareDevice stops sharing deviceID and its single channels.
+func (policy *SharePolicy) UnshareDevice(deviceID string) {
+	policy.mutex.Lock()
+	defer policy.mutex.Unlock()
+	delete(policy.devices, deviceID)
+	delete(policy.channels, deviceID)
+}
+
+// UnshareChannel stops sharing a channel shared with ShareChannel.
+func (policy *SharePolicy) UnshareChannel(deviceID, channelID string) {
+	policy.mutex.Lock()
+	defer policy.mutex.Unlock()
+	delete(policy.channels[deviceID], channelID)
+}
+
+// AddNode adds a business group or virtual organization node to the shared
+// catalog; its ParentID places it in the tree.
+func (policy *SharePolicy) AddNode(node *manscdp.CatalogItem) {
+	policy.mutex.Lock()
+	defer policy.mutex.Unlock()
+	copied := *node
+	policy.nodes[node.DeviceID] = &copied
+}
+
+// RemoveNode removes a node; the channels assigned to it return to the
+// platform.
+func (policy *SharePolicy) RemoveNode(nodeID string) {
+	policy.mutex.Lock()
+	defer policy.mutex.Unlock()
+	delete(policy.nodes, nodeID)
+	for channelID, parentID := range policy.parents {
+		if parentID == nodeID {
+			delete(policy.parents, channelID)
+		}
+	}
+}
+
+// Assign places a shared channel under a node; an empty nodeID places it
+// directly under the platform.
+func (policy *SharePolicy) Assign(channelID, nodeID string) {
+	policy.mutex.Lock()
+	defer policy.mutex.Unlock()
+	if len(nodeID) == 0 {
+		delete(policy.parents, channelID)
+		return
+	}
+	policy.parents[channelID] = nodeID
+}
+
+// IsNode reports whether id is a node added with AddNode.
+func (policy *SharePolicy) IsNode(id string) bool {
+	policy.mutex.RLock()
+	defer policy.mutex.RUnlock()
+	_, ok := policy.nodes[id]
+	return ok
+}
+
+// IsShared reports whether a channel of deviceID is shared.
+func (policy *SharePolicy) IsShared(deviceID, channelID string) bool {
+	policy.mutex.RLock()
+	defer policy.mutex.RUnlock()
+	return policy.devices[deviceID] || policy.channels[deviceID][channelID]
+}
+
+// Items returns the shared catalog as platformID presents it, sorted by
+// id: the nodes, the shared channels known to catalogs and the
+// administrative divisions of their CivilCode. Channels carry the parent
+// they are assigned to, platformID otherwise, since their devices are not
+// visible upstream.
+func (policy *SharePolicy) Items(platformID string, catalogs *platform.CatalogStore) []*manscdp.CatalogItem {
+	policy.mutex.RLock()
+	defer policy.mutex.RUnlock()
+	var items, channels []*manscdp.CatalogItem
+	for _, node := range policy.nodes {
+		copied := *node
+		items = append(items, &copied)
+	}
+	for _, deviceID := range policy.deviceIDs() {
+		for _, channel := range catalogs.Channels(deviceID) {
+			if !policy.devices[deviceID] && !policy.channels[deviceID][channel.DeviceID] {
+				continue
+			}
+			if channel.Parental != 0 {
+				// organization nodes of the device are replaced by ours
+				continue
+			}
+			copied := *channel
+			copied.ParentID = platformID
+			if parentID, ok := policy.parents[channel.DeviceID]; ok {
+				if _, ok := policy.nodes[parentID]; ok {
+					copied.ParentID = parentID
+				}
+			}
+			channels = append(channels, &copied)
+		}
+	}
+	items = append(items, channels...)
+	items = append(items, platform.RegionItems(channels)...)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeviceID < items[j].DeviceID
+	})
+	return items
+}
+
+// Lookup returns the device of a shared channel, which must be known to
+// catalogs.
+func (policy *SharePolicy) Lookup(channelID string, catalogs *platform.CatalogStore) (string, bool) {
+	policy.mutex.RLock()
+	defer policy.mutex.RUnlock()
+	for _, deviceID := range policy.deviceIDs() {
+		if !policy.devices[deviceID] && !policy.channels[deviceID][channelID] {
+			continue
+		}
+		if channel := catalogs.Get(deviceID, channelID); channel != nil && channel.Parental == 0 {
+			return deviceID, true
+		}
+	}
+	return "", false
+}
+
+// deviceIDs returns the devices with shared channels, sorted.
+func (policy *SharePolicy) deviceIDs() []string {
+	var ids []string
+	for deviceID := range policy.devices {
+		ids = append(ids, deviceID)
+	}
+	for deviceID, channels := range policy.channels {
+		if !policy.devices[deviceID] && len(channels) > 0 {
+			ids = append(ids, deviceID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
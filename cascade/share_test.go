@@ -0,0 +1,96 @@
+package cascade
+
+import (
+	"testing"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/platform"
+)
+
+const (
+	testDeviceID = "34020000001110000001"
+	testGroupID  = "34020000002150000001"
+	testOrgID    = "34020000002160000001"
+)
+
+func newTestCatalogs() *platform.CatalogStore {
+	catalogs := platform.NewCatalogStore()
+	catalogs.Replace(testDeviceID, []*manscdp.CatalogItem{
+		{DeviceID: "34020000001320000001", Name: "gate", ParentID: testDeviceID, Status: manscdp.StatusOn},
+		{DeviceID: "34020000001320000002", Name: "hall", ParentID: testDeviceID, Status: manscdp.StatusOff},
+		{DeviceID: "34020000001320000003", Name: "yard", ParentID: testDeviceID, Status: manscdp.StatusOn},
+		{DeviceID: "34020000002160000009", Name: "device org", Parental: 1},
+	})
+	catalogs.Replace("34020000001110000002", []*manscdp.CatalogItem{
+		{DeviceID: "34020000001320000011", Name: "lobby", Status: manscdp.StatusOn},
+	})
+	return catalogs
+}
+
+func TestSharePolicy_Items(t *testing.T) {
+	catalogs := newTestCatalogs()
+	policy := NewSharePolicy()
+	if items := policy.Items(testLocalID, catalogs); len(items) != 0 {
+		t.Fatalf("nothing is shared by default, got %d items", len(items))
+	}
+	policy.ShareChannel(testDeviceID, "34020000001320000001")
+	policy.ShareChannel(testDeviceID, "34020000001320000002")
+	policy.ShareDevice("34020000001110000002")
+	policy.AddNode(&manscdp.CatalogItem{DeviceID: testGroupID, Name: "traffic", ParentID: testLocalID})
+	policy.AddNode(&manscdp.CatalogItem{DeviceID: testOrgID, Name: "east", ParentID: testGroupID, Parental: 1})
+	policy.Assign("34020000001320000002", testOrgID)
+
+	items := policy.Items(testLocalID, catalogs)
+	ids := []string{"34020000001320000001", "34020000001320000002", "34020000001320000011", testGroupID, testOrgID}
+	if len(items) != len(ids) {
+		t.Fatalf("unexpected %d items", len(items))
+	}
+	for i, item := range items {
+		if item.DeviceID != ids[i] {
+			t.Fatalf("item %d is %s, expected %s", i, item.DeviceID, ids[i])
+		}
+	}
+	if items[0].ParentID != testLocalID || items[1].ParentID != testOrgID || items[4].ParentID != testGroupID {
+		t.Fatalf("unexpected parents %s %s %s", items[0].ParentID, items[1].ParentID, items[4].ParentID)
+	}
+	if catalogs.Get(testDeviceID, "34020000001320000002").ParentID != testDeviceID {
+		t.Fatal("the stored channel must not change")
+	}
+
+	if deviceID, ok := policy.Lookup("34020000001320000011", catalogs); !ok || deviceID != "34020000001110000002" {
+		t.Fatalf("unexpected lookup %s %v", deviceID, ok)
+	}
+	if _, ok := policy.Lookup("34020000001320000003", catalogs); ok {
+		t.Fatal("an unshared channel must not be found")
+	}
+
+	policy.RemoveNode(testOrgID)
+	policy.UnshareDevice("34020000001110000002")
+	items = policy.Items(testLocalID, catalogs)
+	if len(items) != 3 || items[1].ParentID != testLocalID {
+		t.Fatalf("unexpected items after removal %+v", items)
+	}
+}
+
+func TestSharePolicy_Regions(t *testing.T) {
+	catalogs := platform.NewCatalogStore()
+	catalogs.Replace(testDeviceID, []*manscdp.CatalogItem{
+		{DeviceID: "34020000001320000001", Name: "gate", CivilCode: "340202"},
+		{DeviceID: "34020000001320000002", Name: "hall", CivilCode: "340203"},
+	})
+	policy := NewSharePolicy()
+	policy.ShareDevice(testDeviceID)
+	items := policy.Items(testLocalID, catalogs)
+	ids := []string{"34", "3402", "34020000001320000001", "34020000001320000002", "340202", "340203"}
+	if len(items) != len(ids) {
+		t.Fatalf("unexpected %d items", len(items))
+	}
+	for i, item := range items {
+		if item.DeviceID != ids[i] {
+			t.Fatalf("item %d is %s, expected %s", i, item.DeviceID, ids[i])
+		}
+	}
+	if items[1].Name != "芜湖市" || items[2].ParentID != testLocalID {
+		t.Fatalf("unexpected items %+v %+v", items[1], items[2])
+	}
+}
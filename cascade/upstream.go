@@ -0,0 +1,373 @@
+package cascade
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kokutas/gb28181/id"
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/auth"
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// Defaults of an Upstream.
+const (
+	DefaultExpires           = 3600
+	DefaultKeepaliveInterval = 60 * time.Second
+	DefaultKeepaliveTimeouts = 3
+	DefaultRetryInterval     = 5 * time.Second
+	DefaultMaxRetryInterval  = 5 * time.Minute
+)
+
+var ErrUnauthorized = errors.New("the upstream platform rejected the credentials")
+
+// Upstream configures the registration of our platform, as a lower-level
+// domain, to an upper-level platform. Zero values take the defaults.
+type Upstream struct {
+	LocalID      string // SIP id of our platform
+	LocalAddress string // listen address of the upstream connection, e.g. 0.0.0.0:5061
+	RemoteID     string // SIP id of the upper-level platform
+	Realm        string // SIP domain of the upper-level platform, RemoteID[:10] when empty
+	Address      string // host:port of the upper-level platform
+	Transport    string // udp or tcp, udp when empty
+	Username     string // digest username, LocalID when empty
+	Password     string
+	Expires      uint // requested registration time in seconds
+	// KeepaliveInterval is the period of Notify/Keepalive messages.
+	KeepaliveInterval time.Duration
+	// KeepaliveTimeouts is the number of keepalives failing in a row after
+	// which the platform registers again.
+	KeepaliveTimeouts int
+	// RetryInterval is the delay before registering again after a failure,
+	// doubled on each further failure up to MaxRetryInterval.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+}
+
+// StateHandler is told whenever the registration succeeds or fails; err is
+// the failure, nil once registered.
+type StateHandler func(registered bool, err error)
+
+// Client keeps our platform registered to one upper-level platform: it
+// registers with digest authentication, refreshes the registration before
+// it expires, sends keepalives and registers again with backoff after a
+// failure.
+type Client struct {
+	upstream  Upstream
+	userAgent *ua.UserAgent
+	sn        int32
+	callId    string
+	tag       string
+	cseq      uint64
+
+	mutex      sync.Mutex
+	registered bool
+	expiry     time.Time
+	handlers   []StateHandler
+	closed     chan struct{}
+	done       chan struct{}
+}
+
+// NewClient builds the client and the user agent of the upstream
+// connection; Start opens it.
+func NewClient(upstream *Upstream) *Client {
+	config := *upstream
+	if len(config.Realm) == 0 && len(config.RemoteID) >= 10 {
+		config.Realm = config.RemoteID[:10]
+	}
+	if len(config.Transport) == 0 {
+		config.Transport = "udp"
+	}
+	if len(config.Username) == 0 {
+		config.Username = config.LocalID
+	}
+	if config.Expires == 0 {
+		config.Expires = DefaultExpires
+	}
+	if config.KeepaliveInterval <= 0 {
+		config.KeepaliveInterval = DefaultKeepaliveInterval
+	}
+	if config.KeepaliveTimeouts <= 0 {
+		config.KeepaliveTimeouts = DefaultKeepaliveTimeouts
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+	if config.MaxRetryInterval < config.RetryInterval {
+		config.MaxRetryInterval = DefaultMaxRetryInterval
+	}
+	localRealm := config.LocalID
+	if len(localRealm) >= 10 {
+		localRealm = localRealm[:10]
+	}
+	return &Client{
+		upstream:  config,
+		userAgent: ua.NewUserAgent(config.LocalID, localRealm, config.Transport, config.LocalAddress),
+		sn:        int32(time.Now().Unix() % 100000),
+		callId:    message.NewCallID(),
+		tag:       message.NewTag(),
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+func (client *Client) GetUpstream() *Upstream {
+	upstream := client.upstream
+	return &upstream
+}
+
+// GetUserAgent returns the user agent of the upstream connection, which
+// also serves the requests of the upper-level platform.
+func (client *Client) GetUserAgent() *ua.UserAgent {
+	return client.userAgent
+}
+
+func (client *Client) IsRegistered() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.registered
+}
+
+// GetExpiry returns when the current registration expires, zero when not
+// registered.
+func (client *Client) GetExpiry() time.Time {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.expiry
+}
+
+// OnStateChange adds a registration state handler.
+func (client *Client) OnStateChange(handler StateHandler) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.handlers = append(client.handlers, handler)
+}
+
+// NextSN returns the next command sequence number.
+func (client *Client) NextSN() int {
+	return int(atomic.AddInt32(&client.sn, 1))
+}
+
+// Start checks the ids, opens the user agent and keeps the platform
+// registered in the background until Close.
+func (client *Client) Start() error {
+	if err := id.Validate(client.upstream.LocalID); err != nil {
+		return fmt.Errorf("local %s", err.Error())
+	}
+	if err := id.Validate(client.upstream.RemoteID); err != nil {
+		return fmt.Errorf("remote %s", err.Error())
+	}
+	if err := client.userAgent.Listen(); err != nil {
+		return err
+	}
+	go client.run()
+	return nil
+}
+
+// Close stops refreshing, unregisters when registered and closes the user
+// agent.
+func (client *Client) Close() error {
+	client.mutex.Lock()
+	select {
+	case <-client.closed:
+		client.mutex.Unlock()
+		return nil
+	default:
+	}
+	close(client.closed)
+	client.mutex.Unlock()
+	<-client.done
+	if client.IsRegistered() {
+		if _, err := client.Register(0); err != nil {
+			log.Printf("unregister from %s error : %s", client.upstream.RemoteID, err.Error())
+		}
+		client.setState(false, nil, 0)
+	}
+	return client.userAgent.Close()
+}
+
+// Register sends one REGISTER of expires seconds, answering a digest
+// challenge, and returns the time granted. An expires of 0 unregisters.
+func (client *Client) Register(expires uint) (uint, error) {
+	uri, err := client.requestUri()
+	if err != nil {
+		return 0, err
+	}
+	response, err := client.userAgent.Request(client.newRegister(uri, expires, nil), client.upstream.Address)
+	if err != nil {
+		return 0, err
+	}
+	if response.GetStatusCode() == 401 {
+		authorization, err := auth.Authorize(response.GetHeader().WWWAuthenticate, client.upstream.Username, client.upstream.Password, "REGISTER", uri)
+		if err != nil {
+			return 0, err
+		}
+		response, err = client.userAgent.Request(client.newRegister(uri, expires, authorization), client.upstream.Address)
+		if err != nil {
+			return 0, err
+		}
+		if response.GetStatusCode() == 401 {
+			return 0, ErrUnauthorized
+		}
+	}
+	if code := response.GetStatusCode(); code >= 300 {
+		return 0, lib.NewSipError(code, response.GetStatusLine().GetReasonPhrase())
+	}
+	if granted := response.GetHeader().Expires; granted != nil {
+		return granted.GetSeconds(), nil
+	}
+	return expires, nil
+}
+
+// Keepalive sends one Notify/Keepalive.
+func (client *Client) Keepalive() error {
+	return client.Send(manscdp.NewKeepaliveNotify(client.NextSN(), client.upstream.LocalID))
+}
+
+// Send sends a MANSCDP body to the upper-level platform in a MESSAGE.
+func (client *Client) Send(body interface{}) error {
+	raw, err := manscdp.Marshal(body)
+	if err != nil {
+		return err
+	}
+	uri, err := client.requestUri()
+	if err != nil {
+		return err
+	}
+	request := client.userAgent.NewRequest("MESSAGE", uri, raw, manscdp.ContentType)
+	response, err := client.userAgent.Request(request, client.upstream.Address)
+	if err != nil {
+		return err
+	}
+	if code := response.GetStatusCode(); code >= 300 {
+		return lib.NewSipError(code, response.GetStatusLine().GetReasonPhrase())
+	}
+	return nil
+}
+
+// newRegister builds a REGISTER of our address of record. Registrations
+// share the Call-ID and From tag, with increasing CSeq (RFC 3261 10.2).
+func (client *Client) newRegister(uri *header.Uri, expires uint, authorization *header.Authorization) *message.Request {
+	request := client.userAgent.NewRequest("REGISTER", uri, nil, "")
+	head := request.GetHeader()
+	head.From = header.NewFrom("", client.userAgent.GetUri(), client.tag)
+	head.To = header.NewTo("", client.userAgent.GetUri(), "")
+	head.CallID = header.NewCallID(client.callId, "")
+	head.CSeq = header.NewCSeq(atomic.AddUint64(&client.cseq, 1), "REGISTER")
+	head.Expires = header.NewExpires(expires)
+	head.Authorization = authorization
+	return request
+}
+
+// requestUri addresses the upper-level platform in its domain, or at its
+// address when the realm is not a domain of its id.
+func (client *Client) requestUri() (*header.Uri, error) {
+	remoteID, realm := client.upstream.RemoteID, client.upstream.Realm
+	if len(remoteID) >= 10 && realm == remoteID[:10] {
+		return header.NewUri("sip", remoteID, realm, 0, nil), nil
+	}
+	host, port, err := net.SplitHostPort(client.upstream.Address)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %s address error : %s", remoteID, err.Error())
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %s address error : %s", remoteID, err.Error())
+	}
+	return header.NewUri("sip", remoteID, host, uint16(portNumber), nil), nil
+}
+
+// run registers, keeps the registration alive and registers again after
+// failures until Close.
+func (client *Client) run() {
+	defer close(client.done)
+	retry := client.upstream.RetryInterval
+	for {
+		granted, err := client.Register(client.upstream.Expires)
+		if err != nil {
+			log.Printf("register to %s error : %s", client.upstream.RemoteID, err.Error())
+			client.setState(false, err, 0)
+			if !client.wait(retry) {
+				return
+			}
+			if retry *= 2; retry > client.upstream.MaxRetryInterval {
+				retry = client.upstream.MaxRetryInterval
+			}
+			continue
+		}
+		retry = client.upstream.RetryInterval
+		if granted == 0 {
+			granted = client.upstream.Expires
+		}
+		client.setState(true, nil, granted)
+		if !client.keepAlive(granted) {
+			return
+		}
+	}
+}
+
+// keepAlive sends keepalives until the registration is due for refresh, at
+// 4/5 of the granted time, or the upper-level platform stops answering
+// them. It returns false once closed.
+func (client *Client) keepAlive(granted uint) bool {
+	refresh := time.NewTimer(time.Duration(granted) * time.Second * 4 / 5)
+	defer refresh.Stop()
+	ticker := time.NewTicker(client.upstream.KeepaliveInterval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-refresh.C:
+			return true
+		case <-ticker.C:
+			err := client.Keepalive()
+			if err == nil {
+				failures = 0
+				continue
+			}
+			failures++
+			log.Printf("keepalive to %s error : %s", client.upstream.RemoteID, err.Error())
+			if failures >= client.upstream.KeepaliveTimeouts {
+				client.setState(false, err, 0)
+				return true
+			}
+		case <-client.closed:
+			return false
+		}
+	}
+}
+
+// wait sleeps for delay and reports false when closed meanwhile.
+func (client *Client) wait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-client.closed:
+		return false
+	}
+}
+
+func (client *Client) setState(registered bool, err error, granted uint) {
+	client.mutex.Lock()
+	client.registered = registered
+	client.expiry = time.Time{}
+	if registered {
+		client.expiry = time.Now().Add(time.Duration(granted) * time.Second)
+	}
+	handlers := append([]StateHandler(nil), client.handlers...)
+	client.mutex.Unlock()
+	for _, handler := range handlers {
+		handler(registered, err)
+	}
+}
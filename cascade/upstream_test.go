@@ -0,0 +1,261 @@
+package cascade
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/auth"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+const (
+	testLocalID  = "34020000002000000001"
+	testRemoteID = "44010000002000000001"
+	testPassword = "12345678"
+)
+
+// testUpstream is an upper-level platform challenging registrations.
+type testUpstream struct {
+	userAgent *ua.UserAgent
+
+	mutex          sync.Mutex
+	registers      []*message.Request // authorized registrations
+	keepalives     int
+	rejectRegister int // registrations answered 403 before accepting
+	rejectMessage  bool
+	granted        uint
+	responses      chan []byte // Response messages of the client
+}
+
+func newTestUpstream(t *testing.T) *testUpstream {
+	upstream := &testUpstream{
+		userAgent: ua.NewUserAgent(testRemoteID, "4401000000", "udp", "127.0.0.1:0"),
+		responses: make(chan []byte, 16),
+	}
+	upstream.userAgent.SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	upstream.userAgent.Handle("REGISTER", upstream.serveRegister)
+	upstream.userAgent.Handle("MESSAGE", upstream.serveMessage)
+	if err := upstream.userAgent.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { upstream.userAgent.Close() })
+	return upstream
+}
+
+func (upstream *testUpstream) serveRegister(tx *ua.ServerTransaction) {
+	request := tx.GetRequest()
+	authorization := request.GetHeader().Authorization
+	if authorization == nil {
+		response := message.NewResponseTo(request, 401)
+		response.GetHeader().WWWAuthenticate = header.NewWWWAuthenticate("Digest", "4401000000", message.NewTag(), "MD5")
+		tx.Respond(response)
+		return
+	}
+	if !auth.Verify(authorization, testPassword, "REGISTER") {
+		tx.RespondCode(403)
+		return
+	}
+	upstream.mutex.Lock()
+	if upstream.rejectRegister > 0 {
+		upstream.rejectRegister--
+		upstream.mutex.Unlock()
+		tx.RespondCode(403)
+		return
+	}
+	upstream.registers = append(upstream.registers, request)
+	granted := upstream.granted
+	upstream.mutex.Unlock()
+	response := message.NewResponseTo(request, 200)
+	if granted > 0 && request.GetHeader().Expires.GetSeconds() > 0 {
+		response.GetHeader().Expires = header.NewExpires(granted)
+	}
+	tx.Respond(response)
+}
+
+func (upstream *testUpstream) serveMessage(tx *ua.ServerTransaction) {
+	envelope, err := manscdp.Decode(tx.GetRequest().GetBody())
+	if err == nil && envelope.GetRoot() == manscdp.RootResponse {
+		tx.RespondCode(200)
+		upstream.responses <- tx.GetRequest().GetBody()
+		return
+	}
+	if err != nil || envelope.CmdType != manscdp.CmdTypeKeepalive {
+		tx.RespondCode(400)
+		return
+	}
+	upstream.mutex.Lock()
+	upstream.keepalives++
+	reject := upstream.rejectMessage
+	upstream.mutex.Unlock()
+	if reject {
+		tx.RespondCode(403)
+		return
+	}
+	tx.RespondCode(200)
+}
+
+func (upstream *testUpstream) counts() (int, int) {
+	upstream.mutex.Lock()
+	defer upstream.mutex.Unlock()
+	return len(upstream.registers), upstream.keepalives
+}
+
+func newTestClient(t *testing.T, upstream *testUpstream, config *Upstream) *Client {
+	config.LocalID = testLocalID
+	config.LocalAddress = "127.0.0.1:0"
+	config.RemoteID = testRemoteID
+	config.Address = upstream.userAgent.Addr().String()
+	config.Password = testPassword
+	client := NewClient(config)
+	client.GetUserAgent().SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := client.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient_RegisterRefreshKeepalive(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.granted = 1
+	client := newTestClient(t, upstream, &Upstream{KeepaliveInterval: 50 * time.Millisecond})
+	waitFor(t, func() bool {
+		registers, keepalives := upstream.counts()
+		return registers >= 2 && keepalives >= 2
+	})
+	if !client.IsRegistered() || client.GetExpiry().IsZero() {
+		t.Fatal("client is not registered")
+	}
+	upstream.mutex.Lock()
+	first, second := upstream.registers[0].GetHeader(), upstream.registers[1].GetHeader()
+	upstream.mutex.Unlock()
+	if first.CallID.GetId() != second.CallID.GetId() || first.From.GetTag() != second.From.GetTag() {
+		t.Fatal("refresh must keep the call-id and from tag")
+	}
+	if second.CSeq.GetSequenceNumber() <= first.CSeq.GetSequenceNumber() {
+		t.Fatal("refresh must increase the cseq")
+	}
+	if first.From.GetAddress().GetUser() != testLocalID || first.Expires.GetSeconds() != DefaultExpires {
+		t.Fatalf("unexpected register %s", upstream.registers[0])
+	}
+	if first.Authorization.GetUserName() != testLocalID || first.Authorization.GetRealm() != "4401000000" {
+		t.Fatalf("unexpected authorization %s", first.Authorization)
+	}
+
+	client.Close()
+	upstream.mutex.Lock()
+	last := upstream.registers[len(upstream.registers)-1].GetHeader()
+	upstream.mutex.Unlock()
+	if last.Expires.GetSeconds() != 0 || client.IsRegistered() {
+		t.Fatal("close must unregister")
+	}
+}
+
+func TestClient_KeepaliveFailure(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.rejectMessage = true
+	states := make(chan bool, 16)
+	client := newTestClient(t, upstream, &Upstream{KeepaliveInterval: 20 * time.Millisecond, KeepaliveTimeouts: 2})
+	client.OnStateChange(func(registered bool, err error) {
+		select {
+		case states <- registered:
+		default:
+		}
+	})
+	waitFor(t, func() bool {
+		registers, _ := upstream.counts()
+		return registers >= 2
+	})
+	_, keepalives := upstream.counts()
+	if keepalives < 2 {
+		t.Fatalf("registered again after %d keepalives", keepalives)
+	}
+	for lost := false; !lost; {
+		select {
+		case registered := <-states:
+			lost = !registered
+		case <-time.After(time.Second):
+			t.Fatal("keepalive failures must report the registration lost")
+		}
+	}
+}
+
+func TestClient_Backoff(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.rejectRegister = 2
+	var mutex sync.Mutex
+	var failures []time.Time
+	start := time.Now()
+	client := NewClient(&Upstream{
+		LocalID:          testLocalID,
+		LocalAddress:     "127.0.0.1:0",
+		RemoteID:         testRemoteID,
+		Address:          upstream.userAgent.Addr().String(),
+		Password:         testPassword,
+		RetryInterval:    50 * time.Millisecond,
+		MaxRetryInterval: time.Second,
+	})
+	client.GetUserAgent().SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	client.OnStateChange(func(registered bool, err error) {
+		if !registered {
+			mutex.Lock()
+			failures = append(failures, time.Now())
+			mutex.Unlock()
+		}
+	})
+	if err := client.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	waitFor(t, client.IsRegistered)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(failures) != 2 {
+		t.Fatalf("unexpected %d failures", len(failures))
+	}
+	// 50ms then 100ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("registered after %s without backoff", elapsed)
+	}
+}
+
+func TestClient_WrongPassword(t *testing.T) {
+	upstream := newTestUpstream(t)
+	client := NewClient(&Upstream{
+		LocalID:      testLocalID,
+		LocalAddress: "127.0.0.1:0",
+		RemoteID:     testRemoteID,
+		Address:      upstream.userAgent.Addr().String(),
+		Password:     "wrong",
+	})
+	client.GetUserAgent().SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := client.GetUserAgent().Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.GetUserAgent().Close()
+	if _, err := client.Register(60); err == nil {
+		t.Fatal("a wrong password must fail")
+	}
+}
+
+func TestClient_MalformedID(t *testing.T) {
+	client := NewClient(&Upstream{LocalID: testLocalID, LocalAddress: "127.0.0.1:0", RemoteID: "4401000000200000001", Address: "127.0.0.1:5060"})
+	if err := client.Start(); err == nil {
+		client.Close()
+		t.Fatal("a malformed remote id must be rejected")
+	}
+}
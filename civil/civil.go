@@ -0,0 +1,180 @@
+// Package civil looks up the GB/T 2260 administrative division codes
+// catalogs carry as CivilCode. GB28181 shortens them to their significant
+// levels: 2 digits for a province, 4 for a city, 6 for a district and 8
+// for a grassroots unit. The embedded table names the provinces, the
+// prefecture-level and the county-level divisions; Load adds grassroots
+// units.
+package civil
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Levels of a division.
+const (
+	LevelProvince = 1
+	LevelCity     = 2
+	LevelDistrict = 3
+	LevelBase     = 4
+)
+
+//go:embed gb2260.txt
+var table string
+
+var (
+	mutex sync.RWMutex
+	names = make(map[string]string)
+)
+
+func init() {
+	if err := Load(strings.NewReader(table)); err != nil {
+		panic(err)
+	}
+}
+
+// Division is an administrative division.
+type Division struct {
+	Code string // shortened code
+	Name string
+}
+
+// GetLevel returns the level of the division.
+func (division *Division) GetLevel() int {
+	return len(division.Code) / 2
+}
+
+// Normalize shortens a code of 2 to 8 digits by dropping its trailing
+// zero levels, e.g. 340200 and 34020000 to 3402. It returns false when code
+// is not a civil code.
+func Normalize(code string) (string, bool) {
+	if len(code) < 2 || len(code) > 8 || len(code)%2 != 0 {
+		return "", false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return "", false
+		}
+	}
+	for len(code) > 2 && strings.HasSuffix(code, "00") {
+		code = code[:len(code)-2]
+	}
+	if code == "00" {
+		return "", false
+	}
+	return code, true
+}
+
+// Parent returns the shortened code of the division containing code, empty
+// for a province or a malformed code.
+func Parent(code string) string {
+	code, ok := Normalize(code)
+	if !ok || len(code) == 2 {
+		return ""
+	}
+	parent, _ := Normalize(code[:len(code)-2])
+	return parent
+}
+
+// Path returns the shortened codes from the province down to code, empty
+// for a malformed code.
+func Path(code string) []string {
+	code, ok := Normalize(code)
+	if !ok {
+		return nil
+	}
+	var path []string
+	for length := 2; length <= len(code); length += 2 {
+		if level, ok := Normalize(code[:length]); ok && (len(path) == 0 || path[len(path)-1] != level) {
+			path = append(path, level)
+		}
+	}
+	return path
+}
+
+// Name returns the name of a division, empty when it is not in the table.
+func Name(code string) string {
+	code, ok := Normalize(code)
+	if !ok {
+		return ""
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return names[code]
+}
+
+// Lookup returns a division of the table.
+func Lookup(code string) (*Division, bool) {
+	code, ok := Normalize(code)
+	if !ok {
+		return nil, false
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	name, ok := names[code]
+	if !ok {
+		return nil, false
+	}
+	return &Division{Code: code, Name: name}, true
+}
+
+// Children returns the divisions of the table directly under code, sorted
+// by code; an empty code returns the provinces.
+func Children(code string) []*Division {
+	if len(code) > 0 {
+		var ok bool
+		if code, ok = Normalize(code); !ok {
+			return nil
+		}
+	}
+	mutex.RLock()
+	var children []*Division
+	for child, name := range names {
+		if Parent(child) == code {
+			children = append(children, &Division{Code: child, Name: name})
+		}
+	}
+	mutex.RUnlock()
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Code < children[j].Code
+	})
+	return children
+}
+
+// Register adds or renames a division.
+func Register(code, name string) error {
+	normalized, ok := Normalize(code)
+	if !ok {
+		return fmt.Errorf("civil code %q error : must be 2 to 8 digits", code)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	names[normalized] = name
+	return nil
+}
+
+// Load registers the divisions of a table with a code and a name separated
+// by white space on each line. Empty lines and lines starting with # are
+// skipped.
+func Load(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return fmt.Errorf("civil code table line %d error : %q", number, line)
+		}
+		if err := Register(fields[0], strings.Join(fields[1:], " ")); err != nil {
+			return fmt.Errorf("civil code table line %d error : %s", number, err.Error())
+		}
+	}
+	return scanner.Err()
+}
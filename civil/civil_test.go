@@ -0,0 +1,75 @@
+package civil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for code, expected := range map[string]string{"34": "34", "340000": "34", "340200": "3402", "34020000": "3402", "340202": "340202", "34020201": "34020201", "3": "", "00": "", "3402a0": "", "3402000000": ""} {
+		if normalized, ok := Normalize(code); normalized != expected || ok != (len(expected) > 0) {
+			t.Fatalf("%q normalized to %q %v", code, normalized, ok)
+		}
+	}
+}
+
+func TestParentPath(t *testing.T) {
+	if parent := Parent("340202"); parent != "3402" {
+		t.Fatalf("unexpected parent %q", parent)
+	}
+	if parent := Parent("340200"); parent != "34" {
+		t.Fatalf("unexpected parent %q", parent)
+	}
+	if parent := Parent("34"); parent != "" {
+		t.Fatalf("a province has no parent, got %q", parent)
+	}
+	if path := Path("34020201"); !reflect.DeepEqual(path, []string{"34", "3402", "340202", "34020201"}) {
+		t.Fatalf("unexpected path %v", path)
+	}
+	if path := Path("440300"); !reflect.DeepEqual(path, []string{"44", "4403"}) {
+		t.Fatalf("unexpected path %v", path)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if division, ok := Lookup("340000"); !ok || division.Name != "安徽省" || division.GetLevel() != LevelProvince {
+		t.Fatalf("unexpected division %+v", division)
+	}
+	if Name("3402") != "芜湖市" || Name("44030000") != "深圳市" {
+		t.Fatal("unexpected city names")
+	}
+	if _, ok := Lookup("340299"); ok {
+		t.Fatal("an unknown division must not be found")
+	}
+	if provinces := Children(""); len(provinces) != 34 || provinces[0].Code != "11" {
+		t.Fatalf("unexpected %d provinces", len(provinces))
+	}
+	if cities := Children("34"); len(cities) != 16 || cities[1].Name != "芜湖市" {
+		t.Fatalf("unexpected %d cities", len(cities))
+	}
+	if division, ok := Lookup("340202"); !ok || division.Name != "镜湖区" || division.GetLevel() != LevelDistrict {
+		t.Fatalf("unexpected division %+v", division)
+	}
+	if Name("110105") != "朝阳区" || Name("659012") != "白杨市" {
+		t.Fatal("unexpected district names")
+	}
+	if districts := Children("3402"); len(districts) != 7 || districts[0].Name != "镜湖区" {
+		t.Fatalf("unexpected %d districts", len(districts))
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if err := Load(strings.NewReader("# grassroots units\n34020201 镜湖街道\n\n34020202 弋矶山街道\n")); err != nil {
+		t.Fatal(err)
+	}
+	if division, ok := Lookup("34020201"); !ok || division.Name != "镜湖街道" || division.GetLevel() != LevelBase {
+		t.Fatalf("unexpected division %+v", division)
+	}
+	if children := Children("340202"); len(children) != 2 {
+		t.Fatalf("unexpected %d grassroots units", len(children))
+	}
+	if err := Load(strings.NewReader("3402x0 error\n")); err == nil {
+		t.Fatal("a malformed code must be rejected")
+	}
+}
@@ -0,0 +1,83 @@
+// Command gb28181-loadtest stresses the registrar and keepalive handling of
+// a platform with many simulated devices and prints what it measured.
+//
+//	gb28181-loadtest -server 127.0.0.1:5060 -server-id 34020000002000000001 \
+//		-password 12345678 -devices 500 -ramp-up 30s -duration 5m -churn 2s
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kokutas/gb28181/simulator"
+)
+
+func main() {
+	config := new(simulator.LoadConfig)
+	flag.IntVar(&config.Devices, "devices", 100, "number of simulated devices")
+	flag.StringVar(&config.FirstID, "first-id", "34020000001110000001", "id of the first device")
+	flag.StringVar(&config.Host, "host", "127.0.0.1", "local IP address of the devices")
+	flag.StringVar(&config.Transport, "transport", "udp", "SIP transport, udp or tcp")
+	flag.StringVar(&config.ServerID, "server-id", "34020000002000000001", "platform id")
+	flag.StringVar(&config.ServerRealm, "realm", "", "platform SIP domain, the first 10 digits of its id by default")
+	flag.StringVar(&config.ServerAddress, "server", "127.0.0.1:5060", "platform SIP address")
+	flag.StringVar(&config.Password, "password", "", "registration password")
+	expires := flag.Uint("expires", 3600, "registration expiry in seconds")
+	flag.DurationVar(&config.KeepaliveInterval, "keepalive", 60*time.Second, "keepalive interval, varied by 10% per device")
+	flag.DurationVar(&config.RampUp, "ramp-up", 10*time.Second, "time over which the devices start")
+	flag.IntVar(&config.MinChannels, "min-channels", 1, "least channels of a device")
+	flag.IntVar(&config.MaxChannels, "max-channels", 8, "most channels of a device")
+	flag.DurationVar(&config.ChurnInterval, "churn", 0, "mean delay between INVITEs of random channels, 0 disables them")
+	flag.DurationVar(&config.HoldTime, "hold", 10*time.Second, "longest time an INVITE is held")
+	flag.Int64Var(&config.Seed, "seed", time.Now().UnixNano(), "random seed")
+	media := flag.String("media", "", "PS file, or .rtp file of RFC 4571 framed RTP, streamed when invited")
+	duration := flag.Duration("duration", time.Minute, "length of the test")
+	interval := flag.Duration("report", 10*time.Second, "interval of intermediate reports, 0 disables them")
+	flag.Parse()
+	config.Expires = *expires
+
+	if len(*media) > 0 {
+		clip, err := simulator.LoadClip(*media)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.Clip = clip
+	}
+	load, err := simulator.NewLoad(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := load.Start(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("load test of %d devices against %s for %s", config.Devices, config.ServerAddress, *duration)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	end := time.NewTimer(*duration)
+	var ticks <-chan time.Time
+	if *interval > 0 {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+wait:
+	for {
+		select {
+		case <-ticks:
+			log.Printf("report\n%s", load.Report())
+		case <-end.C:
+			break wait
+		case <-signals:
+			break wait
+		}
+	}
+	report := load.Report()
+	load.Stop()
+	fmt.Println(report)
+}
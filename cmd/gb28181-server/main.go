@@ -0,0 +1,48 @@
+// Command gb28181-server runs a GB28181 platform: devices register with
+// it, the platform queries their catalogs and a management API lists them.
+//
+//	gb28181-server -config gb28181.json
+//
+// See config.example.json for the settings.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kokutas/gb28181/server"
+)
+
+func main() {
+	path := flag.String("config", "gb28181.json", "JSON config file")
+	flag.Parse()
+
+	config, err := server.LoadConfig(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	level, _ := server.ParseLevel(config.Log.Level)
+	logger := server.NewLogger(os.Stderr, config.Log.Format, level)
+	// the SIP stack logs with the standard logger
+	log.SetFlags(0)
+	log.SetOutput(logger.With("component", "sip").Writer(server.LevelDebug))
+
+	instance := server.NewServer(config, logger)
+	if err := instance.Start(); err != nil {
+		logger.Error("start failed", "error", err)
+		os.Exit(1)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	received := <-signals
+	logger.Info("shutting down", "signal", received.String())
+	if err := instance.Close(); err != nil {
+		logger.Error("close failed", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,123 @@
+// Command gb28181-simulator plays a GB28181 device registering with a
+// platform, for integration tests without real cameras.
+//
+//	gb28181-simulator -server 192.168.1.10:5060 -server-id 34020000002000000001 \
+//		-id 34020000001110000001 -password 12345678 -channels 4 -media clip.ps
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kokutas/gb28181/id"
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/simulator"
+)
+
+func main() {
+	config := new(simulator.Config)
+	flag.StringVar(&config.DeviceID, "id", "34020000001110000001", "device id")
+	flag.StringVar(&config.LocalAddress, "listen", "0.0.0.0:5070", "local SIP address")
+	flag.StringVar(&config.Transport, "transport", "udp", "SIP transport, udp or tcp")
+	flag.StringVar(&config.ServerID, "server-id", "34020000002000000001", "platform id")
+	flag.StringVar(&config.ServerRealm, "realm", "", "platform SIP domain, the first 10 digits of its id by default")
+	flag.StringVar(&config.ServerAddress, "server", "127.0.0.1:5060", "platform SIP address")
+	flag.StringVar(&config.Password, "password", "", "registration password")
+	expires := flag.Uint("expires", 3600, "registration expiry in seconds")
+	flag.DurationVar(&config.KeepaliveInterval, "keepalive", 60*time.Second, "keepalive interval")
+	flag.StringVar(&config.Name, "name", "simulator", "device name")
+	flag.StringVar(&config.Manufacturer, "manufacturer", "gb28181", "device manufacturer")
+	flag.StringVar(&config.Model, "model", "simulator", "device model")
+	flag.StringVar(&config.Firmware, "firmware", "1.0", "device firmware")
+	flag.StringVar(&config.MediaHost, "media-host", "127.0.0.1", "local IP address media is sent from")
+	channels := flag.Int("channels", 1, "number of generated camera channels")
+	catalog := flag.String("catalog", "", "JSON file of the catalog items, replacing generated channels")
+	records := flag.String("records", "", "JSON file of the record items answered to RecordInfo queries")
+	media := flag.String("media", "", "PS file, or .rtp file of RFC 4571 framed RTP, streamed when invited")
+	flag.Parse()
+	config.Expires = *expires
+
+	var err error
+	if len(*catalog) > 0 {
+		err = readJSON(*catalog, &config.Channels)
+	} else {
+		config.Channels, err = generateChannels(config.DeviceID, *channels)
+	}
+	if err == nil && len(*records) > 0 {
+		err = readJSON(*records, &config.Records)
+	}
+	if err == nil && len(*media) > 0 {
+		config.Clip, err = simulator.LoadClip(*media)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	device, err := simulator.NewDevice(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	device.GetClient().OnStateChange(func(registered bool, err error) {
+		if err != nil {
+			log.Printf("device %s registration error : %s", config.DeviceID, err.Error())
+			return
+		}
+		log.Printf("device %s registered : %v", config.DeviceID, registered)
+	})
+	device.OnControl(func(control *manscdp.Control) {
+		log.Printf("device %s control of %s : %+v", config.DeviceID, control.DeviceID, control)
+	})
+	if err := device.Start(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("device %s with %d channels listening on %s", config.DeviceID, len(config.Channels), device.GetUserAgent().Addr())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	if err := device.Close(); err != nil {
+		log.Printf("device %s close error : %s", config.DeviceID, err.Error())
+	}
+}
+
+// generateChannels names count IP cameras after the device id.
+func generateChannels(deviceID string, count int) ([]*manscdp.CatalogItem, error) {
+	device, err := id.Parse(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	var channels []*manscdp.CatalogItem
+	for i := 1; i <= count; i++ {
+		channel, err := id.New(device.GetCenter(), device.GetIndustry(), id.TypeIPC, device.GetNetwork(), i)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, &manscdp.CatalogItem{
+			DeviceID:     channel.String(),
+			Name:         fmt.Sprintf("camera %d", i),
+			Manufacturer: "gb28181",
+			Model:        "simulator",
+			CivilCode:    device.GetCenter()[:6],
+			Status:       manscdp.StatusOn,
+		})
+	}
+	return channels, nil
+}
+
+func readJSON(path string, v interface{}) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%s error : %s", path, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package geo converts the WGS-84 coordinates GPS receivers report to the
+// GCJ-02 coordinates maps of mainland China use.
+package geo
+
+import "math"
+
+// Krasovsky 1940 ellipsoid used by GCJ-02.
+const (
+	semiMajorAxis = 6378245.0
+	eccentricity2 = 0.00669342162296594323
+)
+
+// OutOfChina reports whether a coordinate lies outside the rough bounding
+// box of mainland China, where GCJ-02 equals WGS-84.
+func OutOfChina(longitude, latitude float64) bool {
+	return longitude < 72.004 || longitude > 137.8347 || latitude < 0.8293 || latitude > 55.8271
+}
+
+// WGS84ToGCJ02 converts a WGS-84 coordinate to GCJ-02. Coordinates outside
+// of China are returned unchanged.
+func WGS84ToGCJ02(longitude, latitude float64) (float64, float64) {
+	if OutOfChina(longitude, latitude) {
+		return longitude, latitude
+	}
+	dLatitude := transformLatitude(longitude-105.0, latitude-35.0)
+	dLongitude := transformLongitude(longitude-105.0, latitude-35.0)
+	radLatitude := latitude / 180.0 * math.Pi
+	magic := math.Sin(radLatitude)
+	magic = 1 - eccentricity2*magic*magic
+	sqrtMagic := math.Sqrt(magic)
+	dLatitude = (dLatitude * 180.0) / ((semiMajorAxis * (1 - eccentricity2)) / (magic * sqrtMagic) * math.Pi)
+	dLongitude = (dLongitude * 180.0) / (semiMajorAxis / sqrtMagic * math.Cos(radLatitude) * math.Pi)
+	return longitude + dLongitude, latitude + dLatitude
+}
+
+func transformLatitude(x, y float64) float64 {
+	result := -100.0 + 2.0*x + 3.0*y + 0.2*y*y + 0.1*x*y + 0.2*math.Sqrt(math.Abs(x))
+	result += (20.0*math.Sin(6.0*x*math.Pi) + 20.0*math.Sin(2.0*x*math.Pi)) * 2.0 / 3.0
+	result += (20.0*math.Sin(y*math.Pi) + 40.0*math.Sin(y/3.0*math.Pi)) * 2.0 / 3.0
+	result += (160.0*math.Sin(y/12.0*math.Pi) + 320*math.Sin(y*math.Pi/30.0)) * 2.0 / 3.0
+	return result
+}
+
+func transformLongitude(x, y float64) float64 {
+	result := 300.0 + x + 2.0*y + 0.1*x*x + 0.1*x*y + 0.1*math.Sqrt(math.Abs(x))
+	result += (20.0*math.Sin(6.0*x*math.Pi) + 20.0*math.Sin(2.0*x*math.Pi)) * 2.0 / 3.0
+	result += (20.0*math.Sin(x*math.Pi) + 40.0*math.Sin(x/3.0*math.Pi)) * 2.0 / 3.0
+	result += (150.0*math.Sin(x/12.0*math.Pi) + 300.0*math.Sin(x/30.0*math.Pi)) * 2.0 / 3.0
+	return result
+}
@@ -0,0 +1,18 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWGS84ToGCJ02(t *testing.T) {
+	// Tiananmen, about 570 m east and 150 m north after conversion
+	longitude, latitude := WGS84ToGCJ02(116.397428, 39.90923)
+	if math.Abs(longitude-116.403672) > 1e-6 || math.Abs(latitude-39.910634) > 1e-6 {
+		t.Fatalf("converted to %f,%f", longitude, latitude)
+	}
+	// Tokyo is outside of China
+	if longitude, latitude := WGS84ToGCJ02(139.6917, 35.6895); longitude != 139.6917 || latitude != 35.6895 {
+		t.Fatalf("converted to %f,%f", longitude, latitude)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/kokutas/gb28181
 
 go 1.16
+
+require go.etcd.io/bbolt v1.3.6
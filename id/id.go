@@ -0,0 +1,222 @@
+// Package id parses the 20-digit codes GB28181 identifies devices,
+// channels, platforms and users with: an 8-digit center code (the civil
+// code of the region), a 2-digit industry code, a 3-digit type code, a
+// network digit and a 6-digit serial number.
+package id
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Length is the number of digits of a code.
+const Length = 20
+
+// Type codes of GB/T 28181 annex D.
+const (
+	TypeDVR                 = 111
+	TypeVideoServer         = 112
+	TypeEncoder             = 113
+	TypeDecoder             = 114
+	TypeVideoSwitch         = 115
+	TypeAudioSwitch         = 116
+	TypeAlarmController     = 117
+	TypeNVR                 = 118
+	TypeHVR                 = 130
+	TypeCamera              = 131
+	TypeIPC                 = 132
+	TypeDisplay             = 133
+	TypeAlarmInput          = 134
+	TypeAlarmOutput         = 135
+	TypeAudioInput          = 136
+	TypeAudioOutput         = 137
+	TypeMobileTransmitter   = 138
+	TypePeripheral          = 139
+	TypeSignalServer        = 200
+	TypeWebServer           = 201
+	TypeMediaServer         = 202
+	TypeProxyServer         = 203
+	TypeSecurityServer      = 204
+	TypeAlarmServer         = 205
+	TypeDatabaseServer      = 206
+	TypeGISServer           = 207
+	TypeManagementServer    = 208
+	TypeGateway             = 209
+	TypeStorageServer       = 210
+	TypeSignalRouter        = 211
+	TypeBusinessGroup       = 215
+	TypeVirtualOrganization = 216
+	TypeCenterClient        = 300
+	TypeCenterUser          = 400
+	TypeTerminalUser        = 401
+)
+
+// Kind classifies a code by its type.
+type Kind int
+
+const (
+	KindUnknown             Kind = iota
+	KindDevice                   // front-end device, 111-130: DVR, NVR, encoder...
+	KindChannel                  // front-end peripheral, 131-199: camera, alarm input...
+	KindPlatform                 // platform server, 200-214
+	KindBusinessGroup            // 215
+	KindVirtualOrganization      // 216
+	KindClient                   // center client, 300-399
+	KindUser                     // user, 400-499
+)
+
+var kindNames = map[Kind]string{
+	KindUnknown:             "unknown",
+	KindDevice:              "device",
+	KindChannel:             "channel",
+	KindPlatform:            "platform",
+	KindBusinessGroup:       "business group",
+	KindVirtualOrganization: "virtual organization",
+	KindClient:              "client",
+	KindUser:                "user",
+}
+
+func (kind Kind) String() string {
+	return kindNames[kind]
+}
+
+// KindOf classifies a type code.
+func KindOf(typeCode int) Kind {
+	switch {
+	case typeCode >= 111 && typeCode <= 130:
+		return KindDevice
+	case typeCode >= 131 && typeCode <= 199:
+		return KindChannel
+	case typeCode >= 200 && typeCode <= 214:
+		return KindPlatform
+	case typeCode == TypeBusinessGroup:
+		return KindBusinessGroup
+	case typeCode == TypeVirtualOrganization:
+		return KindVirtualOrganization
+	case typeCode >= 300 && typeCode <= 399:
+		return KindClient
+	case typeCode >= 400 && typeCode <= 499:
+		return KindUser
+	}
+	return KindUnknown
+}
+
+// ID is a parsed code.
+type ID struct {
+	raw      string
+	center   string
+	industry string
+	typeCode int
+	network  int
+	serial   string
+}
+
+// Parse parses a 20-digit code.
+func Parse(raw string) (*ID, error) {
+	if len(raw) != Length {
+		return nil, fmt.Errorf("id %q error : must be %d digits", raw, Length)
+	}
+	if !isDigits(raw) {
+		return nil, fmt.Errorf("id %q error : must only contain digits", raw)
+	}
+	typeCode, _ := strconv.Atoi(raw[10:13])
+	return &ID{
+		raw:      raw,
+		center:   raw[:8],
+		industry: raw[8:10],
+		typeCode: typeCode,
+		network:  int(raw[13] - '0'),
+		serial:   raw[14:],
+	}, nil
+}
+
+// Validate reports why raw is not a code, nil when it is one.
+func Validate(raw string) error {
+	_, err := Parse(raw)
+	return err
+}
+
+// IsValid reports whether raw is a code.
+func IsValid(raw string) bool {
+	return Validate(raw) == nil
+}
+
+// IsCivilCode reports whether raw has the form of a civil code, which
+// catalogs use as the id of administrative regions: 2, 4, 6 or 8 digits.
+func IsCivilCode(raw string) bool {
+	return len(raw) >= 2 && len(raw) <= 8 && len(raw)%2 == 0 && isDigits(raw)
+}
+
+// New builds a code from its fields.
+func New(center, industry string, typeCode, network, serial int) (*ID, error) {
+	return Parse(fmt.Sprintf("%s%s%03d%d%06d", center, industry, typeCode, network, serial))
+}
+
+func (id *ID) String() string {
+	return id.raw
+}
+
+// GetCenter returns the 8-digit center code, the civil code of the region
+// the code belongs to padded with zeros.
+func (id *ID) GetCenter() string {
+	return id.center
+}
+
+// GetRealm returns the center and industry codes, the SIP domain of a
+// platform.
+func (id *ID) GetRealm() string {
+	return id.raw[:10]
+}
+func (id *ID) GetIndustry() string {
+	return id.industry
+}
+func (id *ID) GetType() int {
+	return id.typeCode
+}
+
+// GetNetwork returns the network digit: 0 to 4 for private video networks,
+// 5 for the public security network, 6 for government networks, 7 for the
+// internet, 8 for social resources.
+func (id *ID) GetNetwork() int {
+	return id.network
+}
+func (id *ID) GetSerial() string {
+	return id.serial
+}
+func (id *ID) GetKind() Kind {
+	return KindOf(id.typeCode)
+}
+func (id *ID) IsDevice() bool {
+	return id.GetKind() == KindDevice
+}
+func (id *ID) IsChannel() bool {
+	return id.GetKind() == KindChannel
+}
+func (id *ID) IsPlatform() bool {
+	return id.GetKind() == KindPlatform
+}
+
+// IsNode reports whether the code is a business group or virtual
+// organization of a catalog.
+func (id *ID) IsNode() bool {
+	kind := id.GetKind()
+	return kind == KindBusinessGroup || kind == KindVirtualOrganization
+}
+
+// Classify returns the kind of raw, KindUnknown when it is not a code.
+func Classify(raw string) Kind {
+	id, err := Parse(raw)
+	if err != nil {
+		return KindUnknown
+	}
+	return id.GetKind()
+}
+
+func isDigits(raw string) bool {
+	for i := 0; i < len(raw); i++ {
+		if raw[i] < '0' || raw[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package id
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	code, err := Parse("34020000001320000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.GetCenter() != "34020000" || code.GetIndustry() != "00" || code.GetType() != TypeIPC ||
+		code.GetNetwork() != 0 || code.GetSerial() != "000001" || code.GetRealm() != "3402000000" {
+		t.Fatalf("unexpected fields %+v", code)
+	}
+	if !code.IsChannel() || code.IsDevice() || code.IsPlatform() {
+		t.Fatalf("unexpected kind %s", code.GetKind())
+	}
+	for _, raw := range []string{"", "3402000000132000000", "340200000013200000011", "3402000000132000000x", " 4020000001320000001"} {
+		if _, err := Parse(raw); err == nil {
+			t.Fatalf("%q must not parse", raw)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, test := range []struct {
+		raw  string
+		kind Kind
+	}{
+		{"34020000001110000001", KindDevice},
+		{"34020000001180000001", KindDevice},
+		{"34020000001310000001", KindChannel},
+		{"34020000001340000001", KindChannel},
+		{"34020000002000000001", KindPlatform},
+		{"34020000002150000001", KindBusinessGroup},
+		{"34020000002160000001", KindVirtualOrganization},
+		{"34020000003000000001", KindClient},
+		{"34020000004000000001", KindUser},
+		{"34020000005000000001", KindUnknown},
+		{"3402000000200000001", KindUnknown},
+	} {
+		if kind := Classify(test.raw); kind != test.kind {
+			t.Fatalf("%s classified as %s, want %s", test.raw, kind, test.kind)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	code, err := New("44010000", "00", TypeSignalServer, 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.String() != "44010000002005000001" || code.GetNetwork() != 5 {
+		t.Fatalf("unexpected id %s", code)
+	}
+	if _, err := New("4401", "00", TypeSignalServer, 0, 1); err == nil {
+		t.Fatal("a short center code must be rejected")
+	}
+}
+
+func TestIsCivilCode(t *testing.T) {
+	for raw, valid := range map[string]bool{"34": true, "3402": true, "340200": true, "34020000": true, "3": false, "340": false, "3402000000": false, "34a2": false} {
+		if IsCivilCode(raw) != valid {
+			t.Fatalf("%q civil code %v", raw, !valid)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package manscdp
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+)
+
+// Alarm priorities (A.2.5.3 AlarmPriority).
+const (
+	AlarmPriorityUrgent    = 1
+	AlarmPriorityImportant = 2
+	AlarmPriorityNormal    = 3
+	AlarmPriorityGeneral   = 4
+)
+
+// Alarm methods (A.2.5.3 AlarmMethod); 0 in a query means all methods.
+const (
+	AlarmMethodAll    = 0
+	AlarmMethodPhone  = 1
+	AlarmMethodDevice = 2
+	AlarmMethodSMS    = 3
+	AlarmMethodGPS    = 4
+	AlarmMethodVideo  = 5
+	AlarmMethodFault  = 6
+	AlarmMethodOther  = 7
+)
+
+var alarmMethodNames = []string{"all", "phone", "device", "sms", "gps", "video", "fault", "other"}
+
+// AlarmMethodName returns the name of an alarm method, or its number when
+// unknown.
+func AlarmMethodName(method int) string {
+	if method < 0 || method >= len(alarmMethodNames) {
+		return strconv.Itoa(method)
+	}
+	return alarmMethodNames[method]
+}
+
+// AlarmTypeParam is the AlarmTypeParam element; EventType qualifies video
+// analysis alarms (1 enter, 2 leave).
+type AlarmTypeParam struct {
+	EventType int `xml:"EventType,omitempty"`
+}
+
+// AlarmInfo is the Info element of an alarm notification. AlarmType is
+// interpreted by AlarmMethod, e.g. 1 video loss for device alarms.
+type AlarmInfo struct {
+	AlarmType      int             `xml:"AlarmType,omitempty"`
+	AlarmTypeParam *AlarmTypeParam `xml:"AlarmTypeParam,omitempty"`
+}
+
+// AlarmNotify is Notify/Alarm (A.2.5.3).
+type AlarmNotify struct {
+	XMLName          xml.Name   `xml:"Notify"`
+	CmdType          string     `xml:"CmdType"`
+	SN               int        `xml:"SN"`
+	DeviceID         string     `xml:"DeviceID"`
+	AlarmPriority    int        `xml:"AlarmPriority"`
+	AlarmMethod      int        `xml:"AlarmMethod"`
+	AlarmTime        string     `xml:"AlarmTime"`
+	AlarmDescription string     `xml:"AlarmDescription,omitempty"`
+	Longitude        float64    `xml:"Longitude,omitempty"`
+	Latitude         float64    `xml:"Latitude,omitempty"`
+	Info             *AlarmInfo `xml:"Info,omitempty"`
+}
+
+// NewAlarmNotify builds an alarm notification of deviceID raised at t.
+func NewAlarmNotify(sn int, deviceID string, priority, method int, t time.Time) *AlarmNotify {
+	return &AlarmNotify{
+		CmdType:       CmdTypeAlarm,
+		SN:            sn,
+		DeviceID:      deviceID,
+		AlarmPriority: priority,
+		AlarmMethod:   method,
+		AlarmTime:     FormatTime(t),
+	}
+}
+
+// GetAlarmType returns Info/AlarmType, or 0 without one.
+func (notify *AlarmNotify) GetAlarmType() int {
+	if notify.Info == nil {
+		return 0
+	}
+	return notify.Info.AlarmType
+}
+
+// GetEventType returns Info/AlarmTypeParam/EventType, or 0 without one.
+func (notify *AlarmNotify) GetEventType() int {
+	if notify.Info == nil || notify.Info.AlarmTypeParam == nil {
+		return 0
+	}
+	return notify.Info.AlarmTypeParam.EventType
+}
+
+// AlarmResponse is the Response/Alarm acknowledging an alarm notification.
+type AlarmResponse struct {
+	XMLName  xml.Name `xml:"Response"`
+	CmdType  string   `xml:"CmdType"`
+	SN       int      `xml:"SN"`
+	DeviceID string   `xml:"DeviceID"`
+	Result   string   `xml:"Result"`
+}
+
+// NewAlarmResponse acknowledges notify.
+func NewAlarmResponse(notify *AlarmNotify) *AlarmResponse {
+	return &AlarmResponse{
+		CmdType:  CmdTypeAlarm,
+		SN:       notify.SN,
+		DeviceID: notify.DeviceID,
+		Result:   ResultOK,
+	}
+}
+
+// AlarmQuery is Query/Alarm (A.2.4.7), also the body of an alarm
+// subscription. AlarmMethod lists methods like "12" or "0" for all.
+type AlarmQuery struct {
+	XMLName            xml.Name `xml:"Query"`
+	CmdType            string   `xml:"CmdType"`
+	SN                 int      `xml:"SN"`
+	DeviceID           string   `xml:"DeviceID"`
+	StartAlarmPriority int      `xml:"StartAlarmPriority"`
+	EndAlarmPriority   int      `xml:"EndAlarmPriority"`
+	AlarmMethod        string   `xml:"AlarmMethod"`
+	AlarmType          string   `xml:"AlarmType,omitempty"`
+	StartAlarmTime     string   `xml:"StartAlarmTime,omitempty"`
+	EndAlarmTime       string   `xml:"EndAlarmTime,omitempty"`
+}
+
+// NewAlarmQuery selects the alarms of every priority and method of
+// deviceID. Zero start and end times leave the time range open.
+func NewAlarmQuery(sn int, deviceID string, start, end time.Time) *AlarmQuery {
+	query := &AlarmQuery{
+		CmdType:            CmdTypeAlarm,
+		SN:                 sn,
+		DeviceID:           deviceID,
+		StartAlarmPriority: AlarmPriorityUrgent,
+		EndAlarmPriority:   AlarmPriorityGeneral,
+		AlarmMethod:        strconv.Itoa(AlarmMethodAll),
+	}
+	if !start.IsZero() {
+		query.StartAlarmTime = FormatTime(start)
+	}
+	if !end.IsZero() {
+		query.EndAlarmTime = FormatTime(end)
+	}
+	return query
+}
@@ -0,0 +1,42 @@
+package manscdp
+
+import (
+	"testing"
+)
+
+func TestAlarmNotify_Unmarshal(t *testing.T) {
+	raw := []byte(`<?xml version="1.0" encoding="GB2312"?>
+<Notify>
+<CmdType>Alarm</CmdType>
+<SN>12</SN>
+<DeviceID>34020000001340000001</DeviceID>
+<AlarmPriority>2</AlarmPriority>
+<AlarmMethod>5</AlarmMethod>
+<AlarmTime>2021-03-04T05:06:07</AlarmTime>
+<Longitude>116.397</Longitude>
+<Latitude>39.908</Latitude>
+<Info>
+<AlarmType>2</AlarmType>
+<AlarmTypeParam><EventType>1</EventType></AlarmTypeParam>
+</Info>
+</Notify>
+`)
+	notify := new(AlarmNotify)
+	if err := Unmarshal(raw, notify); err != nil {
+		t.Fatal(err)
+	}
+	if notify.SN != 12 || notify.AlarmPriority != AlarmPriorityImportant || notify.AlarmMethod != AlarmMethodVideo ||
+		notify.GetAlarmType() != 2 || notify.GetEventType() != 1 || notify.Latitude != 39.908 {
+		t.Fatalf("unexpected notify %+v", notify)
+	}
+	if name := AlarmMethodName(notify.AlarmMethod); name != "video" {
+		t.Fatalf("unexpected method name %s", name)
+	}
+	if name := AlarmMethodName(9); name != "9" {
+		t.Fatalf("unexpected method name %s", name)
+	}
+	response := NewAlarmResponse(notify)
+	if response.SN != 12 || response.Result != ResultOK {
+		t.Fatalf("unexpected response %+v", response)
+	}
+}
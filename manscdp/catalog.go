@@ -0,0 +1,203 @@
+package manscdp
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Events of catalog notification items (A.2.5.4).
+const (
+	CatalogEventOn     = "ON"
+	CatalogEventOff    = "OFF"
+	CatalogEventVLost  = "VLOST"
+	CatalogEventDefect = "DEFECT"
+	CatalogEventAdd    = "ADD"
+	CatalogEventDel    = "DEL"
+	CatalogEventUpdate = "UPDATE"
+)
+
+// Status values of catalog items.
+const (
+	StatusOn  = "ON"
+	StatusOff = "OFF"
+)
+
+// CatalogQuery is Query/Catalog (A.2.4.3), also the body of a catalog
+// subscription.
+type CatalogQuery struct {
+	XMLName   xml.Name `xml:"Query"`
+	CmdType   string   `xml:"CmdType"`
+	SN        int      `xml:"SN"`
+	DeviceID  string   `xml:"DeviceID"`
+	StartTime string   `xml:"StartTime,omitempty"`
+	EndTime   string   `xml:"EndTime,omitempty"`
+}
+
+// NewCatalogQuery queries the catalog of deviceID.
+func NewCatalogQuery(sn int, deviceID string) *CatalogQuery {
+	return &CatalogQuery{
+		CmdType:  CmdTypeCatalog,
+		SN:       sn,
+		DeviceID: deviceID,
+	}
+}
+
+// CatalogItemInfo is the Info element of a catalog item.
+type CatalogItemInfo struct {
+	PTZType         int    `xml:"PTZType,omitempty"`
+	PositionType    int    `xml:"PositionType,omitempty"`
+	RoomType        int    `xml:"RoomType,omitempty"`
+	UseType         int    `xml:"UseType,omitempty"`
+	SupplyLightType int    `xml:"SupplyLightType,omitempty"`
+	DirectionType   int    `xml:"DirectionType,omitempty"`
+	Resolution      string `xml:"Resolution,omitempty"`
+	BusinessGroupID string `xml:"BusinessGroupID,omitempty"`
+	DownloadSpeed   string `xml:"DownloadSpeed,omitempty"`
+}
+
+// CatalogItem is a device, channel or organization node of a catalog
+// (A.2.6.4). Event is only set in notifications.
+type CatalogItem struct {
+	DeviceID     string           `xml:"DeviceID"`
+	Event        string           `xml:"Event,omitempty"`
+	Name         string           `xml:"Name,omitempty"`
+	Manufacturer string           `xml:"Manufacturer,omitempty"`
+	Model        string           `xml:"Model,omitempty"`
+	Owner        string           `xml:"Owner,omitempty"`
+	CivilCode    string           `xml:"CivilCode,omitempty"`
+	Block        string           `xml:"Block,omitempty"`
+	Address      string           `xml:"Address,omitempty"`
+	Parental     int              `xml:"Parental"`
+	ParentID     string           `xml:"ParentID,omitempty"`
+	SafetyWay    int              `xml:"SafetyWay,omitempty"`
+	RegisterWay  int              `xml:"RegisterWay,omitempty"`
+	CertNum      string           `xml:"CertNum,omitempty"`
+	Certifiable  int              `xml:"Certifiable,omitempty"`
+	ErrCode      int              `xml:"ErrCode,omitempty"`
+	EndTime      string           `xml:"EndTime,omitempty"`
+	Secrecy      int              `xml:"Secrecy"`
+	IPAddress    string           `xml:"IPAddress,omitempty"`
+	Port         int              `xml:"Port,omitempty"`
+	Password     string           `xml:"Password,omitempty"`
+	Status       string           `xml:"Status,omitempty"`
+	Longitude    float64          `xml:"Longitude,omitempty"`
+	Latitude     float64          `xml:"Latitude,omitempty"`
+	Info         *CatalogItemInfo `xml:"Info,omitempty"`
+}
+
+// IsOnline reports whether Status is ON; some devices send ONLINE or OK.
+func (item *CatalogItem) IsOnline() bool {
+	switch strings.ToUpper(strings.TrimSpace(item.Status)) {
+	case StatusOn, "ONLINE", "OK":
+		return true
+	}
+	return false
+}
+
+// GetParentIDs returns the parents of ParentID, which may list a path
+// separated by '/'.
+func (item *CatalogItem) GetParentIDs() []string {
+	var parents []string
+	for _, parent := range strings.Split(item.ParentID, "/") {
+		if parent = strings.TrimSpace(parent); len(parent) > 0 {
+			parents = append(parents, parent)
+		}
+	}
+	return parents
+}
+
+// DeviceList is the DeviceList element; Num counts the items of this
+// packet.
+type DeviceList struct {
+	Num   int            `xml:"Num,attr"`
+	Items []*CatalogItem `xml:"Item"`
+}
+
+// CatalogResponse is one packet of Response/Catalog (A.2.6.4). SumNum
+// counts the items of all packets answering the same SN.
+type CatalogResponse struct {
+	XMLName    xml.Name    `xml:"Response"`
+	CmdType    string      `xml:"CmdType"`
+	SN         int         `xml:"SN"`
+	DeviceID   string      `xml:"DeviceID"`
+	SumNum     int         `xml:"SumNum"`
+	DeviceList *DeviceList `xml:"DeviceList"`
+}
+
+// GetItems returns the items of the packet.
+func (response *CatalogResponse) GetItems() []*CatalogItem {
+	if response.DeviceList == nil {
+		return nil
+	}
+	return response.DeviceList.Items
+}
+
+// CatalogNotify is one packet of Notify/Catalog (A.2.5.4): catalog changes,
+// each item carrying its Event.
+type CatalogNotify struct {
+	XMLName    xml.Name    `xml:"Notify"`
+	CmdType    string      `xml:"CmdType"`
+	SN         int         `xml:"SN"`
+	DeviceID   string      `xml:"DeviceID"`
+	SumNum     int         `xml:"SumNum"`
+	DeviceList *DeviceList `xml:"DeviceList"`
+}
+
+// GetItems returns the items of the packet.
+func (notify *CatalogNotify) GetItems() []*CatalogItem {
+	if notify.DeviceList == nil {
+		return nil
+	}
+	return notify.DeviceList.Items
+}
+
+// NewCatalogResponses splits items into packets of at most perPacket items
+// answering the query of sn.
+func NewCatalogResponses(sn int, deviceID string, items []*CatalogItem, perPacket int) []*CatalogResponse {
+	var responses []*CatalogResponse
+	for _, packet := range splitItems(items, perPacket) {
+		responses = append(responses, &CatalogResponse{
+			CmdType:    CmdTypeCatalog,
+			SN:         sn,
+			DeviceID:   deviceID,
+			SumNum:     len(items),
+			DeviceList: &DeviceList{Num: len(packet), Items: packet},
+		})
+	}
+	return responses
+}
+
+// NewCatalogNotifies splits the changed items into notification packets of
+// at most perPacket items.
+func NewCatalogNotifies(sn int, deviceID string, items []*CatalogItem, perPacket int) []*CatalogNotify {
+	var notifies []*CatalogNotify
+	for _, packet := range splitItems(items, perPacket) {
+		notifies = append(notifies, &CatalogNotify{
+			CmdType:    CmdTypeCatalog,
+			SN:         sn,
+			DeviceID:   deviceID,
+			SumNum:     len(items),
+			DeviceList: &DeviceList{Num: len(packet), Items: packet},
+		})
+	}
+	return notifies
+}
+
+// splitItems cuts items into packets of at most perPacket items; no items
+// make one empty packet.
+func splitItems(items []*CatalogItem, perPacket int) [][]*CatalogItem {
+	if perPacket <= 0 {
+		perPacket = len(items)
+	}
+	var packets [][]*CatalogItem
+	for offset := 0; ; offset += perPacket {
+		end := offset + perPacket
+		if end > len(items) {
+			end = len(items)
+		}
+		packets = append(packets, items[offset:end])
+		if end >= len(items) {
+			return packets
+		}
+	}
+}
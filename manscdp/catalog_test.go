@@ -0,0 +1,71 @@
+package manscdp
+
+import (
+	"testing"
+)
+
+func TestCatalogNotify_Unmarshal(t *testing.T) {
+	raw := []byte(`<?xml version="1.0" encoding="GB2312"?>
+<Notify>
+<CmdType>Catalog</CmdType>
+<SN>40</SN>
+<DeviceID>34020000001110000001</DeviceID>
+<SumNum>2</SumNum>
+<DeviceList Num="2">
+<Item>
+<DeviceID>34020000001320000001</DeviceID>
+<Event>ADD</Event>
+<Name>gate</Name>
+<Parental>0</Parental>
+<ParentID>34020000001110000001/34020000002160000001</ParentID>
+<Secrecy>0</Secrecy>
+<Status>ONLINE</Status>
+<Info><PTZType>1</PTZType></Info>
+</Item>
+<Item>
+<DeviceID>34020000001320000002</DeviceID>
+<Event>OFF</Event>
+</Item>
+</DeviceList>
+</Notify>
+`)
+	notify := new(CatalogNotify)
+	if err := Unmarshal(raw, notify); err != nil {
+		t.Fatal(err)
+	}
+	items := notify.GetItems()
+	if notify.SN != 40 || notify.SumNum != 2 || notify.DeviceList.Num != 2 || len(items) != 2 {
+		t.Fatalf("unexpected notify %+v", notify)
+	}
+	if items[0].Event != CatalogEventAdd || !items[0].IsOnline() || items[0].Info.PTZType != 1 || items[1].Event != CatalogEventOff {
+		t.Fatalf("unexpected items %+v %+v", items[0], items[1])
+	}
+	if parents := items[0].GetParentIDs(); len(parents) != 2 || parents[1] != "34020000002160000001" {
+		t.Fatalf("unexpected parents %v", parents)
+	}
+}
+
+func TestNewCatalogResponses(t *testing.T) {
+	items := make([]*CatalogItem, 7)
+	for i := range items {
+		items[i] = &CatalogItem{DeviceID: "34020000001320000001", Status: StatusOn}
+	}
+	responses := NewCatalogResponses(5, "34020000001110000001", items, 3)
+	if len(responses) != 3 || responses[2].DeviceList.Num != 1 || responses[0].SumNum != 7 {
+		t.Fatalf("unexpected packets %+v", responses)
+	}
+	raw, err := Marshal(responses[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(CatalogResponse)
+	if err := Unmarshal(raw, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.SN != 5 || len(decoded.GetItems()) != 3 || decoded.GetItems()[0].Event != "" {
+		t.Fatalf("unexpected response %+v", decoded)
+	}
+	if notifies := NewCatalogNotifies(6, "34020000001110000001", nil, 3); len(notifies) != 1 || notifies[0].SumNum != 0 {
+		t.Fatalf("unexpected notifies %+v", notifies)
+	}
+}
@@ -0,0 +1,220 @@
+package manscdp
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Values of the single-element DeviceControl commands (A.2.3.1).
+const (
+	TeleBootBoot    = "Boot"
+	RecordCmdRecord = "Record"
+	RecordCmdStop   = "StopRecord"
+	GuardCmdSet     = "SetGuard"
+	GuardCmdReset   = "ResetGuard"
+	AlarmCmdReset   = "ResetAlarm"
+	IFameCmdSend    = "Send"
+)
+
+// Result values of a control Response.
+const (
+	ResultOK    = "OK"
+	ResultError = "ERROR"
+)
+
+// defaultPriority is the PTZ control priority used when none is given.
+const defaultPriority = 5
+
+// ControlInfo is the Info element of Control: the PTZ control priority or
+// the alarm reset filter.
+type ControlInfo struct {
+	ControlPriority int    `xml:"ControlPriority,omitempty"`
+	AlarmMethod     string `xml:"AlarmMethod,omitempty"`
+	AlarmType       string `xml:"AlarmType,omitempty"`
+}
+
+// DragZoom is the DragZoomIn/DragZoomOut element: the selected rectangle in
+// a Length x Width play window.
+type DragZoom struct {
+	Length    int `xml:"Length"`
+	Width     int `xml:"Width"`
+	MidPointX int `xml:"MidPointX"`
+	MidPointY int `xml:"MidPointY"`
+	LengthX   int `xml:"LengthX"`
+	LengthY   int `xml:"LengthY"`
+}
+
+// HomePosition is the HomePosition element: the camera returns to
+// PresetIndex after ResetTime seconds without control.
+type HomePosition struct {
+	Enabled     int `xml:"Enabled"`
+	ResetTime   int `xml:"ResetTime,omitempty"`
+	PresetIndex int `xml:"PresetIndex,omitempty"`
+}
+
+// BasicParam is the BasicParam element of DeviceConfig (A.2.3.2).
+type BasicParam struct {
+	Name              string `xml:"Name,omitempty"`
+	Expiration        int    `xml:"Expiration,omitempty"`
+	HeartBeatInterval int    `xml:"HeartBeatInterval,omitempty"`
+	HeartBeatCount    int    `xml:"HeartBeatCount,omitempty"`
+}
+
+// Control is a Control message (GB/T 28181-2016 A.2.3): DeviceControl with
+// exactly one command element, or DeviceConfig.
+type Control struct {
+	XMLName      xml.Name      `xml:"Control"`
+	CmdType      string        `xml:"CmdType"`
+	SN           int           `xml:"SN"`
+	DeviceID     string        `xml:"DeviceID"`
+	PTZCmd       string        `xml:"PTZCmd,omitempty"`
+	TeleBoot     string        `xml:"TeleBoot,omitempty"`
+	RecordCmd    string        `xml:"RecordCmd,omitempty"`
+	GuardCmd     string        `xml:"GuardCmd,omitempty"`
+	AlarmCmd     string        `xml:"AlarmCmd,omitempty"`
+	IFameCmd     string        `xml:"IFameCmd,omitempty"`
+	DragZoomIn   *DragZoom     `xml:"DragZoomIn,omitempty"`
+	DragZoomOut  *DragZoom     `xml:"DragZoomOut,omitempty"`
+	HomePosition *HomePosition `xml:"HomePosition,omitempty"`
+	BasicParam   *BasicParam   `xml:"BasicParam,omitempty"`
+	Info         *ControlInfo  `xml:"Info,omitempty"`
+}
+
+// HasResponse reports whether the device answers the command with a
+// Response message (A.2.6.1): record, guard, alarm reset, home position
+// and device config do; PTZ, reboot, I-frame and drag zoom do not.
+func (control *Control) HasResponse() bool {
+	if control.CmdType == CmdTypeDeviceConfig {
+		return true
+	}
+	return len(control.RecordCmd) > 0 || len(control.GuardCmd) > 0 || len(control.AlarmCmd) > 0 || control.HomePosition != nil
+}
+
+func newDeviceControl(sn int, deviceID string) *Control {
+	return &Control{
+		CmdType:  CmdTypeDeviceControl,
+		SN:       sn,
+		DeviceID: deviceID,
+	}
+}
+
+// NewPTZControl builds the DeviceControl body carrying a PTZ instruction.
+// A priority of 0 uses the default priority 5.
+func NewPTZControl(sn int, deviceID string, ptzCmd *PTZCmd, priority int) *Control {
+	if priority <= 0 {
+		priority = defaultPriority
+	}
+	control := newDeviceControl(sn, deviceID)
+	control.PTZCmd = ptzCmd.String()
+	control.Info = &ControlInfo{ControlPriority: priority}
+	return control
+}
+
+// NewTeleBoot reboots the device.
+func NewTeleBoot(sn int, deviceID string) *Control {
+	control := newDeviceControl(sn, deviceID)
+	control.TeleBoot = TeleBootBoot
+	return control
+}
+
+// NewRecordControl starts or stops manual recording of a channel.
+func NewRecordControl(sn int, deviceID string, record bool) *Control {
+	control := newDeviceControl(sn, deviceID)
+	if record {
+		control.RecordCmd = RecordCmdRecord
+	} else {
+		control.RecordCmd = RecordCmdStop
+	}
+	return control
+}
+
+// NewGuardControl arms or disarms the alarm guard of a device or channel.
+func NewGuardControl(sn int, deviceID string, guard bool) *Control {
+	control := newDeviceControl(sn, deviceID)
+	if guard {
+		control.GuardCmd = GuardCmdSet
+	} else {
+		control.GuardCmd = GuardCmdReset
+	}
+	return control
+}
+
+// NewAlarmReset resets an alarm. Empty alarmMethod and alarmType reset all
+// alarms.
+func NewAlarmReset(sn int, deviceID string, alarmMethod, alarmType string) *Control {
+	control := newDeviceControl(sn, deviceID)
+	control.AlarmCmd = AlarmCmdReset
+	if len(alarmMethod) > 0 || len(alarmType) > 0 {
+		control.Info = &ControlInfo{AlarmMethod: alarmMethod, AlarmType: alarmType}
+	}
+	return control
+}
+
+// NewIFrameControl asks the channel to send an I-frame at once.
+func NewIFrameControl(sn int, deviceID string) *Control {
+	control := newDeviceControl(sn, deviceID)
+	control.IFameCmd = IFameCmdSend
+	return control
+}
+
+// NewDragZoom zooms into (in) or out of the dragged rectangle.
+func NewDragZoom(sn int, deviceID string, in bool, dragZoom *DragZoom) *Control {
+	control := newDeviceControl(sn, deviceID)
+	if in {
+		control.DragZoomIn = dragZoom
+	} else {
+		control.DragZoomOut = dragZoom
+	}
+	return control
+}
+
+// NewHomePosition enables the home position at presetIndex, returned to
+// after resetTime seconds, or disables it.
+func NewHomePosition(sn int, deviceID string, enabled bool, resetTime, presetIndex int) *Control {
+	control := newDeviceControl(sn, deviceID)
+	if enabled {
+		control.HomePosition = &HomePosition{Enabled: 1, ResetTime: resetTime, PresetIndex: presetIndex}
+	} else {
+		control.HomePosition = &HomePosition{Enabled: 0}
+	}
+	return control
+}
+
+// NewDeviceConfig changes the basic parameters of a device.
+func NewDeviceConfig(sn int, deviceID string, basicParam *BasicParam) *Control {
+	return &Control{
+		CmdType:    CmdTypeDeviceConfig,
+		SN:         sn,
+		DeviceID:   deviceID,
+		BasicParam: basicParam,
+	}
+}
+
+// ControlResponse is the Response to DeviceControl and DeviceConfig
+// (A.2.6.1, A.2.6.2).
+type ControlResponse struct {
+	XMLName  xml.Name `xml:"Response"`
+	CmdType  string   `xml:"CmdType"`
+	SN       int      `xml:"SN"`
+	DeviceID string   `xml:"DeviceID"`
+	Result   string   `xml:"Result"`
+}
+
+// IsOK reports whether the device executed the command.
+func (response *ControlResponse) IsOK() bool {
+	return strings.EqualFold(strings.TrimSpace(response.Result), ResultOK)
+}
+
+// NewControlResponse answers control on the device side.
+func NewControlResponse(control *Control, ok bool) *ControlResponse {
+	result := ResultError
+	if ok {
+		result = ResultOK
+	}
+	return &ControlResponse{
+		CmdType:  control.CmdType,
+		SN:       control.SN,
+		DeviceID: control.DeviceID,
+		Result:   result,
+	}
+}
@@ -0,0 +1,57 @@
+package manscdp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestControl_Marshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		control  *Control
+		contains string
+		response bool
+	}{
+		{"teleboot", NewTeleBoot(1, "34020000001110000001"), "<TeleBoot>Boot</TeleBoot>", false},
+		{"record", NewRecordControl(2, "34020000001320000001", false), "<RecordCmd>StopRecord</RecordCmd>", true},
+		{"guard", NewGuardControl(3, "34020000001340000001", true), "<GuardCmd>SetGuard</GuardCmd>", true},
+		{"alarm", NewAlarmReset(4, "34020000001340000001", "2", "1"), "<AlarmMethod>2</AlarmMethod>", true},
+		{"iframe", NewIFrameControl(5, "34020000001320000001"), "<IFameCmd>Send</IFameCmd>", false},
+		{"drag zoom", NewDragZoom(6, "34020000001320000001", false, &DragZoom{Length: 1920, Width: 1080, MidPointX: 100, MidPointY: 200, LengthX: 50, LengthY: 40}),
+			"<DragZoomOut>\n    <Length>1920</Length>", false},
+		{"home position", NewHomePosition(7, "34020000001320000001", true, 60, 3), "<PresetIndex>3</PresetIndex>", true},
+		{"device config", NewDeviceConfig(8, "34020000001110000001", &BasicParam{Expiration: 3600}), "<CmdType>DeviceConfig</CmdType>", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := Marshal(tt.control)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(raw, []byte(tt.contains)) {
+				t.Fatalf("%s not in %s", tt.contains, raw)
+			}
+			if tt.control.HasResponse() != tt.response {
+				t.Fatalf("HasResponse() = %v", tt.control.HasResponse())
+			}
+			decoded := new(Control)
+			if err := Unmarshal(raw, decoded); err != nil {
+				t.Fatal(err)
+			}
+			if decoded.SN != tt.control.SN || decoded.HasResponse() != tt.response {
+				t.Fatalf("round trip mismatch %+v", decoded)
+			}
+		})
+	}
+}
+
+func TestControlResponse_IsOK(t *testing.T) {
+	response := new(ControlResponse)
+	raw := []byte("<?xml version=\"1.0\"?><Response><CmdType>DeviceControl</CmdType><SN>9</SN><DeviceID>34020000001320000001</DeviceID><Result> ok </Result></Response>")
+	if err := Unmarshal(raw, response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.IsOK() || response.SN != 9 {
+		t.Fatalf("unexpected response %+v", response)
+	}
+}
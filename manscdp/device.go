@@ -0,0 +1,110 @@
+package manscdp
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Online values of Response/DeviceStatus.
+const (
+	OnlineOnline  = "ONLINE"
+	OnlineOffline = "OFFLINE"
+)
+
+// DeviceInfoQuery is Query/DeviceInfo (A.2.4.5).
+type DeviceInfoQuery struct {
+	XMLName  xml.Name `xml:"Query"`
+	CmdType  string   `xml:"CmdType"`
+	SN       int      `xml:"SN"`
+	DeviceID string   `xml:"DeviceID"`
+}
+
+func NewDeviceInfoQuery(sn int, deviceID string) *DeviceInfoQuery {
+	return &DeviceInfoQuery{
+		CmdType:  CmdTypeDeviceInfo,
+		SN:       sn,
+		DeviceID: deviceID,
+	}
+}
+
+// DeviceInfoResponse is Response/DeviceInfo (A.2.6.5). Channel is the
+// number of channels of the device.
+type DeviceInfoResponse struct {
+	XMLName      xml.Name `xml:"Response"`
+	CmdType      string   `xml:"CmdType"`
+	SN           int      `xml:"SN"`
+	DeviceID     string   `xml:"DeviceID"`
+	DeviceName   string   `xml:"DeviceName,omitempty"`
+	Result       string   `xml:"Result"`
+	Manufacturer string   `xml:"Manufacturer,omitempty"`
+	Model        string   `xml:"Model,omitempty"`
+	Firmware     string   `xml:"Firmware,omitempty"`
+	Channel      int      `xml:"Channel,omitempty"`
+}
+
+// NewDeviceInfoResponse answers query successfully; the caller fills in
+// the device fields.
+func NewDeviceInfoResponse(query *DeviceInfoQuery) *DeviceInfoResponse {
+	return &DeviceInfoResponse{
+		CmdType:  CmdTypeDeviceInfo,
+		SN:       query.SN,
+		DeviceID: query.DeviceID,
+		Result:   ResultOK,
+	}
+}
+
+// DeviceStatusQuery is Query/DeviceStatus (A.2.4.4).
+type DeviceStatusQuery struct {
+	XMLName  xml.Name `xml:"Query"`
+	CmdType  string   `xml:"CmdType"`
+	SN       int      `xml:"SN"`
+	DeviceID string   `xml:"DeviceID"`
+}
+
+func NewDeviceStatusQuery(sn int, deviceID string) *DeviceStatusQuery {
+	return &DeviceStatusQuery{
+		CmdType:  CmdTypeDeviceStatus,
+		SN:       sn,
+		DeviceID: deviceID,
+	}
+}
+
+// DeviceStatusResponse is Response/DeviceStatus (A.2.6.3). Status is OK
+// when the device works normally, otherwise Reason tells why.
+type DeviceStatusResponse struct {
+	XMLName    xml.Name `xml:"Response"`
+	CmdType    string   `xml:"CmdType"`
+	SN         int      `xml:"SN"`
+	DeviceID   string   `xml:"DeviceID"`
+	Result     string   `xml:"Result"`
+	Online     string   `xml:"Online"`
+	Status     string   `xml:"Status"`
+	Reason     string   `xml:"Reason,omitempty"`
+	Encode     string   `xml:"Encode,omitempty"`
+	Record     string   `xml:"Record,omitempty"`
+	DeviceTime string   `xml:"DeviceTime,omitempty"`
+}
+
+// NewDeviceStatusResponse answers query with the online state of the
+// device at t.
+func NewDeviceStatusResponse(query *DeviceStatusQuery, online bool, t time.Time) *DeviceStatusResponse {
+	response := &DeviceStatusResponse{
+		CmdType:    CmdTypeDeviceStatus,
+		SN:         query.SN,
+		DeviceID:   query.DeviceID,
+		Result:     ResultOK,
+		Online:     OnlineOnline,
+		Status:     ResultOK,
+		DeviceTime: FormatTime(t),
+	}
+	if !online {
+		response.Online = OnlineOffline
+		response.Status = ResultError
+	}
+	return response
+}
+
+// IsOnline reports whether the device is online.
+func (response *DeviceStatusResponse) IsOnline() bool {
+	return response.Online == OnlineOnline
+}
@@ -0,0 +1,43 @@
+package manscdp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviceStatusResponse_Unmarshal(t *testing.T) {
+	raw := []byte(`<?xml version="1.0" encoding="GB2312"?>
+<Response>
+<CmdType>DeviceStatus</CmdType>
+<SN>248</SN>
+<DeviceID>34020000001320000001</DeviceID>
+<Result>OK</Result>
+<Online>ONLINE</Online>
+<Status>OK</Status>
+<DeviceTime>2021-03-04T05:06:07</DeviceTime>
+</Response>
+`)
+	response := new(DeviceStatusResponse)
+	if err := Unmarshal(raw, response); err != nil {
+		t.Fatal(err)
+	}
+	if response.SN != 248 || !response.IsOnline() || response.Status != ResultOK {
+		t.Fatalf("unexpected response %+v", response)
+	}
+}
+
+func TestNewDeviceStatusResponse(t *testing.T) {
+	query := NewDeviceStatusQuery(3, "34020000001320000001")
+	response := NewDeviceStatusResponse(query, false, time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local))
+	if response.IsOnline() || response.Status != ResultError || response.DeviceTime != "2021-03-04T05:06:07" {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	body, err := Marshal(NewDeviceInfoResponse(NewDeviceInfoQuery(4, "34020000001110000001")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := Decode(body)
+	if err != nil || envelope.GetRoot() != RootResponse || envelope.CmdType != CmdTypeDeviceInfo || envelope.SN != 4 {
+		t.Fatalf("unexpected envelope %+v %v", envelope, err)
+	}
+}
@@ -0,0 +1,28 @@
+package manscdp
+
+import "encoding/xml"
+
+// KeepaliveNotify is Notify/Keepalive (A.2.5.2). Info lists the devices in
+// fault, if any.
+type KeepaliveNotify struct {
+	XMLName  xml.Name       `xml:"Notify"`
+	CmdType  string         `xml:"CmdType"`
+	SN       int            `xml:"SN"`
+	DeviceID string         `xml:"DeviceID"`
+	Status   string         `xml:"Status"`
+	Info     *KeepaliveInfo `xml:"Info,omitempty"`
+}
+
+type KeepaliveInfo struct {
+	DeviceIDs []string `xml:"DeviceID"`
+}
+
+// NewKeepaliveNotify reports deviceID working normally.
+func NewKeepaliveNotify(sn int, deviceID string) *KeepaliveNotify {
+	return &KeepaliveNotify{
+		CmdType:  CmdTypeKeepalive,
+		SN:       sn,
+		DeviceID: deviceID,
+		Status:   ResultOK,
+	}
+}
@@ -0,0 +1,114 @@
+package manscdp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// ContentType is the Content-Type of MANSCDP bodies carried by MESSAGE,
+// SUBSCRIBE and NOTIFY.
+const ContentType = "Application/MANSCDP+xml"
+
+// Root elements of MANSCDP messages.
+const (
+	RootControl  = "Control"
+	RootQuery    = "Query"
+	RootNotify   = "Notify"
+	RootResponse = "Response"
+)
+
+// CmdType values of GB/T 28181-2016 Annex A.
+const (
+	CmdTypeDeviceControl  = "DeviceControl"
+	CmdTypeDeviceConfig   = "DeviceConfig"
+	CmdTypeDeviceStatus   = "DeviceStatus"
+	CmdTypeCatalog        = "Catalog"
+	CmdTypeDeviceInfo     = "DeviceInfo"
+	CmdTypeRecordInfo     = "RecordInfo"
+	CmdTypeAlarm          = "Alarm"
+	CmdTypeConfigDownload = "ConfigDownload"
+	CmdTypePresetQuery    = "PresetQuery"
+	CmdTypeMobilePosition = "MobilePosition"
+	CmdTypeKeepalive      = "Keepalive"
+	CmdTypeMediaStatus    = "MediaStatus"
+	CmdTypeBroadcast      = "Broadcast"
+)
+
+// Envelope holds the fields shared by every MANSCDP message; it is enough
+// to route a body to its handler.
+type Envelope struct {
+	XMLName  xml.Name
+	CmdType  string `xml:"CmdType"`
+	SN       int    `xml:"SN"`
+	DeviceID string `xml:"DeviceID"`
+}
+
+// GetRoot returns the root element name, e.g. Query.
+func (envelope *Envelope) GetRoot() string {
+	return envelope.XMLName.Local
+}
+
+// Decode reads the envelope of a MANSCDP body.
+func Decode(raw []byte) (*Envelope, error) {
+	envelope := new(Envelope)
+	if err := Unmarshal(raw, envelope); err != nil {
+		return nil, err
+	}
+	switch envelope.GetRoot() {
+	case RootControl, RootQuery, RootNotify, RootResponse:
+	default:
+		return nil, fmt.Errorf("unknown manscdp root element : %s", envelope.GetRoot())
+	}
+	if len(strings.TrimSpace(envelope.CmdType)) == 0 {
+		return nil, errors.New("the manscdp CmdType element is empty")
+	}
+	return envelope, nil
+}
+
+// Marshal encodes v with the XML declaration GB28181 devices expect. The
+// declared encoding is GB2312 when the document is plain ASCII (a subset of
+// GB2312) and UTF-8 otherwise, so the declaration never lies.
+func Marshal(v interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	encoding := "GB2312"
+	for _, b := range body {
+		if b >= utf8.RuneSelf {
+			encoding = "UTF-8"
+			break
+		}
+	}
+	result := []byte(fmt.Sprintf("<?xml version=\"1.0\" encoding=\"%s\"?>\r\n", encoding))
+	result = append(result, body...)
+	return append(result, '\r', '\n'), nil
+}
+
+// Unmarshal decodes a MANSCDP body. Devices declare GB2312 or GBK but
+// often send UTF-8; bytes that are not valid UTF-8 are replaced rather
+// than failing the whole message.
+func Unmarshal(raw []byte, v interface{}) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return errors.New("the manscdp body is empty")
+	}
+	if !utf8.Valid(raw) {
+		raw = []byte(strings.ToValidUTF8(string(raw), "�"))
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	// some devices leave bare ampersands in names
+	decoder.Strict = false
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("manscdp decode error : %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package manscdp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	raw := []byte("<?xml version=\"1.0\" encoding=\"GB2312\"?>\r\n<Query>\r\n<CmdType>Catalog</CmdType>\r\n<SN>17430</SN>\r\n<DeviceID>34020000001320000001</DeviceID>\r\n</Query>\r\n")
+	envelope, err := Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.GetRoot() != RootQuery || envelope.CmdType != CmdTypeCatalog || envelope.SN != 17430 ||
+		envelope.DeviceID != "34020000001320000001" {
+		t.Fatalf("unexpected envelope %+v", envelope)
+	}
+	if _, err := Decode([]byte("<Foo><CmdType>Catalog</CmdType></Foo>")); err == nil {
+		t.Fatal("expected error for unknown root")
+	}
+	if _, err := Decode([]byte("<Query><SN>1</SN></Query>")); err == nil {
+		t.Fatal("expected error for empty CmdType")
+	}
+	// GBK bytes in a name must not fail the message
+	if _, err := Decode([]byte("<Notify><CmdType>Keepalive</CmdType><Name>\xc9\xe3\xcf\xf1</Name></Notify>")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewPTZControl(t *testing.T) {
+	control := NewPTZControl(11, "34020000001320000001", NewPTZStop(), 5)
+	raw, err := Marshal(control)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, []byte("<?xml version=\"1.0\" encoding=\"GB2312\"?>\r\n<Control>")) {
+		t.Fatalf("unexpected body %s", raw)
+	}
+	if !bytes.Contains(raw, []byte("<PTZCmd>A50F0100000000B5</PTZCmd>")) ||
+		!bytes.Contains(raw, []byte("<ControlPriority>5</ControlPriority>")) {
+		t.Fatalf("unexpected body %s", raw)
+	}
+	decoded := new(Control)
+	if err := Unmarshal(raw, decoded); err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := ParsePTZCmd(decoded.PTZCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.SN != 11 || decoded.CmdType != CmdTypeDeviceControl || cmd.GetKind() != PTZKindStop {
+		t.Fatalf("unexpected control %+v", decoded)
+	}
+}
@@ -0,0 +1,56 @@
+package manscdp
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// MobilePositionQuery is Query/MobilePosition (A.2.4.9), the body of a
+// mobile position subscription. Interval is the reporting period in
+// seconds.
+type MobilePositionQuery struct {
+	XMLName  xml.Name `xml:"Query"`
+	CmdType  string   `xml:"CmdType"`
+	SN       int      `xml:"SN"`
+	DeviceID string   `xml:"DeviceID"`
+	Interval int      `xml:"Interval,omitempty"`
+}
+
+// NewMobilePositionQuery asks deviceID for its position every interval
+// seconds; 0 leaves the period to the device.
+func NewMobilePositionQuery(sn int, deviceID string, interval int) *MobilePositionQuery {
+	return &MobilePositionQuery{
+		CmdType:  CmdTypeMobilePosition,
+		SN:       sn,
+		DeviceID: deviceID,
+		Interval: interval,
+	}
+}
+
+// MobilePositionNotify is Notify/MobilePosition (A.2.5.5): a WGS-84 fix
+// with speed in km/h, direction in degrees from north and altitude in
+// meters.
+type MobilePositionNotify struct {
+	XMLName   xml.Name `xml:"Notify"`
+	CmdType   string   `xml:"CmdType"`
+	SN        int      `xml:"SN"`
+	DeviceID  string   `xml:"DeviceID"`
+	Time      string   `xml:"Time"`
+	Longitude float64  `xml:"Longitude"`
+	Latitude  float64  `xml:"Latitude"`
+	Speed     float64  `xml:"Speed,omitempty"`
+	Direction float64  `xml:"Direction,omitempty"`
+	Altitude  float64  `xml:"Altitude,omitempty"`
+}
+
+// NewMobilePositionNotify reports the position of deviceID at t.
+func NewMobilePositionNotify(sn int, deviceID string, t time.Time, longitude, latitude float64) *MobilePositionNotify {
+	return &MobilePositionNotify{
+		CmdType:   CmdTypeMobilePosition,
+		SN:        sn,
+		DeviceID:  deviceID,
+		Time:      FormatTime(t),
+		Longitude: longitude,
+		Latitude:  latitude,
+	}
+}
@@ -0,0 +1,402 @@
+package manscdp
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PTZ command bytes of GB/T 28181-2016 Annex A.3. Byte 4 selects the
+// instruction; its top two bits are 00 for PTZ, 01 for focus/iris and 10
+// for preset, cruise, scan and auxiliary switch instructions.
+const (
+	ptzHead    = 0xa5
+	ptzVersion = 0x00
+
+	ptzRight   = 0x01
+	ptzLeft    = 0x02
+	ptzDown    = 0x04
+	ptzUp      = 0x08
+	ptzZoomIn  = 0x10
+	ptzZoomOut = 0x20
+
+	fiFocusFar  = 0x01
+	fiFocusNear = 0x02
+	fiIrisOpen  = 0x04
+	fiIrisClose = 0x08
+	fiPrefix    = 0x40
+
+	PTZPresetSet    = 0x81
+	PTZPresetCall   = 0x82
+	PTZPresetDelete = 0x83
+	PTZCruiseAdd    = 0x84
+	PTZCruiseDelete = 0x85
+	PTZCruiseSpeed  = 0x86
+	PTZCruiseDwell  = 0x87
+	PTZCruiseStart  = 0x88
+	PTZScan         = 0x89
+	PTZScanSpeed    = 0x8a
+	PTZAuxOn        = 0x8c
+	PTZAuxOff       = 0x8d
+)
+
+// Scan operations carried in byte 6 of a PTZScan instruction.
+const (
+	ScanStart    = 0x00
+	ScanSetLeft  = 0x01
+	ScanSetRight = 0x02
+)
+
+type PanDirection int
+type TiltDirection int
+type ZoomDirection int
+type FocusDirection int
+type IrisDirection int
+
+const (
+	PanStop PanDirection = iota
+	PanLeft
+	PanRight
+)
+const (
+	TiltStop TiltDirection = iota
+	TiltUp
+	TiltDown
+)
+const (
+	ZoomStop ZoomDirection = iota
+	ZoomIn
+	ZoomOut
+)
+const (
+	FocusStop FocusDirection = iota
+	FocusNear
+	FocusFar
+)
+const (
+	IrisStop IrisDirection = iota
+	IrisOpen
+	IrisClose
+)
+
+// PTZKind classifies a decoded PTZ command.
+type PTZKind int
+
+const (
+	PTZKindStop PTZKind = iota
+	PTZKindMove
+	PTZKindFocusIris
+	PTZKindPreset
+	PTZKindCruise
+	PTZKindScan
+	PTZKindAux
+	PTZKindUnknown
+)
+
+// PTZCmd is the 8-byte front-end device control instruction sent as the
+// hex PTZCmd element of Control/DeviceControl.
+type PTZCmd struct {
+	address uint16 // 12-bit device address
+	command uint8  // byte 4
+	data1   uint8  // byte 5
+	data2   uint8  // byte 6
+	data3   uint8  // high nibble of byte 7
+}
+
+func (ptzCmd *PTZCmd) SetAddress(address uint16) {
+	ptzCmd.address = address & 0x0fff
+}
+func (ptzCmd *PTZCmd) GetAddress() uint16 {
+	return ptzCmd.address
+}
+func (ptzCmd *PTZCmd) GetCommand() uint8 {
+	return ptzCmd.command
+}
+func (ptzCmd *PTZCmd) GetData() (uint8, uint8, uint8) {
+	return ptzCmd.data1, ptzCmd.data2, ptzCmd.data3
+}
+
+func NewPTZCmd(command, data1, data2, data3 uint8) *PTZCmd {
+	return &PTZCmd{
+		address: 0x01,
+		command: command,
+		data1:   data1,
+		data2:   data2,
+		data3:   data3 & 0x0f,
+	}
+}
+
+// NewPTZStop stops every PTZ, focus/iris, cruise and scan movement.
+func NewPTZStop() *PTZCmd {
+	return NewPTZCmd(0x00, 0, 0, 0)
+}
+
+// NewPTZMove pans, tilts and zooms. Pan and tilt speeds range over 0-255,
+// the zoom speed over 0-15.
+func NewPTZMove(pan PanDirection, tilt TiltDirection, zoom ZoomDirection, panSpeed, tiltSpeed, zoomSpeed uint8) *PTZCmd {
+	var command uint8
+	switch pan {
+	case PanLeft:
+		command |= ptzLeft
+	case PanRight:
+		command |= ptzRight
+	}
+	switch tilt {
+	case TiltUp:
+		command |= ptzUp
+	case TiltDown:
+		command |= ptzDown
+	}
+	switch zoom {
+	case ZoomIn:
+		command |= ptzZoomIn
+	case ZoomOut:
+		command |= ptzZoomOut
+	}
+	return NewPTZCmd(command, panSpeed, tiltSpeed, zoomSpeed)
+}
+
+// NewFocusIris adjusts focus and iris. Speeds range over 0-255.
+func NewFocusIris(focus FocusDirection, iris IrisDirection, focusSpeed, irisSpeed uint8) *PTZCmd {
+	command := uint8(fiPrefix)
+	switch focus {
+	case FocusNear:
+		command |= fiFocusNear
+	case FocusFar:
+		command |= fiFocusFar
+	}
+	switch iris {
+	case IrisOpen:
+		command |= fiIrisOpen
+	case IrisClose:
+		command |= fiIrisClose
+	}
+	return NewPTZCmd(command, focusSpeed, irisSpeed, 0)
+}
+
+// NewPreset sets, calls or deletes preset 1-255. Operation is one of
+// PTZPresetSet, PTZPresetCall or PTZPresetDelete.
+func NewPreset(operation uint8, preset uint8) (*PTZCmd, error) {
+	if operation < PTZPresetSet || operation > PTZPresetDelete {
+		return nil, fmt.Errorf("invalid preset operation 0x%02x", operation)
+	}
+	if preset == 0 {
+		return nil, errors.New("the preset number must be 1-255")
+	}
+	return NewPTZCmd(operation, 0, preset, 0), nil
+}
+
+// NewCruisePoint adds preset to, or removes it from, a cruise group.
+// Removing preset 0 deletes the whole group.
+func NewCruisePoint(add bool, group, preset uint8) *PTZCmd {
+	if add {
+		return NewPTZCmd(PTZCruiseAdd, group, preset, 0)
+	}
+	return NewPTZCmd(PTZCruiseDelete, group, preset, 0)
+}
+
+// NewCruiseSpeed sets the 12-bit cruise speed of a group.
+func NewCruiseSpeed(group uint8, speed uint16) *PTZCmd {
+	return NewPTZCmd(PTZCruiseSpeed, group, uint8(speed), uint8(speed>>8))
+}
+
+// NewCruiseDwell sets the 12-bit dwell time, in seconds, of a group.
+func NewCruiseDwell(group uint8, seconds uint16) *PTZCmd {
+	return NewPTZCmd(PTZCruiseDwell, group, uint8(seconds), uint8(seconds>>8))
+}
+
+// NewCruiseStart starts a cruise; NewPTZStop stops it.
+func NewCruiseStart(group uint8) *PTZCmd {
+	return NewPTZCmd(PTZCruiseStart, group, 0, 0)
+}
+
+// NewScan starts an auto scan or sets its left or right boundary.
+func NewScan(group, operation uint8) *PTZCmd {
+	return NewPTZCmd(PTZScan, group, operation, 0)
+}
+
+// NewScanSpeed sets the 12-bit auto scan speed of a group.
+func NewScanSpeed(group uint8, speed uint16) *PTZCmd {
+	return NewPTZCmd(PTZScanSpeed, group, uint8(speed), uint8(speed>>8))
+}
+
+// NewAux switches auxiliary device number (e.g. 1 for the wiper).
+func NewAux(on bool, number uint8) *PTZCmd {
+	if on {
+		return NewPTZCmd(PTZAuxOn, number, 0, 0)
+	}
+	return NewPTZCmd(PTZAuxOff, number, 0, 0)
+}
+
+// Bytes encodes the 8-byte instruction with its checksums.
+func (ptzCmd *PTZCmd) Bytes() []byte {
+	b := make([]byte, 8)
+	b[0] = ptzHead
+	b[1] = ptzVersion<<4 | ((ptzHead>>4)+(ptzHead&0x0f)+ptzVersion)&0x0f
+	b[2] = uint8(ptzCmd.address)
+	b[3] = ptzCmd.command
+	b[4] = ptzCmd.data1
+	b[5] = ptzCmd.data2
+	b[6] = ptzCmd.data3<<4 | uint8(ptzCmd.address>>8)&0x0f
+	var sum int
+	for _, v := range b[:7] {
+		sum += int(v)
+	}
+	b[7] = uint8(sum % 256)
+	return b
+}
+
+// String returns the upper-case hex form sent in the PTZCmd element.
+func (ptzCmd *PTZCmd) String() string {
+	return strings.ToUpper(hex.EncodeToString(ptzCmd.Bytes()))
+}
+
+// ParsePTZCmd decodes the hex PTZCmd element and verifies its checksums.
+func ParsePTZCmd(raw string) (*PTZCmd, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("ptz command is not hex : %s", err.Error())
+	}
+	if len(b) != 8 {
+		return nil, fmt.Errorf("ptz command must be 8 bytes, got %d", len(b))
+	}
+	if b[0] != ptzHead {
+		return nil, fmt.Errorf("ptz command must start with A5, got %02X", b[0])
+	}
+	version := b[1] >> 4
+	if b[1]&0x0f != ((b[0]>>4)+(b[0]&0x0f)+version)&0x0f {
+		return nil, errors.New("ptz command byte 2 check nibble is wrong")
+	}
+	var sum int
+	for _, v := range b[:7] {
+		sum += int(v)
+	}
+	if uint8(sum%256) != b[7] {
+		return nil, fmt.Errorf("ptz command checksum is %02X, want %02X", b[7], uint8(sum%256))
+	}
+	return &PTZCmd{
+		address: uint16(b[6]&0x0f)<<8 | uint16(b[2]),
+		command: b[3],
+		data1:   b[4],
+		data2:   b[5],
+		data3:   b[6] >> 4,
+	}, nil
+}
+
+// GetKind classifies the instruction.
+func (ptzCmd *PTZCmd) GetKind() PTZKind {
+	switch {
+	case ptzCmd.command == 0x00 || ptzCmd.command == fiPrefix:
+		return PTZKindStop
+	case ptzCmd.command&0xc0 == 0x00:
+		return PTZKindMove
+	case ptzCmd.command&0xf0 == fiPrefix:
+		return PTZKindFocusIris
+	}
+	switch ptzCmd.command {
+	case PTZPresetSet, PTZPresetCall, PTZPresetDelete:
+		return PTZKindPreset
+	case PTZCruiseAdd, PTZCruiseDelete, PTZCruiseSpeed, PTZCruiseDwell, PTZCruiseStart:
+		return PTZKindCruise
+	case PTZScan, PTZScanSpeed:
+		return PTZKindScan
+	case PTZAuxOn, PTZAuxOff:
+		return PTZKindAux
+	}
+	return PTZKindUnknown
+}
+
+// GetPan returns the pan direction and speed of a move instruction.
+func (ptzCmd *PTZCmd) GetPan() (PanDirection, uint8) {
+	if ptzCmd.GetKind() != PTZKindMove {
+		return PanStop, 0
+	}
+	switch {
+	case ptzCmd.command&ptzLeft != 0:
+		return PanLeft, ptzCmd.data1
+	case ptzCmd.command&ptzRight != 0:
+		return PanRight, ptzCmd.data1
+	}
+	return PanStop, 0
+}
+
+// GetTilt returns the tilt direction and speed of a move instruction.
+func (ptzCmd *PTZCmd) GetTilt() (TiltDirection, uint8) {
+	if ptzCmd.GetKind() != PTZKindMove {
+		return TiltStop, 0
+	}
+	switch {
+	case ptzCmd.command&ptzUp != 0:
+		return TiltUp, ptzCmd.data2
+	case ptzCmd.command&ptzDown != 0:
+		return TiltDown, ptzCmd.data2
+	}
+	return TiltStop, 0
+}
+
+// GetZoom returns the zoom direction and speed of a move instruction.
+func (ptzCmd *PTZCmd) GetZoom() (ZoomDirection, uint8) {
+	if ptzCmd.GetKind() != PTZKindMove {
+		return ZoomStop, 0
+	}
+	switch {
+	case ptzCmd.command&ptzZoomIn != 0:
+		return ZoomIn, ptzCmd.data3
+	case ptzCmd.command&ptzZoomOut != 0:
+		return ZoomOut, ptzCmd.data3
+	}
+	return ZoomStop, 0
+}
+
+// GetFocus returns the focus direction and speed of a focus/iris instruction.
+func (ptzCmd *PTZCmd) GetFocus() (FocusDirection, uint8) {
+	if ptzCmd.GetKind() != PTZKindFocusIris {
+		return FocusStop, 0
+	}
+	switch {
+	case ptzCmd.command&fiFocusNear != 0:
+		return FocusNear, ptzCmd.data1
+	case ptzCmd.command&fiFocusFar != 0:
+		return FocusFar, ptzCmd.data1
+	}
+	return FocusStop, 0
+}
+
+// GetIris returns the iris direction and speed of a focus/iris instruction.
+func (ptzCmd *PTZCmd) GetIris() (IrisDirection, uint8) {
+	if ptzCmd.GetKind() != PTZKindFocusIris {
+		return IrisStop, 0
+	}
+	switch {
+	case ptzCmd.command&fiIrisOpen != 0:
+		return IrisOpen, ptzCmd.data2
+	case ptzCmd.command&fiIrisClose != 0:
+		return IrisClose, ptzCmd.data2
+	}
+	return IrisStop, 0
+}
+
+// GetPreset returns the preset number of a preset instruction.
+func (ptzCmd *PTZCmd) GetPreset() uint8 {
+	switch ptzCmd.command {
+	case PTZPresetSet, PTZPresetCall, PTZPresetDelete, PTZCruiseAdd, PTZCruiseDelete:
+		return ptzCmd.data2
+	}
+	return 0
+}
+
+// GetGroup returns the cruise or scan group number.
+func (ptzCmd *PTZCmd) GetGroup() uint8 {
+	switch ptzCmd.GetKind() {
+	case PTZKindCruise, PTZKindScan:
+		return ptzCmd.data1
+	}
+	return 0
+}
+
+// GetValue returns the 12-bit speed or dwell time of the cruise and scan
+// speed/dwell instructions.
+func (ptzCmd *PTZCmd) GetValue() uint16 {
+	return uint16(ptzCmd.data3)<<8 | uint16(ptzCmd.data2)
+}
@@ -0,0 +1,80 @@
+package manscdp
+
+import "testing"
+
+func TestPTZCmd_String(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *PTZCmd
+		want string
+	}{
+		{"stop", NewPTZStop(), "A50F0100000000B5"},
+		{"up", NewPTZMove(PanStop, TiltUp, ZoomStop, 0, 250, 0), "A50F010800FA00B7"},
+		{"left down zoom in", NewPTZMove(PanLeft, TiltDown, ZoomIn, 0x20, 0x30, 0x05), "A50F01162030506B"},
+		{"focus near iris open", NewFocusIris(FocusNear, IrisOpen, 0x10, 0x20), "A50F01461020002B"},
+		{"cruise speed", NewCruiseSpeed(1, 0x123), "A50F01860123106F"},
+		{"aux on", NewAux(true, 1), "A50F018C01000042"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cmd.String(); got != tt.want {
+				t.Fatalf("String() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPTZCmd_Address(t *testing.T) {
+	cmd := NewPTZMove(PanRight, TiltStop, ZoomStop, 0x40, 0, 0)
+	cmd.SetAddress(0x123)
+	parsed, err := ParsePTZCmd(cmd.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.GetAddress() != 0x123 {
+		t.Fatalf("address = %#x", parsed.GetAddress())
+	}
+	if direction, speed := parsed.GetPan(); direction != PanRight || speed != 0x40 {
+		t.Fatalf("pan = %d %d", direction, speed)
+	}
+}
+
+func TestParsePTZCmd(t *testing.T) {
+	cmd, err := ParsePTZCmd("a50f01162030506b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.GetKind() != PTZKindMove {
+		t.Fatalf("kind = %d", cmd.GetKind())
+	}
+	if direction, speed := cmd.GetPan(); direction != PanLeft || speed != 0x20 {
+		t.Fatalf("pan = %d %d", direction, speed)
+	}
+	if direction, speed := cmd.GetTilt(); direction != TiltDown || speed != 0x30 {
+		t.Fatalf("tilt = %d %d", direction, speed)
+	}
+	if direction, speed := cmd.GetZoom(); direction != ZoomIn || speed != 0x05 {
+		t.Fatalf("zoom = %d %d", direction, speed)
+	}
+
+	preset, err := NewPreset(PTZPresetCall, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err = ParsePTZCmd(preset.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.GetKind() != PTZKindPreset || cmd.GetCommand() != PTZPresetCall || cmd.GetPreset() != 3 {
+		t.Fatalf("unexpected preset command %s", cmd)
+	}
+
+	for _, raw := range []string{"A50F0100000000B6", "A50E0100000000B4", "B50F0100000000C5", "A50F01", "zz"} {
+		if _, err := ParsePTZCmd(raw); err == nil {
+			t.Fatalf("%s: expected error", raw)
+		}
+	}
+	if _, err := NewPreset(PTZPresetSet, 0); err == nil {
+		t.Fatal("expected error for preset 0")
+	}
+}
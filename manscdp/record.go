@@ -0,0 +1,137 @@
+package manscdp
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Record types of RecordInfo queries and items.
+const (
+	RecordTypeAll    = "all"
+	RecordTypeTime   = "time"
+	RecordTypeAlarm  = "alarm"
+	RecordTypeManual = "manual"
+)
+
+// TimeLayout is the local date-time form of MANSCDP time elements.
+const TimeLayout = "2006-01-02T15:04:05"
+
+// FormatTime formats t in its own location, which devices read as local
+// time.
+func FormatTime(t time.Time) string {
+	return t.Format(TimeLayout)
+}
+
+// ParseTime parses a MANSCDP time in loc. Some devices separate date and
+// time with a blank or append fractional seconds or a zone.
+func ParseTime(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if loc == nil {
+		loc = time.Local
+	}
+	for _, layout := range []string{TimeLayout, "2006-01-02 15:04:05", "2006-01-02T15:04:05.000", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid manscdp time %q", value)
+}
+
+// RecordInfoQuery is Query/RecordInfo (A.2.4.5).
+type RecordInfoQuery struct {
+	XMLName    xml.Name `xml:"Query"`
+	CmdType    string   `xml:"CmdType"`
+	SN         int      `xml:"SN"`
+	DeviceID   string   `xml:"DeviceID"`
+	StartTime  string   `xml:"StartTime"`
+	EndTime    string   `xml:"EndTime"`
+	FilePath   string   `xml:"FilePath,omitempty"`
+	Address    string   `xml:"Address,omitempty"`
+	Secrecy    int      `xml:"Secrecy"`
+	Type       string   `xml:"Type,omitempty"`
+	RecorderID string   `xml:"RecorderID,omitempty"`
+}
+
+// NewRecordInfoQuery queries the records of channel deviceID between start
+// and end. An empty recordType queries all types.
+func NewRecordInfoQuery(sn int, deviceID string, start, end time.Time, recordType string) *RecordInfoQuery {
+	if len(recordType) == 0 {
+		recordType = RecordTypeAll
+	}
+	return &RecordInfoQuery{
+		CmdType:   CmdTypeRecordInfo,
+		SN:        sn,
+		DeviceID:  deviceID,
+		StartTime: FormatTime(start),
+		EndTime:   FormatTime(end),
+		Type:      recordType,
+	}
+}
+
+// RecordItem is one recorded file of a RecordInfo response.
+type RecordItem struct {
+	DeviceID   string `xml:"DeviceID"`
+	Name       string `xml:"Name"`
+	FilePath   string `xml:"FilePath,omitempty"`
+	Address    string `xml:"Address,omitempty"`
+	StartTime  string `xml:"StartTime"`
+	EndTime    string `xml:"EndTime"`
+	Secrecy    int    `xml:"Secrecy"`
+	Type       string `xml:"Type,omitempty"`
+	RecorderID string `xml:"RecorderID,omitempty"`
+	FileSize   int64  `xml:"FileSize,omitempty"`
+}
+
+// RecordList is the RecordList element; Num counts the items of this packet.
+type RecordList struct {
+	Num   int           `xml:"Num,attr"`
+	Items []*RecordItem `xml:"Item"`
+}
+
+// RecordInfoResponse is one packet of Response/RecordInfo (A.2.6.6).
+// SumNum counts the items of all packets answering the same SN.
+type RecordInfoResponse struct {
+	XMLName    xml.Name    `xml:"Response"`
+	CmdType    string      `xml:"CmdType"`
+	SN         int         `xml:"SN"`
+	DeviceID   string      `xml:"DeviceID"`
+	Name       string      `xml:"Name"`
+	SumNum     int         `xml:"SumNum"`
+	RecordList *RecordList `xml:"RecordList"`
+}
+
+// GetItems returns the items of the packet.
+func (response *RecordInfoResponse) GetItems() []*RecordItem {
+	if response.RecordList == nil {
+		return nil
+	}
+	return response.RecordList.Items
+}
+
+// NewRecordInfoResponses splits items into packets of at most perPacket
+// items, as a device answers query.
+func NewRecordInfoResponses(query *RecordInfoQuery, name string, items []*RecordItem, perPacket int) []*RecordInfoResponse {
+	if perPacket <= 0 {
+		perPacket = len(items)
+	}
+	var responses []*RecordInfoResponse
+	for offset := 0; ; offset += perPacket {
+		end := offset + perPacket
+		if end > len(items) {
+			end = len(items)
+		}
+		responses = append(responses, &RecordInfoResponse{
+			CmdType:    CmdTypeRecordInfo,
+			SN:         query.SN,
+			DeviceID:   query.DeviceID,
+			Name:       name,
+			SumNum:     len(items),
+			RecordList: &RecordList{Num: end - offset, Items: items[offset:end]},
+		})
+		if end >= len(items) {
+			return responses
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package manscdp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	for _, value := range []string{"2021-03-04T05:06:07", " 2021-03-04 05:06:07", "2021-03-04T05:06:07.000", "2021-03-04T05:06:07Z"} {
+		got, err := ParseTime(value, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("%q parsed as %s", value, got)
+		}
+	}
+	if _, err := ParseTime("20210304", time.UTC); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestRecordInfoQuery_Marshal(t *testing.T) {
+	start := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	query := NewRecordInfoQuery(17, "34020000001320000001", start, start.Add(time.Hour), "")
+	raw, err := Marshal(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.GetRoot() != RootQuery || envelope.CmdType != CmdTypeRecordInfo || envelope.SN != 17 {
+		t.Fatalf("unexpected envelope %+v", envelope)
+	}
+	decoded := new(RecordInfoQuery)
+	if err := Unmarshal(raw, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.StartTime != "2021-03-04T00:00:00" || decoded.EndTime != "2021-03-04T01:00:00" || decoded.Type != RecordTypeAll {
+		t.Fatalf("unexpected query %+v", decoded)
+	}
+}
+
+func TestNewRecordInfoResponses(t *testing.T) {
+	query := &RecordInfoQuery{CmdType: CmdTypeRecordInfo, SN: 3, DeviceID: "34020000001320000001"}
+	items := make([]*RecordItem, 5)
+	for i := range items {
+		items[i] = &RecordItem{DeviceID: query.DeviceID, Name: "camera", Type: RecordTypeTime}
+	}
+	responses := NewRecordInfoResponses(query, "camera", items, 2)
+	if len(responses) != 3 {
+		t.Fatalf("got %d packets", len(responses))
+	}
+	for i, num := range []int{2, 2, 1} {
+		if responses[i].SumNum != 5 || responses[i].RecordList.Num != num || len(responses[i].GetItems()) != num {
+			t.Fatalf("unexpected packet %d %+v", i, responses[i])
+		}
+	}
+	raw, err := Marshal(responses[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(RecordInfoResponse)
+	if err := Unmarshal(raw, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.SumNum != 5 || decoded.RecordList.Num != 1 || len(decoded.GetItems()) != 1 {
+		t.Fatalf("unexpected response %+v", decoded)
+	}
+	if empty := NewRecordInfoResponses(query, "camera", nil, 2); len(empty) != 1 || empty[0].SumNum != 0 {
+		t.Fatalf("unexpected empty answer %+v", empty)
+	}
+}
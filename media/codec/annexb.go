@@ -0,0 +1,26 @@
+package codec
+
+// SplitAnnexB returns the NAL units of an Annex B byte stream without their
+// start codes.
+func SplitAnnexB(data []byte) [][]byte {
+	var result [][]byte
+	start := -1
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			end := i
+			for end > start && data[end-1] == 0 {
+				end--
+			}
+			result = append(result, data[start:end])
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 && start < len(data) {
+		result = append(result, data[start:])
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package codec
+
+import "errors"
+
+var errShortData = errors.New("parameter set is truncated")
+
+// bitReader reads an RBSP most significant bit first.
+type bitReader struct {
+	data   []byte
+	offset int // in bits
+}
+
+func newBitReader(rbsp []byte) *bitReader {
+	return &bitReader{data: rbsp}
+}
+
+func (reader *bitReader) readBit() (uint32, error) {
+	if reader.offset >= 8*len(reader.data) {
+		return 0, errShortData
+	}
+	bit := reader.data[reader.offset/8] >> (7 - uint(reader.offset%8)) & 0x01
+	reader.offset++
+	return uint32(bit), nil
+}
+
+func (reader *bitReader) readBits(n int) (uint32, error) {
+	var result uint32
+	for i := 0; i < n; i++ {
+		bit, err := reader.readBit()
+		if err != nil {
+			return 0, err
+		}
+		result = result<<1 | bit
+	}
+	return result, nil
+}
+
+func (reader *bitReader) readFlag() (bool, error) {
+	bit, err := reader.readBit()
+	return bit == 1, err
+}
+
+func (reader *bitReader) skipBits(n int) error {
+	if reader.offset+n > 8*len(reader.data) {
+		return errShortData
+	}
+	reader.offset += n
+	return nil
+}
+
+// readUE reads an unsigned Exp-Golomb code.
+func (reader *bitReader) readUE() (uint32, error) {
+	zeros := 0
+	for {
+		bit, err := reader.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			break
+		}
+		zeros++
+		if zeros > 31 {
+			return 0, errors.New("exp-golomb code is too long")
+		}
+	}
+	value, err := reader.readBits(zeros)
+	if err != nil {
+		return 0, err
+	}
+	return (1<<uint(zeros) - 1) + value, nil
+}
+
+// readSE reads a signed Exp-Golomb code.
+func (reader *bitReader) readSE() (int32, error) {
+	value, err := reader.readUE()
+	if err != nil {
+		return 0, err
+	}
+	if value&0x01 == 1 {
+		return int32((value + 1) / 2), nil
+	}
+	return -int32(value / 2), nil
+}
+
+// unescapeRBSP removes the emulation prevention bytes of a NAL unit.
+func unescapeRBSP(nalu []byte) []byte {
+	result := make([]byte, 0, len(nalu))
+	zeros := 0
+	for _, b := range nalu {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		result = append(result, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return result
+}
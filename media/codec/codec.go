@@ -0,0 +1,58 @@
+package codec
+
+// Codec names a video coding standard carried in Annex B byte streams.
+type Codec string
+
+const (
+	H264 Codec = "H.264"
+	H265 Codec = "H.265"
+)
+
+// IsKeyFrame reports whether the access unit contains an IDR/IRAP picture.
+func IsKeyFrame(codec Codec, data []byte) bool {
+	for _, nalu := range SplitAnnexB(data) {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch codec {
+		case H264:
+			if H264NALType(nalu) == H264NALIDR {
+				return true
+			}
+		case H265:
+			if IsH265IRAP(H265NALType(nalu)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParameterSets returns the parameter set NAL units of an access unit: SPS
+// and PPS for H.264, and VPS, SPS and PPS for H.265.
+func ParameterSets(codec Codec, data []byte) (vps, sps, pps []byte) {
+	for _, nalu := range SplitAnnexB(data) {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch codec {
+		case H264:
+			switch H264NALType(nalu) {
+			case H264NALSPS:
+				sps = nalu
+			case H264NALPPS:
+				pps = nalu
+			}
+		case H265:
+			switch H265NALType(nalu) {
+			case H265NALVPS:
+				vps = nalu
+			case H265NALSPS:
+				sps = nalu
+			case H265NALPPS:
+				pps = nalu
+			}
+		}
+	}
+	return vps, sps, pps
+}
@@ -0,0 +1,314 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// H.264 NAL unit types (ITU-T H.264 Table 7-1).
+const (
+	H264NALSlice = 1
+	H264NALIDR   = 5
+	H264NALSEI   = 6
+	H264NALSPS   = 7
+	H264NALPPS   = 8
+	H264NALAUD   = 9
+)
+
+func H264NALType(nalu []byte) uint8 {
+	return nalu[0] & 0x1f
+}
+
+// H264SPS holds the fields of a sequence parameter set needed to describe
+// the stream.
+type H264SPS struct {
+	ProfileIDC      uint8
+	ConstraintFlags uint8
+	LevelIDC        uint8
+	ChromaFormatIDC uint32
+	Width           int
+	Height          int
+	FrameRate       float64 // from the VUI timing info, 0 when absent
+}
+
+var h264ProfileNames = map[uint8]string{
+	44:  "CAVLC 4:4:4 Intra",
+	66:  "Baseline",
+	77:  "Main",
+	88:  "Extended",
+	100: "High",
+	110: "High 10",
+	122: "High 4:2:2",
+	244: "High 4:4:4 Predictive",
+}
+
+// Profile returns the profile name.
+func (sps *H264SPS) Profile() string {
+	if sps.ProfileIDC == 66 && sps.ConstraintFlags&0x40 != 0 {
+		return "Constrained Baseline"
+	}
+	if name, ok := h264ProfileNames[sps.ProfileIDC]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", sps.ProfileIDC)
+}
+
+// Level returns the level number, e.g. 3.1.
+func (sps *H264SPS) Level() string {
+	if sps.LevelIDC == 11 && sps.ConstraintFlags&0x10 != 0 && sps.ProfileIDC != 100 {
+		return "1b"
+	}
+	return fmt.Sprintf("%d.%d", sps.LevelIDC/10, sps.LevelIDC%10)
+}
+
+// ParseH264SPS parses an SPS NAL unit, including its header byte.
+func ParseH264SPS(nalu []byte) (*H264SPS, error) {
+	if len(nalu) < 4 || H264NALType(nalu) != H264NALSPS {
+		return nil, errors.New("not an h.264 sps nal unit")
+	}
+	reader := newBitReader(unescapeRBSP(nalu[1:]))
+	sps := new(H264SPS)
+	profile, _ := reader.readBits(8)
+	constraint, _ := reader.readBits(8)
+	level, _ := reader.readBits(8)
+	sps.ProfileIDC, sps.ConstraintFlags, sps.LevelIDC = uint8(profile), uint8(constraint), uint8(level)
+	if err := sps.parse(reader); err != nil {
+		return nil, fmt.Errorf("h.264 sps : %s", err.Error())
+	}
+	return sps, nil
+}
+
+func (sps *H264SPS) parse(reader *bitReader) error {
+	if _, err := reader.readUE(); err != nil { // seq_parameter_set_id
+		return err
+	}
+	sps.ChromaFormatIDC = 1
+	switch sps.ProfileIDC {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chroma, err := reader.readUE()
+		if err != nil {
+			return err
+		}
+		sps.ChromaFormatIDC = chroma
+		if chroma == 3 {
+			if err := reader.skipBits(1); err != nil { // separate_colour_plane_flag
+				return err
+			}
+		}
+		for i := 0; i < 2; i++ { // bit_depth_luma/chroma_minus8
+			if _, err := reader.readUE(); err != nil {
+				return err
+			}
+		}
+		if err := reader.skipBits(1); err != nil { // qpprime_y_zero_transform_bypass_flag
+			return err
+		}
+		matrix, err := reader.readFlag()
+		if err != nil {
+			return err
+		}
+		if matrix {
+			lists := 8
+			if chroma == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				present, err := reader.readFlag()
+				if err != nil {
+					return err
+				}
+				if !present {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				if err := skipScalingList(reader, size); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if _, err := reader.readUE(); err != nil { // log2_max_frame_num_minus4
+		return err
+	}
+	pocType, err := reader.readUE()
+	if err != nil {
+		return err
+	}
+	switch pocType {
+	case 0:
+		if _, err := reader.readUE(); err != nil {
+			return err
+		}
+	case 1:
+		if err := reader.skipBits(1); err != nil {
+			return err
+		}
+		if _, err := reader.readSE(); err != nil {
+			return err
+		}
+		if _, err := reader.readSE(); err != nil {
+			return err
+		}
+		cycle, err := reader.readUE()
+		if err != nil {
+			return err
+		}
+		for i := uint32(0); i < cycle; i++ {
+			if _, err := reader.readSE(); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := reader.readUE(); err != nil { // max_num_ref_frames
+		return err
+	}
+	if err := reader.skipBits(1); err != nil { // gaps_in_frame_num_value_allowed_flag
+		return err
+	}
+	widthInMbs, err := reader.readUE()
+	if err != nil {
+		return err
+	}
+	heightInMapUnits, err := reader.readUE()
+	if err != nil {
+		return err
+	}
+	frameMbsOnly, err := reader.readFlag()
+	if err != nil {
+		return err
+	}
+	if !frameMbsOnly {
+		if err := reader.skipBits(1); err != nil { // mb_adaptive_frame_field_flag
+			return err
+		}
+	}
+	if err := reader.skipBits(1); err != nil { // direct_8x8_inference_flag
+		return err
+	}
+	fieldFactor := 2
+	if frameMbsOnly {
+		fieldFactor = 1
+	}
+	sps.Width = int(widthInMbs+1) * 16
+	sps.Height = fieldFactor * int(heightInMapUnits+1) * 16
+	cropping, err := reader.readFlag()
+	if err != nil {
+		return err
+	}
+	if cropping {
+		var crop [4]uint32
+		for i := range crop {
+			if crop[i], err = reader.readUE(); err != nil {
+				return err
+			}
+		}
+		cropX, cropY := 1, fieldFactor
+		switch sps.ChromaFormatIDC {
+		case 1:
+			cropX, cropY = 2, 2*fieldFactor
+		case 2:
+			cropX = 2
+		}
+		sps.Width -= cropX * int(crop[0]+crop[1])
+		sps.Height -= cropY * int(crop[2]+crop[3])
+	}
+	vui, err := reader.readFlag()
+	if err != nil || !vui {
+		return err
+	}
+	// a truncated VUI still leaves the picture size usable
+	sps.FrameRate, _ = parseH264VUITiming(reader)
+	return nil
+}
+
+func skipScalingList(reader *bitReader, size int) error {
+	last, next := int32(8), int32(8)
+	for i := 0; i < size; i++ {
+		if next != 0 {
+			delta, err := reader.readSE()
+			if err != nil {
+				return err
+			}
+			next = (last + delta + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+	return nil
+}
+
+func parseH264VUITiming(reader *bitReader) (float64, error) {
+	aspect, err := reader.readFlag()
+	if err != nil {
+		return 0, err
+	}
+	if aspect {
+		idc, err := reader.readBits(8)
+		if err != nil {
+			return 0, err
+		}
+		if idc == 255 { // Extended_SAR
+			if err := reader.skipBits(32); err != nil {
+				return 0, err
+			}
+		}
+	}
+	overscan, err := reader.readFlag()
+	if err != nil {
+		return 0, err
+	}
+	if overscan {
+		if err := reader.skipBits(1); err != nil {
+			return 0, err
+		}
+	}
+	signal, err := reader.readFlag()
+	if err != nil {
+		return 0, err
+	}
+	if signal {
+		if err := reader.skipBits(4); err != nil {
+			return 0, err
+		}
+		colour, err := reader.readFlag()
+		if err != nil {
+			return 0, err
+		}
+		if colour {
+			if err := reader.skipBits(24); err != nil {
+				return 0, err
+			}
+		}
+	}
+	chromaLoc, err := reader.readFlag()
+	if err != nil {
+		return 0, err
+	}
+	if chromaLoc {
+		for i := 0; i < 2; i++ {
+			if _, err := reader.readUE(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	timing, err := reader.readFlag()
+	if err != nil || !timing {
+		return 0, err
+	}
+	unitsInTick, err := reader.readBits(32)
+	if err != nil {
+		return 0, err
+	}
+	timeScale, err := reader.readBits(32)
+	if err != nil {
+		return 0, err
+	}
+	if unitsInTick == 0 {
+		return 0, nil
+	}
+	return float64(timeScale) / float64(2*unitsInTick), nil
+}
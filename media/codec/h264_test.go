@@ -0,0 +1,61 @@
+package codec
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseH264SPS(t *testing.T) {
+	cases := []struct {
+		sps           string
+		width, height int
+		profile       string
+		level         string
+		frameRate     float64
+	}{
+		{"6742c01eda0280f684000003000400000300ca10", 640, 480, "Constrained Baseline", "3.0", 25},
+		{"67640028acd940780227e5c04400000fa40003a98210", 1920, 1080, "High", "4.0", 29.97002997002997},
+	}
+	for _, c := range cases {
+		sps, err := ParseH264SPS(mustDecodeHex(t, c.sps))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sps.Width != c.width || sps.Height != c.height || sps.Profile() != c.profile || sps.Level() != c.level || sps.FrameRate != c.frameRate {
+			t.Fatalf("%s: got %dx%d %s %s %f", c.sps, sps.Width, sps.Height, sps.Profile(), sps.Level(), sps.FrameRate)
+		}
+	}
+	if _, err := ParseH264SPS([]byte{0x68, 0xce, 0x00, 0x80}); err == nil {
+		t.Fatal("expected an error for a pps")
+	}
+	if _, err := ParseH264SPS([]byte{0x67, 0x42, 0xc0, 0x1e}); err == nil {
+		t.Fatal("expected an error for a truncated sps")
+	}
+}
+
+func TestIsKeyFrame(t *testing.T) {
+	au := append([]byte{0, 0, 0, 1}, mustDecodeHex(t, "6742c01eda0280f684000003000400000300ca10")...)
+	au = append(au, 0, 0, 0, 1, 0x68, 0xce, 0x00, 0x80, 0, 0, 1, 0x65, 0x88, 0x84)
+	if !IsKeyFrame(H264, au) {
+		t.Fatal("IDR access unit is not a key frame")
+	}
+	if IsKeyFrame(H264, []byte{0, 0, 0, 1, 0x41, 0x9a, 0x00}) {
+		t.Fatal("P slice is a key frame")
+	}
+	_, sps, pps := ParameterSets(H264, au)
+	if sps == nil || sps[0] != 0x67 || len(pps) != 4 {
+		t.Fatalf("parameter sets % x / % x", sps, pps)
+	}
+	nalus := SplitAnnexB(au)
+	if len(nalus) != 3 || nalus[2][0] != 0x65 {
+		t.Fatalf("split into %d nal units", len(nalus))
+	}
+}
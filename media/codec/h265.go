@@ -0,0 +1,266 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// H.265 NAL unit types (ITU-T H.265 Table 7-1).
+const (
+	H265NALTrailR     = 1
+	H265NALBLAWLP     = 16
+	H265NALIDRWRADL   = 19
+	H265NALIDRNLP     = 20
+	H265NALCRANUT     = 21
+	H265NALVPS        = 32
+	H265NALSPS        = 33
+	H265NALPPS        = 34
+	H265NALAUD        = 35
+	H265NALPrefixSEI  = 39
+	h265NALIRAPMaxVCL = 23
+)
+
+func H265NALType(nalu []byte) uint8 {
+	return nalu[0] >> 1 & 0x3f
+}
+
+// IsH265IRAP reports whether a NAL unit type is an intra random access
+// point picture (BLA, IDR or CRA).
+func IsH265IRAP(nalType uint8) bool {
+	return nalType >= H265NALBLAWLP && nalType <= h265NALIRAPMaxVCL
+}
+
+// H265ProfileTierLevel holds the general profile_tier_level fields.
+type H265ProfileTierLevel struct {
+	ProfileSpace uint8
+	Tier         uint8
+	ProfileIDC   uint8
+	LevelIDC     uint8
+}
+
+var h265ProfileNames = map[uint8]string{
+	1: "Main",
+	2: "Main 10",
+	3: "Main Still Picture",
+	4: "Range Extensions",
+	5: "High Throughput",
+	9: "Screen Content Coding",
+}
+
+// Profile returns the profile name.
+func (ptl *H265ProfileTierLevel) Profile() string {
+	if name, ok := h265ProfileNames[ptl.ProfileIDC]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", ptl.ProfileIDC)
+}
+
+// Level returns the level number with its tier, e.g. 4.1 (Main tier).
+func (ptl *H265ProfileTierLevel) Level() string {
+	tier := "Main"
+	if ptl.Tier == 1 {
+		tier = "High"
+	}
+	level := fmt.Sprintf("%d", ptl.LevelIDC/30)
+	if ptl.LevelIDC%30 != 0 {
+		level = fmt.Sprintf("%d.%d", ptl.LevelIDC/30, ptl.LevelIDC%30/3)
+	}
+	return fmt.Sprintf("%s (%s tier)", level, tier)
+}
+
+// H265VPS holds the video parameter set timing.
+type H265VPS struct {
+	H265ProfileTierLevel
+	FrameRate float64 // from vps_timing_info, 0 when absent
+}
+
+// H265SPS holds the fields of a sequence parameter set needed to describe
+// the stream.
+type H265SPS struct {
+	H265ProfileTierLevel
+	ChromaFormatIDC uint32
+	Width           int
+	Height          int
+}
+
+// ParseH265VPS parses a VPS NAL unit, including its two header bytes.
+func ParseH265VPS(nalu []byte) (*H265VPS, error) {
+	if len(nalu) < 3 || H265NALType(nalu) != H265NALVPS {
+		return nil, errors.New("not an h.265 vps nal unit")
+	}
+	reader := newBitReader(unescapeRBSP(nalu[2:]))
+	vps := new(H265VPS)
+	if err := reader.skipBits(4 + 1 + 1 + 6); err != nil {
+		return nil, err
+	}
+	maxSubLayers, err := reader.readBits(3)
+	if err != nil {
+		return nil, err
+	}
+	if err := reader.skipBits(1 + 16); err != nil {
+		return nil, err
+	}
+	if err := parseProfileTierLevel(reader, &vps.H265ProfileTierLevel, int(maxSubLayers)); err != nil {
+		return nil, fmt.Errorf("h.265 vps : %s", err.Error())
+	}
+	vps.FrameRate, _ = parseH265VPSTiming(reader, int(maxSubLayers))
+	return vps, nil
+}
+
+func parseH265VPSTiming(reader *bitReader, maxSubLayers int) (float64, error) {
+	orderingInfo, err := reader.readFlag()
+	if err != nil {
+		return 0, err
+	}
+	first := maxSubLayers
+	if orderingInfo {
+		first = 0
+	}
+	for i := first; i <= maxSubLayers; i++ {
+		for j := 0; j < 3; j++ {
+			if _, err := reader.readUE(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	maxLayerID, err := reader.readBits(6)
+	if err != nil {
+		return 0, err
+	}
+	layerSets, err := reader.readUE()
+	if err != nil {
+		return 0, err
+	}
+	if err := reader.skipBits(int(layerSets) * int(maxLayerID+1)); err != nil {
+		return 0, err
+	}
+	timing, err := reader.readFlag()
+	if err != nil || !timing {
+		return 0, err
+	}
+	unitsInTick, err := reader.readBits(32)
+	if err != nil {
+		return 0, err
+	}
+	timeScale, err := reader.readBits(32)
+	if err != nil || unitsInTick == 0 {
+		return 0, err
+	}
+	return float64(timeScale) / float64(unitsInTick), nil
+}
+
+// ParseH265SPS parses an SPS NAL unit, including its two header bytes.
+func ParseH265SPS(nalu []byte) (*H265SPS, error) {
+	if len(nalu) < 3 || H265NALType(nalu) != H265NALSPS {
+		return nil, errors.New("not an h.265 sps nal unit")
+	}
+	reader := newBitReader(unescapeRBSP(nalu[2:]))
+	sps := new(H265SPS)
+	if err := reader.skipBits(4); err != nil { // sps_video_parameter_set_id
+		return nil, err
+	}
+	maxSubLayers, err := reader.readBits(3)
+	if err != nil {
+		return nil, err
+	}
+	if err := reader.skipBits(1); err != nil { // sps_temporal_id_nesting_flag
+		return nil, err
+	}
+	if err := parseProfileTierLevel(reader, &sps.H265ProfileTierLevel, int(maxSubLayers)); err != nil {
+		return nil, fmt.Errorf("h.265 sps : %s", err.Error())
+	}
+	if _, err := reader.readUE(); err != nil { // sps_seq_parameter_set_id
+		return nil, err
+	}
+	if sps.ChromaFormatIDC, err = reader.readUE(); err != nil {
+		return nil, err
+	}
+	if sps.ChromaFormatIDC == 3 {
+		if err := reader.skipBits(1); err != nil { // separate_colour_plane_flag
+			return nil, err
+		}
+	}
+	width, err := reader.readUE()
+	if err != nil {
+		return nil, err
+	}
+	height, err := reader.readUE()
+	if err != nil {
+		return nil, err
+	}
+	sps.Width, sps.Height = int(width), int(height)
+	conformance, err := reader.readFlag()
+	if err != nil {
+		return nil, err
+	}
+	if conformance {
+		var window [4]uint32
+		for i := range window {
+			if window[i], err = reader.readUE(); err != nil {
+				return nil, err
+			}
+		}
+		subWidth, subHeight := 1, 1
+		switch sps.ChromaFormatIDC {
+		case 1:
+			subWidth, subHeight = 2, 2
+		case 2:
+			subWidth = 2
+		}
+		sps.Width -= subWidth * int(window[0]+window[1])
+		sps.Height -= subHeight * int(window[2]+window[3])
+	}
+	return sps, nil
+}
+
+func parseProfileTierLevel(reader *bitReader, ptl *H265ProfileTierLevel, maxSubLayers int) error {
+	space, err := reader.readBits(2)
+	if err != nil {
+		return err
+	}
+	tier, err := reader.readBits(1)
+	if err != nil {
+		return err
+	}
+	profile, err := reader.readBits(5)
+	if err != nil {
+		return err
+	}
+	// compatibility flags, source flags and reserved bits
+	if err := reader.skipBits(32 + 4 + 43 + 1); err != nil {
+		return err
+	}
+	level, err := reader.readBits(8)
+	if err != nil {
+		return err
+	}
+	ptl.ProfileSpace, ptl.Tier, ptl.ProfileIDC, ptl.LevelIDC = uint8(space), uint8(tier), uint8(profile), uint8(level)
+	profilePresent := make([]bool, maxSubLayers)
+	levelPresent := make([]bool, maxSubLayers)
+	for i := 0; i < maxSubLayers; i++ {
+		if profilePresent[i], err = reader.readFlag(); err != nil {
+			return err
+		}
+		if levelPresent[i], err = reader.readFlag(); err != nil {
+			return err
+		}
+	}
+	if maxSubLayers > 0 {
+		if err := reader.skipBits(2 * (8 - maxSubLayers)); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < maxSubLayers; i++ {
+		if profilePresent[i] {
+			if err := reader.skipBits(88); err != nil {
+				return err
+			}
+		}
+		if levelPresent[i] {
+			if err := reader.skipBits(8); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package codec
+
+import "testing"
+
+const (
+	testH265VPS = "40010c01ffff01600000030090000003000003007bac0c0000030004000003006480"
+	testH265SPS = "42010101600000030090000003000003007ba003c0801107cb96"
+)
+
+func TestParseH265VPS(t *testing.T) {
+	vps, err := ParseH265VPS(mustDecodeHex(t, testH265VPS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vps.FrameRate != 25 || vps.Profile() != "Main" {
+		t.Fatalf("got %f fps, %s", vps.FrameRate, vps.Profile())
+	}
+}
+
+func TestParseH265SPS(t *testing.T) {
+	sps, err := ParseH265SPS(mustDecodeHex(t, testH265SPS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sps.Width != 1920 || sps.Height != 1080 || sps.Profile() != "Main" || sps.Level() != "4.1 (Main tier)" {
+		t.Fatalf("got %dx%d %s %s", sps.Width, sps.Height, sps.Profile(), sps.Level())
+	}
+	if _, err := ParseH265SPS(mustDecodeHex(t, testH265VPS)); err == nil {
+		t.Fatal("expected an error for a vps")
+	}
+	au := []byte{0, 0, 0, 1, 0x26, 0x01, 0xaf, 0, 0, 0, 1, 0x02, 0x01, 0xd0}
+	if !IsKeyFrame(H265, au) || IsKeyFrame(H265, au[7:]) {
+		t.Fatal("irap detection failed")
+	}
+}
@@ -0,0 +1,295 @@
+package ps
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Frame is one elementary stream access unit.
+type Frame struct {
+	StreamID   uint8
+	StreamType StreamType
+	PTS        uint64 // 90 kHz
+	DTS        uint64 // 90 kHz, equal to PTS when the stream carries no DTS
+	Data       []byte
+}
+
+func (frame *Frame) IsVideo() bool {
+	if frame.StreamType != StreamTypeUnknown {
+		return frame.StreamType.IsVideo()
+	}
+	return isVideoStreamID(frame.StreamID)
+}
+
+func (frame *Frame) IsAudio() bool {
+	if frame.StreamType != StreamTypeUnknown {
+		return frame.StreamType.IsAudio()
+	}
+	return isAudioStreamID(frame.StreamID)
+}
+
+// Demuxer splits an MPEG-2 program stream into access units. Input may be
+// cut at any byte; a PES packet carrying a PTS starts a new access unit of
+// its stream and PES packets without one continue it.
+type Demuxer struct {
+	handler     func(*Frame)
+	buffer      []byte
+	streamTypes map[uint8]StreamType
+	pending     map[uint8]*Frame
+	order       []uint8 // stream ids of pending in arrival order
+	scr         uint64
+}
+
+func NewDemuxer(handler func(*Frame)) *Demuxer {
+	return &Demuxer{
+		handler:     handler,
+		streamTypes: make(map[uint8]StreamType),
+		pending:     make(map[uint8]*Frame),
+	}
+}
+
+// GetStreamTypes returns the stream types announced by the last PSM.
+func (demuxer *Demuxer) GetStreamTypes() map[uint8]StreamType {
+	result := make(map[uint8]StreamType, len(demuxer.streamTypes))
+	for id, streamType := range demuxer.streamTypes {
+		result[id] = streamType
+	}
+	return result
+}
+
+// GetSCR returns the system clock reference of the last pack header, in
+// 90 kHz units.
+func (demuxer *Demuxer) GetSCR() uint64 {
+	return demuxer.scr
+}
+
+// Write feeds program stream bytes. On malformed input the demuxer skips to
+// the next start code and returns the error after consuming data.
+func (demuxer *Demuxer) Write(data []byte) error {
+	demuxer.buffer = append(demuxer.buffer, data...)
+	return demuxer.parse(false)
+}
+
+// Flush consumes buffered input, including a trailing PES packet of
+// unbounded length, and emits every pending access unit.
+func (demuxer *Demuxer) Flush() error {
+	err := demuxer.parse(true)
+	demuxer.buffer = demuxer.buffer[:0]
+	for len(demuxer.order) > 0 {
+		demuxer.emit(demuxer.order[0])
+	}
+	return err
+}
+
+// Reset drops buffered input and pending access units, e.g. after loss.
+func (demuxer *Demuxer) Reset() {
+	demuxer.buffer = demuxer.buffer[:0]
+	demuxer.pending = make(map[uint8]*Frame)
+	demuxer.order = demuxer.order[:0]
+}
+
+var startCodePrefix = []byte{0x00, 0x00, 0x01}
+
+func (demuxer *Demuxer) parse(final bool) error {
+	var firstErr error
+	for {
+		index := bytes.Index(demuxer.buffer, startCodePrefix)
+		if index < 0 {
+			// keep a possible partial prefix
+			if len(demuxer.buffer) > 2 {
+				demuxer.buffer = demuxer.buffer[len(demuxer.buffer)-2:]
+			}
+			return firstErr
+		}
+		demuxer.buffer = demuxer.buffer[index:]
+		if len(demuxer.buffer) < 4 {
+			return firstErr
+		}
+		n, err := demuxer.unit(demuxer.buffer, final)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			demuxer.buffer = demuxer.buffer[3:]
+			continue
+		}
+		if n == 0 {
+			return firstErr
+		}
+		demuxer.buffer = demuxer.buffer[n:]
+	}
+}
+
+// unit parses the unit starting at raw[0] and returns its length, or 0 if
+// more input is needed.
+func (demuxer *Demuxer) unit(raw []byte, final bool) (int, error) {
+	id := raw[3]
+	switch {
+	case id == StreamIDProgramEnd:
+		return 4, nil
+	case id == StreamIDPack:
+		return demuxer.packHeader(raw)
+	case id < StreamIDProgramEnd:
+		return 0, fmt.Errorf("unexpected start code 0x%02x", id)
+	}
+	if len(raw) < 6 {
+		return 0, nil
+	}
+	length := int(binary.BigEndian.Uint16(raw[4:]))
+	end := 6 + length
+	if length == 0 {
+		if !isVideoStreamID(id) {
+			return 0, fmt.Errorf("stream 0x%02x has an empty packet", id)
+		}
+		// unbounded video PES: runs until the next system start code
+		end = nextUnit(raw, 6)
+		if end < 0 {
+			if !final {
+				return 0, nil
+			}
+			end = len(raw)
+		}
+	} else if len(raw) < end {
+		if !final {
+			return 0, nil
+		}
+		return 0, errors.New("pes packet is truncated")
+	}
+	packet := raw[:end]
+	switch {
+	case id == StreamIDSystemHeader:
+		return end, nil
+	case id == StreamIDProgramMap:
+		return end, demuxer.programStreamMap(packet)
+	case isVideoStreamID(id), isAudioStreamID(id), id == StreamIDPrivate1:
+		return end, demuxer.pes(id, packet)
+	}
+	// padding, private 2 and directory packets are skipped
+	return end, nil
+}
+
+// nextUnit finds the next pack, system, PSM or PES start code after from.
+func nextUnit(raw []byte, from int) int {
+	for from < len(raw) {
+		index := bytes.Index(raw[from:], startCodePrefix)
+		if index < 0 || from+index+3 >= len(raw) {
+			return -1
+		}
+		if raw[from+index+3] >= StreamIDProgramEnd {
+			return from + index
+		}
+		from += index + 3
+	}
+	return -1
+}
+
+func (demuxer *Demuxer) packHeader(raw []byte) (int, error) {
+	if len(raw) < 5 {
+		return 0, nil
+	}
+	if raw[4]&0xf0 == 0x20 {
+		// MPEG-1 pack header
+		if len(raw) < 12 {
+			return 0, nil
+		}
+		return 12, nil
+	}
+	if raw[4]&0xc0 != 0x40 {
+		return 0, errors.New("pack header marker bits are invalid")
+	}
+	if len(raw) < 14 {
+		return 0, nil
+	}
+	end := 14 + int(raw[13]&0x07)
+	if len(raw) < end {
+		return 0, nil
+	}
+	b := raw[4:]
+	demuxer.scr = uint64(b[0]>>3&0x07)<<30 |
+		uint64(b[0]&0x03)<<28 |
+		uint64(b[1])<<20 |
+		uint64(b[2]>>3)<<15 |
+		uint64(b[2]&0x03)<<13 |
+		uint64(b[3])<<5 |
+		uint64(b[4]>>3)
+	return end, nil
+}
+
+func (demuxer *Demuxer) programStreamMap(raw []byte) error {
+	if len(raw) < 16 {
+		return errors.New("program stream map is truncated")
+	}
+	infoLength := int(binary.BigEndian.Uint16(raw[8:]))
+	offset := 10 + infoLength
+	if len(raw) < offset+2 {
+		return errors.New("program stream map is truncated")
+	}
+	mapLength := int(binary.BigEndian.Uint16(raw[offset:]))
+	offset += 2
+	end := offset + mapLength
+	if len(raw) < end+4 {
+		return errors.New("program stream map is truncated")
+	}
+	streamTypes := make(map[uint8]StreamType)
+	for offset+4 <= end {
+		streamType := StreamType(raw[offset])
+		id := raw[offset+1]
+		esInfoLength := int(binary.BigEndian.Uint16(raw[offset+2:]))
+		streamTypes[id] = streamType
+		offset += 4 + esInfoLength
+	}
+	demuxer.streamTypes = streamTypes
+	for id, frame := range demuxer.pending {
+		if streamType, ok := streamTypes[id]; ok {
+			frame.StreamType = streamType
+		}
+	}
+	return nil
+}
+
+func (demuxer *Demuxer) pes(id uint8, raw []byte) error {
+	header, err := parsePESHeader(raw)
+	if err != nil {
+		return err
+	}
+	payload := raw[header.length:]
+	frame, ok := demuxer.pending[id]
+	if header.hasPTS || !ok {
+		if ok {
+			demuxer.emit(id)
+		}
+		if !header.hasPTS {
+			// the start of this access unit was lost
+			return nil
+		}
+		frame = &Frame{
+			StreamID:   id,
+			StreamType: demuxer.streamTypes[id],
+			PTS:        header.pts,
+			DTS:        header.dts,
+		}
+		demuxer.pending[id] = frame
+		demuxer.order = append(demuxer.order, id)
+	}
+	frame.Data = append(frame.Data, payload...)
+	return nil
+}
+
+func (demuxer *Demuxer) emit(id uint8) {
+	frame, ok := demuxer.pending[id]
+	if !ok {
+		return
+	}
+	delete(demuxer.pending, id)
+	for i, v := range demuxer.order {
+		if v == id {
+			demuxer.order = append(demuxer.order[:i], demuxer.order[i+1:]...)
+			break
+		}
+	}
+	if demuxer.handler != nil && len(frame.Data) > 0 {
+		demuxer.handler(frame)
+	}
+}
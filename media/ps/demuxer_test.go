@@ -0,0 +1,91 @@
+package ps
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func demuxFixture(t *testing.T, chunk int) []*Frame {
+	raw, err := ioutil.ReadFile("testdata/h264_g711.ps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := make([]*Frame, 0)
+	demuxer := NewDemuxer(func(frame *Frame) {
+		frames = append(frames, frame)
+	})
+	for len(raw) > 0 {
+		n := chunk
+		if n > len(raw) {
+			n = len(raw)
+		}
+		if err := demuxer.Write(raw[:n]); err != nil {
+			t.Fatal(err)
+		}
+		raw = raw[n:]
+	}
+	if err := demuxer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return frames
+}
+
+func TestDemuxer_Write(t *testing.T) {
+	for _, chunk := range []int{1 << 20, 7, 188, 1000} {
+		frames := demuxFixture(t, chunk)
+		if len(frames) != 10 {
+			t.Fatalf("chunk %d: got %d frames, want 10", chunk, len(frames))
+		}
+		video, audio := 0, 0
+		for _, frame := range frames {
+			switch {
+			case frame.IsVideo():
+				if frame.StreamType != StreamTypeH264 {
+					t.Fatalf("video stream type %s", frame.StreamType)
+				}
+				if want := uint64(90000 + 3600*video); frame.PTS != want || frame.DTS != want {
+					t.Fatalf("video frame %d: pts %d dts %d, want %d", video, frame.PTS, frame.DTS, want)
+				}
+				video++
+			case frame.IsAudio():
+				if frame.StreamType != StreamTypeG711A {
+					t.Fatalf("audio stream type %s", frame.StreamType)
+				}
+				if len(frame.Data) != 320 {
+					t.Fatalf("audio frame length %d", len(frame.Data))
+				}
+				audio++
+			}
+		}
+		if video != 5 || audio != 5 {
+			t.Fatalf("chunk %d: got %d video and %d audio frames", chunk, video, audio)
+		}
+		// the first access unit spans two PES packets
+		if frames[0].Data[4] != 0x67 || len(frames[0].Data) < 3000 {
+			t.Fatalf("first access unit is not the joined key frame: % x", frames[0].Data[:8])
+		}
+	}
+}
+
+func TestDemuxer_Resync(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/h264_g711.ps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	demuxer := NewDemuxer(func(frame *Frame) {
+		count++
+	})
+	garbage := []byte{0x00, 0x00, 0x01, 0x05, 0xff, 0xff}
+	if err := demuxer.Write(append(garbage, raw...)); err == nil {
+		t.Fatal("expected an error for the garbage prefix")
+	}
+	_ = demuxer.Flush()
+	if count != 10 {
+		t.Fatalf("got %d frames after resync, want 10", count)
+	}
+	types := demuxer.GetStreamTypes()
+	if types[StreamIDVideo] != StreamTypeH264 || types[StreamIDAudio] != StreamTypeG711A {
+		t.Fatalf("unexpected stream map %v", types)
+	}
+}
@@ -0,0 +1,192 @@
+package ps
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/kokutas/gb28181/media/codec"
+)
+
+// maxPESPayload keeps PES_packet_length within 16 bits including the
+// optional header with both PTS and DTS.
+const maxPESPayload = 0xffff - 3 - 10
+
+// Muxer wraps elementary stream access units into MPEG-2 program stream
+// packs the way GB28181 devices send them: every access unit is one pack,
+// and key frames are preceded by a system header and a PSM.
+type Muxer struct {
+	streamTypes map[uint8]StreamType
+	order       []uint8 // stream ids in the order they were added
+	nextVideo   uint8
+	nextAudio   uint8
+	muxRate     uint32 // in units of 50 bytes/s
+	psmVersion  uint8
+	sentHeaders bool
+}
+
+func NewMuxer() *Muxer {
+	return &Muxer{
+		streamTypes: make(map[uint8]StreamType),
+		nextVideo:   StreamIDVideo,
+		nextAudio:   StreamIDAudio,
+		muxRate:     6106,
+	}
+}
+
+func (muxer *Muxer) SetMuxRate(muxRate uint32) {
+	muxer.muxRate = muxRate & 0x3fffff
+}
+func (muxer *Muxer) GetMuxRate() uint32 {
+	return muxer.muxRate
+}
+
+// AddStream registers an elementary stream and returns its stream id.
+func (muxer *Muxer) AddStream(streamType StreamType) (uint8, error) {
+	var id uint8
+	switch {
+	case streamType.IsVideo():
+		if muxer.nextVideo > 0xef {
+			return 0, errors.New("too many video streams")
+		}
+		id = muxer.nextVideo
+		muxer.nextVideo++
+	case streamType.IsAudio():
+		if muxer.nextAudio > 0xdf {
+			return 0, errors.New("too many audio streams")
+		}
+		id = muxer.nextAudio
+		muxer.nextAudio++
+	default:
+		return 0, fmt.Errorf("unsupported stream type %s", streamType)
+	}
+	muxer.streamTypes[id] = streamType
+	muxer.order = append(muxer.order, id)
+	muxer.psmVersion = (muxer.psmVersion + 1) & 0x1f
+	muxer.sentHeaders = false
+	return id, nil
+}
+
+// Mux returns one pack carrying the access unit. Timestamps are in 90 kHz
+// units; pass dts equal to pts for streams without B-frames.
+func (muxer *Muxer) Mux(streamID uint8, pts, dts uint64, data []byte) ([]byte, error) {
+	streamType, ok := muxer.streamTypes[streamID]
+	if !ok {
+		return nil, fmt.Errorf("unknown stream id 0x%02x", streamID)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("the access unit is empty")
+	}
+	buf := new(bytes.Buffer)
+	muxer.writePackHeader(buf, dts)
+	if !muxer.sentHeaders || IsKeyFrame(streamType, data) {
+		muxer.writeSystemHeader(buf)
+		muxer.writeProgramStreamMap(buf)
+		muxer.sentHeaders = true
+	}
+	first := true
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxPESPayload {
+			n = maxPESPayload
+		}
+		writePES(buf, streamID, first, streamType.IsVideo() && pts != dts, pts, dts, data[:n])
+		data = data[n:]
+		first = false
+	}
+	return buf.Bytes(), nil
+}
+
+func (muxer *Muxer) writePackHeader(buf *bytes.Buffer, scr uint64) {
+	var b [14]byte
+	copy(b[:], []byte{0x00, 0x00, 0x01, StreamIDPack})
+	b[4] = 0x40 | uint8(scr>>27)&0x38 | 0x04 | uint8(scr>>28)&0x03
+	b[5] = uint8(scr >> 20)
+	b[6] = uint8(scr>>12)&0xf8 | 0x04 | uint8(scr>>13)&0x03
+	b[7] = uint8(scr >> 5)
+	b[8] = uint8(scr<<3) | 0x04
+	b[9] = 0x01
+	b[10] = uint8(muxer.muxRate >> 14)
+	b[11] = uint8(muxer.muxRate >> 6)
+	b[12] = uint8(muxer.muxRate<<2) | 0x03
+	b[13] = 0xf8
+	buf.Write(b[:])
+}
+
+func (muxer *Muxer) writeSystemHeader(buf *bytes.Buffer) {
+	audioBound, videoBound := 0, 0
+	body := make([]byte, 6, 6+3*len(muxer.order))
+	for _, id := range muxer.order {
+		if isVideoStreamID(id) {
+			videoBound++
+			// buffer bound scale 1024, 1 MiB
+			body = append(body, id, 0xe0|0x04, 0x00)
+		} else {
+			audioBound++
+			// buffer bound scale 128, 4 KiB
+			body = append(body, id, 0xc0, 0x20)
+		}
+	}
+	body[0] = 0x80 | uint8(muxer.muxRate>>15)
+	body[1] = uint8(muxer.muxRate >> 7)
+	body[2] = uint8(muxer.muxRate<<1) | 0x01
+	body[3] = uint8(audioBound << 2)   // variable bitrate, CSPS off
+	body[4] = 0xe0 | uint8(videoBound) // audio and video locked
+	body[5] = 0x7f
+	buf.Write([]byte{0x00, 0x00, 0x01, StreamIDSystemHeader})
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(body)))
+	buf.Write(body)
+}
+
+func (muxer *Muxer) writeProgramStreamMap(buf *bytes.Buffer) {
+	entries := make([]byte, 0, 4*len(muxer.order))
+	for _, id := range muxer.order {
+		entries = append(entries, uint8(muxer.streamTypes[id]), id, 0x00, 0x00)
+	}
+	psm := []byte{0x00, 0x00, 0x01, StreamIDProgramMap, 0, 0, 0x80 | 0x60 | muxer.psmVersion, 0xff, 0x00, 0x00}
+	psm = append(psm, uint8(len(entries)>>8), uint8(len(entries)))
+	psm = append(psm, entries...)
+	binary.BigEndian.PutUint16(psm[4:], uint16(len(psm)-6+4))
+	crc := crc32MPEG2(psm)
+	psm = append(psm, uint8(crc>>24), uint8(crc>>16), uint8(crc>>8), uint8(crc))
+	buf.Write(psm)
+}
+
+func writePES(buf *bytes.Buffer, streamID uint8, first, withDTS bool, pts, dts uint64, payload []byte) {
+	header := []byte{0x80, 0x00, 0x00}
+	var timestamps []byte
+	if first {
+		header[0] |= 0x04 // data alignment
+		if withDTS {
+			header[1] = 0xc0
+			timestamps = make([]byte, 10)
+			writeTimestamp(timestamps, 0x03, pts)
+			writeTimestamp(timestamps[5:], 0x01, dts)
+		} else {
+			header[1] = 0x80
+			timestamps = make([]byte, 5)
+			writeTimestamp(timestamps, 0x02, pts)
+		}
+	}
+	header[2] = uint8(len(timestamps))
+	buf.Write([]byte{0x00, 0x00, 0x01, streamID})
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(header)+len(timestamps)+len(payload)))
+	buf.Write(header)
+	buf.Write(timestamps)
+	buf.Write(payload)
+}
+
+// IsKeyFrame reports whether an access unit starts a GOP: it contains an
+// IDR/IRAP picture or a sequence parameter set. Audio is never a key frame.
+func IsKeyFrame(streamType StreamType, data []byte) bool {
+	videoCodec := streamType.Codec()
+	if len(videoCodec) == 0 {
+		return false
+	}
+	if codec.IsKeyFrame(videoCodec, data) {
+		return true
+	}
+	_, sps, _ := codec.ParameterSets(videoCodec, data)
+	return sps != nil
+}
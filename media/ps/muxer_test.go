@@ -0,0 +1,93 @@
+package ps
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMuxer_Mux(t *testing.T) {
+	muxer := NewMuxer()
+	video, err := muxer.AddStream(StreamTypeH265)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := muxer.AddStream(StreamTypeG711U)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := muxer.AddStream(StreamType(0x42)); err == nil {
+		t.Fatal("expected an error for an unknown stream type")
+	}
+	// VPS + IDR_W_RADL, larger than one PES packet
+	key := append([]byte{0, 0, 0, 1, 0x40, 0x01, 0x0c}, []byte{0, 0, 0, 1, 0x26, 0x01}...)
+	key = append(key, bytes.Repeat([]byte{0xaa}, 100000)...)
+	inter := append([]byte{0, 0, 0, 1, 0x02, 0x01}, bytes.Repeat([]byte{0xbb}, 500)...)
+	g711 := bytes.Repeat([]byte{0xd5}, 160)
+
+	var stream []byte
+	for _, au := range []struct {
+		id       uint8
+		pts, dts uint64
+		data     []byte
+	}{
+		{video, 3600, 0, key},
+		{audio, 3600, 3600, g711},
+		{video, 7200, 3600, inter},
+		{audio, 7200, 7200, g711},
+	} {
+		pack, err := muxer.Mux(au.id, au.pts, au.dts, au.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, pack...)
+	}
+	if _, err := muxer.Mux(0xe5, 0, 0, g711); err == nil {
+		t.Fatal("expected an error for an unknown stream id")
+	}
+
+	var frames []*Frame
+	demuxer := NewDemuxer(func(frame *Frame) {
+		frames = append(frames, frame)
+	})
+	if err := demuxer.Write(stream); err != nil {
+		t.Fatal(err)
+	}
+	if err := demuxer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 4 {
+		t.Fatalf("got %d frames, want 4", len(frames))
+	}
+	if frames[0].StreamType != StreamTypeH265 || frames[0].PTS != 3600 || frames[0].DTS != 0 || !bytes.Equal(frames[0].Data, key) {
+		t.Fatalf("key frame mismatch: type %s pts %d dts %d len %d", frames[0].StreamType, frames[0].PTS, frames[0].DTS, len(frames[0].Data))
+	}
+	if frames[1].StreamType != StreamTypeG711U || !bytes.Equal(frames[1].Data, g711) {
+		t.Fatalf("audio frame mismatch")
+	}
+	if !bytes.Equal(frames[2].Data, inter) || frames[2].DTS != 3600 {
+		t.Fatalf("inter frame mismatch")
+	}
+	if demuxer.GetSCR() != 7200 {
+		t.Fatalf("scr %d, want 7200", demuxer.GetSCR())
+	}
+}
+
+func TestIsKeyFrame(t *testing.T) {
+	cases := []struct {
+		streamType StreamType
+		data       []byte
+		want       bool
+	}{
+		{StreamTypeH264, []byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 1, 0x68, 0xce}, true},
+		{StreamTypeH264, []byte{0, 0, 1, 0x65, 0x88}, true},
+		{StreamTypeH264, []byte{0, 0, 0, 1, 0x41, 0x9a}, false},
+		{StreamTypeH265, []byte{0, 0, 0, 1, 0x28, 0x01, 0xaf}, true},
+		{StreamTypeH265, []byte{0, 0, 0, 1, 0x02, 0x01, 0xd0}, false},
+		{StreamTypeG711A, []byte{0, 0, 1, 0x65}, false},
+	}
+	for _, c := range cases {
+		if got := IsKeyFrame(c.streamType, c.data); got != c.want {
+			t.Fatalf("%s % x: got %t", c.streamType, c.data, got)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package ps
+
+import "errors"
+
+// pesHeader is the optional PES header of ISO/IEC 13818-1 §2.4.3.7.
+type pesHeader struct {
+	hasPTS bool
+	hasDTS bool
+	pts    uint64
+	dts    uint64
+	length int // bytes of the PES packet preceding the payload
+}
+
+// parsePESHeader parses the header of a PES packet that starts at raw[0].
+func parsePESHeader(raw []byte) (*pesHeader, error) {
+	if len(raw) < 9 {
+		return nil, errors.New("pes header is truncated")
+	}
+	if raw[6]&0xc0 != 0x80 {
+		return nil, errors.New("pes header marker bits are invalid")
+	}
+	header := &pesHeader{length: 9 + int(raw[8])}
+	if len(raw) < header.length {
+		return nil, errors.New("pes header is truncated")
+	}
+	flags := raw[7] >> 6
+	if flags&0x02 != 0 {
+		if header.length < 14 {
+			return nil, errors.New("pes header is too short for the pts field")
+		}
+		header.hasPTS = true
+		header.pts = readTimestamp(raw[9:14])
+		header.dts = header.pts
+	}
+	if flags == 0x03 {
+		if header.length < 19 {
+			return nil, errors.New("pes header is too short for the dts field")
+		}
+		header.hasDTS = true
+		header.dts = readTimestamp(raw[14:19])
+	}
+	return header, nil
+}
+
+// readTimestamp decodes a 33-bit PTS/DTS from its 5-byte form.
+func readTimestamp(b []byte) uint64 {
+	return uint64(b[0]>>1&0x07)<<30 |
+		uint64(b[1])<<22 |
+		uint64(b[2]>>1)<<15 |
+		uint64(b[3])<<7 |
+		uint64(b[4]>>1)
+}
+
+// writeTimestamp encodes a 33-bit PTS/DTS with its 4-bit prefix.
+func writeTimestamp(b []byte, prefix uint8, timestamp uint64) {
+	b[0] = prefix<<4 | uint8(timestamp>>29)&0x0e | 0x01
+	b[1] = uint8(timestamp >> 22)
+	b[2] = uint8(timestamp>>14)&0xfe | 0x01
+	b[3] = uint8(timestamp >> 7)
+	b[4] = uint8(timestamp<<1) | 0x01
+}
+
+// crc32MPEG2 is the CRC of ISO/IEC 13818-1 Annex A used by the PSM.
+func crc32MPEG2(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
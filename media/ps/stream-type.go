@@ -0,0 +1,97 @@
+package ps
+
+import (
+	"fmt"
+
+	"github.com/kokutas/gb28181/media/codec"
+)
+
+// StreamType is the stream_type of a program stream map entry
+// (ISO/IEC 13818-1 Table 2-34, with the GB28181 audio extensions).
+type StreamType uint8
+
+const (
+	StreamTypeUnknown   StreamType = 0x00
+	StreamTypeMPEG4     StreamType = 0x10
+	StreamTypeH264      StreamType = 0x1b
+	StreamTypeH265      StreamType = 0x24
+	StreamTypeSVAC      StreamType = 0x80
+	StreamTypeAAC       StreamType = 0x0f
+	StreamTypeG711A     StreamType = 0x90
+	StreamTypeG711U     StreamType = 0x91
+	StreamTypeG7221     StreamType = 0x92
+	StreamTypeG7231     StreamType = 0x93
+	StreamTypeG729      StreamType = 0x99
+	StreamTypeSVACAudio StreamType = 0x9b
+)
+
+var streamTypeNames = map[StreamType]string{
+	StreamTypeMPEG4:     "MPEG-4",
+	StreamTypeH264:      "H.264",
+	StreamTypeH265:      "H.265",
+	StreamTypeSVAC:      "SVAC",
+	StreamTypeAAC:       "AAC",
+	StreamTypeG711A:     "G.711A",
+	StreamTypeG711U:     "G.711U",
+	StreamTypeG7221:     "G.722.1",
+	StreamTypeG7231:     "G.723.1",
+	StreamTypeG729:      "G.729",
+	StreamTypeSVACAudio: "SVAC Audio",
+}
+
+func (streamType StreamType) IsVideo() bool {
+	switch streamType {
+	case StreamTypeMPEG4, StreamTypeH264, StreamTypeH265, StreamTypeSVAC:
+		return true
+	}
+	return false
+}
+
+func (streamType StreamType) IsAudio() bool {
+	switch streamType {
+	case StreamTypeAAC, StreamTypeG711A, StreamTypeG711U, StreamTypeG7221, StreamTypeG7231, StreamTypeG729, StreamTypeSVACAudio:
+		return true
+	}
+	return false
+}
+
+// Codec returns the Annex B codec of a video stream type, or "" for
+// streams the codec package cannot parse.
+func (streamType StreamType) Codec() codec.Codec {
+	switch streamType {
+	case StreamTypeH264:
+		return codec.H264
+	case StreamTypeH265:
+		return codec.H265
+	}
+	return ""
+}
+
+func (streamType StreamType) String() string {
+	if name, ok := streamTypeNames[streamType]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", uint8(streamType))
+}
+
+// Stream ids of ISO/IEC 13818-1 Table 2-18 used by GB28181 senders.
+const (
+	StreamIDProgramEnd      uint8 = 0xb9
+	StreamIDPack            uint8 = 0xba
+	StreamIDSystemHeader    uint8 = 0xbb
+	StreamIDProgramMap      uint8 = 0xbc
+	StreamIDPrivate1        uint8 = 0xbd
+	StreamIDPadding         uint8 = 0xbe
+	StreamIDPrivate2        uint8 = 0xbf
+	StreamIDAudio           uint8 = 0xc0
+	StreamIDVideo           uint8 = 0xe0
+	StreamIDProgramDirector uint8 = 0xff
+)
+
+func isAudioStreamID(id uint8) bool {
+	return id >= 0xc0 && id <= 0xdf
+}
+
+func isVideoStreamID(id uint8) bool {
+	return id >= 0xe0 && id <= 0xef
+}
@@ -0,0 +1,62 @@
+package rtp
+
+// Frame is the payload of all packets sharing one RTP timestamp. For
+// GB28181 streams it carries one or more complete PS packs.
+type Frame struct {
+	PayloadType uint8
+	SSRC        uint32
+	Timestamp   uint32
+	Data        []byte
+	Incomplete  bool // a packet of the frame was lost
+}
+
+// Assembler joins in-order packets into frames. A frame ends on a packet with
+// the marker bit set, or when a packet with a different timestamp arrives.
+type Assembler struct {
+	current *Frame
+	lastSeq uint16
+	hasLast bool
+}
+
+func NewAssembler() *Assembler {
+	return new(Assembler)
+}
+
+// Push adds the next in-order packet and returns the completed frames.
+func (assembler *Assembler) Push(packet *Packet) []*Frame {
+	var result []*Frame
+	gap := assembler.hasLast && packet.GetSequenceNumber() != assembler.lastSeq+1
+	assembler.lastSeq = packet.GetSequenceNumber()
+	assembler.hasLast = true
+	if assembler.current != nil && (assembler.current.Timestamp != packet.GetTimestamp() || assembler.current.SSRC != packet.GetSSRC()) {
+		if gap {
+			// the tail of the previous frame or the head of this one was lost
+			assembler.current.Incomplete = true
+		}
+		result = append(result, assembler.current)
+		assembler.current = nil
+	}
+	if assembler.current == nil {
+		assembler.current = &Frame{
+			PayloadType: packet.GetPayloadType(),
+			SSRC:        packet.GetSSRC(),
+			Timestamp:   packet.GetTimestamp(),
+			Incomplete:  gap,
+		}
+	} else if gap {
+		assembler.current.Incomplete = true
+	}
+	assembler.current.Data = append(assembler.current.Data, packet.GetPayload()...)
+	if packet.GetMarker() {
+		result = append(result, assembler.current)
+		assembler.current = nil
+	}
+	return result
+}
+
+// Flush returns the frame being assembled, if any.
+func (assembler *Assembler) Flush() *Frame {
+	frame := assembler.current
+	assembler.current = nil
+	return frame
+}
@@ -0,0 +1,177 @@
+package rtp
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Forwarder relays the RTP packets it receives over UDP, or over RFC 4571
+// framed TCP connections, to a Sender. Packets are relayed one by one
+// without reordering; their SSRC is rewritten to the one of the sender's
+// packetizer, the payload type, sequence number and timestamp are kept.
+type Forwarder struct {
+	network string // udp / tcp
+	address string // listen address
+	sender  *Sender
+
+	mutex     sync.Mutex
+	forwarded uint64
+	invalid   uint64
+	failed    uint64
+
+	packetConn net.PacketConn
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+	closed     bool
+	wg         sync.WaitGroup
+}
+
+func NewForwarder(network, address string, sender *Sender) *Forwarder {
+	return &Forwarder{
+		network: strings.ToLower(network),
+		address: address,
+		sender:  sender,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+func (forwarder *Forwarder) GetNetwork() string {
+	return forwarder.network
+}
+func (forwarder *Forwarder) GetSender() *Sender {
+	return forwarder.sender
+}
+
+// Stats returns the number of packets relayed, packets that failed to
+// parse and packets the sender could not send, e.g. before a passive TCP
+// peer connected.
+func (forwarder *Forwarder) Stats() (forwarded, invalid, failed uint64) {
+	forwarder.mutex.Lock()
+	defer forwarder.mutex.Unlock()
+	return forwarder.forwarded, forwarder.invalid, forwarder.failed
+}
+
+// Listen binds the receiving socket and starts relaying in the background.
+func (forwarder *Forwarder) Listen() error {
+	switch forwarder.network {
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(forwarder.network, forwarder.address)
+		if err != nil {
+			return err
+		}
+		forwarder.packetConn = conn
+		forwarder.wg.Add(1)
+		go forwarder.readPackets(conn)
+	case "tcp", "tcp4", "tcp6":
+		listener, err := net.Listen(forwarder.network, forwarder.address)
+		if err != nil {
+			return err
+		}
+		forwarder.listener = listener
+		forwarder.wg.Add(1)
+		go forwarder.accept(listener)
+	default:
+		return fmt.Errorf("unsupported rtp network : %s", forwarder.network)
+	}
+	return nil
+}
+
+// Addr returns the bound receiving address, or nil before Listen.
+func (forwarder *Forwarder) Addr() net.Addr {
+	if forwarder.packetConn != nil {
+		return forwarder.packetConn.LocalAddr()
+	}
+	if forwarder.listener != nil {
+		return forwarder.listener.Addr()
+	}
+	return nil
+}
+
+// Close stops receiving and closes the sender.
+func (forwarder *Forwarder) Close() error {
+	forwarder.mutex.Lock()
+	forwarder.closed = true
+	var err error
+	if forwarder.packetConn != nil {
+		err = forwarder.packetConn.Close()
+	}
+	if forwarder.listener != nil {
+		err = forwarder.listener.Close()
+	}
+	for conn := range forwarder.conns {
+		_ = conn.Close()
+	}
+	forwarder.mutex.Unlock()
+	forwarder.wg.Wait()
+	if closeErr := forwarder.sender.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Feed relays one raw RTP packet.
+func (forwarder *Forwarder) Feed(raw []byte) {
+	packet := new(Packet)
+	if err := packet.Parse(raw); err != nil {
+		forwarder.mutex.Lock()
+		forwarder.invalid++
+		forwarder.mutex.Unlock()
+		return
+	}
+	packet.SetSSRC(forwarder.sender.GetPacketizer().GetSSRC())
+	err := forwarder.sender.WritePacket(packet)
+	forwarder.mutex.Lock()
+	defer forwarder.mutex.Unlock()
+	if err != nil {
+		forwarder.failed++
+		return
+	}
+	forwarder.forwarded++
+}
+
+func (forwarder *Forwarder) readPackets(conn net.PacketConn) {
+	defer forwarder.wg.Done()
+	buf := make([]byte, MaxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		forwarder.Feed(buf[:n])
+	}
+}
+
+func (forwarder *Forwarder) accept(listener net.Listener) {
+	defer forwarder.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		forwarder.mutex.Lock()
+		if forwarder.closed {
+			forwarder.mutex.Unlock()
+			_ = conn.Close()
+			return
+		}
+		forwarder.conns[conn] = struct{}{}
+		forwarder.mutex.Unlock()
+		forwarder.wg.Add(1)
+		go func() {
+			defer forwarder.wg.Done()
+			for {
+				raw, err := ReadFramed(conn)
+				if err != nil {
+					break
+				}
+				forwarder.Feed(raw)
+			}
+			forwarder.mutex.Lock()
+			delete(forwarder.conns, conn)
+			forwarder.mutex.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
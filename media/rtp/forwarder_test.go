@@ -0,0 +1,72 @@
+package rtp
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForwarder(t *testing.T) {
+	var mutex sync.Mutex
+	var frames []*Frame
+	receiver := NewReceiver("udp", "127.0.0.1:0", 16, func(frame *Frame) {
+		mutex.Lock()
+		frames = append(frames, frame)
+		mutex.Unlock()
+	})
+	if err := receiver.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	forwarder := NewForwarder("udp", "127.0.0.1:0", NewSender("udp", "", "", receiver.Addr().String(), NewPacketizer(96, 200, 0)))
+	if err := forwarder.GetSender().Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := forwarder.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer forwarder.Close()
+
+	conn, err := net.Dial("udp", forwarder.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		raw, _ := NewPacket(96, uint16(10+i), uint32(3600*i), 100, true, []byte{byte(i), 1, 2, 3}).Raw()
+		if _, err := conn.Write(raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.Write([]byte{1, 2})
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if forwarded, invalid, _ := forwarder.Stats(); forwarded == 3 && invalid == 1 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if forwarded, invalid, failed := forwarder.Stats(); forwarded != 3 || invalid != 1 || failed != 0 {
+		t.Fatalf("unexpected stats %d %d %d", forwarded, invalid, failed)
+	}
+	for time.Now().Before(deadline) {
+		mutex.Lock()
+		n := len(frames)
+		mutex.Unlock()
+		if n == 3 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames", len(frames))
+	}
+	for i, frame := range frames {
+		if frame.SSRC != 200 || frame.Timestamp != uint32(3600*i) || frame.Data[0] != byte(i) {
+			t.Fatalf("unexpected frame %d %+v", i, frame)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// MaxPacketSize is the largest packet accepted from a datagram or a
+// RFC 4571 frame.
+const MaxPacketSize = 65535
+
+// ReadFramed reads one RFC 4571 frame (a 2-byte big-endian length followed
+// by a packet) from reader. Recorded fixtures use the same layout.
+func ReadFramed(reader io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(reader, length[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint16(length[:])
+	if size == 0 {
+		return nil, errors.New("rtp frame length is zero")
+	}
+	raw := make([]byte, size)
+	if _, err := io.ReadFull(reader, raw); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return raw, nil
+}
+
+// WriteFramed writes raw as one RFC 4571 frame.
+func WriteFramed(writer io.Writer, raw []byte) error {
+	if len(raw) == 0 || len(raw) > MaxPacketSize {
+		return errors.New("rtp frame length is out of range")
+	}
+	buf := make([]byte, 2+len(raw))
+	binary.BigEndian.PutUint16(buf, uint16(len(raw)))
+	copy(buf[2:], raw)
+	_, err := writer.Write(buf)
+	return err
+}
@@ -0,0 +1,111 @@
+package rtp
+
+// JitterBuffer reorders packets by sequence number. Packets are held until
+// the gap in front of them is filled or the buffer holds more than capacity
+// packets, in which case the missing sequence numbers are counted as lost.
+type JitterBuffer struct {
+	capacity int                // maximum number of buffered packets
+	packets  map[uint16]*Packet // buffered packets by sequence number
+	next     uint16             // next expected sequence number
+	started  bool               // whether next is known
+	lost     uint64             // skipped sequence numbers
+	dropped  uint64             // late or duplicated packets
+}
+
+func NewJitterBuffer(capacity int) *JitterBuffer {
+	if capacity <= 0 {
+		capacity = 64
+	}
+	return &JitterBuffer{
+		capacity: capacity,
+		packets:  make(map[uint16]*Packet),
+	}
+}
+
+func (jitterBuffer *JitterBuffer) GetCapacity() int {
+	return jitterBuffer.capacity
+}
+func (jitterBuffer *JitterBuffer) GetLost() uint64 {
+	return jitterBuffer.lost
+}
+func (jitterBuffer *JitterBuffer) GetDropped() uint64 {
+	return jitterBuffer.dropped
+}
+func (jitterBuffer *JitterBuffer) Len() int {
+	return len(jitterBuffer.packets)
+}
+
+// Push adds a packet and returns the packets that are now ready, in order.
+func (jitterBuffer *JitterBuffer) Push(packet *Packet) []*Packet {
+	seq := packet.GetSequenceNumber()
+	if !jitterBuffer.started {
+		jitterBuffer.started = true
+		jitterBuffer.next = seq
+	}
+	if seqBefore(seq, jitterBuffer.next) {
+		jitterBuffer.dropped++
+		return nil
+	}
+	if _, ok := jitterBuffer.packets[seq]; ok {
+		jitterBuffer.dropped++
+		return nil
+	}
+	jitterBuffer.packets[seq] = packet
+	result := jitterBuffer.drain()
+	for len(jitterBuffer.packets) > jitterBuffer.capacity {
+		jitterBuffer.skip()
+		result = append(result, jitterBuffer.drain()...)
+	}
+	return result
+}
+
+// Flush returns every buffered packet in order, skipping any gaps.
+func (jitterBuffer *JitterBuffer) Flush() []*Packet {
+	result := make([]*Packet, 0, len(jitterBuffer.packets))
+	for len(jitterBuffer.packets) > 0 {
+		jitterBuffer.skip()
+		result = append(result, jitterBuffer.drain()...)
+	}
+	return result
+}
+
+// Reset forgets all state, e.g. after the SSRC of the stream changed.
+func (jitterBuffer *JitterBuffer) Reset() {
+	jitterBuffer.packets = make(map[uint16]*Packet)
+	jitterBuffer.started = false
+}
+
+func (jitterBuffer *JitterBuffer) drain() []*Packet {
+	var result []*Packet
+	for {
+		packet, ok := jitterBuffer.packets[jitterBuffer.next]
+		if !ok {
+			return result
+		}
+		delete(jitterBuffer.packets, jitterBuffer.next)
+		result = append(result, packet)
+		jitterBuffer.next++
+	}
+}
+
+// skip moves next forward to the oldest buffered packet.
+func (jitterBuffer *JitterBuffer) skip() {
+	first := true
+	var oldest uint16
+	for seq := range jitterBuffer.packets {
+		if first || seqBefore(seq, oldest) {
+			oldest = seq
+			first = false
+		}
+	}
+	if first {
+		return
+	}
+	jitterBuffer.lost += uint64(oldest - jitterBuffer.next)
+	jitterBuffer.next = oldest
+}
+
+// seqBefore reports whether a precedes b, allowing for wrap-around.
+func seqBefore(a, b uint16) bool {
+	return a != b && int16(a-b) < 0
+}
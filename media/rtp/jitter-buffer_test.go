@@ -0,0 +1,46 @@
+package rtp
+
+import "testing"
+
+func sequenceNumbers(packets []*Packet) []uint16 {
+	result := make([]uint16, 0, len(packets))
+	for _, packet := range packets {
+		result = append(result, packet.GetSequenceNumber())
+	}
+	return result
+}
+
+func TestJitterBuffer_Push(t *testing.T) {
+	jitterBuffer := NewJitterBuffer(4)
+	var out []uint16
+	for _, seq := range []uint16{65534, 0, 65535, 1, 1, 65533, 2} {
+		out = append(out, sequenceNumbers(jitterBuffer.Push(NewPacket(96, seq, 0, 1, false, nil)))...)
+	}
+	want := []uint16{65534, 65535, 0, 1, 2}
+	if len(out) != len(want) {
+		t.Fatalf("got %v, want %v", out, want)
+	}
+	for i := range want {
+		if out[i] != want[i] {
+			t.Fatalf("got %v, want %v", out, want)
+		}
+	}
+	if jitterBuffer.GetDropped() != 2 {
+		t.Fatalf("dropped %d, want 2", jitterBuffer.GetDropped())
+	}
+}
+
+func TestJitterBuffer_Loss(t *testing.T) {
+	jitterBuffer := NewJitterBuffer(2)
+	var out []uint16
+	for _, seq := range []uint16{10, 12, 13, 14} {
+		out = append(out, sequenceNumbers(jitterBuffer.Push(NewPacket(96, seq, 0, 1, false, nil)))...)
+	}
+	if len(out) != 4 || out[1] != 12 || jitterBuffer.GetLost() != 1 {
+		t.Fatalf("got %v lost %d", out, jitterBuffer.GetLost())
+	}
+	jitterBuffer.Push(NewPacket(96, 20, 0, 1, false, nil))
+	if out := sequenceNumbers(jitterBuffer.Flush()); len(out) != 1 || out[0] != 20 {
+		t.Fatalf("flush got %v", out)
+	}
+}
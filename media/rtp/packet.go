@@ -0,0 +1,189 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// HeaderLength is the length of the fixed RTP header (RFC 3550 §5.1).
+const HeaderLength = 12
+
+type Packet struct {
+	version        uint8    // version
+	padding        bool     // padding
+	extension      bool     // extension
+	marker         bool     // marker
+	payloadType    uint8    // payload type
+	sequenceNumber uint16   // sequence number
+	timestamp      uint32   // timestamp
+	ssrc           uint32   // synchronization source
+	csrc           []uint32 // contributing sources
+	payload        []byte   // payload
+}
+
+func (packet *Packet) SetVersion(version uint8) {
+	packet.version = version
+}
+func (packet *Packet) GetVersion() uint8 {
+	return packet.version
+}
+func (packet *Packet) SetPadding(padding bool) {
+	packet.padding = padding
+}
+func (packet *Packet) GetPadding() bool {
+	return packet.padding
+}
+func (packet *Packet) SetExtension(extension bool) {
+	packet.extension = extension
+}
+func (packet *Packet) GetExtension() bool {
+	return packet.extension
+}
+func (packet *Packet) SetMarker(marker bool) {
+	packet.marker = marker
+}
+func (packet *Packet) GetMarker() bool {
+	return packet.marker
+}
+func (packet *Packet) SetPayloadType(payloadType uint8) {
+	packet.payloadType = payloadType
+}
+func (packet *Packet) GetPayloadType() uint8 {
+	return packet.payloadType
+}
+func (packet *Packet) SetSequenceNumber(sequenceNumber uint16) {
+	packet.sequenceNumber = sequenceNumber
+}
+func (packet *Packet) GetSequenceNumber() uint16 {
+	return packet.sequenceNumber
+}
+func (packet *Packet) SetTimestamp(timestamp uint32) {
+	packet.timestamp = timestamp
+}
+func (packet *Packet) GetTimestamp() uint32 {
+	return packet.timestamp
+}
+func (packet *Packet) SetSSRC(ssrc uint32) {
+	packet.ssrc = ssrc
+}
+func (packet *Packet) GetSSRC() uint32 {
+	return packet.ssrc
+}
+func (packet *Packet) SetCSRC(csrc ...uint32) {
+	packet.csrc = csrc
+}
+func (packet *Packet) GetCSRC() []uint32 {
+	return packet.csrc
+}
+func (packet *Packet) SetPayload(payload []byte) {
+	packet.payload = payload
+}
+func (packet *Packet) GetPayload() []byte {
+	return packet.payload
+}
+
+func NewPacket(payloadType uint8, sequenceNumber uint16, timestamp uint32, ssrc uint32, marker bool, payload []byte) *Packet {
+	return &Packet{
+		version:        2,
+		marker:         marker,
+		payloadType:    payloadType,
+		sequenceNumber: sequenceNumber,
+		timestamp:      timestamp,
+		ssrc:           ssrc,
+		payload:        payload,
+	}
+}
+
+// Raw encodes the packet. Header extensions and padding are never emitted.
+func (packet *Packet) Raw() ([]byte, error) {
+	if err := packet.Validator(); err != nil {
+		return nil, err
+	}
+	result := make([]byte, HeaderLength+4*len(packet.csrc)+len(packet.payload))
+	result[0] = packet.version<<6 | uint8(len(packet.csrc))
+	result[1] = packet.payloadType & 0x7f
+	if packet.marker {
+		result[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(result[2:], packet.sequenceNumber)
+	binary.BigEndian.PutUint32(result[4:], packet.timestamp)
+	binary.BigEndian.PutUint32(result[8:], packet.ssrc)
+	offset := HeaderLength
+	for _, csrc := range packet.csrc {
+		binary.BigEndian.PutUint32(result[offset:], csrc)
+		offset += 4
+	}
+	copy(result[offset:], packet.payload)
+	return result, nil
+}
+
+// Parse decodes raw into the packet. The payload aliases raw.
+func (packet *Packet) Parse(raw []byte) error {
+	if reflect.DeepEqual(nil, packet) {
+		return errors.New("rtp packet caller is not allowed to be nil")
+	}
+	if len(raw) < HeaderLength {
+		return fmt.Errorf("the raw parameter is too short : %d bytes", len(raw))
+	}
+	packet.version = raw[0] >> 6
+	packet.padding = raw[0]&0x20 != 0
+	packet.extension = raw[0]&0x10 != 0
+	csrcCount := int(raw[0] & 0x0f)
+	packet.marker = raw[1]&0x80 != 0
+	packet.payloadType = raw[1] & 0x7f
+	packet.sequenceNumber = binary.BigEndian.Uint16(raw[2:])
+	packet.timestamp = binary.BigEndian.Uint32(raw[4:])
+	packet.ssrc = binary.BigEndian.Uint32(raw[8:])
+	offset := HeaderLength
+	if len(raw) < offset+4*csrcCount {
+		return errors.New("the csrc list exceeds the packet length")
+	}
+	packet.csrc = nil
+	for i := 0; i < csrcCount; i++ {
+		packet.csrc = append(packet.csrc, binary.BigEndian.Uint32(raw[offset:]))
+		offset += 4
+	}
+	if packet.extension {
+		if len(raw) < offset+4 {
+			return errors.New("the header extension exceeds the packet length")
+		}
+		extensionLength := 4 + 4*int(binary.BigEndian.Uint16(raw[offset+2:]))
+		if len(raw) < offset+extensionLength {
+			return errors.New("the header extension exceeds the packet length")
+		}
+		offset += extensionLength
+	}
+	end := len(raw)
+	if packet.padding {
+		paddingLength := int(raw[end-1])
+		if paddingLength == 0 || offset+paddingLength > end {
+			return errors.New("the padding length is invalid")
+		}
+		end -= paddingLength
+	}
+	packet.payload = raw[offset:end]
+	return packet.Validator()
+}
+
+func (packet *Packet) Validator() error {
+	if reflect.DeepEqual(nil, packet) {
+		return errors.New("rtp packet caller is not allowed to be nil")
+	}
+	if packet.version != 2 {
+		return errors.New("the value of the version field must be 2")
+	}
+	if packet.payloadType > 127 {
+		return errors.New("the value of the payload type field must be less than 128")
+	}
+	if len(packet.csrc) > 15 {
+		return errors.New("the csrc field allows at most 15 sources")
+	}
+	return nil
+}
+
+func (packet *Packet) String() string {
+	return fmt.Sprintf("RTP PT=%d SEQ=%d TS=%d SSRC=%d M=%t LEN=%d",
+		packet.payloadType, packet.sequenceNumber, packet.timestamp, packet.ssrc, packet.marker, len(packet.payload))
+}
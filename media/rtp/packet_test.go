@@ -0,0 +1,52 @@
+package rtp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPacket_Raw(t *testing.T) {
+	packet := NewPacket(96, 65535, 3600, 100000001, true, []byte{0x00, 0x00, 0x01, 0xba})
+	packet.SetCSRC(1, 2)
+	raw, err := packet.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != HeaderLength+8+4 || raw[0] != 0x82 || raw[1] != 0x80|96 {
+		t.Fatalf("unexpected header % x", raw[:2])
+	}
+	parsed := new(Packet)
+	if err := parsed.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.GetSequenceNumber() != 65535 || parsed.GetTimestamp() != 3600 || parsed.GetSSRC() != 100000001 ||
+		!parsed.GetMarker() || len(parsed.GetCSRC()) != 2 || !bytes.Equal(parsed.GetPayload(), packet.GetPayload()) {
+		t.Fatalf("round trip mismatch: %s", parsed)
+	}
+}
+
+func TestPacket_Parse(t *testing.T) {
+	// padding and a one-word header extension
+	raw := []byte{
+		0xb0, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+		0xbe, 0xde, 0x00, 0x01, 0x10, 0x20, 0x30, 0x40,
+		0xaa, 0xbb,
+		0x00, 0x00, 0x03,
+	}
+	packet := new(Packet)
+	if err := packet.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packet.GetPayload(), []byte{0xaa, 0xbb}) {
+		t.Fatalf("payload % x", packet.GetPayload())
+	}
+	for _, raw := range [][]byte{
+		{0x80, 0x60},
+		{0x40, 0x60, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0x81, 0x60, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	} {
+		if err := new(Packet).Parse(raw); err == nil {
+			t.Fatalf("% x: expected an error", raw)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package rtp
+
+import "math/rand"
+
+// DefaultPayloadSize keeps a packet with its IP/UDP headers within a 1500
+// byte Ethernet MTU.
+const DefaultPayloadSize = 1400
+
+// Packetizer splits frames into packets of one RTP stream. All packets of a
+// frame share its timestamp and the last one carries the marker bit.
+type Packetizer struct {
+	payloadType    uint8  // payload type
+	ssrc           uint32 // synchronization source
+	payloadSize    int    // maximum payload per packet
+	sequenceNumber uint16 // next sequence number
+}
+
+func NewPacketizer(payloadType uint8, ssrc uint32, payloadSize int) *Packetizer {
+	if payloadSize <= 0 {
+		payloadSize = DefaultPayloadSize
+	}
+	return &Packetizer{
+		payloadType:    payloadType,
+		ssrc:           ssrc,
+		payloadSize:    payloadSize,
+		sequenceNumber: uint16(rand.Intn(1 << 16)),
+	}
+}
+
+func (packetizer *Packetizer) GetPayloadType() uint8 {
+	return packetizer.payloadType
+}
+func (packetizer *Packetizer) GetSSRC() uint32 {
+	return packetizer.ssrc
+}
+func (packetizer *Packetizer) SetSequenceNumber(sequenceNumber uint16) {
+	packetizer.sequenceNumber = sequenceNumber
+}
+func (packetizer *Packetizer) GetSequenceNumber() uint16 {
+	return packetizer.sequenceNumber
+}
+
+// Packetize returns the packets carrying one frame.
+func (packetizer *Packetizer) Packetize(timestamp uint32, data []byte) []*Packet {
+	result := make([]*Packet, 0, len(data)/packetizer.payloadSize+1)
+	for len(data) > 0 {
+		n := len(data)
+		if n > packetizer.payloadSize {
+			n = packetizer.payloadSize
+		}
+		packet := NewPacket(packetizer.payloadType, packetizer.sequenceNumber, timestamp, packetizer.ssrc, n == len(data), data[:n])
+		packetizer.sequenceNumber++
+		result = append(result, packet)
+		data = data[n:]
+	}
+	return result
+}
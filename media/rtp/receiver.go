@@ -0,0 +1,231 @@
+package rtp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Receiver reads RTP from a UDP socket or from RFC 4571 framed TCP
+// connections, reorders it with a JitterBuffer and hands complete frames to
+// the handler. Frames are delivered from a single goroutine at a time.
+type Receiver struct {
+	network   string       // udp / tcp
+	address   string       // listen address
+	handler   func(*Frame) // frame handler
+	delivery  sync.Mutex   // serializes the handler calls, held outside mutex
+	mutex     sync.Mutex
+	jitter    *JitterBuffer
+	assembler *Assembler
+	ssrc      uint32
+	hasSSRC   bool
+	received  uint64
+	invalid   uint64
+
+	packetConn net.PacketConn
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+	closed     bool
+	wg         sync.WaitGroup
+}
+
+func NewReceiver(network, address string, capacity int, handler func(*Frame)) *Receiver {
+	return &Receiver{
+		network:   strings.ToLower(network),
+		address:   address,
+		handler:   handler,
+		jitter:    NewJitterBuffer(capacity),
+		assembler: NewAssembler(),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+func (receiver *Receiver) GetNetwork() string {
+	return receiver.network
+}
+func (receiver *Receiver) GetAddress() string {
+	return receiver.address
+}
+
+// Stats returns the number of accepted packets, packets that failed to
+// parse, sequence numbers skipped as lost and late or duplicated packets.
+func (receiver *Receiver) Stats() (received, invalid, lost, dropped uint64) {
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+	return receiver.received, receiver.invalid, receiver.jitter.GetLost(), receiver.jitter.GetDropped()
+}
+
+// Listen binds the socket and starts receiving in the background.
+func (receiver *Receiver) Listen() error {
+	switch receiver.network {
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(receiver.network, receiver.address)
+		if err != nil {
+			return err
+		}
+		receiver.packetConn = conn
+		receiver.wg.Add(1)
+		go receiver.readPackets(conn)
+	case "tcp", "tcp4", "tcp6":
+		listener, err := net.Listen(receiver.network, receiver.address)
+		if err != nil {
+			return err
+		}
+		receiver.listener = listener
+		receiver.wg.Add(1)
+		go receiver.accept(listener)
+	default:
+		return fmt.Errorf("unsupported rtp network : %s", receiver.network)
+	}
+	return nil
+}
+
+// Addr returns the bound local address, or nil before Listen.
+func (receiver *Receiver) Addr() net.Addr {
+	if receiver.packetConn != nil {
+		return receiver.packetConn.LocalAddr()
+	}
+	if receiver.listener != nil {
+		return receiver.listener.Addr()
+	}
+	return nil
+}
+
+// Close stops receiving, waits for the readers to exit and delivers what is
+// left in the jitter buffer.
+func (receiver *Receiver) Close() error {
+	receiver.mutex.Lock()
+	receiver.closed = true
+	var err error
+	if receiver.packetConn != nil {
+		err = receiver.packetConn.Close()
+	}
+	if receiver.listener != nil {
+		err = receiver.listener.Close()
+	}
+	for conn := range receiver.conns {
+		_ = conn.Close()
+	}
+	receiver.mutex.Unlock()
+	receiver.wg.Wait()
+	receiver.Flush()
+	return err
+}
+
+// ServeStream reads RFC 4571 framed packets from reader until it fails or
+// reaches EOF. It is used for TCP connections and for recorded fixtures.
+func (receiver *Receiver) ServeStream(reader io.Reader) error {
+	for {
+		raw, err := ReadFramed(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		receiver.Feed(raw)
+	}
+}
+
+// Feed processes one raw RTP packet. The handler runs without the receiver
+// lock held, so it may call Stats.
+func (receiver *Receiver) Feed(raw []byte) {
+	packet := new(Packet)
+	if err := packet.Parse(raw); err != nil {
+		receiver.mutex.Lock()
+		receiver.invalid++
+		receiver.mutex.Unlock()
+		return
+	}
+	receiver.delivery.Lock()
+	defer receiver.delivery.Unlock()
+	receiver.mutex.Lock()
+	receiver.received++
+	var frames []*Frame
+	if receiver.hasSSRC && receiver.ssrc != packet.GetSSRC() {
+		// the sender restarted the stream
+		frames = receiver.assemble(receiver.jitter.Flush())
+		receiver.jitter.Reset()
+	}
+	receiver.ssrc = packet.GetSSRC()
+	receiver.hasSSRC = true
+	frames = append(frames, receiver.assemble(receiver.jitter.Push(packet))...)
+	receiver.mutex.Unlock()
+	receiver.deliver(frames)
+}
+
+// Flush delivers every buffered packet and the frame being assembled.
+func (receiver *Receiver) Flush() {
+	receiver.delivery.Lock()
+	defer receiver.delivery.Unlock()
+	receiver.mutex.Lock()
+	frames := receiver.assemble(receiver.jitter.Flush())
+	if frame := receiver.assembler.Flush(); frame != nil {
+		frames = append(frames, frame)
+	}
+	receiver.mutex.Unlock()
+	receiver.deliver(frames)
+}
+
+// assemble returns the frames packets complete; the caller holds mutex.
+func (receiver *Receiver) assemble(packets []*Packet) []*Frame {
+	var frames []*Frame
+	for _, packet := range packets {
+		frames = append(frames, receiver.assembler.Push(packet)...)
+	}
+	return frames
+}
+
+// deliver hands frames to the handler; the caller holds delivery.
+func (receiver *Receiver) deliver(frames []*Frame) {
+	if receiver.handler == nil {
+		return
+	}
+	for _, frame := range frames {
+		receiver.handler(frame)
+	}
+}
+
+func (receiver *Receiver) readPackets(conn net.PacketConn) {
+	defer receiver.wg.Done()
+	buf := make([]byte, MaxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		raw := make([]byte, n)
+		copy(raw, buf[:n])
+		receiver.Feed(raw)
+	}
+}
+
+func (receiver *Receiver) accept(listener net.Listener) {
+	defer receiver.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		receiver.mutex.Lock()
+		if receiver.closed {
+			receiver.mutex.Unlock()
+			_ = conn.Close()
+			return
+		}
+		receiver.conns[conn] = struct{}{}
+		receiver.mutex.Unlock()
+		receiver.wg.Add(1)
+		go func() {
+			defer receiver.wg.Done()
+			_ = receiver.ServeStream(conn)
+			receiver.mutex.Lock()
+			delete(receiver.conns, conn)
+			receiver.mutex.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
@@ -0,0 +1,183 @@
+package rtp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/media/ps"
+)
+
+const fixture = "testdata/ps_h264_g711.rtp"
+
+type collector struct {
+	mutex  sync.Mutex
+	frames []*ps.Frame
+	lost   int
+}
+
+func (c *collector) handle(frame *Frame) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if frame.Incomplete {
+		c.lost++
+		return
+	}
+	demuxer := ps.NewDemuxer(func(f *ps.Frame) {
+		c.frames = append(c.frames, f)
+	})
+	_ = demuxer.Write(frame.Data)
+	_ = demuxer.Flush()
+}
+
+func (c *collector) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.frames)
+}
+
+func checkFrames(t *testing.T, c *collector) {
+	if c.lost != 0 {
+		t.Fatalf("%d incomplete frames", c.lost)
+	}
+	if len(c.frames) != 10 {
+		t.Fatalf("got %d elementary frames, want 10", len(c.frames))
+	}
+	for i, frame := range c.frames {
+		want := uint64(90000 + 3600*(i/2))
+		if frame.PTS != want {
+			t.Fatalf("frame %d pts %d, want %d", i, frame.PTS, want)
+		}
+	}
+}
+
+func TestReceiver_ServeStream(t *testing.T) {
+	raw, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := new(collector)
+	receiver := NewReceiver("tcp", "", 8, c.handle)
+	if err := receiver.ServeStream(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	receiver.Flush()
+	checkFrames(t, c)
+	received, invalid, lost, dropped := receiver.Stats()
+	if received != 20 || invalid != 0 || lost != 0 || dropped != 1 {
+		t.Fatalf("stats %d %d %d %d", received, invalid, lost, dropped)
+	}
+}
+
+func readFixture(t *testing.T) [][]byte {
+	raw, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bytes.NewReader(raw)
+	var packets [][]byte
+	for reader.Len() > 0 {
+		packet, err := ReadFramed(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+func waitFrames(c *collector, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for c.count() < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReceiver_ListenUDP(t *testing.T) {
+	c := new(collector)
+	receiver := NewReceiver("udp", "127.0.0.1:0", 8, c.handle)
+	if err := receiver.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("udp", receiver.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, packet := range readFixture(t) {
+		if _, err := conn.Write(packet); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	waitFrames(c, 10)
+	_ = receiver.Close()
+	checkFrames(t, c)
+}
+
+func TestReceiver_ListenTCP(t *testing.T) {
+	c := new(collector)
+	receiver := NewReceiver("tcp", "127.0.0.1:0", 8, c.handle)
+	if err := receiver.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", receiver.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, packet := range readFixture(t) {
+		if err := WriteFramed(conn, packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFrames(c, 10)
+	_ = conn.Close()
+	_ = receiver.Close()
+	checkFrames(t, c)
+}
+
+func TestReceiver_HandlerStats(t *testing.T) {
+	var receiver *Receiver
+	var active, overlapped, frames int32
+	receiver = NewReceiver("tcp", "", 8, func(frame *Frame) {
+		if atomic.AddInt32(&active, 1) > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		// the handler may read the stats of its receiver
+		if received, _, _, _ := receiver.Stats(); received == 0 {
+			t.Error("no packet counted before a frame")
+		}
+		atomic.AddInt32(&frames, 1)
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&active, -1)
+	})
+	packets := readFixture(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for half := 0; half < 2; half++ {
+			wg.Add(1)
+			go func(packets [][]byte) {
+				defer wg.Done()
+				for _, packet := range packets {
+					receiver.Feed(packet)
+				}
+			}(packets[half*len(packets)/2 : (half+1)*len(packets)/2])
+		}
+		wg.Wait()
+		receiver.Flush()
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a handler calling Stats deadlocked the receiver")
+	}
+	if atomic.LoadInt32(&frames) == 0 || atomic.LoadInt32(&overlapped) != 0 {
+		t.Fatalf("%d frames, overlapping handler calls %d", frames, overlapped)
+	}
+}
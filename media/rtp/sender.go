@@ -0,0 +1,230 @@
+package rtp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kokutas/gb28181/media/sdp"
+)
+
+// ErrNotConnected is returned by a passive TCP sender before the peer
+// connected. Frames written meanwhile are dropped.
+var ErrNotConnected = errors.New("rtp sender is not connected")
+
+// Sender packetizes frames and sends them over UDP, over TCP it connects
+// itself (setup active), or over TCP the peer connects to (setup passive).
+// TCP packets use RFC 4571 framing.
+type Sender struct {
+	network       string // udp / tcp
+	setup         string // active / passive, tcp only
+	localAddress  string // local address, the listen address for passive
+	remoteAddress string // remote address, unused for passive
+	packetizer    *Packetizer
+
+	mutex    sync.Mutex
+	conn     net.Conn
+	listener net.Listener
+	closed   bool
+	sent     uint64
+}
+
+func NewSender(network, setup, localAddress, remoteAddress string, packetizer *Packetizer) *Sender {
+	return &Sender{
+		network:       strings.ToLower(network),
+		setup:         strings.ToLower(setup),
+		localAddress:  localAddress,
+		remoteAddress: remoteAddress,
+		packetizer:    packetizer,
+	}
+}
+
+// NewSenderForOffer builds the sender answering an SDP offer: media goes to
+// the offered connection address and port, over TCP it takes the opposite
+// setup role, and the SSRC comes from the y= line.
+func NewSenderForOffer(offer *sdp.Session, media *sdp.Media, localAddress string, payloadType uint8) (*Sender, error) {
+	connection := offer.GetMediaConnection(media)
+	if connection == nil {
+		return nil, errors.New("the sdp offer has no connection address")
+	}
+	ssrc, err := offer.GetSSRCValue()
+	if err != nil {
+		return nil, err
+	}
+	remoteAddress := net.JoinHostPort(connection.Address, strconv.Itoa(int(media.GetPort())))
+	packetizer := NewPacketizer(payloadType, ssrc, DefaultPayloadSize)
+	if !media.IsTCP() {
+		return NewSender("udp", "", localAddress, remoteAddress, packetizer), nil
+	}
+	setup := sdp.SetupActive
+	if media.GetSetup() == sdp.SetupActive {
+		setup = sdp.SetupPassive
+	}
+	return NewSender("tcp", setup, localAddress, remoteAddress, packetizer), nil
+}
+
+func (sender *Sender) GetNetwork() string {
+	return sender.network
+}
+func (sender *Sender) GetSetup() string {
+	return sender.setup
+}
+func (sender *Sender) GetPacketizer() *Packetizer {
+	return sender.packetizer
+}
+
+// GetSent returns the number of packets sent.
+func (sender *Sender) GetSent() uint64 {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	return sender.sent
+}
+
+// Start opens the socket. A passive sender listens and accepts the first
+// connection in the background.
+func (sender *Sender) Start() error {
+	var local net.Addr
+	var err error
+	switch {
+	case sender.network == "udp":
+		if len(sender.localAddress) > 0 {
+			if local, err = net.ResolveUDPAddr("udp", sender.localAddress); err != nil {
+				return err
+			}
+		}
+		dialer := &net.Dialer{LocalAddr: local}
+		conn, err := dialer.Dial("udp", sender.remoteAddress)
+		if err != nil {
+			return err
+		}
+		sender.setConn(conn)
+	case sender.network == "tcp" && sender.setup == sdp.SetupActive:
+		if len(sender.localAddress) > 0 {
+			if local, err = net.ResolveTCPAddr("tcp", sender.localAddress); err != nil {
+				return err
+			}
+		}
+		dialer := &net.Dialer{LocalAddr: local}
+		conn, err := dialer.Dial("tcp", sender.remoteAddress)
+		if err != nil {
+			return err
+		}
+		sender.setConn(conn)
+	case sender.network == "tcp" && sender.setup == sdp.SetupPassive:
+		listener, err := net.Listen("tcp", sender.localAddress)
+		if err != nil {
+			return err
+		}
+		sender.mutex.Lock()
+		sender.listener = listener
+		sender.mutex.Unlock()
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = listener.Close()
+			sender.setConn(conn)
+		}()
+	default:
+		return fmt.Errorf("unsupported rtp transport : %s %s", sender.network, sender.setup)
+	}
+	return nil
+}
+
+func (sender *Sender) setConn(conn net.Conn) {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	if sender.closed {
+		_ = conn.Close()
+		return
+	}
+	sender.conn = conn
+}
+
+// LocalAddr returns the bound address; for a passive sender it is the
+// address to announce in the SDP answer.
+func (sender *Sender) LocalAddr() net.Addr {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	if sender.listener != nil {
+		return sender.listener.Addr()
+	}
+	if sender.conn != nil {
+		return sender.conn.LocalAddr()
+	}
+	return nil
+}
+
+// Connected reports whether frames can be sent.
+func (sender *Sender) Connected() bool {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	return sender.conn != nil
+}
+
+// WriteFrame sends one frame with a 90 kHz timestamp.
+func (sender *Sender) WriteFrame(timestamp uint32, data []byte) error {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	if sender.closed {
+		return errors.New("rtp sender is closed")
+	}
+	if sender.conn == nil {
+		return ErrNotConnected
+	}
+	for _, packet := range sender.packetizer.Packetize(timestamp, data) {
+		if err := sender.write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePacket sends a packet as it is, e.g. one relayed from another
+// stream.
+func (sender *Sender) WritePacket(packet *Packet) error {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	if sender.closed {
+		return errors.New("rtp sender is closed")
+	}
+	if sender.conn == nil {
+		return ErrNotConnected
+	}
+	return sender.write(packet)
+}
+
+func (sender *Sender) write(packet *Packet) error {
+	raw, err := packet.Raw()
+	if err != nil {
+		return err
+	}
+	if sender.network == "tcp" {
+		err = WriteFramed(sender.conn, raw)
+	} else {
+		_, err = sender.conn.Write(raw)
+	}
+	if err != nil {
+		return err
+	}
+	sender.sent++
+	return nil
+}
+
+func (sender *Sender) Close() error {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	sender.closed = true
+	var err error
+	if sender.listener != nil {
+		_ = sender.listener.Close()
+	}
+	if sender.conn != nil {
+		err = sender.conn.Close()
+	}
+	return err
+}
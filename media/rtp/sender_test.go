@@ -0,0 +1,152 @@
+package rtp
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/media/ps"
+	"github.com/kokutas/gb28181/media/sdp"
+)
+
+func TestPacketizer_Packetize(t *testing.T) {
+	packetizer := NewPacketizer(96, 7, 100)
+	packetizer.SetSequenceNumber(65535)
+	packets := packetizer.Packetize(3600, bytes.Repeat([]byte{1}, 250))
+	if len(packets) != 3 {
+		t.Fatalf("got %d packets, want 3", len(packets))
+	}
+	if packets[0].GetSequenceNumber() != 65535 || packets[1].GetSequenceNumber() != 0 {
+		t.Fatal("sequence numbers do not wrap")
+	}
+	if packets[0].GetMarker() || !packets[2].GetMarker() || len(packets[2].GetPayload()) != 50 {
+		t.Fatal("only the last packet carries the marker")
+	}
+}
+
+// loopback muxes a few PS frames, sends them and checks what the receiver
+// demuxes.
+func loopback(t *testing.T, sender *Sender, receiver *Receiver, frames *[]*ps.Frame, mutex *sync.Mutex) {
+	muxer := ps.NewMuxer()
+	video, _ := muxer.AddStream(ps.StreamTypeH264)
+	deadline := time.Now().Add(2 * time.Second)
+	for !sender.Connected() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		pts := uint64(3600 * i)
+		au := append([]byte{0, 0, 0, 1, 0x65}, bytes.Repeat([]byte{byte(i + 1)}, 3000)...)
+		pack, err := muxer.Mux(video, pts, pts, au)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sender.WriteFrame(uint32(pts), pack); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for time.Now().Before(deadline) {
+		mutex.Lock()
+		n := len(*frames)
+		mutex.Unlock()
+		if n == 5 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	_ = sender.Close()
+	_ = receiver.Close()
+	if len(*frames) != 5 {
+		t.Fatalf("got %d frames, want 5", len(*frames))
+	}
+	for i, frame := range *frames {
+		if frame.PTS != uint64(3600*i) || frame.StreamType != ps.StreamTypeH264 || len(frame.Data) != 3005 {
+			t.Fatalf("frame %d: pts %d type %s len %d", i, frame.PTS, frame.StreamType, len(frame.Data))
+		}
+	}
+	if sender.GetSent() < 10 {
+		t.Fatalf("sent %d packets", sender.GetSent())
+	}
+}
+
+func newDemuxingReceiver(network, address string) (*Receiver, *[]*ps.Frame, *sync.Mutex) {
+	var mutex sync.Mutex
+	frames := make([]*ps.Frame, 0)
+	demuxer := ps.NewDemuxer(func(frame *ps.Frame) {
+		mutex.Lock()
+		frames = append(frames, frame)
+		mutex.Unlock()
+	})
+	receiver := NewReceiver(network, address, 16, func(frame *Frame) {
+		_ = demuxer.Write(frame.Data)
+		_ = demuxer.Flush()
+	})
+	return receiver, &frames, &mutex
+}
+
+func TestSender_UDP(t *testing.T) {
+	receiver, frames, mutex := newDemuxingReceiver("udp", "127.0.0.1:0")
+	if err := receiver.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	sender := NewSender("udp", "", "", receiver.Addr().String(), NewPacketizer(96, 1, 0))
+	if err := sender.Start(); err != nil {
+		t.Fatal(err)
+	}
+	loopback(t, sender, receiver, frames, mutex)
+}
+
+func TestSender_TCPActive(t *testing.T) {
+	receiver, frames, mutex := newDemuxingReceiver("tcp", "127.0.0.1:0")
+	if err := receiver.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	sender := NewSender("tcp", sdp.SetupActive, "", receiver.Addr().String(), NewPacketizer(96, 1, 0))
+	if err := sender.Start(); err != nil {
+		t.Fatal(err)
+	}
+	loopback(t, sender, receiver, frames, mutex)
+}
+
+func TestSender_TCPPassive(t *testing.T) {
+	sender := NewSender("tcp", sdp.SetupPassive, "127.0.0.1:0", "", NewPacketizer(96, 1, 0))
+	if err := sender.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.WriteFrame(0, []byte{1}); err != ErrNotConnected {
+		t.Fatalf("got %v, want ErrNotConnected", err)
+	}
+	receiver, frames, mutex := newDemuxingReceiver("tcp", "")
+	conn, err := net.Dial("tcp", sender.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = receiver.ServeStream(conn)
+	}()
+	loopback(t, sender, receiver, frames, mutex)
+	_ = conn.Close()
+}
+
+func TestNewSenderForOffer(t *testing.T) {
+	media := sdp.NewMedia("video", 30000, sdp.ProtoTCP, "96")
+	media.AddAttribute("setup", sdp.SetupPassive)
+	offer := sdp.NewSession(sdp.NewOrigin("34020000002000000001", "10.0.0.1"), "Play", sdp.NewConnection("10.0.0.1"), "0100000002", media)
+	sender, err := NewSenderForOffer(offer, media, "", 96)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender.GetNetwork() != "tcp" || sender.GetSetup() != sdp.SetupActive || sender.GetPacketizer().GetSSRC() != 100000002 {
+		t.Fatalf("unexpected sender %s %s %d", sender.GetNetwork(), sender.GetSetup(), sender.GetPacketizer().GetSSRC())
+	}
+	if sender.remoteAddress != net.JoinHostPort("10.0.0.1", strconv.Itoa(30000)) {
+		t.Fatalf("remote address %s", sender.remoteAddress)
+	}
+	media.SetProto(sdp.ProtoUDP)
+	if sender, err = NewSenderForOffer(offer, media, "", 96); err != nil || sender.GetNetwork() != "udp" {
+		t.Fatal(fmt.Sprint("udp offer: ", err))
+	}
+}
@@ -0,0 +1,474 @@
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the Content-Type of SDP bodies.
+const ContentType = "application/sdp"
+
+// Setup roles of the a=setup attribute (RFC 4145) used by GB28181 for
+// TCP media.
+const (
+	SetupActive  = "active"
+	SetupPassive = "passive"
+)
+
+// Transport protocols of the m= line.
+const (
+	ProtoUDP = "RTP/AVP"
+	ProtoTCP = "TCP/RTP/AVP"
+)
+
+// Session is a session description (RFC 4566) with the GB28181 y= (SSRC)
+// and f= (media format) lines.
+type Session struct {
+	version     int          // v=
+	origin      *Origin      // o=
+	sessionName string       // s=
+	uri         string       // u=
+	connection  *Connection  // c=
+	startTime   uint64       // t= start
+	stopTime    uint64       // t= stop
+	attributes  []*Attribute // session level a=
+	media       []*Media     // m= sections
+	ssrc        string       // y=
+	format      string       // f=
+}
+
+type Origin struct {
+	Username       string
+	SessionID      string
+	SessionVersion string
+	NetType        string
+	AddrType       string
+	Address        string
+}
+
+type Connection struct {
+	NetType  string
+	AddrType string
+	Address  string
+}
+
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+type Media struct {
+	mediaType  string       // video / audio
+	port       uint16       // port
+	proto      string       // RTP/AVP / TCP/RTP/AVP
+	formats    []string     // payload types
+	connection *Connection  // media level c=
+	attributes []*Attribute // media level a=
+}
+
+func (session *Session) SetVersion(version int) {
+	session.version = version
+}
+func (session *Session) GetVersion() int {
+	return session.version
+}
+func (session *Session) SetOrigin(origin *Origin) {
+	session.origin = origin
+}
+func (session *Session) GetOrigin() *Origin {
+	return session.origin
+}
+func (session *Session) SetSessionName(sessionName string) {
+	session.sessionName = sessionName
+}
+func (session *Session) GetSessionName() string {
+	return session.sessionName
+}
+func (session *Session) SetUri(uri string) {
+	session.uri = uri
+}
+func (session *Session) GetUri() string {
+	return session.uri
+}
+func (session *Session) SetConnection(connection *Connection) {
+	session.connection = connection
+}
+func (session *Session) GetConnection() *Connection {
+	return session.connection
+}
+func (session *Session) SetTime(startTime, stopTime uint64) {
+	session.startTime = startTime
+	session.stopTime = stopTime
+}
+func (session *Session) GetTime() (uint64, uint64) {
+	return session.startTime, session.stopTime
+}
+func (session *Session) SetAttributes(attributes ...*Attribute) {
+	session.attributes = attributes
+}
+func (session *Session) GetAttributes() []*Attribute {
+	return session.attributes
+}
+func (session *Session) SetMedia(media ...*Media) {
+	session.media = media
+}
+func (session *Session) GetMedia() []*Media {
+	return session.media
+}
+func (session *Session) SetSSRC(ssrc string) {
+	session.ssrc = ssrc
+}
+func (session *Session) GetSSRC() string {
+	return session.ssrc
+}
+func (session *Session) SetFormat(format string) {
+	session.format = format
+}
+func (session *Session) GetFormat() string {
+	return session.format
+}
+
+func NewSession(origin *Origin, sessionName string, connection *Connection, ssrc string, media ...*Media) *Session {
+	return &Session{
+		origin:      origin,
+		sessionName: sessionName,
+		connection:  connection,
+		ssrc:        ssrc,
+		media:       media,
+	}
+}
+
+func NewOrigin(username, address string) *Origin {
+	return &Origin{
+		Username:       username,
+		SessionID:      "0",
+		SessionVersion: "0",
+		NetType:        "IN",
+		AddrType:       addrType(address),
+		Address:        address,
+	}
+}
+
+func NewConnection(address string) *Connection {
+	return &Connection{
+		NetType:  "IN",
+		AddrType: addrType(address),
+		Address:  address,
+	}
+}
+
+func addrType(address string) string {
+	if strings.Contains(address, ":") {
+		return "IP6"
+	}
+	return "IP4"
+}
+
+func (media *Media) SetMediaType(mediaType string) {
+	media.mediaType = mediaType
+}
+func (media *Media) GetMediaType() string {
+	return media.mediaType
+}
+func (media *Media) SetPort(port uint16) {
+	media.port = port
+}
+func (media *Media) GetPort() uint16 {
+	return media.port
+}
+func (media *Media) SetProto(proto string) {
+	media.proto = proto
+}
+func (media *Media) GetProto() string {
+	return media.proto
+}
+func (media *Media) SetFormats(formats ...string) {
+	media.formats = formats
+}
+func (media *Media) GetFormats() []string {
+	return media.formats
+}
+func (media *Media) SetConnection(connection *Connection) {
+	media.connection = connection
+}
+func (media *Media) GetConnection() *Connection {
+	return media.connection
+}
+func (media *Media) SetAttributes(attributes ...*Attribute) {
+	media.attributes = attributes
+}
+func (media *Media) GetAttributes() []*Attribute {
+	return media.attributes
+}
+
+func NewMedia(mediaType string, port uint16, proto string, formats ...string) *Media {
+	return &Media{
+		mediaType: mediaType,
+		port:      port,
+		proto:     proto,
+		formats:   formats,
+	}
+}
+
+// AddAttribute appends a=name:value, or a=name when value is empty.
+func (media *Media) AddAttribute(name, value string) {
+	media.attributes = append(media.attributes, &Attribute{Name: name, Value: value})
+}
+
+// GetAttribute returns the value of the first attribute called name.
+func (media *Media) GetAttribute(name string) (string, bool) {
+	for _, attribute := range media.attributes {
+		if strings.EqualFold(attribute.Name, name) {
+			return attribute.Value, true
+		}
+	}
+	return "", false
+}
+
+// IsTCP reports whether the media is carried over RFC 4571 framed TCP.
+func (media *Media) IsTCP() bool {
+	return strings.HasPrefix(strings.ToUpper(media.proto), "TCP/")
+}
+
+// GetSetup returns the a=setup role, active when absent as in RFC 4145.
+func (media *Media) GetSetup() string {
+	if setup, ok := media.GetAttribute("setup"); ok {
+		return strings.ToLower(setup)
+	}
+	return SetupActive
+}
+
+// GetDirection returns sendrecv, sendonly, recvonly or inactive.
+func (media *Media) GetDirection() string {
+	for _, attribute := range media.attributes {
+		switch strings.ToLower(attribute.Name) {
+		case "sendrecv", "sendonly", "recvonly", "inactive":
+			return strings.ToLower(attribute.Name)
+		}
+	}
+	return "sendrecv"
+}
+
+// GetRtpmap returns the encoding name and clock rate of a payload type.
+func (media *Media) GetRtpmap(payloadType string) (string, int, bool) {
+	for _, attribute := range media.attributes {
+		if !strings.EqualFold(attribute.Name, "rtpmap") {
+			continue
+		}
+		fields := strings.Fields(attribute.Value)
+		if len(fields) != 2 || fields[0] != payloadType {
+			continue
+		}
+		encoding := strings.SplitN(fields[1], "/", 3)
+		rate := 0
+		if len(encoding) > 1 {
+			rate, _ = strconv.Atoi(encoding[1])
+		}
+		return encoding[0], rate, true
+	}
+	return "", 0, false
+}
+
+// GetMediaConnection returns the address media should be sent to, taken
+// from the media level c= line or the session level one.
+func (session *Session) GetMediaConnection(media *Media) *Connection {
+	if media.connection != nil {
+		return media.connection
+	}
+	return session.connection
+}
+
+// GetSSRCValue returns the y= line as a number. GB28181 writes it as ten
+// decimal digits.
+func (session *Session) GetSSRCValue() (uint32, error) {
+	if len(strings.TrimSpace(session.ssrc)) == 0 {
+		return 0, errors.New("the ssrc field is empty")
+	}
+	ssrc, err := strconv.ParseUint(strings.TrimSpace(session.ssrc), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("the ssrc field is invalid : %s", err.Error())
+	}
+	return uint32(ssrc), nil
+}
+
+func (session *Session) Raw() (string, error) {
+	result := ""
+	if err := session.Validator(); err != nil {
+		return result, err
+	}
+	result += fmt.Sprintf("v=%d\r\n", session.version)
+	result += fmt.Sprintf("o=%s %s %s %s %s %s\r\n", session.origin.Username, session.origin.SessionID, session.origin.SessionVersion,
+		session.origin.NetType, session.origin.AddrType, session.origin.Address)
+	result += fmt.Sprintf("s=%s\r\n", session.sessionName)
+	if len(strings.TrimSpace(session.uri)) > 0 {
+		result += fmt.Sprintf("u=%s\r\n", session.uri)
+	}
+	if session.connection != nil {
+		result += fmt.Sprintf("c=%s\r\n", session.connection.String())
+	}
+	result += fmt.Sprintf("t=%d %d\r\n", session.startTime, session.stopTime)
+	for _, attribute := range session.attributes {
+		result += fmt.Sprintf("a=%s\r\n", attribute.String())
+	}
+	for _, media := range session.media {
+		result += fmt.Sprintf("m=%s %d %s %s\r\n", media.mediaType, media.port, media.proto, strings.Join(media.formats, " "))
+		if media.connection != nil {
+			result += fmt.Sprintf("c=%s\r\n", media.connection.String())
+		}
+		for _, attribute := range media.attributes {
+			result += fmt.Sprintf("a=%s\r\n", attribute.String())
+		}
+	}
+	if len(strings.TrimSpace(session.ssrc)) > 0 {
+		result += fmt.Sprintf("y=%s\r\n", session.ssrc)
+	}
+	if len(strings.TrimSpace(session.format)) > 0 {
+		result += fmt.Sprintf("f=%s\r\n", session.format)
+	}
+	return result, nil
+}
+
+func (session *Session) Parse(raw string) error {
+	if reflect.DeepEqual(nil, session) {
+		return errors.New("sdp session caller is not allowed to be nil")
+	}
+	if len(strings.TrimSpace(raw)) == 0 {
+		return errors.New("the raw parameter is not allowed to be empty")
+	}
+	var media *Media
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return fmt.Errorf("invalid sdp line : %s", line)
+		}
+		value := line[2:]
+		switch line[0] {
+		case 'v':
+			version, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("invalid sdp version : %s", value)
+			}
+			session.version = version
+		case 'o':
+			fields := strings.Fields(value)
+			if len(fields) != 6 {
+				return fmt.Errorf("invalid sdp origin : %s", value)
+			}
+			session.origin = &Origin{fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]}
+		case 's':
+			session.sessionName = value
+		case 'u':
+			session.uri = value
+		case 'c':
+			fields := strings.Fields(value)
+			if len(fields) != 3 {
+				return fmt.Errorf("invalid sdp connection : %s", value)
+			}
+			// strip a multicast ttl/number suffix
+			connection := &Connection{fields[0], fields[1], strings.SplitN(fields[2], "/", 2)[0]}
+			if media != nil {
+				media.connection = connection
+			} else {
+				session.connection = connection
+			}
+		case 't':
+			fields := strings.Fields(value)
+			if len(fields) != 2 {
+				return fmt.Errorf("invalid sdp timing : %s", value)
+			}
+			start, err := strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid sdp timing : %s", value)
+			}
+			stop, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid sdp timing : %s", value)
+			}
+			session.startTime, session.stopTime = start, stop
+		case 'm':
+			fields := strings.Fields(value)
+			if len(fields) < 3 {
+				return fmt.Errorf("invalid sdp media : %s", value)
+			}
+			port, err := strconv.ParseUint(strings.SplitN(fields[1], "/", 2)[0], 10, 16)
+			if err != nil {
+				return fmt.Errorf("invalid sdp media port : %s", value)
+			}
+			media = NewMedia(fields[0], uint16(port), fields[2], fields[3:]...)
+			session.media = append(session.media, media)
+		case 'a':
+			attribute := parseAttribute(value)
+			if media != nil {
+				media.attributes = append(media.attributes, attribute)
+			} else {
+				session.attributes = append(session.attributes, attribute)
+			}
+		case 'y':
+			session.ssrc = strings.TrimSpace(value)
+		case 'f':
+			session.format = strings.TrimSpace(value)
+		}
+		// other lines (i=, e=, p=, b=, k=...) are ignored
+	}
+	return session.Validator()
+}
+
+func parseAttribute(value string) *Attribute {
+	index := strings.Index(value, ":")
+	if index < 0 {
+		return &Attribute{Name: value}
+	}
+	return &Attribute{Name: value[:index], Value: value[index+1:]}
+}
+
+func (session *Session) Validator() error {
+	if reflect.DeepEqual(nil, session) {
+		return errors.New("sdp session caller is not allowed to be nil")
+	}
+	if session.version != 0 {
+		return errors.New("the value of the version field must be 0")
+	}
+	if session.origin == nil {
+		return errors.New("the origin field is not allowed to be nil")
+	}
+	if len(strings.TrimSpace(session.sessionName)) == 0 {
+		return errors.New("the session name field is not allowed to be empty")
+	}
+	for _, media := range session.media {
+		if len(strings.TrimSpace(media.mediaType)) == 0 {
+			return errors.New("the media type field is not allowed to be empty")
+		}
+		if len(strings.TrimSpace(media.proto)) == 0 {
+			return errors.New("the media proto field is not allowed to be empty")
+		}
+		if session.GetMediaConnection(media) == nil {
+			return fmt.Errorf("the %s media has no connection", media.mediaType)
+		}
+	}
+	return nil
+}
+
+func (session *Session) String() string {
+	result, err := session.Raw()
+	if err != nil {
+		return ""
+	}
+	return result
+}
+
+func (connection *Connection) String() string {
+	return fmt.Sprintf("%s %s %s", connection.NetType, connection.AddrType, connection.Address)
+}
+
+func (attribute *Attribute) String() string {
+	if len(attribute.Value) == 0 {
+		return attribute.Name
+	}
+	return fmt.Sprintf("%s:%s", attribute.Name, attribute.Value)
+}
@@ -0,0 +1,76 @@
+package sdp
+
+import (
+	"strings"
+	"testing"
+)
+
+const offer = "v=0\r\n" +
+	"o=34020000002000000001 0 0 IN IP4 192.168.1.10\r\n" +
+	"s=Play\r\n" +
+	"c=IN IP4 192.168.1.10\r\n" +
+	"t=0 0\r\n" +
+	"m=video 30000 TCP/RTP/AVP 96 98 97\r\n" +
+	"a=recvonly\r\n" +
+	"a=rtpmap:96 PS/90000\r\n" +
+	"a=rtpmap:98 H264/90000\r\n" +
+	"a=rtpmap:97 MPEG4/90000\r\n" +
+	"a=setup:passive\r\n" +
+	"a=connection:new\r\n" +
+	"y=0100000001\r\n" +
+	"f=v/2/5///a///\r\n"
+
+func TestSession_Parse(t *testing.T) {
+	session := new(Session)
+	if err := session.Parse(offer); err != nil {
+		t.Fatal(err)
+	}
+	if session.GetSessionName() != "Play" || session.GetOrigin().Username != "34020000002000000001" {
+		t.Fatalf("unexpected session header %+v", session.GetOrigin())
+	}
+	media := session.GetMedia()
+	if len(media) != 1 || media[0].GetPort() != 30000 || !media[0].IsTCP() || len(media[0].GetFormats()) != 3 {
+		t.Fatalf("unexpected media %+v", media)
+	}
+	if media[0].GetSetup() != SetupPassive || media[0].GetDirection() != "recvonly" {
+		t.Fatalf("setup %s direction %s", media[0].GetSetup(), media[0].GetDirection())
+	}
+	if encoding, rate, ok := media[0].GetRtpmap("96"); !ok || encoding != "PS" || rate != 90000 {
+		t.Fatalf("rtpmap 96: %s %d %t", encoding, rate, ok)
+	}
+	if ssrc, err := session.GetSSRCValue(); err != nil || ssrc != 100000001 {
+		t.Fatalf("ssrc %d %v", ssrc, err)
+	}
+	if session.GetFormat() != "v/2/5///a///" {
+		t.Fatalf("format %s", session.GetFormat())
+	}
+	raw, err := session.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != offer {
+		t.Fatalf("round trip mismatch:\n%s", raw)
+	}
+}
+
+func TestSession_Raw(t *testing.T) {
+	media := NewMedia("video", 6000, ProtoUDP, "96")
+	media.AddAttribute("sendonly", "")
+	media.AddAttribute("rtpmap", "96 PS/90000")
+	session := NewSession(NewOrigin("34020000001320000001", "10.0.0.2"), "Play", NewConnection("10.0.0.2"), "0100000001", media)
+	raw, err := session.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"m=video 6000 RTP/AVP 96\r\n", "a=sendonly\r\n", "c=IN IP4 10.0.0.2\r\n", "y=0100000001\r\n"} {
+		if !strings.Contains(raw, line) {
+			t.Fatalf("missing %q in\n%s", line, raw)
+		}
+	}
+	if err := NewSession(nil, "Play", nil, "").Validator(); err == nil {
+		t.Fatal("expected an error for a session without origin")
+	}
+	if err := new(Session).Parse("v=0\r\nbogus\r\n"); err == nil {
+		t.Fatal("expected an error for an invalid line")
+	}
+}
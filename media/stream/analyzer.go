@@ -0,0 +1,167 @@
+package stream
+
+import (
+	"math"
+
+	"github.com/kokutas/gb28181/media/codec"
+	"github.com/kokutas/gb28181/media/ps"
+)
+
+// rateWindow is the number of frame intervals averaged when the stream
+// does not signal its frame rate.
+const rateWindow = 25
+
+// Info describes the streams of one media session as they are actually
+// coded, independent of what the SDP f= line announced.
+type Info struct {
+	Session          string  `json:"session"`
+	VideoCodec       string  `json:"video_codec,omitempty"`
+	Width            int     `json:"width,omitempty"`
+	Height           int     `json:"height,omitempty"`
+	Profile          string  `json:"profile,omitempty"`
+	Level            string  `json:"level,omitempty"`
+	FrameRate        float64 `json:"frame_rate,omitempty"`
+	KeyFrameInterval int     `json:"key_frame_interval,omitempty"` // frames between the last two key frames
+	AudioCodec       string  `json:"audio_codec,omitempty"`
+}
+
+// Analyzer inspects the demuxed frames of a session and calls the handler
+// with a new Info whenever a property changes.
+type Analyzer struct {
+	session    string
+	handler    func(*Info)
+	current    Info
+	emitted    Info
+	signalRate float64  // frame rate from the SPS/VPS timing info
+	lastDTS    uint64   // of the previous video frame
+	hasDTS     bool     // lastDTS is valid
+	intervals  []uint64 // recent video frame intervals, 90 kHz
+	sinceKey   int      // video frames since the last key frame
+	seenKey    bool
+	keyFrames  uint64
+}
+
+func NewAnalyzer(session string, handler func(*Info)) *Analyzer {
+	return &Analyzer{
+		session: session,
+		handler: handler,
+		current: Info{Session: session},
+		emitted: Info{Session: session},
+	}
+}
+
+func (analyzer *Analyzer) GetSession() string {
+	return analyzer.session
+}
+
+// GetInfo returns the current stream description.
+func (analyzer *Analyzer) GetInfo() Info {
+	return analyzer.current
+}
+
+// GetKeyFrames returns the number of key frames seen.
+func (analyzer *Analyzer) GetKeyFrames() uint64 {
+	return analyzer.keyFrames
+}
+
+// Analyze inspects one access unit and reports whether it is a key frame.
+func (analyzer *Analyzer) Analyze(frame *ps.Frame) bool {
+	keyFrame := false
+	switch {
+	case frame.IsVideo():
+		keyFrame = analyzer.video(frame)
+	case frame.IsAudio():
+		if frame.StreamType != ps.StreamTypeUnknown {
+			analyzer.current.AudioCodec = frame.StreamType.String()
+		}
+	}
+	analyzer.notify()
+	return keyFrame
+}
+
+func (analyzer *Analyzer) video(frame *ps.Frame) bool {
+	videoCodec := frame.StreamType.Codec()
+	if frame.StreamType != ps.StreamTypeUnknown {
+		analyzer.current.VideoCodec = frame.StreamType.String()
+	}
+	if analyzer.hasDTS && frame.DTS > analyzer.lastDTS {
+		analyzer.intervals = append(analyzer.intervals, frame.DTS-analyzer.lastDTS)
+		if len(analyzer.intervals) > rateWindow {
+			analyzer.intervals = analyzer.intervals[1:]
+		}
+	}
+	analyzer.lastDTS, analyzer.hasDTS = frame.DTS, true
+	if len(videoCodec) == 0 {
+		analyzer.updateRate()
+		return false
+	}
+	vps, sps, _ := codec.ParameterSets(videoCodec, frame.Data)
+	switch videoCodec {
+	case codec.H264:
+		if sps != nil {
+			if parsed, err := codec.ParseH264SPS(sps); err == nil {
+				analyzer.current.Width, analyzer.current.Height = parsed.Width, parsed.Height
+				analyzer.current.Profile, analyzer.current.Level = parsed.Profile(), parsed.Level()
+				analyzer.signalRate = parsed.FrameRate
+			}
+		}
+	case codec.H265:
+		if vps != nil {
+			if parsed, err := codec.ParseH265VPS(vps); err == nil {
+				analyzer.signalRate = parsed.FrameRate
+			}
+		}
+		if sps != nil {
+			if parsed, err := codec.ParseH265SPS(sps); err == nil {
+				analyzer.current.Width, analyzer.current.Height = parsed.Width, parsed.Height
+				analyzer.current.Profile, analyzer.current.Level = parsed.Profile(), parsed.Level()
+			}
+		}
+	}
+	analyzer.updateRate()
+	keyFrame := codec.IsKeyFrame(videoCodec, frame.Data)
+	if keyFrame {
+		analyzer.keyFrames++
+		if analyzer.seenKey {
+			analyzer.current.KeyFrameInterval = analyzer.sinceKey
+		}
+		analyzer.seenKey = true
+		analyzer.sinceKey = 0
+	}
+	analyzer.sinceKey++
+	return keyFrame
+}
+
+func (analyzer *Analyzer) updateRate() {
+	if analyzer.signalRate > 0 {
+		analyzer.current.FrameRate = round(analyzer.signalRate)
+		return
+	}
+	if len(analyzer.intervals) < 5 {
+		return
+	}
+	var sum uint64
+	for _, interval := range analyzer.intervals {
+		sum += interval
+	}
+	analyzer.current.FrameRate = round(90000 * float64(len(analyzer.intervals)) / float64(sum))
+}
+
+func (analyzer *Analyzer) notify() {
+	current, emitted := analyzer.current, analyzer.emitted
+	// measured rates drift slightly; only report a real change
+	rateChanged := math.Abs(current.FrameRate-emitted.FrameRate) >= 0.5
+	current.FrameRate, emitted.FrameRate = 0, 0
+	if current == emitted && !rateChanged {
+		return
+	}
+	analyzer.emitted = analyzer.current
+	if analyzer.handler != nil {
+		info := analyzer.current
+		analyzer.handler(&info)
+	}
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/kokutas/gb28181/media/ps"
+)
+
+func TestAnalyzer_H264(t *testing.T) {
+	raw, err := ioutil.ReadFile("../ps/testdata/h264_g711.ps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []*Info
+	analyzer := NewAnalyzer("34020000001320000001_0100000001", func(info *Info) {
+		events = append(events, info)
+	})
+	keyFrames := 0
+	demuxer := ps.NewDemuxer(func(frame *ps.Frame) {
+		if analyzer.Analyze(frame) {
+			keyFrames++
+		}
+	})
+	_ = demuxer.Write(raw)
+	_ = demuxer.Flush()
+	if keyFrames != 1 || analyzer.GetKeyFrames() != 1 {
+		t.Fatalf("got %d key frames, want 1", keyFrames)
+	}
+	info := analyzer.GetInfo()
+	want := Info{
+		Session:    "34020000001320000001_0100000001",
+		VideoCodec: "H.264",
+		Width:      640,
+		Height:     480,
+		Profile:    "Constrained Baseline",
+		Level:      "3.0",
+		FrameRate:  25,
+		AudioCodec: "G.711A",
+	}
+	if info != want {
+		t.Fatalf("got %+v", info)
+	}
+	// one event for the video parameters and one once audio was seen
+	if len(events) != 2 || *events[len(events)-1] != want {
+		t.Fatalf("got %d events", len(events))
+	}
+}
+
+func TestAnalyzer_H265(t *testing.T) {
+	vps, _ := hex.DecodeString("40010c01ffff01600000030090000003000003007bac0c0000030004000003006480")
+	sps, _ := hex.DecodeString("42010101600000030090000003000003007ba003c0801107cb96")
+	key := append([]byte{0, 0, 0, 1}, vps...)
+	key = append(key, 0, 0, 0, 1)
+	key = append(key, sps...)
+	key = append(key, 0, 0, 0, 1, 0x26, 0x01, 0xaf)
+	inter := []byte{0, 0, 0, 1, 0x02, 0x01, 0xd0}
+	var last *Info
+	analyzer := NewAnalyzer("s1", func(info *Info) {
+		last = info
+	})
+	for i := 0; i < 12; i++ {
+		data := inter
+		if i%5 == 0 {
+			data = key
+		}
+		analyzer.Analyze(&ps.Frame{StreamID: 0xe0, StreamType: ps.StreamTypeH265, PTS: uint64(3600 * i), DTS: uint64(3600 * i), Data: data})
+	}
+	if last == nil || last.Width != 1920 || last.Height != 1080 || last.FrameRate != 25 || last.KeyFrameInterval != 5 || last.Level != "4.1 (Main tier)" {
+		t.Fatalf("got %+v", last)
+	}
+}
+
+func TestAnalyzer_MeasuredFrameRate(t *testing.T) {
+	analyzer := NewAnalyzer("s2", nil)
+	for i := 0; i < 20; i++ {
+		// 12.5 fps, no SPS timing
+		analyzer.Analyze(&ps.Frame{StreamID: 0xe0, StreamType: ps.StreamTypeH264, DTS: uint64(7200 * i), Data: []byte{0, 0, 1, 0x41, 0x9a}})
+	}
+	if info := analyzer.GetInfo(); info.FrameRate != 12.5 {
+		t.Fatalf("got %f fps", info.FrameRate)
+	}
+}
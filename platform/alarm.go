@@ -0,0 +1,130 @@
+package platform
+
+import (
+	"log"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/subscription"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// Alarm is an alarm a device reported.
+type Alarm struct {
+	DeviceID    string // device or alarm input raising the alarm
+	Priority    int    // manscdp.AlarmPriority values, 1 is the highest
+	Method      int    // manscdp.AlarmMethod values
+	Type        int    // interpreted by Method
+	EventType   int    // video analysis event, 0 without one
+	Time        time.Time
+	Description string
+	Longitude   float64
+	Latitude    float64
+	// From is the id of the device sending the notification, Source its
+	// address.
+	From   string
+	Source string
+	// Subscribed tells a NOTIFY of an alarm subscription from a MESSAGE.
+	Subscribed bool
+	Notify     *manscdp.AlarmNotify
+}
+
+// AlarmHandler receives the alarms of all devices. Handlers run in the
+// order they were added, one alarm at a time in the order the alarms
+// arrived, outside of the SIP transaction.
+type AlarmHandler func(alarm *Alarm)
+
+// OnAlarm adds an alarm handler.
+func (platform *Platform) OnAlarm(handler AlarmHandler) {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	platform.alarmHandlers = append(platform.alarmHandlers, handler)
+}
+
+// SetAlarmResponse sets whether alarm notifications sent as MESSAGE are
+// answered with a Response/Alarm MESSAGE after the 200; it is on by
+// default since many devices repeat unanswered alarms.
+func (platform *Platform) SetAlarmResponse(enabled bool) {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	platform.alarmResponse = enabled
+}
+
+// QueryAlarm sends Query/Alarm to the device; the matching alarms arrive as
+// notifications to the alarm handlers.
+func (platform *Platform) QueryAlarm(device *Device, query *manscdp.AlarmQuery) error {
+	if query.SN == 0 {
+		query.SN = platform.NextSN()
+	}
+	if len(query.DeviceID) == 0 {
+		query.DeviceID = device.ID
+	}
+	return platform.Send(device, query.DeviceID, query)
+}
+
+// SubscribeAlarm subscribes to the alarms of the device selected by query
+// for expires seconds, refreshed until Unsubscribe. A nil query selects all
+// alarms.
+func (platform *Platform) SubscribeAlarm(device *Device, query *manscdp.AlarmQuery, expires uint) (*subscription.Subscription, error) {
+	if query == nil {
+		query = manscdp.NewAlarmQuery(0, device.ID, time.Time{}, time.Time{})
+	}
+	if query.SN == 0 {
+		query.SN = platform.NextSN()
+	}
+	if len(query.DeviceID) == 0 {
+		query.DeviceID = device.ID
+	}
+	return platform.Subscribe(device, query.DeviceID, EventPresence, query, expires)
+}
+
+// serveAlarm accepts Notify/Alarm, acknowledges it and hands it to the
+// alarm handlers.
+func (platform *Platform) serveAlarm(tx *ua.ServerTransaction, envelope *manscdp.Envelope) int {
+	request := tx.GetRequest()
+	notify := new(manscdp.AlarmNotify)
+	if err := manscdp.Unmarshal(request.GetBody(), notify); err != nil {
+		log.Printf("alarm from %s error : %s", tx.GetSource(), err.Error())
+		return 400
+	}
+	alarm := &Alarm{
+		DeviceID:    notify.DeviceID,
+		Priority:    notify.AlarmPriority,
+		Method:      notify.AlarmMethod,
+		Type:        notify.GetAlarmType(),
+		EventType:   notify.GetEventType(),
+		Description: notify.AlarmDescription,
+		Longitude:   notify.Longitude,
+		Latitude:    notify.Latitude,
+		From:        request.GetHeader().From.GetAddress().GetUser(),
+		Source:      tx.GetSource(),
+		Subscribed:  request.GetMethod() == "NOTIFY",
+		Notify:      notify,
+	}
+	alarmTime, err := manscdp.ParseTime(notify.AlarmTime, nil)
+	if err != nil {
+		log.Printf("alarm of %s time error : %s", notify.DeviceID, err.Error())
+		alarmTime = time.Now()
+	}
+	alarm.Time = alarmTime
+	platform.mutex.Lock()
+	handlers := append([]AlarmHandler(nil), platform.alarmHandlers...)
+	sendResponse := platform.alarmResponse && !alarm.Subscribed
+	platform.mutex.Unlock()
+	if sendResponse {
+		device := &Device{ID: alarm.From, Address: alarm.Source}
+		go func() {
+			if err := platform.Send(device, notify.DeviceID, manscdp.NewAlarmResponse(notify)); err != nil {
+				log.Printf("alarm response to %s error : %s", device.ID, err.Error())
+			}
+		}()
+	}
+	if len(handlers) > 0 {
+		platform.alarmQueue.push(func() {
+			for _, handler := range handlers {
+				handler(alarm)
+			}
+		})
+	}
+	return 200
+}
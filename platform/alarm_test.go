@@ -0,0 +1,177 @@
+package platform
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/subscription"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+func newTestUserAgent(t *testing.T, id string) *ua.UserAgent {
+	userAgent := ua.NewUserAgent(id, "3402000000", "udp", "127.0.0.1:0")
+	userAgent.SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := userAgent.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { userAgent.Close() })
+	return userAgent
+}
+
+func platformUri(platform *Platform) *header.Uri {
+	userAgent := platform.GetUserAgent()
+	return header.NewUri("sip", userAgent.GetID(), userAgent.GetHost(), userAgent.GetPort(), nil)
+}
+
+func TestPlatform_Alarm(t *testing.T) {
+	platform := newTestPlatform(t)
+	alarms := make(chan *Alarm, 1)
+	platform.OnAlarm(func(alarm *Alarm) { alarms <- alarm })
+	device := newTestUserAgent(t, testDeviceID)
+	responses := make(chan *manscdp.AlarmResponse, 1)
+	device.Handle("MESSAGE", func(tx *ua.ServerTransaction) {
+		response := new(manscdp.AlarmResponse)
+		if err := manscdp.Unmarshal(tx.GetRequest().GetBody(), response); err != nil {
+			t.Error(err)
+		}
+		tx.RespondCode(200)
+		responses <- response
+	})
+
+	alarmTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local)
+	notify := manscdp.NewAlarmNotify(9, "34020000001340000001", manscdp.AlarmPriorityUrgent, manscdp.AlarmMethodDevice, alarmTime)
+	notify.AlarmDescription = "video loss"
+	notify.Info = &manscdp.AlarmInfo{AlarmType: 1}
+	body, _ := manscdp.Marshal(notify)
+	response, err := device.Request(device.NewRequest("MESSAGE", platformUri(platform), body, manscdp.ContentType), platform.GetUserAgent().Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.GetStatusCode() != 200 {
+		t.Fatalf("unexpected response %s", response)
+	}
+	select {
+	case ack := <-responses:
+		if ack.CmdType != manscdp.CmdTypeAlarm || ack.SN != 9 || ack.DeviceID != notify.DeviceID || ack.Result != manscdp.ResultOK {
+			t.Fatalf("unexpected alarm response %+v", ack)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no alarm response")
+	}
+	select {
+	case alarm := <-alarms:
+		if alarm.DeviceID != notify.DeviceID || alarm.Priority != 1 || alarm.Method != 2 || alarm.Type != 1 ||
+			!alarm.Time.Equal(alarmTime) || alarm.Description != "video loss" || alarm.Subscribed {
+			t.Fatalf("unexpected alarm %+v", alarm)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no alarm")
+	}
+}
+
+func TestPlatform_SubscribeAlarm(t *testing.T) {
+	platform := newTestPlatform(t)
+	alarms := make(chan *Alarm, 1)
+	platform.OnAlarm(func(alarm *Alarm) { alarms <- alarm })
+	device := newTestUserAgent(t, testDeviceID)
+	var mutex sync.Mutex
+	var subscribes []*message.Request
+	device.Handle("SUBSCRIBE", func(tx *ua.ServerTransaction) {
+		request := tx.GetRequest()
+		mutex.Lock()
+		subscribes = append(subscribes, request)
+		mutex.Unlock()
+		response := message.NewResponseTo(request, 200)
+		// grant one second so that the test sees a refresh
+		if request.GetHeader().Expires.GetSeconds() > 0 {
+			response.GetHeader().Expires = header.NewExpires(1)
+		} else {
+			response.GetHeader().Expires = header.NewExpires(0)
+		}
+		tx.Respond(response)
+	})
+	alarmSubscription, err := platform.SubscribeAlarm(&Device{ID: testDeviceID, Address: device.Addr().String()}, nil, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alarmSubscription.GetExpires() != 1 {
+		t.Fatalf("granted %d", alarmSubscription.GetExpires())
+	}
+
+	notify := manscdp.NewAlarmNotify(3, testDeviceID, manscdp.AlarmPriorityNormal, manscdp.AlarmMethodVideo, time.Now())
+	body, _ := manscdp.Marshal(notify)
+	request := device.NewRequest("NOTIFY", platformUri(platform), body, manscdp.ContentType)
+	request.GetHeader().Event = header.NewEvent(EventPresence, "")
+	if _, err := device.Request(request, platform.GetUserAgent().Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case alarm := <-alarms:
+		if !alarm.Subscribed || alarm.Method != manscdp.AlarmMethodVideo {
+			t.Fatalf("unexpected alarm %+v", alarm)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no alarm")
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+	if err := alarmSubscription.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	if alarmSubscription.Err() != subscription.ErrClosed {
+		t.Fatalf("unexpected error %v", alarmSubscription.Err())
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(subscribes) < 3 {
+		t.Fatalf("got %d subscribes", len(subscribes))
+	}
+	first, last := subscribes[0].GetHeader(), subscribes[len(subscribes)-1].GetHeader()
+	if first.Event.GetEventType() != EventPresence || first.To.GetTag() != "" {
+		t.Fatalf("unexpected subscribe %s", subscribes[0])
+	}
+	if last.Expires.GetSeconds() != 0 || last.CallID.GetId() != first.CallID.GetId() ||
+		last.From.GetTag() != first.From.GetTag() || last.To.GetTag() == "" ||
+		last.CSeq.GetSequenceNumber() != first.CSeq.GetSequenceNumber()+uint64(len(subscribes)-1) {
+		t.Fatalf("unexpected unsubscribe %s", subscribes[len(subscribes)-1])
+	}
+	query := new(manscdp.AlarmQuery)
+	if err := manscdp.Unmarshal(subscribes[1].GetBody(), query); err != nil || query.CmdType != manscdp.CmdTypeAlarm {
+		t.Fatalf("unexpected refresh body %q", subscribes[1].GetBody())
+	}
+}
+
+func TestPlatform_AlarmOrder(t *testing.T) {
+	platform := newTestPlatform(t)
+	platform.SetAlarmResponse(false)
+	alarms := make(chan *Alarm, 8)
+	platform.OnAlarm(func(alarm *Alarm) {
+		if alarm.Notify.SN == 1 {
+			// a slow handler holds back the alarms after it
+			time.Sleep(100 * time.Millisecond)
+		}
+		alarms <- alarm
+	})
+	device := newTestUserAgent(t, testDeviceID)
+	for sn := 1; sn <= 4; sn++ {
+		body, _ := manscdp.Marshal(manscdp.NewAlarmNotify(sn, testDeviceID, manscdp.AlarmPriorityNormal, manscdp.AlarmMethodDevice, time.Now()))
+		request := device.NewRequest("MESSAGE", platformUri(platform), body, manscdp.ContentType)
+		if _, err := device.Request(request, platform.GetUserAgent().Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for sn := 1; sn <= 4; sn++ {
+		select {
+		case alarm := <-alarms:
+			if alarm.Notify.SN != sn {
+				t.Fatalf("alarm %d delivered as %d", alarm.Notify.SN, sn)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no alarm")
+		}
+	}
+}
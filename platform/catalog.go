@@ -0,0 +1,422 @@
+package platform
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/id"
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/subscription"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// EventCatalog is the event package of catalog subscriptions.
+const EventCatalog = "Catalog"
+
+// CatalogRefreshInterval is the least time between two catalog queries
+// made after missed notifications of a device.
+const CatalogRefreshInterval = time.Minute
+
+// CatalogChange is a change of the catalog of a device. Event is one of the
+// manscdp.CatalogEvent values; a full refresh reports its differences as
+// ADD, UPDATE and DEL. Channel is the channel after the change, or the
+// removed one for DEL; Previous is the channel before, nil for a new one.
+type CatalogChange struct {
+	DeviceID string
+	Event    string
+	Channel  *manscdp.CatalogItem
+	Previous *manscdp.CatalogItem
+}
+
+// CatalogHandler receives the catalog changes of all devices.
+type CatalogHandler func(change *CatalogChange)
+
+// CatalogStore keeps the catalog of each device. Stored items are replaced,
+// never modified, so they can be shared but must not be changed by callers.
+type CatalogStore struct {
+	mutex   sync.RWMutex
+	devices map[string]*deviceCatalog
+}
+
+type deviceCatalog struct {
+	channels map[string]*manscdp.CatalogItem
+	series   catalogSeries // the last notification series
+}
+
+// catalogSeries counts the items received of the packets of a notification
+// sharing one SN.
+type catalogSeries struct {
+	sn       int
+	sumNum   int
+	received int
+}
+
+func NewCatalogStore() *CatalogStore {
+	return &CatalogStore{
+		devices: make(map[string]*deviceCatalog),
+	}
+}
+
+func (store *CatalogStore) device(deviceID string) *deviceCatalog {
+	catalog, ok := store.devices[deviceID]
+	if !ok {
+		catalog = &deviceCatalog{channels: make(map[string]*manscdp.CatalogItem)}
+		store.devices[deviceID] = catalog
+	}
+	return catalog
+}
+
+// Replace sets the whole catalog of deviceID and returns the differences to
+// the previous one, sorted by channel id.
+func (store *CatalogStore) Replace(deviceID string, items []*manscdp.CatalogItem) []*CatalogChange {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	catalog := store.device(deviceID)
+	channels := make(map[string]*manscdp.CatalogItem, len(items))
+	var changes []*CatalogChange
+	for _, item := range items {
+		channel := storedItem(item)
+		channels[channel.DeviceID] = channel
+	}
+	for id, channel := range channels {
+		previous, ok := catalog.channels[id]
+		if !ok {
+			changes = append(changes, &CatalogChange{DeviceID: deviceID, Event: manscdp.CatalogEventAdd, Channel: channel})
+		} else if !reflect.DeepEqual(previous, channel) {
+			changes = append(changes, &CatalogChange{DeviceID: deviceID, Event: manscdp.CatalogEventUpdate, Channel: channel, Previous: previous})
+		}
+	}
+	for id, previous := range catalog.channels {
+		if _, ok := channels[id]; !ok {
+			changes = append(changes, &CatalogChange{DeviceID: deviceID, Event: manscdp.CatalogEventDel, Channel: previous, Previous: previous})
+		}
+	}
+	catalog.channels = channels
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Channel.DeviceID < changes[j].Channel.DeviceID
+	})
+	return changes
+}
+
+// Apply applies the Event of a notification item and returns the change,
+// or nil when the item changes nothing, e.g. ON for an unknown channel.
+// UPDATE replaces the channel but keeps its status when the item has none.
+func (store *CatalogStore) Apply(deviceID string, item *manscdp.CatalogItem) *CatalogChange {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	catalog := store.device(deviceID)
+	event := strings.ToUpper(strings.TrimSpace(item.Event))
+	previous := catalog.channels[item.DeviceID]
+	change := &CatalogChange{DeviceID: deviceID, Event: event, Previous: previous}
+	switch event {
+	case manscdp.CatalogEventAdd:
+		change.Channel = storedItem(item)
+	case manscdp.CatalogEventUpdate:
+		change.Channel = storedItem(item)
+		if len(change.Channel.Status) == 0 && previous != nil {
+			change.Channel.Status = previous.Status
+		}
+	case manscdp.CatalogEventDel:
+		if previous == nil {
+			return nil
+		}
+		delete(catalog.channels, item.DeviceID)
+		change.Channel = previous
+		return change
+	case manscdp.CatalogEventOn, manscdp.CatalogEventOff:
+		if previous == nil {
+			return nil
+		}
+		channel := *previous
+		channel.Status = event
+		change.Channel = &channel
+	case manscdp.CatalogEventVLost, manscdp.CatalogEventDefect:
+		// faults are reported without changing the channel
+		if previous == nil {
+			return nil
+		}
+		change.Channel = previous
+		return change
+	default:
+		return nil
+	}
+	catalog.channels[item.DeviceID] = change.Channel
+	return change
+}
+
+// sequence records a notification packet of deviceID carrying items of
+// the sumNum items notified under sn, and reports whether notifications
+// were missed: a packet of the previous series never arrived. Devices share
+// one SN counter among all their messages and reset it when they restart,
+// so SNs that skip ahead or go back start a new series and are no gap.
+// incomplete tells whether items of the series are still to come.
+func (store *CatalogStore) sequence(deviceID string, sn, sumNum, items int) (gap, incomplete bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	catalog := store.device(deviceID)
+	if catalog.series.sn == sn && catalog.series.sumNum > 0 {
+		catalog.series.received += items
+		return false, catalog.series.received < catalog.series.sumNum
+	}
+	gap = catalog.series.received < catalog.series.sumNum
+	catalog.series = catalogSeries{sn: sn, sumNum: sumNum, received: items}
+	return gap, items < sumNum
+}
+
+// incomplete tells whether items of the last series of deviceID are still
+// to come.
+func (store *CatalogStore) incomplete(deviceID string) bool {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	catalog, ok := store.devices[deviceID]
+	return ok && catalog.series.received < catalog.series.sumNum
+}
+
+// Get returns a channel of deviceID, or nil.
+func (store *CatalogStore) Get(deviceID, channelID string) *manscdp.CatalogItem {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	catalog, ok := store.devices[deviceID]
+	if !ok {
+		return nil
+	}
+	return catalog.channels[channelID]
+}
+
+// Channels returns the channels of deviceID sorted by id.
+func (store *CatalogStore) Channels(deviceID string) []*manscdp.CatalogItem {
+	return store.filter(deviceID, func(*manscdp.CatalogItem) bool { return true })
+}
+
+// Children returns the channels whose direct parent is parentID. Channels
+// without ParentID are children of the device.
+func (store *CatalogStore) Children(deviceID, parentID string) []*manscdp.CatalogItem {
+	return store.filter(deviceID, func(channel *manscdp.CatalogItem) bool {
+		parents := channel.GetParentIDs()
+		if len(parents) == 0 {
+			return parentID == deviceID
+		}
+		return parents[len(parents)-1] == parentID
+	})
+}
+
+// Remove forgets the catalog of deviceID.
+func (store *CatalogStore) Remove(deviceID string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.devices, deviceID)
+}
+
+func (store *CatalogStore) filter(deviceID string, match func(*manscdp.CatalogItem) bool) []*manscdp.CatalogItem {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	catalog, ok := store.devices[deviceID]
+	if !ok {
+		return nil
+	}
+	var channels []*manscdp.CatalogItem
+	for _, channel := range catalog.channels {
+		if match(channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].DeviceID < channels[j].DeviceID
+	})
+	return channels
+}
+
+// isCatalogID reports whether raw may identify a catalog item: a 20-digit
+// code, or the civil code of an administrative region.
+func isCatalogID(raw string) bool {
+	return id.IsValid(raw) || id.IsCivilCode(raw)
+}
+
+// storedItem copies item without its notification event.
+func storedItem(item *manscdp.CatalogItem) *manscdp.CatalogItem {
+	channel := *item
+	channel.Event = ""
+	if item.Info != nil {
+		info := *item.Info
+		channel.Info = &info
+	}
+	return &channel
+}
+
+func (platform *Platform) GetCatalogStore() *CatalogStore {
+	return platform.catalogs
+}
+
+// OnCatalogChange adds a catalog change handler. Handlers are called one
+// change at a time in the order the catalogs changed.
+func (platform *Platform) OnCatalogChange(handler CatalogHandler) {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	platform.catalogHandlers = append(platform.catalogHandlers, handler)
+}
+
+// QueryCatalog queries the catalog of the device, collecting the items of
+// all Response packets until their count reaches SumNum. Items repeated
+// across packets are counted once.
+func (platform *Platform) QueryCatalog(device *Device) ([]*manscdp.CatalogItem, error) {
+	query := manscdp.NewCatalogQuery(platform.NextSN(), device.ID)
+	var items []*manscdp.CatalogItem
+	seen := make(map[string]int)
+	received, sumNum := 0, -1
+	err := platform.QueryAll(device, device.ID, query, manscdp.CmdTypeCatalog, query.SN, func(raw []byte) (bool, error) {
+		response := new(manscdp.CatalogResponse)
+		if err := manscdp.Unmarshal(raw, response); err != nil {
+			return false, fmt.Errorf("%s response error : %s", manscdp.CmdTypeCatalog, err.Error())
+		}
+		sumNum = response.SumNum
+		for _, item := range response.GetItems() {
+			received++
+			if !isCatalogID(item.DeviceID) {
+				log.Printf("catalog of %s item error : malformed id %q", device.ID, item.DeviceID)
+				continue
+			}
+			if index, ok := seen[item.DeviceID]; ok {
+				items[index] = item
+				continue
+			}
+			seen[item.DeviceID] = len(items)
+			items = append(items, item)
+		}
+		return received >= sumNum, nil
+	})
+	if err == ErrNoResponse && sumNum >= 0 {
+		return nil, fmt.Errorf("%s response incomplete : %d of %d items", manscdp.CmdTypeCatalog, received, sumNum)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// RefreshCatalog queries the whole catalog of the device, stores it and
+// emits the differences to the stored one.
+func (platform *Platform) RefreshCatalog(device *Device) ([]*CatalogChange, error) {
+	items, err := platform.QueryCatalog(device)
+	if err != nil {
+		return nil, err
+	}
+	changes := platform.applyCatalog(func() []*CatalogChange {
+		return platform.catalogs.Replace(device.ID, items)
+	})
+	return changes, nil
+}
+
+// SubscribeCatalog subscribes to the catalog changes of the device for
+// expires seconds, refreshed until Unsubscribe.
+func (platform *Platform) SubscribeCatalog(device *Device, expires uint) (*subscription.Subscription, error) {
+	query := manscdp.NewCatalogQuery(platform.NextSN(), device.ID)
+	return platform.Subscribe(device, device.ID, EventCatalog, query, expires)
+}
+
+// applyCatalog changes the catalog store with apply and hands the changes
+// to the handlers before any other change is made, so that handlers see
+// the changes in the order they were applied. Handlers are called
+// synchronously and must not change catalogs themselves.
+func (platform *Platform) applyCatalog(apply func() []*CatalogChange) []*CatalogChange {
+	platform.catalogMutex.Lock()
+	defer platform.catalogMutex.Unlock()
+	changes := apply()
+	if len(changes) == 0 {
+		return changes
+	}
+	platform.mutex.Lock()
+	handlers := append([]CatalogHandler(nil), platform.catalogHandlers...)
+	platform.mutex.Unlock()
+	for _, change := range changes {
+		for _, handler := range handlers {
+			handler(change)
+		}
+	}
+	return changes
+}
+
+// serveCatalog applies a Notify/Catalog to the catalog of its device. When
+// a packet of the previous notification is missing, or the rest of the
+// current one does not arrive within the timeout, the whole catalog is
+// queried again.
+func (platform *Platform) serveCatalog(tx *ua.ServerTransaction, envelope *manscdp.Envelope) int {
+	notify := new(manscdp.CatalogNotify)
+	if err := manscdp.Unmarshal(tx.GetRequest().GetBody(), notify); err != nil {
+		log.Printf("catalog notification from %s error : %s", tx.GetSource(), err.Error())
+		return 400
+	}
+	if err := id.Validate(notify.DeviceID); err != nil {
+		log.Printf("catalog notification from %s error : %s", tx.GetSource(), err.Error())
+		return 400
+	}
+	gap, incomplete := platform.catalogs.sequence(notify.DeviceID, notify.SN, notify.SumNum, len(notify.GetItems()))
+	platform.applyCatalog(func() []*CatalogChange {
+		var changes []*CatalogChange
+		for _, item := range notify.GetItems() {
+			if !isCatalogID(item.DeviceID) {
+				log.Printf("catalog notification of %s item error : malformed id %q", notify.DeviceID, item.DeviceID)
+				continue
+			}
+			if change := platform.catalogs.Apply(notify.DeviceID, item); change != nil {
+				changes = append(changes, change)
+			}
+		}
+		return changes
+	})
+	device := &Device{ID: notify.DeviceID, Address: tx.GetSource()}
+	platform.awaitCatalog(device, incomplete)
+	if gap {
+		platform.refreshAfterGap(device)
+	}
+	return 200
+}
+
+// awaitCatalog waits the timeout for the rest of the notification series
+// of the device when it is incomplete, and refreshes the catalog if the
+// series is still incomplete then. Each packet restarts the wait.
+func (platform *Platform) awaitCatalog(device *Device, incomplete bool) {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	if timer, ok := platform.catalogTimers[device.ID]; ok {
+		timer.Stop()
+		delete(platform.catalogTimers, device.ID)
+	}
+	if !incomplete {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(platform.timeout, func() {
+		platform.mutex.Lock()
+		current := platform.catalogTimers[device.ID] == timer
+		if current {
+			delete(platform.catalogTimers, device.ID)
+		}
+		platform.mutex.Unlock()
+		if current && platform.catalogs.incomplete(device.ID) {
+			platform.refreshAfterGap(device)
+		}
+	})
+	platform.catalogTimers[device.ID] = timer
+}
+
+// refreshAfterGap refreshes the catalog of the device in the background,
+// at most once per CatalogRefreshInterval per device.
+func (platform *Platform) refreshAfterGap(device *Device) {
+	platform.mutex.Lock()
+	if last, ok := platform.catalogRefreshed[device.ID]; ok && time.Since(last) < CatalogRefreshInterval {
+		platform.mutex.Unlock()
+		return
+	}
+	platform.catalogRefreshed[device.ID] = time.Now()
+	platform.mutex.Unlock()
+	go func() {
+		if _, err := platform.RefreshCatalog(device); err != nil {
+			log.Printf("catalog of %s refresh error : %s", device.ID, err.Error())
+		}
+	}()
+}
@@ -0,0 +1,249 @@
+package platform
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+func testChannel(id, parentID, status string) *manscdp.CatalogItem {
+	return &manscdp.CatalogItem{DeviceID: id, Name: id[16:], ParentID: parentID, Status: status}
+}
+
+func TestCatalogStore_Apply(t *testing.T) {
+	store := NewCatalogStore()
+	store.Replace(testDeviceID, []*manscdp.CatalogItem{
+		testChannel("34020000001320000001", "", manscdp.StatusOn),
+		testChannel("34020000001320000002", testDeviceID+"/34020000002160000001", manscdp.StatusOn),
+	})
+	off := &manscdp.CatalogItem{DeviceID: "34020000001320000001", Event: manscdp.CatalogEventOff}
+	change := store.Apply(testDeviceID, off)
+	if change == nil || change.Event != manscdp.CatalogEventOff || change.Channel.Status != manscdp.StatusOff || change.Previous.Status != manscdp.StatusOn {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	update := testChannel("34020000001320000002", "", "")
+	update.Name, update.Event = "renamed", manscdp.CatalogEventUpdate
+	if change := store.Apply(testDeviceID, update); change == nil || change.Channel.Name != "renamed" || change.Channel.Status != manscdp.StatusOn {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	if update.Event != manscdp.CatalogEventUpdate || store.Get(testDeviceID, update.DeviceID).Event != "" {
+		t.Fatal("the notification item was stored")
+	}
+	add := testChannel("34020000001320000003", "34020000002160000001", manscdp.StatusOn)
+	add.Event = manscdp.CatalogEventAdd
+	store.Apply(testDeviceID, add)
+	if change := store.Apply(testDeviceID, &manscdp.CatalogItem{DeviceID: "34020000001320000001", Event: manscdp.CatalogEventDel}); change == nil || change.Channel.Name != "0001" {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	if change := store.Apply(testDeviceID, &manscdp.CatalogItem{DeviceID: "34020000001320000009", Event: manscdp.CatalogEventOn}); change != nil {
+		t.Fatalf("unexpected change of an unknown channel %+v", change)
+	}
+	if channels := store.Channels(testDeviceID); len(channels) != 2 {
+		t.Fatalf("got %d channels", len(channels))
+	}
+	if children := store.Children(testDeviceID, "34020000002160000001"); len(children) != 1 || children[0].DeviceID != "34020000001320000003" {
+		t.Fatalf("unexpected children %+v", children)
+	}
+	if children := store.Children(testDeviceID, testDeviceID); len(children) != 1 || children[0].DeviceID != "34020000001320000002" {
+		t.Fatalf("unexpected device children %+v", children)
+	}
+}
+
+func TestCatalogStore_Replace(t *testing.T) {
+	store := NewCatalogStore()
+	store.Replace(testDeviceID, []*manscdp.CatalogItem{
+		testChannel("34020000001320000001", "", manscdp.StatusOn),
+		testChannel("34020000001320000002", "", manscdp.StatusOn),
+	})
+	changes := store.Replace(testDeviceID, []*manscdp.CatalogItem{
+		testChannel("34020000001320000002", "", manscdp.StatusOff),
+		testChannel("34020000001320000003", "", manscdp.StatusOn),
+	})
+	events := []string{manscdp.CatalogEventDel, manscdp.CatalogEventUpdate, manscdp.CatalogEventAdd}
+	if len(changes) != len(events) {
+		t.Fatalf("got %d changes", len(changes))
+	}
+	for i, event := range events {
+		if changes[i].Event != event {
+			t.Fatalf("unexpected change %d %+v", i, changes[i])
+		}
+	}
+}
+
+func TestCatalogStore_Sequence(t *testing.T) {
+	store := NewCatalogStore()
+	// SNs that skip ahead or go back are no gap, a series missing items is
+	for i, step := range []struct {
+		sn, sumNum, items int
+		gap, incomplete   bool
+	}{{7, 1, 1, false, false}, {10, 3, 2, false, true}, {10, 3, 1, false, false}, {12, 2, 1, false, true}, {13, 1, 1, true, false}, {2, 1, 1, false, false}, {3, 0, 0, false, false}, {4, 1, 1, false, false}} {
+		if gap, incomplete := store.sequence(testDeviceID, step.sn, step.sumNum, step.items); gap != step.gap || incomplete != step.incomplete {
+			t.Fatalf("step %d: sn %d gap %v incomplete %v", i, step.sn, gap, incomplete)
+		}
+		if store.incomplete(testDeviceID) != step.incomplete {
+			t.Fatalf("step %d: sn %d series not recorded", i, step.sn)
+		}
+	}
+}
+
+func TestPlatform_CatalogNotify(t *testing.T) {
+	platform := newTestPlatform(t)
+	changes := make(chan *CatalogChange, 16)
+	platform.OnCatalogChange(func(change *CatalogChange) { changes <- change })
+	device := newTestUserAgent(t, testDeviceID)
+	channels := []*manscdp.CatalogItem{
+		testChannel("34020000001320000001", "", manscdp.StatusOn),
+		testChannel("34020000001320000002", "", manscdp.StatusOn),
+		testChannel("34020000001320000003", "", manscdp.StatusOff),
+	}
+	var queries int32
+	device.Handle("MESSAGE", func(tx *ua.ServerTransaction) {
+		query := new(manscdp.CatalogQuery)
+		if err := manscdp.Unmarshal(tx.GetRequest().GetBody(), query); err != nil {
+			t.Error(err)
+			tx.RespondCode(400)
+			return
+		}
+		tx.RespondCode(200)
+		atomic.AddInt32(&queries, 1)
+		for _, response := range manscdp.NewCatalogResponses(query.SN, testDeviceID, channels, 2) {
+			body, _ := manscdp.Marshal(response)
+			if _, err := device.Request(device.NewRequest("MESSAGE", platformUri(platform), body, manscdp.ContentType), platform.GetUserAgent().Addr().String()); err != nil && err != ua.ErrClosed {
+				t.Error(err)
+			}
+		}
+	})
+	notify := func(sn int, item *manscdp.CatalogItem) {
+		body, _ := manscdp.Marshal(manscdp.NewCatalogNotifies(sn, testDeviceID, []*manscdp.CatalogItem{item}, 0)[0])
+		request := device.NewRequest("MESSAGE", platformUri(platform), body, manscdp.ContentType)
+		if _, err := device.Request(request, platform.GetUserAgent().Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive := func() *CatalogChange {
+		select {
+		case change := <-changes:
+			return change
+		case <-time.After(2 * time.Second):
+			t.Fatal("no catalog change")
+			return nil
+		}
+	}
+
+	initial, err := platform.RefreshCatalog(&Device{ID: testDeviceID, Address: device.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(initial) != 3 {
+		t.Fatalf("got %d changes", len(initial))
+	}
+	for range initial {
+		receive()
+	}
+
+	on := &manscdp.CatalogItem{DeviceID: "34020000001320000003", Event: manscdp.CatalogEventOn}
+	notify(1, on)
+	if change := receive(); change.Event != manscdp.CatalogEventOn || !change.Channel.IsOnline() {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	// the packet of a deletion is lost, which the next notification shows
+	channels = channels[:2]
+	off := &manscdp.CatalogItem{DeviceID: "34020000001320000001", Event: manscdp.CatalogEventOff}
+	del := &manscdp.CatalogItem{DeviceID: "34020000001320000003", Event: manscdp.CatalogEventDel}
+	body, _ := manscdp.Marshal(manscdp.NewCatalogNotifies(9, testDeviceID, []*manscdp.CatalogItem{off, del}, 1)[0])
+	if _, err := device.Request(device.NewRequest("MESSAGE", platformUri(platform), body, manscdp.ContentType), platform.GetUserAgent().Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if change := receive(); change.Event != manscdp.CatalogEventOff {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	notify(12, &manscdp.CatalogItem{DeviceID: "34020000001320000002", Event: manscdp.CatalogEventVLost})
+	if change := receive(); change.Event != manscdp.CatalogEventVLost {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	// the re-query finds the deleted channel and the one turned back on
+	var events []string
+	for i := 0; i < 2; i++ {
+		change := receive()
+		events = append(events, change.Event+" "+change.Channel.DeviceID)
+	}
+	if events[0] != "UPDATE 34020000001320000001" || events[1] != "DEL 34020000001320000003" {
+		t.Fatalf("unexpected changes %v", events)
+	}
+	if n := atomic.LoadInt32(&queries); n != 2 {
+		t.Fatalf("sent %d catalog queries", n)
+	}
+	if channels := platform.GetCatalogStore().Channels(testDeviceID); len(channels) != 2 {
+		t.Fatalf("stored %d channels", len(channels))
+	}
+}
+
+func TestPlatform_CatalogSeriesTimeout(t *testing.T) {
+	platform := newTestPlatform(t)
+	platform.SetTimeout(200 * time.Millisecond)
+	device := newTestUserAgent(t, testDeviceID)
+	queries := make(chan int, 4)
+	device.Handle("MESSAGE", func(tx *ua.ServerTransaction) {
+		query := new(manscdp.CatalogQuery)
+		if err := manscdp.Unmarshal(tx.GetRequest().GetBody(), query); err != nil {
+			t.Error(err)
+			tx.RespondCode(400)
+			return
+		}
+		tx.RespondCode(200)
+		queries <- query.SN
+	})
+	send := func(notify *manscdp.CatalogNotify) {
+		body, _ := manscdp.Marshal(notify)
+		if _, err := device.Request(device.NewRequest("MESSAGE", platformUri(platform), body, manscdp.ContentType), platform.GetUserAgent().Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	on := &manscdp.CatalogItem{DeviceID: "34020000001320000001", Event: manscdp.CatalogEventOn}
+	off := &manscdp.CatalogItem{DeviceID: "34020000001320000002", Event: manscdp.CatalogEventOff}
+
+	// a complete series is not waited for
+	send(manscdp.NewCatalogNotifies(3, testDeviceID, []*manscdp.CatalogItem{on}, 0)[0])
+	select {
+	case <-queries:
+		t.Fatal("queried the catalog after a complete notification")
+	case <-time.After(400 * time.Millisecond):
+	}
+	// the last packet of a series is lost and no other notification follows
+	send(manscdp.NewCatalogNotifies(4, testDeviceID, []*manscdp.CatalogItem{on, off}, 1)[0])
+	select {
+	case <-queries:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the lost packet was not detected")
+	}
+}
+
+func TestPlatform_CatalogMalformedID(t *testing.T) {
+	platform := newTestPlatform(t)
+	device := newTestUserAgent(t, testDeviceID)
+	notify := func(deviceID string, items ...*manscdp.CatalogItem) int {
+		body, _ := manscdp.Marshal(manscdp.NewCatalogNotifies(1, deviceID, items, 0)[0])
+		request := device.NewRequest("MESSAGE", platformUri(platform), body, manscdp.ContentType)
+		response, err := device.Request(request, platform.GetUserAgent().Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.GetStatusCode()
+	}
+	add := func(channelID string) *manscdp.CatalogItem {
+		return &manscdp.CatalogItem{DeviceID: channelID, Name: channelID, Status: manscdp.StatusOn, Event: manscdp.CatalogEventAdd}
+	}
+	if code := notify("3402000000132000001", add("34020000001320000001")); code != 400 {
+		t.Fatalf("a notification of a malformed device must be rejected, got %d", code)
+	}
+	if code := notify(testDeviceID, add("3402000000132000000A"), add("34020000001320000001"), add("340200")); code != 200 {
+		t.Fatalf("unexpected status %d", code)
+	}
+	channels := platform.GetCatalogStore().Channels(testDeviceID)
+	if len(channels) != 2 || channels[0].DeviceID != "340200" || channels[1].DeviceID != "34020000001320000001" {
+		t.Fatalf("unexpected channels %v", channels)
+	}
+}
@@ -0,0 +1,83 @@
+package platform
+
+import (
+	"fmt"
+
+	"github.com/kokutas/gb28181/manscdp"
+)
+
+// Control sends a DeviceControl or DeviceConfig body to targetID. Commands
+// the device answers (see manscdp.Control.HasResponse) wait for and return
+// the Response; the others return a nil response once the MESSAGE is
+// accepted. A zero SN is assigned.
+func (platform *Platform) Control(device *Device, targetID string, control *manscdp.Control) (*manscdp.ControlResponse, error) {
+	if control.SN == 0 {
+		control.SN = platform.NextSN()
+	}
+	if len(control.DeviceID) == 0 {
+		control.DeviceID = targetID
+	}
+	if !control.HasResponse() {
+		return nil, platform.Send(device, targetID, control)
+	}
+	raw, err := platform.Query(device, targetID, control, control.CmdType, control.SN)
+	if err != nil {
+		return nil, err
+	}
+	response := new(manscdp.ControlResponse)
+	if err := manscdp.Unmarshal(raw, response); err != nil {
+		return nil, fmt.Errorf("%s response error : %s", control.CmdType, err.Error())
+	}
+	return response, nil
+}
+
+// PTZ sends a PTZ, focus/iris, preset, cruise, scan or auxiliary switch
+// instruction to a channel. Priority 0 uses the default priority.
+func (platform *Platform) PTZ(device *Device, channelID string, ptzCmd *manscdp.PTZCmd, priority int) error {
+	_, err := platform.Control(device, channelID, manscdp.NewPTZControl(platform.NextSN(), channelID, ptzCmd, priority))
+	return err
+}
+
+// TeleBoot reboots the device.
+func (platform *Platform) TeleBoot(device *Device) error {
+	_, err := platform.Control(device, device.ID, manscdp.NewTeleBoot(platform.NextSN(), device.ID))
+	return err
+}
+
+// Record starts or stops manual recording of a channel.
+func (platform *Platform) Record(device *Device, channelID string, record bool) (*manscdp.ControlResponse, error) {
+	return platform.Control(device, channelID, manscdp.NewRecordControl(platform.NextSN(), channelID, record))
+}
+
+// Guard arms or disarms the device or one of its alarm channels.
+func (platform *Platform) Guard(device *Device, targetID string, guard bool) (*manscdp.ControlResponse, error) {
+	return platform.Control(device, targetID, manscdp.NewGuardControl(platform.NextSN(), targetID, guard))
+}
+
+// ResetAlarm resets the alarms of alarmMethod and alarmType, or all alarms
+// when both are empty.
+func (platform *Platform) ResetAlarm(device *Device, targetID, alarmMethod, alarmType string) (*manscdp.ControlResponse, error) {
+	return platform.Control(device, targetID, manscdp.NewAlarmReset(platform.NextSN(), targetID, alarmMethod, alarmType))
+}
+
+// IFrame forces an I-frame on a channel.
+func (platform *Platform) IFrame(device *Device, channelID string) error {
+	_, err := platform.Control(device, channelID, manscdp.NewIFrameControl(platform.NextSN(), channelID))
+	return err
+}
+
+// DragZoom zooms a channel into (in) or out of a dragged rectangle.
+func (platform *Platform) DragZoom(device *Device, channelID string, in bool, dragZoom *manscdp.DragZoom) error {
+	_, err := platform.Control(device, channelID, manscdp.NewDragZoom(platform.NextSN(), channelID, in, dragZoom))
+	return err
+}
+
+// HomePosition enables or disables the home position of a channel.
+func (platform *Platform) HomePosition(device *Device, channelID string, enabled bool, resetTime, presetIndex int) (*manscdp.ControlResponse, error) {
+	return platform.Control(device, channelID, manscdp.NewHomePosition(platform.NextSN(), channelID, enabled, resetTime, presetIndex))
+}
+
+// DeviceConfig changes the basic parameters of the device.
+func (platform *Platform) DeviceConfig(device *Device, basicParam *manscdp.BasicParam) (*manscdp.ControlResponse, error) {
+	return platform.Control(device, device.ID, manscdp.NewDeviceConfig(platform.NextSN(), device.ID, basicParam))
+}
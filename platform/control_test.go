@@ -0,0 +1,116 @@
+package platform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+const (
+	testPlatformID = "34020000002000000001"
+	testDeviceID   = "34020000001110000001"
+	testChannelID  = "34020000001320000001"
+)
+
+// newTestDevice starts a user agent that accepts every Control and answers
+// those with a response, recording what it got.
+func newTestDevice(t *testing.T, platform *Platform, result string) (*Device, chan *manscdp.Control) {
+	device := ua.NewUserAgent(testDeviceID, "3402000000", "udp", "127.0.0.1:0")
+	device.SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := device.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { device.Close() })
+	controls := make(chan *manscdp.Control, 4)
+	device.Handle("MESSAGE", func(tx *ua.ServerTransaction) {
+		control := new(manscdp.Control)
+		if err := manscdp.Unmarshal(tx.GetRequest().GetBody(), control); err != nil {
+			t.Error(err)
+			tx.RespondCode(400)
+			return
+		}
+		tx.RespondCode(200)
+		controls <- control
+		if !control.HasResponse() {
+			return
+		}
+		response := manscdp.NewControlResponse(control, true)
+		response.Result = result
+		body, _ := manscdp.Marshal(response)
+		userAgent := platform.GetUserAgent()
+		target := header.NewUri("sip", userAgent.GetID(), userAgent.GetHost(), userAgent.GetPort(), nil)
+		if _, err := device.Request(device.NewRequest("MESSAGE", target, body, manscdp.ContentType), userAgent.Addr().String()); err != nil && err != ua.ErrClosed {
+			t.Error(err)
+		}
+	})
+	return &Device{ID: testDeviceID, Address: device.Addr().String()}, controls
+}
+
+func newTestPlatform(t *testing.T) *Platform {
+	userAgent := ua.NewUserAgent(testPlatformID, "3402000000", "udp", "127.0.0.1:0")
+	userAgent.SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := userAgent.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { userAgent.Close() })
+	platform := NewPlatform(userAgent)
+	platform.SetTimeout(2 * time.Second)
+	return platform
+}
+
+func TestPlatform_Record(t *testing.T) {
+	platform := newTestPlatform(t)
+	device, controls := newTestDevice(t, platform, manscdp.ResultOK)
+	response, err := platform.Record(device, testChannelID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	control := <-controls
+	if control.RecordCmd != manscdp.RecordCmdRecord || control.DeviceID != testChannelID {
+		t.Fatalf("unexpected control %+v", control)
+	}
+	if !response.IsOK() || response.SN != control.SN || response.CmdType != manscdp.CmdTypeDeviceControl {
+		t.Fatalf("unexpected response %+v", response)
+	}
+}
+
+func TestPlatform_DeviceConfig(t *testing.T) {
+	platform := newTestPlatform(t)
+	device, controls := newTestDevice(t, platform, manscdp.ResultError)
+	response, err := platform.DeviceConfig(device, &manscdp.BasicParam{Name: "gate", HeartBeatInterval: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	control := <-controls
+	if control.CmdType != manscdp.CmdTypeDeviceConfig || control.BasicParam == nil || control.BasicParam.HeartBeatInterval != 30 {
+		t.Fatalf("unexpected control %+v", control)
+	}
+	if response.IsOK() {
+		t.Fatalf("unexpected response %+v", response)
+	}
+}
+
+func TestPlatform_PTZ(t *testing.T) {
+	platform := newTestPlatform(t)
+	device, controls := newTestDevice(t, platform, manscdp.ResultOK)
+	if err := platform.PTZ(device, testChannelID, manscdp.NewPTZStop(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if control := <-controls; control.PTZCmd != "A50F0100000000B5" || control.Info.ControlPriority != 5 {
+		t.Fatalf("unexpected control %+v", control)
+	}
+}
+
+func TestPlatform_NoResponse(t *testing.T) {
+	platform := newTestPlatform(t)
+	platform.SetTimeout(100 * time.Millisecond)
+	device, _ := newTestDevice(t, platform, manscdp.ResultOK)
+	// the device answers SN 7, the platform waits for SN 8
+	control := manscdp.NewGuardControl(7, testDeviceID, true)
+	if _, err := platform.Query(device, testDeviceID, control, manscdp.CmdTypeDeviceControl, 8); err != ErrNoResponse {
+		t.Fatalf("expected no response, got %v", err)
+	}
+}
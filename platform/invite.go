@@ -0,0 +1,146 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kokutas/gb28181/media/sdp"
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+var ErrCallEnded = errors.New("the call has ended")
+
+// Call is an INVITE session with a channel of a device.
+type Call struct {
+	device    *Device
+	channelID string
+	dialog    *ua.Dialog
+	offer     *sdp.Session
+	answer    *sdp.Session
+	done      chan struct{}
+}
+
+func (call *Call) GetDevice() *Device {
+	return call.device
+}
+func (call *Call) GetChannelID() string {
+	return call.channelID
+}
+func (call *Call) GetDialog() *ua.Dialog {
+	return call.dialog
+}
+func (call *Call) GetOffer() *sdp.Session {
+	return call.offer
+}
+func (call *Call) GetAnswer() *sdp.Session {
+	return call.answer
+}
+
+// Done is closed when the call ends, by Bye or by a BYE of the device.
+func (call *Call) Done() <-chan struct{} {
+	return call.done
+}
+
+// Invite invites channelID of the device to a media session described by
+// offer and acknowledges the answer. The call lasts until Bye or a BYE of
+// the device.
+func (platform *Platform) Invite(device *Device, channelID string, offer *sdp.Session) (*Call, error) {
+	body, err := offer.Raw()
+	if err != nil {
+		return nil, err
+	}
+	target, err := targetUri(device, channelID)
+	if err != nil {
+		return nil, err
+	}
+	request := platform.userAgent.NewRequest("INVITE", target, []byte(body), sdp.ContentType)
+	response, err := platform.userAgent.Request(request, device.Address)
+	if err != nil {
+		return nil, err
+	}
+	if code := response.GetStatusCode(); code >= 300 {
+		return nil, lib.NewSipError(code, response.GetStatusLine().GetReasonPhrase())
+	}
+	if err := platform.userAgent.Ack(request, response, device.Address); err != nil {
+		return nil, err
+	}
+	call := &Call{
+		device:    device,
+		channelID: target.GetUser(),
+		dialog:    ua.NewDialog(request, response),
+		offer:     offer,
+		answer:    new(sdp.Session),
+		done:      make(chan struct{}),
+	}
+	if err := call.answer.Parse(string(response.GetBody())); err != nil {
+		platform.bye(call)
+		return nil, fmt.Errorf("sdp answer of %s error : %s", call.channelID, err.Error())
+	}
+	platform.mutex.Lock()
+	platform.calls[callKey(call.dialog.GetCallID(), call.dialog.GetLocalTag())] = call
+	platform.mutex.Unlock()
+	return call, nil
+}
+
+// Bye ends the call.
+func (platform *Platform) Bye(call *Call) error {
+	if !platform.endCall(call) {
+		return ErrCallEnded
+	}
+	return platform.bye(call)
+}
+
+// GetCalls returns the calls in progress.
+func (platform *Platform) GetCalls() []*Call {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	calls := make([]*Call, 0, len(platform.calls))
+	for _, call := range platform.calls {
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+func (platform *Platform) bye(call *Call) error {
+	request := platform.userAgent.NewDialogRequest(call.dialog, "BYE", nil, "")
+	response, err := platform.userAgent.Request(request, call.device.Address)
+	if err != nil {
+		return err
+	}
+	if code := response.GetStatusCode(); code >= 300 && code != 481 {
+		return lib.NewSipError(code, response.GetStatusLine().GetReasonPhrase())
+	}
+	return nil
+}
+
+// endCall forgets the call and reports whether it was in progress.
+func (platform *Platform) endCall(call *Call) bool {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	key := callKey(call.dialog.GetCallID(), call.dialog.GetLocalTag())
+	if _, ok := platform.calls[key]; !ok {
+		return false
+	}
+	delete(platform.calls, key)
+	close(call.done)
+	return true
+}
+
+// serveBye ends the call a device hangs up.
+func (platform *Platform) serveBye(tx *ua.ServerTransaction) {
+	head := tx.GetRequest().GetHeader()
+	platform.mutex.Lock()
+	call, ok := platform.calls[callKey(head.CallID.GetId(), head.To.GetTag())]
+	platform.mutex.Unlock()
+	if !ok {
+		respond(tx, 481)
+		return
+	}
+	platform.endCall(call)
+	respond(tx, 200)
+}
+
+func callKey(callId, localTag string) string {
+	return callId + "/" + localTag
+}
@@ -0,0 +1,293 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/subscription"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// DefaultTimeout bounds the wait for the Response message of a command.
+const DefaultTimeout = 10 * time.Second
+
+var ErrNoResponse = errors.New("the device did not respond in time")
+
+// Device is a device as the platform reaches it: its id and the host:port
+// its requests come from.
+type Device struct {
+	ID      string
+	Address string
+}
+
+// MessageHandler serves an incoming MANSCDP message and returns the status
+// code of the MESSAGE response.
+type MessageHandler func(tx *ua.ServerTransaction, envelope *manscdp.Envelope) int
+
+// Platform is the SIP server side of GB28181: it sends MANSCDP messages to
+// devices over MESSAGE, correlates their Response messages by CmdType and
+// SN, and routes the other messages to handlers.
+type Platform struct {
+	userAgent     *ua.UserAgent
+	subscriptions *subscription.Manager
+	sn            int32
+	timeout       time.Duration
+
+	mutex         sync.Mutex
+	pending       map[string]*pendingQuery
+	handlers      map[string]MessageHandler
+	alarmHandlers []AlarmHandler
+	alarmQueue    queue
+	alarmResponse bool
+
+	positions        *PositionStore
+	positionMutex    sync.Mutex // orders stored positions and their handlers
+	positionHandlers []PositionHandler
+	positionQueue    queue
+
+	catalogs         *CatalogStore
+	catalogMutex     sync.Mutex // orders catalog changes and their handlers
+	catalogHandlers  []CatalogHandler
+	catalogRefreshed map[string]time.Time
+	catalogTimers    map[string]*time.Timer // waits for the rest of incomplete series
+
+	calls map[string]*Call
+}
+
+func (platform *Platform) GetUserAgent() *ua.UserAgent {
+	return platform.userAgent
+}
+func (platform *Platform) GetSubscriptionManager() *subscription.Manager {
+	return platform.subscriptions
+}
+func (platform *Platform) SetTimeout(timeout time.Duration) {
+	platform.timeout = timeout
+}
+func (platform *Platform) GetTimeout() time.Duration {
+	return platform.timeout
+}
+
+// NewPlatform serves the MESSAGE, SUBSCRIBE, NOTIFY and BYE requests of
+// userAgent. NOTIFY requests outside of a subscription are served like
+// MESSAGE requests.
+func NewPlatform(userAgent *ua.UserAgent) *Platform {
+	platform := &Platform{
+		userAgent:        userAgent,
+		subscriptions:    subscription.NewManager(userAgent),
+		sn:               int32(time.Now().Unix() % 100000),
+		timeout:          DefaultTimeout,
+		pending:          make(map[string]*pendingQuery),
+		handlers:         make(map[string]MessageHandler),
+		alarmResponse:    true,
+		positions:        NewPositionStore(DefaultPositionCapacity),
+		catalogs:         NewCatalogStore(),
+		catalogRefreshed: make(map[string]time.Time),
+		catalogTimers:    make(map[string]*time.Timer),
+		calls:            make(map[string]*Call),
+	}
+	platform.handlers[manscdp.RootNotify+"/"+manscdp.CmdTypeAlarm] = platform.serveAlarm
+	platform.handlers[manscdp.RootNotify+"/"+manscdp.CmdTypeMobilePosition] = platform.servePosition
+	platform.handlers[manscdp.RootNotify+"/"+manscdp.CmdTypeCatalog] = platform.serveCatalog
+	userAgent.Handle("MESSAGE", platform.serveMessage)
+	userAgent.Handle("BYE", platform.serveBye)
+	platform.subscriptions.HandleUnmatched(platform.serveMessage)
+	return platform
+}
+
+// queue runs functions one at a time in the order they were queued, in a
+// goroutine of its own while the queue is not empty.
+type queue struct {
+	mutex   sync.Mutex
+	pending []func()
+	running bool
+}
+
+func (q *queue) push(run func()) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.pending = append(q.pending, run)
+	if !q.running {
+		q.running = true
+		go q.drain()
+	}
+}
+
+func (q *queue) drain() {
+	for {
+		q.mutex.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mutex.Unlock()
+			return
+		}
+		run := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.mutex.Unlock()
+		run()
+	}
+}
+
+// NextSN returns the next command sequence number.
+func (platform *Platform) NextSN() int {
+	return int(atomic.AddInt32(&platform.sn, 1))
+}
+
+// Handle registers the handler of messages with root element root (e.g.
+// manscdp.RootNotify) and CmdType cmdType.
+func (platform *Platform) Handle(root, cmdType string, handler MessageHandler) {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	platform.handlers[root+"/"+cmdType] = handler
+}
+
+// Send sends body as a MESSAGE to targetID (the device or one of its
+// channels) and returns once the MESSAGE transaction completes.
+func (platform *Platform) Send(device *Device, targetID string, body interface{}) error {
+	raw, err := manscdp.Marshal(body)
+	if err != nil {
+		return err
+	}
+	target, err := targetUri(device, targetID)
+	if err != nil {
+		return err
+	}
+	request := platform.userAgent.NewRequest("MESSAGE", target, raw, manscdp.ContentType)
+	response, err := platform.userAgent.Request(request, device.Address)
+	if err != nil {
+		return err
+	}
+	if code := response.GetStatusCode(); code >= 300 {
+		return lib.NewSipError(code, response.GetStatusLine().GetReasonPhrase())
+	}
+	return nil
+}
+
+// pendingQuery receives the Response packets of a query until done closes.
+type pendingQuery struct {
+	responses chan []byte
+	done      chan struct{}
+}
+
+// Query sends body and waits for the Response message of cmdType carrying
+// sn, returning its raw XML.
+func (platform *Platform) Query(device *Device, targetID string, body interface{}, cmdType string, sn int) ([]byte, error) {
+	var response []byte
+	err := platform.QueryAll(device, targetID, body, cmdType, sn, func(raw []byte) (bool, error) {
+		response = raw
+		return true, nil
+	})
+	return response, err
+}
+
+// QueryAll sends body and passes every Response packet of cmdType carrying
+// sn to collect until collect reports the answer complete or fails. The
+// timeout applies to each packet, so long multi-packet answers are not cut
+// off as long as the device keeps sending.
+func (platform *Platform) QueryAll(device *Device, targetID string, body interface{}, cmdType string, sn int, collect func(raw []byte) (bool, error)) error {
+	key := pendingKey(cmdType, sn)
+	query := &pendingQuery{
+		responses: make(chan []byte),
+		done:      make(chan struct{}),
+	}
+	platform.mutex.Lock()
+	platform.pending[key] = query
+	platform.mutex.Unlock()
+	defer func() {
+		platform.mutex.Lock()
+		delete(platform.pending, key)
+		platform.mutex.Unlock()
+		close(query.done)
+	}()
+	if err := platform.Send(device, targetID, body); err != nil {
+		return err
+	}
+	timer := time.NewTimer(platform.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case raw := <-query.responses:
+			complete, err := collect(raw)
+			if err != nil || complete {
+				return err
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(platform.timeout)
+		case <-timer.C:
+			return ErrNoResponse
+		}
+	}
+}
+
+func pendingKey(cmdType string, sn int) string {
+	return cmdType + "/" + strconv.Itoa(sn)
+}
+
+// targetUri addresses targetID at the device's host and port.
+func targetUri(device *Device, targetID string) (*header.Uri, error) {
+	host, port, err := net.SplitHostPort(device.Address)
+	if err != nil {
+		return nil, fmt.Errorf("device %s address error : %s", device.ID, err.Error())
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("device %s address error : %s", device.ID, err.Error())
+	}
+	if len(targetID) == 0 {
+		targetID = device.ID
+	}
+	return header.NewUri("sip", targetID, host, uint16(portNumber), nil), nil
+}
+
+func (platform *Platform) serveMessage(tx *ua.ServerTransaction) {
+	respond(tx, platform.dispatch(tx))
+}
+
+// dispatch delivers a MANSCDP request body to the pending query or the
+// handler it belongs to and returns the status code to answer.
+func (platform *Platform) dispatch(tx *ua.ServerTransaction) int {
+	body := tx.GetRequest().GetBody()
+	envelope, err := manscdp.Decode(body)
+	if err != nil {
+		log.Printf("manscdp message from %s error : %s", tx.GetSource(), err.Error())
+		return 400
+	}
+	if envelope.GetRoot() == manscdp.RootResponse {
+		platform.mutex.Lock()
+		query, ok := platform.pending[pendingKey(envelope.CmdType, envelope.SN)]
+		platform.mutex.Unlock()
+		if ok {
+			select {
+			case query.responses <- body:
+			case <-query.done:
+			}
+			return 200
+		}
+	}
+	platform.mutex.Lock()
+	handler, ok := platform.handlers[envelope.GetRoot()+"/"+envelope.CmdType]
+	platform.mutex.Unlock()
+	if !ok {
+		// late responses and unsupported notifications are accepted so
+		// the device does not retransmit them
+		return 200
+	}
+	return handler(tx, envelope)
+}
+
+func respond(tx *ua.ServerTransaction, statusCode int) {
+	if err := tx.RespondCode(statusCode); err != nil {
+		log.Printf("sip response to %s error : %s", tx.GetSource(), err.Error())
+	}
+}
@@ -0,0 +1,214 @@
+package platform
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/geo"
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/subscription"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// DefaultPositionCapacity is the number of positions kept per device.
+const DefaultPositionCapacity = 1024
+
+// Position is a fix a mobile device reported.
+type Position struct {
+	DeviceID  string
+	Time      time.Time
+	Longitude float64
+	Latitude  float64
+	Speed     float64 // km/h
+	Direction float64 // degrees clockwise from north
+	Altitude  float64 // meters
+}
+
+// PositionHandler receives the positions of all devices after they are
+// stored, one at a time in the order they were stored, outside of the SIP
+// transaction.
+type PositionHandler func(position *Position)
+
+// PositionStore keeps the latest positions of each device in a ring
+// buffer. With GCJ-02 enabled, positions are converted from WGS-84 when
+// added.
+type PositionStore struct {
+	mutex    sync.RWMutex
+	capacity int
+	gcj02    bool
+	tracks   map[string]*track
+}
+
+// track is the ring buffer of a device: next is where the next position
+// goes, full tells whether positions were overwritten.
+type track struct {
+	positions []*Position
+	next      int
+	full      bool
+}
+
+// NewPositionStore keeps capacity positions per device; capacity ≤ 0 means
+// DefaultPositionCapacity.
+func NewPositionStore(capacity int) *PositionStore {
+	if capacity <= 0 {
+		capacity = DefaultPositionCapacity
+	}
+	return &PositionStore{
+		capacity: capacity,
+		tracks:   make(map[string]*track),
+	}
+}
+
+// SetGCJ02 sets whether positions added from now on are converted to
+// GCJ-02.
+func (store *PositionStore) SetGCJ02(gcj02 bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.gcj02 = gcj02
+}
+func (store *PositionStore) GetGCJ02() bool {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.gcj02
+}
+
+// Add stores position, overwriting the oldest one of its device when the
+// buffer is full, and returns the stored position, converted to GCJ-02 when
+// enabled.
+func (store *PositionStore) Add(position *Position) *Position {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.gcj02 {
+		converted := *position
+		converted.Longitude, converted.Latitude = geo.WGS84ToGCJ02(position.Longitude, position.Latitude)
+		position = &converted
+	}
+	deviceTrack, ok := store.tracks[position.DeviceID]
+	if !ok {
+		deviceTrack = &track{positions: make([]*Position, store.capacity)}
+		store.tracks[position.DeviceID] = deviceTrack
+	}
+	deviceTrack.positions[deviceTrack.next] = position
+	deviceTrack.next = (deviceTrack.next + 1) % len(deviceTrack.positions)
+	if deviceTrack.next == 0 {
+		deviceTrack.full = true
+	}
+	return position
+}
+
+// Query returns the positions of deviceID from start to end inclusive,
+// sorted by time. A zero start or end leaves that side open.
+func (store *PositionStore) Query(deviceID string, start, end time.Time) []*Position {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	deviceTrack, ok := store.tracks[deviceID]
+	if !ok {
+		return nil
+	}
+	var positions []*Position
+	for _, position := range deviceTrack.all() {
+		if !start.IsZero() && position.Time.Before(start) {
+			continue
+		}
+		if !end.IsZero() && position.Time.After(end) {
+			continue
+		}
+		positions = append(positions, position)
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		return positions[i].Time.Before(positions[j].Time)
+	})
+	return positions
+}
+
+// Latest returns the last position added for deviceID, or nil.
+func (store *PositionStore) Latest(deviceID string) *Position {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	deviceTrack, ok := store.tracks[deviceID]
+	if !ok {
+		return nil
+	}
+	return deviceTrack.positions[(deviceTrack.next+len(deviceTrack.positions)-1)%len(deviceTrack.positions)]
+}
+
+// Remove forgets the positions of deviceID.
+func (store *PositionStore) Remove(deviceID string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.tracks, deviceID)
+}
+
+// all returns the positions in the order they were added.
+func (deviceTrack *track) all() []*Position {
+	if !deviceTrack.full {
+		return deviceTrack.positions[:deviceTrack.next]
+	}
+	positions := make([]*Position, 0, len(deviceTrack.positions))
+	positions = append(positions, deviceTrack.positions[deviceTrack.next:]...)
+	return append(positions, deviceTrack.positions[:deviceTrack.next]...)
+}
+
+func (platform *Platform) GetPositionStore() *PositionStore {
+	return platform.positions
+}
+
+// OnPosition adds a position handler.
+func (platform *Platform) OnPosition(handler PositionHandler) {
+	platform.mutex.Lock()
+	defer platform.mutex.Unlock()
+	platform.positionHandlers = append(platform.positionHandlers, handler)
+}
+
+// SubscribeMobilePosition subscribes to the position of the device every
+// interval seconds for expires seconds, refreshed until Unsubscribe.
+func (platform *Platform) SubscribeMobilePosition(device *Device, interval int, expires uint) (*subscription.Subscription, error) {
+	query := manscdp.NewMobilePositionQuery(platform.NextSN(), device.ID, interval)
+	return platform.Subscribe(device, device.ID, EventPresence, query, expires)
+}
+
+// QueryPositions returns the stored positions of deviceID from start to
+// end.
+func (platform *Platform) QueryPositions(deviceID string, start, end time.Time) []*Position {
+	return platform.positions.Query(deviceID, start, end)
+}
+
+// servePosition stores a Notify/MobilePosition, sent in a subscription
+// NOTIFY or, by some devices, a MESSAGE.
+func (platform *Platform) servePosition(tx *ua.ServerTransaction, envelope *manscdp.Envelope) int {
+	notify := new(manscdp.MobilePositionNotify)
+	if err := manscdp.Unmarshal(tx.GetRequest().GetBody(), notify); err != nil {
+		log.Printf("mobile position from %s error : %s", tx.GetSource(), err.Error())
+		return 400
+	}
+	positionTime, err := manscdp.ParseTime(notify.Time, nil)
+	if err != nil {
+		log.Printf("mobile position of %s time error : %s", notify.DeviceID, err.Error())
+		positionTime = time.Now()
+	}
+	position := &Position{
+		DeviceID:  notify.DeviceID,
+		Time:      positionTime,
+		Longitude: notify.Longitude,
+		Latitude:  notify.Latitude,
+		Speed:     notify.Speed,
+		Direction: notify.Direction,
+		Altitude:  notify.Altitude,
+	}
+	platform.positionMutex.Lock()
+	defer platform.positionMutex.Unlock()
+	stored := platform.positions.Add(position)
+	platform.mutex.Lock()
+	handlers := append([]PositionHandler(nil), platform.positionHandlers...)
+	platform.mutex.Unlock()
+	if len(handlers) > 0 {
+		platform.positionQueue.push(func() {
+			for _, handler := range handlers {
+				handler(stored)
+			}
+		})
+	}
+	return 200
+}
@@ -0,0 +1,128 @@
+package platform
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/subscription"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+func TestPositionStore_Query(t *testing.T) {
+	store := NewPositionStore(3)
+	base := time.Date(2021, 3, 4, 5, 0, 0, 0, time.UTC)
+	// the fourth fix arrives late
+	for _, minute := range []int{0, 1, 2, 4, 3} {
+		store.Add(&Position{DeviceID: testDeviceID, Time: base.Add(time.Duration(minute) * time.Minute), Longitude: float64(minute)})
+	}
+	positions := store.Query(testDeviceID, time.Time{}, time.Time{})
+	if len(positions) != 3 {
+		t.Fatalf("kept %d positions", len(positions))
+	}
+	for i, minute := range []int{2, 3, 4} {
+		if positions[i].Longitude != float64(minute) {
+			t.Fatalf("unexpected position %d %+v", i, positions[i])
+		}
+	}
+	if latest := store.Latest(testDeviceID); latest.Longitude != 3 {
+		t.Fatalf("unexpected latest %+v", latest)
+	}
+	if positions := store.Query(testDeviceID, base.Add(3*time.Minute), base.Add(3*time.Minute)); len(positions) != 1 {
+		t.Fatalf("got %d positions", len(positions))
+	}
+	if positions := store.Query(testChannelID, time.Time{}, time.Time{}); positions != nil || store.Latest(testChannelID) != nil {
+		t.Fatal("unexpected positions of an unknown device")
+	}
+	store.Remove(testDeviceID)
+	if store.Latest(testDeviceID) != nil {
+		t.Fatal("positions left after remove")
+	}
+}
+
+func TestPositionStore_GCJ02(t *testing.T) {
+	store := NewPositionStore(0)
+	store.SetGCJ02(true)
+	position := &Position{DeviceID: testDeviceID, Time: time.Now(), Longitude: 116.397428, Latitude: 39.90923}
+	stored := store.Add(position)
+	latest := store.Latest(testDeviceID)
+	if latest != stored || math.Abs(latest.Longitude-116.403672) > 1e-6 || math.Abs(latest.Latitude-39.910634) > 1e-6 {
+		t.Fatalf("unexpected conversion %+v", latest)
+	}
+	if position.Longitude != 116.397428 {
+		t.Fatal("the reported position was modified")
+	}
+}
+
+func TestPlatform_SubscribeMobilePosition(t *testing.T) {
+	platform := newTestPlatform(t)
+	positions := make(chan *Position, 1)
+	platform.OnPosition(func(position *Position) { positions <- position })
+	device := newTestUserAgent(t, testDeviceID)
+	notifier := subscription.NewManager(device)
+	fixTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local)
+	notifier.HandleSubscribe(EventPresence, func(serverSubscription *subscription.ServerSubscription, tx *ua.ServerTransaction) int {
+		query := new(manscdp.MobilePositionQuery)
+		if err := manscdp.Unmarshal(tx.GetRequest().GetBody(), query); err != nil || query.Interval != 5 {
+			t.Errorf("unexpected query %q", tx.GetRequest().GetBody())
+			return 400
+		}
+		go func() {
+			notify := manscdp.NewMobilePositionNotify(query.SN, testDeviceID, fixTime, 121.4737, 31.2304)
+			notify.Speed, notify.Direction, notify.Altitude = 42.5, 270, 12
+			body, _ := manscdp.Marshal(notify)
+			if err := serverSubscription.Notify(body, manscdp.ContentType); err != nil {
+				t.Error(err)
+			}
+		}()
+		return 200
+	})
+	positionSubscription, err := platform.SubscribeMobilePosition(&Device{ID: testDeviceID, Address: device.Addr().String()}, 5, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer positionSubscription.Unsubscribe()
+	select {
+	case position := <-positions:
+		if position.DeviceID != testDeviceID || !position.Time.Equal(fixTime) || position.Longitude != 121.4737 ||
+			position.Latitude != 31.2304 || position.Speed != 42.5 || position.Direction != 270 || position.Altitude != 12 {
+			t.Fatalf("unexpected position %+v", position)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no position")
+	}
+	if stored := platform.QueryPositions(testDeviceID, fixTime, fixTime); len(stored) != 1 {
+		t.Fatalf("stored %d positions", len(stored))
+	}
+}
+
+func TestPlatform_PositionOrder(t *testing.T) {
+	platform := newTestPlatform(t)
+	positions := make(chan *Position, 8)
+	platform.OnPosition(func(position *Position) {
+		if position.Longitude == 0 {
+			// a slow handler holds back the positions after it
+			time.Sleep(100 * time.Millisecond)
+		}
+		positions <- position
+	})
+	device := newTestUserAgent(t, testDeviceID)
+	for i := 0; i < 4; i++ {
+		body, _ := manscdp.Marshal(manscdp.NewMobilePositionNotify(i+1, testDeviceID, time.Now(), float64(i), 31.2304))
+		request := device.NewRequest("MESSAGE", platformUri(platform), body, manscdp.ContentType)
+		if _, err := device.Request(request, platform.GetUserAgent().Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case position := <-positions:
+			if position.Longitude != float64(i) {
+				t.Fatalf("position %d delivered as %d", int(position.Longitude), i)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no position")
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+)
+
+// DefaultRecordSlice is the longest time range asked of a device in one
+// RecordInfo query; many devices truncate or reject longer ranges.
+const DefaultRecordSlice = 24 * time.Hour
+
+// RecordQuery selects the records of a channel.
+type RecordQuery struct {
+	ChannelID string
+	Start     time.Time
+	End       time.Time
+	// Type is one of the manscdp.RecordType values; empty means all.
+	Type string
+	// Slice bounds the range of each RecordInfo query; 0 means
+	// DefaultRecordSlice.
+	Slice time.Duration
+}
+
+// RecordSegment is a span of the record timeline: a recorded file, or the
+// overlapping files of the same type merged into one span.
+type RecordSegment struct {
+	Start    time.Time
+	End      time.Time
+	Type     string
+	FileSize int64
+	Items    []*manscdp.RecordItem
+}
+
+// Duration returns the length of the segment.
+func (segment *RecordSegment) Duration() time.Duration {
+	return segment.End.Sub(segment.Start)
+}
+
+// QueryRecords asks the device for the records of query, one RecordInfo
+// query per slice of the time range, and returns them as a timeline sorted
+// by start time. Items repeated across packets or slices are counted once.
+func (platform *Platform) QueryRecords(device *Device, query *RecordQuery) ([]*RecordSegment, error) {
+	if !query.End.After(query.Start) {
+		return nil, errors.New("the end of the record query is not after its start")
+	}
+	channelID := query.ChannelID
+	if len(channelID) == 0 {
+		channelID = device.ID
+	}
+	slice := query.Slice
+	if slice <= 0 {
+		slice = DefaultRecordSlice
+	}
+	var items []*manscdp.RecordItem
+	for start := query.Start; start.Before(query.End); start = start.Add(slice) {
+		end := start.Add(slice)
+		if end.After(query.End) {
+			end = query.End
+		}
+		sliceItems, err := platform.RecordInfo(device, channelID, start, end, query.Type)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, sliceItems...)
+	}
+	return NewRecordTimeline(items), nil
+}
+
+// RecordInfo sends one RecordInfo query and collects the items of all its
+// Response packets, until their count reaches SumNum.
+func (platform *Platform) RecordInfo(device *Device, channelID string, start, end time.Time, recordType string) ([]*manscdp.RecordItem, error) {
+	query := manscdp.NewRecordInfoQuery(platform.NextSN(), channelID, start, end, recordType)
+	var items []*manscdp.RecordItem
+	sumNum := -1
+	err := platform.QueryAll(device, channelID, query, manscdp.CmdTypeRecordInfo, query.SN, func(raw []byte) (bool, error) {
+		response := new(manscdp.RecordInfoResponse)
+		if err := manscdp.Unmarshal(raw, response); err != nil {
+			return false, fmt.Errorf("%s response error : %s", manscdp.CmdTypeRecordInfo, err.Error())
+		}
+		sumNum = response.SumNum
+		items = append(items, response.GetItems()...)
+		return len(items) >= sumNum, nil
+	})
+	if err == ErrNoResponse && sumNum >= 0 {
+		return nil, fmt.Errorf("%s response incomplete : %d of %d items", manscdp.CmdTypeRecordInfo, len(items), sumNum)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// NewRecordTimeline turns record items into a timeline sorted by start time.
+// Duplicate items are dropped, and overlapping items of the same type are
+// merged into one segment whose file size is the sum of theirs. Items with
+// invalid times are skipped.
+func NewRecordTimeline(items []*manscdp.RecordItem) []*RecordSegment {
+	seen := make(map[string]bool)
+	byType := make(map[string][]*RecordSegment)
+	for _, item := range items {
+		key := strings.Join([]string{item.DeviceID, item.FilePath, item.Name, item.StartTime, item.EndTime, item.Type}, "|")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		start, err := manscdp.ParseTime(item.StartTime, nil)
+		if err != nil {
+			log.Printf("record item %s error : %s", item.Name, err.Error())
+			continue
+		}
+		end, err := manscdp.ParseTime(item.EndTime, nil)
+		if err != nil {
+			log.Printf("record item %s error : %s", item.Name, err.Error())
+			continue
+		}
+		if end.Before(start) {
+			log.Printf("record item %s error : ends before it starts", item.Name)
+			continue
+		}
+		recordType := strings.ToLower(strings.TrimSpace(item.Type))
+		byType[recordType] = append(byType[recordType], &RecordSegment{
+			Start:    start,
+			End:      end,
+			Type:     recordType,
+			FileSize: item.FileSize,
+			Items:    []*manscdp.RecordItem{item},
+		})
+	}
+	var timeline []*RecordSegment
+	for _, segments := range byType {
+		sortSegments(segments)
+		var current *RecordSegment
+		for _, segment := range segments {
+			if current != nil && segment.Start.Before(current.End) {
+				if segment.End.After(current.End) {
+					current.End = segment.End
+				}
+				current.FileSize += segment.FileSize
+				current.Items = append(current.Items, segment.Items...)
+				continue
+			}
+			current = segment
+			timeline = append(timeline, current)
+		}
+	}
+	sortSegments(timeline)
+	return timeline
+}
+
+func sortSegments(segments []*RecordSegment) {
+	sort.Slice(segments, func(i, j int) bool {
+		if !segments[i].Start.Equal(segments[j].Start) {
+			return segments[i].Start.Before(segments[j].Start)
+		}
+		if !segments[i].End.Equal(segments[j].End) {
+			return segments[i].End.Before(segments[j].End)
+		}
+		return segments[i].Type < segments[j].Type
+	})
+}
@@ -0,0 +1,123 @@
+package platform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+func newTestRecorder(t *testing.T, platform *Platform, items []*manscdp.RecordItem, perPacket int) (*Device, chan *manscdp.RecordInfoQuery) {
+	device := ua.NewUserAgent(testDeviceID, "3402000000", "udp", "127.0.0.1:0")
+	device.SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := device.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { device.Close() })
+	queries := make(chan *manscdp.RecordInfoQuery, 16)
+	device.Handle("MESSAGE", func(tx *ua.ServerTransaction) {
+		query := new(manscdp.RecordInfoQuery)
+		if err := manscdp.Unmarshal(tx.GetRequest().GetBody(), query); err != nil {
+			t.Error(err)
+			tx.RespondCode(400)
+			return
+		}
+		tx.RespondCode(200)
+		queries <- query
+		start, _ := manscdp.ParseTime(query.StartTime, nil)
+		end, _ := manscdp.ParseTime(query.EndTime, nil)
+		// like most devices, answer every file touching the range
+		var matched []*manscdp.RecordItem
+		for _, item := range items {
+			itemStart, _ := manscdp.ParseTime(item.StartTime, nil)
+			itemEnd, _ := manscdp.ParseTime(item.EndTime, nil)
+			if itemStart.Before(end) && itemEnd.After(start) {
+				matched = append(matched, item)
+			}
+		}
+		userAgent := platform.GetUserAgent()
+		target := header.NewUri("sip", userAgent.GetID(), userAgent.GetHost(), userAgent.GetPort(), nil)
+		for _, response := range manscdp.NewRecordInfoResponses(query, "camera", matched, perPacket) {
+			body, _ := manscdp.Marshal(response)
+			if _, err := device.Request(device.NewRequest("MESSAGE", target, body, manscdp.ContentType), userAgent.Addr().String()); err != nil && err != ua.ErrClosed {
+				t.Error(err)
+			}
+		}
+	})
+	return &Device{ID: testDeviceID, Address: device.Addr().String()}, queries
+}
+
+func testRecordItem(start, end time.Time, recordType string, fileSize int64) *manscdp.RecordItem {
+	return &manscdp.RecordItem{
+		DeviceID:  testChannelID,
+		Name:      "camera",
+		FilePath:  manscdp.FormatTime(start),
+		StartTime: manscdp.FormatTime(start),
+		EndTime:   manscdp.FormatTime(end),
+		Type:      recordType,
+		FileSize:  fileSize,
+	}
+}
+
+func TestPlatform_QueryRecords(t *testing.T) {
+	platform := newTestPlatform(t)
+	day := time.Date(2021, 3, 4, 0, 0, 0, 0, time.Local)
+	items := []*manscdp.RecordItem{
+		testRecordItem(day.Add(time.Hour), day.Add(2*time.Hour), manscdp.RecordTypeTime, 100),
+		// spans the slice boundary at 06:00 and is answered twice
+		testRecordItem(day.Add(5*time.Hour), day.Add(7*time.Hour), manscdp.RecordTypeTime, 200),
+		testRecordItem(day.Add(6*time.Hour+30*time.Minute), day.Add(8*time.Hour), manscdp.RecordTypeTime, 50),
+		testRecordItem(day.Add(6*time.Hour), day.Add(6*time.Hour+10*time.Minute), manscdp.RecordTypeAlarm, 10),
+		testRecordItem(day.Add(13*time.Hour), day.Add(14*time.Hour), manscdp.RecordTypeManual, 30),
+	}
+	device, queries := newTestRecorder(t, platform, items, 1)
+	timeline, err := platform.QueryRecords(device, &RecordQuery{
+		ChannelID: testChannelID,
+		Start:     day,
+		End:       day.Add(15 * time.Hour),
+		Slice:     6 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(queries); n != 3 {
+		t.Fatalf("sent %d queries", n)
+	}
+	want := []struct {
+		start, end time.Duration
+		recordType string
+		fileSize   int64
+	}{
+		{time.Hour, 2 * time.Hour, manscdp.RecordTypeTime, 100},
+		{5 * time.Hour, 8 * time.Hour, manscdp.RecordTypeTime, 250},
+		{6 * time.Hour, 6*time.Hour + 10*time.Minute, manscdp.RecordTypeAlarm, 10},
+		{13 * time.Hour, 14 * time.Hour, manscdp.RecordTypeManual, 30},
+	}
+	if len(timeline) != len(want) {
+		t.Fatalf("got %d segments", len(timeline))
+	}
+	for i, segment := range timeline {
+		if !segment.Start.Equal(day.Add(want[i].start)) || !segment.End.Equal(day.Add(want[i].end)) ||
+			segment.Type != want[i].recordType || segment.FileSize != want[i].fileSize {
+			t.Fatalf("unexpected segment %d %+v", i, segment)
+		}
+	}
+}
+
+func TestPlatform_QueryRecordsEmpty(t *testing.T) {
+	platform := newTestPlatform(t)
+	device, _ := newTestRecorder(t, platform, nil, 2)
+	now := time.Now()
+	timeline, err := platform.QueryRecords(device, &RecordQuery{Start: now.Add(-time.Hour), End: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeline) != 0 {
+		t.Fatalf("unexpected timeline %+v", timeline)
+	}
+	if _, err := platform.QueryRecords(device, &RecordQuery{Start: now, End: now}); err == nil {
+		t.Fatal("expected an error for an empty range")
+	}
+}
@@ -0,0 +1,93 @@
+package platform
+
+import (
+	"sort"
+
+	"github.com/kokutas/gb28181/civil"
+	"github.com/kokutas/gb28181/manscdp"
+)
+
+// Region is an administrative division of a catalog grouped by CivilCode,
+// with the divisions and channels directly in it.
+type Region struct {
+	Code     string
+	Name     string
+	Regions  []*Region
+	Channels []*manscdp.CatalogItem
+}
+
+// GroupByRegion arranges channels in the province, city and district tree
+// of their CivilCode, provinces first, sorted by code. Channels without a
+// valid CivilCode are returned apart.
+func GroupByRegion(channels []*manscdp.CatalogItem) ([]*Region, []*manscdp.CatalogItem) {
+	regions := make(map[string]*Region)
+	var roots []*Region
+	var region func(code string) *Region
+	region = func(code string) *Region {
+		if found, ok := regions[code]; ok {
+			return found
+		}
+		created := &Region{Code: code, Name: regionName(code)}
+		regions[code] = created
+		if parent := civil.Parent(code); len(parent) > 0 {
+			parentRegion := region(parent)
+			parentRegion.Regions = append(parentRegion.Regions, created)
+		} else {
+			roots = append(roots, created)
+		}
+		return created
+	}
+	var others []*manscdp.CatalogItem
+	for _, channel := range channels {
+		code, ok := civil.Normalize(channel.CivilCode)
+		if !ok {
+			others = append(others, channel)
+			continue
+		}
+		found := region(code)
+		found.Channels = append(found.Channels, channel)
+	}
+	sortRegions(roots)
+	return roots, others
+}
+
+// RegionItems returns the catalog items of the divisions channels lie in,
+// sorted by code. As GB28181 asks, they only carry the shortened civil
+// code as DeviceID and the name.
+func RegionItems(channels []*manscdp.CatalogItem) []*manscdp.CatalogItem {
+	seen := make(map[string]bool)
+	var items []*manscdp.CatalogItem
+	for _, channel := range channels {
+		for _, code := range civil.Path(channel.CivilCode) {
+			if seen[code] {
+				continue
+			}
+			seen[code] = true
+			items = append(items, &manscdp.CatalogItem{DeviceID: code, Name: regionName(code)})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeviceID < items[j].DeviceID
+	})
+	return items
+}
+
+// regionName names a division missing from the table by its code.
+func regionName(code string) string {
+	if name := civil.Name(code); len(name) > 0 {
+		return name
+	}
+	return code
+}
+
+func sortRegions(regions []*Region) {
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].Code < regions[j].Code
+	})
+	for _, region := range regions {
+		sortRegions(region.Regions)
+		sort.Slice(region.Channels, func(i, j int) bool {
+			return region.Channels[i].DeviceID < region.Channels[j].DeviceID
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/kokutas/gb28181/manscdp"
+)
+
+func TestGroupByRegion(t *testing.T) {
+	channels := []*manscdp.CatalogItem{
+		{DeviceID: "34020000001320000002", CivilCode: "340202"},
+		{DeviceID: "34020000001320000001", CivilCode: "34020201"},
+		{DeviceID: "34020000001320000003", CivilCode: "340200"},
+		{DeviceID: "44030000001320000001", CivilCode: "440300"},
+		{DeviceID: "34020000001320000004"},
+	}
+	regions, others := GroupByRegion(channels)
+	if len(regions) != 2 || regions[0].Code != "34" || regions[0].Name != "安徽省" || regions[1].Code != "44" {
+		t.Fatalf("unexpected provinces %+v", regions)
+	}
+	city := regions[0].Regions[0]
+	if city.Code != "3402" || city.Name != "芜湖市" || len(city.Channels) != 1 || city.Channels[0].DeviceID != "34020000001320000003" {
+		t.Fatalf("unexpected city %+v", city)
+	}
+	district := city.Regions[0]
+	if district.Code != "340202" || len(district.Channels) != 1 || len(district.Regions) != 1 || district.Regions[0].Code != "34020201" {
+		t.Fatalf("unexpected district %+v", district)
+	}
+	if len(others) != 1 || others[0].DeviceID != "34020000001320000004" {
+		t.Fatalf("unexpected others %v", others)
+	}
+
+	items := RegionItems(channels)
+	ids := []string{"34", "3402", "340202", "34020201", "44", "4403"}
+	if len(items) != len(ids) {
+		t.Fatalf("unexpected %d items", len(items))
+	}
+	for i, item := range items {
+		if item.DeviceID != ids[i] || len(item.Name) == 0 {
+			t.Fatalf("item %d is %+v, expected %s", i, item, ids[i])
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package platform
+
+import (
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/subscription"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// EventPresence is the event package GB28181 devices take alarm and mobile
+// position subscriptions in; the body tells them apart.
+const EventPresence = "presence"
+
+// Subscribe subscribes to event at targetID with a MANSCDP body. The
+// subscription is refreshed until Unsubscribe, and the MANSCDP bodies of
+// its NOTIFY requests go to the message handlers like MESSAGE bodies. An
+// expires of 0 asks for subscription.DefaultExpires.
+func (platform *Platform) Subscribe(device *Device, targetID, event string, body interface{}, expires uint) (*subscription.Subscription, error) {
+	raw, err := manscdp.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	target, err := targetUri(device, targetID)
+	if err != nil {
+		return nil, err
+	}
+	return platform.subscriptions.Subscribe(device.Address, target, header.NewEvent(event, ""), raw, manscdp.ContentType, expires,
+		func(_ *subscription.Subscription, tx *ua.ServerTransaction) int {
+			return platform.dispatch(tx)
+		})
+}
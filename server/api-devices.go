@@ -0,0 +1,548 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kokutas/gb28181/id"
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/platform"
+)
+
+// maxRecordRange bounds the time range of a record query.
+const maxRecordRange = 31 * 24 * time.Hour
+
+// Health is the answer of GET /api/health.
+type Health struct {
+	ID            string `json:"id"`
+	Realm         string `json:"realm"`
+	Uptime        string `json:"uptime"`
+	Registrations int    `json:"registrations"`
+	Calls         int    `json:"calls"`
+	Streams       int    `json:"streams"`
+}
+
+// DeviceSummary is a registered device with the counts of its catalog.
+type DeviceSummary struct {
+	*Registration
+	Channels       int `json:"channels"`
+	OnlineChannels int `json:"online_channels"`
+}
+
+// DeviceList is a page of devices out of Total matching ones.
+type DeviceList struct {
+	Total int              `json:"total"`
+	Page  int              `json:"page"`
+	Size  int              `json:"size"`
+	Items []*DeviceSummary `json:"items"`
+}
+
+// DeviceDetail is a registered device with its channels.
+type DeviceDetail struct {
+	*Registration
+	Channels []*Channel `json:"channels"`
+}
+
+// Channel is a catalog item of a device.
+type Channel struct {
+	ID           string  `json:"id"`
+	DeviceID     string  `json:"device_id"`
+	ParentID     string  `json:"parent_id,omitempty"`
+	Name         string  `json:"name"`
+	Manufacturer string  `json:"manufacturer,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	Owner        string  `json:"owner,omitempty"`
+	CivilCode    string  `json:"civil_code,omitempty"`
+	Address      string  `json:"address,omitempty"`
+	Status       string  `json:"status,omitempty"`
+	Online       bool    `json:"online"`
+	Parental     bool    `json:"parental"`
+	Longitude    float64 `json:"longitude,omitempty"`
+	Latitude     float64 `json:"latitude,omitempty"`
+	PTZType      int     `json:"ptz_type,omitempty"`
+}
+
+func newChannel(deviceID string, item *manscdp.CatalogItem) *Channel {
+	channel := &Channel{
+		ID:           item.DeviceID,
+		DeviceID:     deviceID,
+		ParentID:     item.ParentID,
+		Name:         item.Name,
+		Manufacturer: item.Manufacturer,
+		Model:        item.Model,
+		Owner:        item.Owner,
+		CivilCode:    item.CivilCode,
+		Address:      item.Address,
+		Status:       item.Status,
+		Online:       item.IsOnline(),
+		Parental:     item.Parental == 1,
+		Longitude:    item.Longitude,
+		Latitude:     item.Latitude,
+	}
+	if item.Info != nil {
+		channel.PTZType = item.Info.PTZType
+	}
+	return channel
+}
+
+// RegionNode is an administrative division with the channels in it.
+type RegionNode struct {
+	Code     string        `json:"code"`
+	Name     string        `json:"name"`
+	Regions  []*RegionNode `json:"regions,omitempty"`
+	Channels []*Channel    `json:"channels,omitempty"`
+}
+
+// RegionTree is the answer of GET /api/regions; Others have no valid
+// CivilCode.
+type RegionTree struct {
+	Regions []*RegionNode `json:"regions"`
+	Others  []*Channel    `json:"others"`
+}
+
+// CatalogRefresh is the answer of a catalog refresh.
+type CatalogRefresh struct {
+	Changes  int        `json:"changes"`
+	Channels []*Channel `json:"channels"`
+}
+
+// Record is a span of the record timeline of a channel.
+type Record struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Type     string    `json:"type"`
+	FileSize int64     `json:"file_size,omitempty"`
+	Files    int       `json:"files"`
+}
+
+// PTZRequest moves a channel: Action is move, stop, preset_set,
+// preset_call or preset_delete.
+type PTZRequest struct {
+	Action string `json:"action"`
+	Pan    string `json:"pan,omitempty"`    // left or right
+	Tilt   string `json:"tilt,omitempty"`   // up or down
+	Zoom   string `json:"zoom,omitempty"`   // in or out
+	Speed  int    `json:"speed,omitempty"`  // 0-255, zoom moves at a sixteenth of it
+	Preset int    `json:"preset,omitempty"` // 1-255
+}
+
+// ControlRequest sends a command to a device, or to Target, one of its
+// channels: Command is reboot, record, stop_record, guard, reset_guard or
+// iframe.
+type ControlRequest struct {
+	Command string `json:"command"`
+	Target  string `json:"target,omitempty"`
+}
+
+// ControlResult is the result a device answered, OK or ERROR; commands
+// without an answer report OK once sent.
+type ControlResult struct {
+	Result string `json:"result"`
+}
+
+var (
+	deviceParam  = apiParam{name: "id", in: "path", kind: "string", required: true, description: "device id"}
+	channelParam = apiParam{name: "channel", in: "path", kind: "string", required: true, description: "channel id"}
+)
+
+func (server *Server) routes() []*apiRoute {
+	return []*apiRoute{
+		{method: "GET", pattern: "/api/health", summary: "Server status", tag: "server",
+			result: &Health{}, status: http.StatusOK, handle: server.getHealth},
+		{method: "GET", pattern: "/api/openapi.json", summary: "This document", tag: "server",
+			result: map[string]interface{}{}, status: http.StatusOK, handle: server.getOpenAPI},
+		{method: "GET", pattern: "/api/devices", summary: "List and search the registered devices", tag: "devices",
+			params: []apiParam{
+				{name: "q", in: "query", kind: "string", description: "part of the id or name"},
+				{name: "kind", in: "query", kind: "string", description: "device, channel or platform"},
+				{name: "page", in: "query", kind: "integer", description: "page from 1"},
+				{name: "size", in: "query", kind: "integer", description: "page size, 20 by default, at most 1000"},
+			},
+			result: &DeviceList{}, status: http.StatusOK, handle: server.listDevices},
+		{method: "GET", pattern: "/api/devices/{id}", summary: "Device with its channels", tag: "devices",
+			params: []apiParam{deviceParam}, result: &DeviceDetail{}, status: http.StatusOK, handle: server.getDevice},
+		{method: "DELETE", pattern: "/api/devices/{id}", summary: "Drop a registration, the device has to register again", tag: "devices",
+			params: []apiParam{deviceParam}, status: http.StatusNoContent, handle: server.deleteDevice},
+		{method: "GET", pattern: "/api/devices/{id}/channels", summary: "Channels of a device", tag: "devices",
+			params: []apiParam{
+				deviceParam,
+				{name: "q", in: "query", kind: "string", description: "part of the id or name"},
+				{name: "status", in: "query", kind: "string", description: "online or offline"},
+			},
+			result: []*Channel{}, status: http.StatusOK, handle: server.listChannels},
+		{method: "POST", pattern: "/api/devices/{id}/catalog", summary: "Query the catalog of a device again", tag: "devices",
+			params: []apiParam{deviceParam}, result: &CatalogRefresh{}, status: http.StatusOK, handle: server.refreshCatalog},
+		{method: "POST", pattern: "/api/devices/{id}/control", summary: "Send a control command", tag: "control",
+			params: []apiParam{deviceParam}, body: &ControlRequest{}, result: &ControlResult{}, status: http.StatusOK, handle: server.control},
+		{method: "GET", pattern: "/api/devices/{id}/channels/{channel}/records", summary: "Records of a channel", tag: "records",
+			params: []apiParam{
+				deviceParam, channelParam,
+				{name: "start", in: "query", kind: "string", required: true, description: "start time, RFC 3339 or local 2006-01-02T15:04:05"},
+				{name: "end", in: "query", kind: "string", required: true, description: "end time, at most 31 days after start"},
+				{name: "type", in: "query", kind: "string", description: "all, time, alarm or manual"},
+			},
+			result: []*Record{}, status: http.StatusOK, handle: server.listRecords},
+		{method: "POST", pattern: "/api/devices/{id}/channels/{channel}/ptz", summary: "Move a channel or use its presets", tag: "control",
+			params: []apiParam{deviceParam, channelParam}, body: &PTZRequest{}, status: http.StatusNoContent, handle: server.ptz},
+		{method: "POST", pattern: "/api/devices/{id}/channels/{channel}/live", summary: "Start the live stream of a channel, 201 when new", tag: "streams",
+			params: []apiParam{deviceParam, channelParam}, result: &Stream{}, status: http.StatusCreated, handle: server.startLive},
+		{method: "DELETE", pattern: "/api/devices/{id}/channels/{channel}/live", summary: "Stop the live stream of a channel", tag: "streams",
+			params: []apiParam{deviceParam, channelParam}, status: http.StatusNoContent, handle: server.stopLive},
+		{method: "GET", pattern: "/api/streams", summary: "Live streams", tag: "streams",
+			result: []*Stream{}, status: http.StatusOK, handle: server.listStreams},
+		{method: "GET", pattern: "/api/regions", summary: "Channels of the registered devices by administrative division", tag: "devices",
+			result: &RegionTree{}, status: http.StatusOK, handle: server.getRegions},
+		{method: "GET", pattern: "/api/events", summary: "Server-sent events, resumed from the Last-Event-ID header", tag: "events",
+			params: eventParams, result: &Event{}, status: http.StatusOK, serve: server.serveEvents, contentType: "text/event-stream"},
+		{method: "GET", pattern: "/api/events/ws", summary: "Events as WebSocket text messages", tag: "events",
+			params: eventParams, status: http.StatusSwitchingProtocols, serve: server.serveEventSocket},
+	}
+}
+
+func (server *Server) getHealth(request *apiRequest) (interface{}, error) {
+	return &Health{
+		ID:            server.config.ID,
+		Realm:         server.config.Realm,
+		Uptime:        time.Since(server.started).Truncate(time.Second).String(),
+		Registrations: len(server.registrar.GetRegistrations()),
+		Calls:         len(server.platform.GetCalls()),
+		Streams:       len(server.GetStreams()),
+	}, nil
+}
+
+func (server *Server) listDevices(request *apiRequest) (interface{}, error) {
+	page, err := request.queryInt("page", 1, 1, 1<<30)
+	if err != nil {
+		return nil, err
+	}
+	size, err := request.queryInt("size", 20, 1, 1000)
+	if err != nil {
+		return nil, err
+	}
+	search := strings.ToLower(request.URL.Query().Get("q"))
+	kind := request.URL.Query().Get("kind")
+	list := &DeviceList{Page: page, Size: size, Items: []*DeviceSummary{}}
+	for _, registration := range server.registrar.GetRegistrations() {
+		if len(kind) > 0 && registration.Kind != kind {
+			continue
+		}
+		if len(search) > 0 && !strings.Contains(registration.ID, search) &&
+			(registration.Info == nil || !strings.Contains(strings.ToLower(registration.Info.Name), search)) {
+			continue
+		}
+		list.Total++
+		if list.Total <= (page-1)*size || len(list.Items) >= size {
+			continue
+		}
+		summary := &DeviceSummary{Registration: registration}
+		for _, item := range server.platform.GetCatalogStore().Channels(registration.ID) {
+			summary.Channels++
+			if item.IsOnline() {
+				summary.OnlineChannels++
+			}
+		}
+		list.Items = append(list.Items, summary)
+	}
+	return list, nil
+}
+
+func (server *Server) getDevice(request *apiRequest) (interface{}, error) {
+	device, err := request.device()
+	if err != nil {
+		return nil, err
+	}
+	registration := server.registrar.Get(device.ID)
+	if registration == nil {
+		return nil, ErrNotRegistered
+	}
+	return &DeviceDetail{Registration: registration, Channels: server.channels(device.ID)}, nil
+}
+
+func (server *Server) deleteDevice(request *apiRequest) (interface{}, error) {
+	deviceID, err := request.deviceID()
+	if err != nil {
+		return nil, err
+	}
+	if !server.registrar.Remove(deviceID, ReasonRemoved) {
+		return nil, ErrNotRegistered
+	}
+	return nil, nil
+}
+
+func (server *Server) listChannels(request *apiRequest) (interface{}, error) {
+	device, err := request.device()
+	if err != nil {
+		return nil, err
+	}
+	search := strings.ToLower(request.URL.Query().Get("q"))
+	status := request.URL.Query().Get("status")
+	if len(status) > 0 && status != "online" && status != "offline" {
+		return nil, badRequest("status must be online or offline")
+	}
+	channels := []*Channel{}
+	for _, channel := range server.channels(device.ID) {
+		if len(status) > 0 && channel.Online != (status == "online") {
+			continue
+		}
+		if len(search) > 0 && !strings.Contains(channel.ID, search) && !strings.Contains(strings.ToLower(channel.Name), search) {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+func (server *Server) refreshCatalog(request *apiRequest) (interface{}, error) {
+	device, err := request.device()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := server.platform.RefreshCatalog(device)
+	if err != nil {
+		return nil, err
+	}
+	return &CatalogRefresh{Changes: len(changes), Channels: server.channels(device.ID)}, nil
+}
+
+// channels returns the stored catalog of a device sorted by id.
+func (server *Server) channels(deviceID string) []*Channel {
+	channels := []*Channel{}
+	for _, item := range server.platform.GetCatalogStore().Channels(deviceID) {
+		channels = append(channels, newChannel(deviceID, item))
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].ID < channels[j].ID
+	})
+	return channels
+}
+
+func (server *Server) getRegions(request *apiRequest) (interface{}, error) {
+	var items []*manscdp.CatalogItem
+	owners := make(map[*manscdp.CatalogItem]string)
+	for _, registration := range server.registrar.GetRegistrations() {
+		for _, item := range server.platform.GetCatalogStore().Channels(registration.ID) {
+			items = append(items, item)
+			owners[item] = registration.ID
+		}
+	}
+	regions, others := platform.GroupByRegion(items)
+	tree := &RegionTree{Regions: []*RegionNode{}, Others: []*Channel{}}
+	var convert func(region *platform.Region) *RegionNode
+	convert = func(region *platform.Region) *RegionNode {
+		node := &RegionNode{Code: region.Code, Name: region.Name}
+		for _, child := range region.Regions {
+			node.Regions = append(node.Regions, convert(child))
+		}
+		for _, item := range region.Channels {
+			node.Channels = append(node.Channels, newChannel(owners[item], item))
+		}
+		return node
+	}
+	for _, region := range regions {
+		tree.Regions = append(tree.Regions, convert(region))
+	}
+	for _, item := range others {
+		tree.Others = append(tree.Others, newChannel(owners[item], item))
+	}
+	return tree, nil
+}
+
+func (server *Server) listRecords(request *apiRequest) (interface{}, error) {
+	device, err := request.device()
+	if err != nil {
+		return nil, err
+	}
+	channelID, err := request.channelID()
+	if err != nil {
+		return nil, err
+	}
+	query := request.URL.Query()
+	start, err := manscdp.ParseTime(query.Get("start"), nil)
+	if err != nil {
+		return nil, badRequest("start %s", err.Error())
+	}
+	end, err := manscdp.ParseTime(query.Get("end"), nil)
+	if err != nil {
+		return nil, badRequest("end %s", err.Error())
+	}
+	if !end.After(start) || end.Sub(start) > maxRecordRange {
+		return nil, badRequest("end must be after start and at most 31 days later")
+	}
+	recordType := query.Get("type")
+	switch recordType {
+	case "", manscdp.RecordTypeAll, manscdp.RecordTypeTime, manscdp.RecordTypeAlarm, manscdp.RecordTypeManual:
+	default:
+		return nil, badRequest("type must be all, time, alarm or manual")
+	}
+	segments, err := server.platform.QueryRecords(device, &platform.RecordQuery{
+		ChannelID: channelID,
+		Start:     start,
+		End:       end,
+		Type:      recordType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	records := []*Record{}
+	for _, segment := range segments {
+		records = append(records, &Record{
+			Start:    segment.Start,
+			End:      segment.End,
+			Type:     segment.Type,
+			FileSize: segment.FileSize,
+			Files:    len(segment.Items),
+		})
+	}
+	return records, nil
+}
+
+func (server *Server) ptz(request *apiRequest) (interface{}, error) {
+	device, err := request.device()
+	if err != nil {
+		return nil, err
+	}
+	channelID, err := request.channelID()
+	if err != nil {
+		return nil, err
+	}
+	body := new(PTZRequest)
+	if err := request.decode(body); err != nil {
+		return nil, err
+	}
+	ptzCmd, err := body.command()
+	if err != nil {
+		return nil, err
+	}
+	return nil, server.platform.PTZ(device, channelID, ptzCmd, 0)
+}
+
+// command builds the PTZ instruction of the request.
+func (body *PTZRequest) command() (*manscdp.PTZCmd, error) {
+	if body.Speed < 0 || body.Speed > 255 {
+		return nil, badRequest("speed must be between 0 and 255")
+	}
+	switch body.Action {
+	case "stop":
+		return manscdp.NewPTZStop(), nil
+	case "move":
+		pan, tilt, zoom := manscdp.PanStop, manscdp.TiltStop, manscdp.ZoomStop
+		switch body.Pan {
+		case "":
+		case "left":
+			pan = manscdp.PanLeft
+		case "right":
+			pan = manscdp.PanRight
+		default:
+			return nil, badRequest("pan must be left or right")
+		}
+		switch body.Tilt {
+		case "":
+		case "up":
+			tilt = manscdp.TiltUp
+		case "down":
+			tilt = manscdp.TiltDown
+		default:
+			return nil, badRequest("tilt must be up or down")
+		}
+		switch body.Zoom {
+		case "":
+		case "in":
+			zoom = manscdp.ZoomIn
+		case "out":
+			zoom = manscdp.ZoomOut
+		default:
+			return nil, badRequest("zoom must be in or out")
+		}
+		if pan == manscdp.PanStop && tilt == manscdp.TiltStop && zoom == manscdp.ZoomStop {
+			return nil, badRequest("a move needs pan, tilt or zoom")
+		}
+		zoomSpeed := body.Speed >> 4
+		return manscdp.NewPTZMove(pan, tilt, zoom, uint8(body.Speed), uint8(body.Speed), uint8(zoomSpeed)), nil
+	case "preset_set", "preset_call", "preset_delete":
+		if body.Preset < 1 || body.Preset > 255 {
+			return nil, badRequest("preset must be between 1 and 255")
+		}
+		operation := map[string]uint8{
+			"preset_set":    manscdp.PTZPresetSet,
+			"preset_call":   manscdp.PTZPresetCall,
+			"preset_delete": manscdp.PTZPresetDelete,
+		}[body.Action]
+		return manscdp.NewPreset(operation, uint8(body.Preset))
+	}
+	return nil, badRequest("action must be move, stop, preset_set, preset_call or preset_delete")
+}
+
+func (server *Server) control(request *apiRequest) (interface{}, error) {
+	device, err := request.device()
+	if err != nil {
+		return nil, err
+	}
+	body := new(ControlRequest)
+	if err := request.decode(body); err != nil {
+		return nil, err
+	}
+	target := body.Target
+	if len(target) == 0 {
+		target = device.ID
+	} else if err := id.Validate(target); err != nil {
+		return nil, badRequest("target %s", err.Error())
+	}
+	var response *manscdp.ControlResponse
+	switch body.Command {
+	case "reboot":
+		err = server.platform.TeleBoot(device)
+	case "record", "stop_record":
+		response, err = server.platform.Record(device, target, body.Command == "record")
+	case "guard", "reset_guard":
+		response, err = server.platform.Guard(device, target, body.Command == "guard")
+	case "iframe":
+		err = server.platform.IFrame(device, target)
+	default:
+		return nil, badRequest("command must be reboot, record, stop_record, guard, reset_guard or iframe")
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &ControlResult{Result: manscdp.ResultOK}
+	if response != nil && !response.IsOK() {
+		result.Result = manscdp.ResultError
+	}
+	return result, nil
+}
+
+func (server *Server) startLive(request *apiRequest) (interface{}, error) {
+	deviceID, err := request.deviceID()
+	if err != nil {
+		return nil, err
+	}
+	channelID, err := request.channelID()
+	if err != nil {
+		return nil, err
+	}
+	stream, created, err := server.StartLive(deviceID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		request.status = http.StatusOK
+	}
+	return stream, nil
+}
+
+func (server *Server) stopLive(request *apiRequest) (interface{}, error) {
+	deviceID, err := request.deviceID()
+	if err != nil {
+		return nil, err
+	}
+	channelID, err := request.channelID()
+	if err != nil {
+		return nil, err
+	}
+	return nil, server.StopLive(deviceID, channelID)
+}
+
+func (server *Server) listStreams(request *apiRequest) (interface{}, error) {
+	return server.GetStreams(), nil
+}
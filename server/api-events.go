@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kokutas/gb28181/id"
+)
+
+// eventHeartbeat is the interval of the comments and pings keeping idle
+// event streams open through proxies.
+const eventHeartbeat = 15 * time.Second
+
+// eventRetry is the reconnection delay advised to SSE clients, in
+// milliseconds.
+const eventRetry = 3000
+
+// websocketGoingAway is the close status code of a server stopping a
+// WebSocket; clients resume from the last event they got.
+const websocketGoingAway = 1001
+
+var eventParams = []apiParam{
+	{name: "type", in: "query", kind: "string", description: "comma separated event types, all when empty: " + strings.Join(EventTypes, ", ")},
+	{name: "device", in: "query", kind: "string", description: "comma separated device ids, all when empty"},
+	{name: "last_event_id", in: "query", kind: "integer", description: "resume after this event; SSE clients send the Last-Event-ID header instead"},
+}
+
+// splitQuery returns the comma separated values of a query parameter,
+// which may also repeat.
+func splitQuery(request *apiRequest, name string) []string {
+	var values []string
+	for _, value := range request.URL.Query()[name] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); len(field) > 0 {
+				values = append(values, field)
+			}
+		}
+	}
+	return values
+}
+
+// eventFilter reads the filter of an event stream and the event it
+// resumes after.
+func (request *apiRequest) eventFilter() (*EventFilter, uint64, error) {
+	filter := &EventFilter{Types: splitQuery(request, "type"), Devices: splitQuery(request, "device")}
+	for _, eventType := range filter.Types {
+		if !matchAny(EventTypes, eventType) {
+			return nil, 0, badRequest("event type error : %s", eventType)
+		}
+	}
+	for _, deviceID := range filter.Devices {
+		if err := id.Validate(deviceID); err != nil {
+			return nil, 0, badRequest("device %s", err.Error())
+		}
+	}
+	raw := request.Header.Get("Last-Event-ID")
+	if len(raw) == 0 {
+		raw = request.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if len(raw) > 0 {
+		var err error
+		if lastID, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			return nil, 0, badRequest("last event id error : %s", raw)
+		}
+	}
+	return filter, lastID, nil
+}
+
+// serveEvents streams the events as server-sent events until the client
+// leaves or the server stops.
+func (server *Server) serveEvents(writer http.ResponseWriter, request *apiRequest) {
+	filter, lastID, err := request.eventFilter()
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeError(writer, &apiError{Code: http.StatusInternalServerError, Message: "streaming is not supported"})
+		return
+	}
+	subscriber := server.events.Subscribe(filter, lastID)
+	defer server.events.Unsubscribe(subscriber)
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	fmt.Fprintf(writer, "retry: %d\n\n", eventRetry)
+	flusher.Flush()
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-subscriber.C:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(event)
+			if _, err := fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := writer.Write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-request.Context().Done():
+			return
+		}
+	}
+}
+
+// serveEventSocket streams the events as WebSocket text messages until
+// the client leaves or the server stops.
+func (server *Server) serveEventSocket(writer http.ResponseWriter, request *apiRequest) {
+	filter, lastID, err := request.eventFilter()
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	websocket, err := upgradeWebSocket(writer, request.Request)
+	if err == errNotWebSocket {
+		writeError(writer, badRequest("%s", err.Error()))
+		return
+	}
+	if err != nil {
+		writeError(writer, &apiError{Code: http.StatusUpgradeRequired, Message: err.Error()})
+		return
+	}
+	subscriber := server.events.Subscribe(filter, lastID)
+	defer server.events.Unsubscribe(subscriber)
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-subscriber.C:
+			if !ok {
+				websocket.Close(websocketGoingAway)
+				return
+			}
+			data, _ := json.Marshal(event)
+			if err := websocket.WriteText(data); err != nil {
+				websocket.shutdown()
+				return
+			}
+		case <-heartbeat.C:
+			if err := websocket.writeFrame(opPing, nil); err != nil {
+				websocket.shutdown()
+				return
+			}
+		case <-websocket.Closed():
+			return
+		}
+	}
+}
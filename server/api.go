@@ -0,0 +1,287 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kokutas/gb28181/id"
+	"github.com/kokutas/gb28181/platform"
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// apiPrefix is the path prefix of the management API.
+const apiPrefix = "/api/"
+
+// maxBodySize bounds the JSON bodies of API requests.
+const maxBodySize = 1 << 20
+
+// apiError is an error answered with its status code, and the body of
+// every error answer.
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *apiError) Error() string {
+	return err.Message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// httpStatus maps an error to the status code of its answer.
+func httpStatus(err error) int {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	var sipError *lib.SipError
+	if errors.As(err, &sipError) {
+		return sipStatus(sipError.Code)
+	}
+	switch err {
+	case ErrNotRegistered, ErrStreamNotFound:
+		return http.StatusNotFound
+	case ErrNoMediaServer, ErrNoMediaPort:
+		return http.StatusServiceUnavailable
+	case platform.ErrNoResponse, ua.ErrTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// sipStatus maps the status code of a device rejecting a request to the
+// status code of the API answer. Rejections naming the target or the
+// caller keep their meaning; the other ones are failures of the device.
+func sipStatus(code int) int {
+	switch code {
+	case 400:
+		return http.StatusBadRequest
+	case 403, 603:
+		return http.StatusForbidden
+	case 404, 410, 484, 604:
+		return http.StatusNotFound
+	case 405, 501:
+		return http.StatusNotImplemented
+	case 408:
+		return http.StatusGatewayTimeout
+	case 480, 503:
+		return http.StatusServiceUnavailable
+	case 486, 487, 600:
+		return http.StatusConflict
+	}
+	return http.StatusBadGateway
+}
+
+// apiParam documents a path or query parameter.
+type apiParam struct {
+	name        string
+	in          string // path or query
+	kind        string // OpenAPI type: string or integer
+	required    bool
+	description string
+}
+
+// apiRoute is an endpoint: its handler and what the OpenAPI document says
+// about it.
+type apiRoute struct {
+	method  string
+	pattern string // path with {param} segments
+	summary string
+	tag     string
+	params  []apiParam
+	body    interface{} // request model, nil without a body
+	result  interface{} // answer model, nil for 204
+	status  int         // status of a success
+	handle  func(request *apiRequest) (interface{}, error)
+	// serve replaces handle for answers streamed in another content type
+	// than JSON, such as text/event-stream.
+	serve       func(writer http.ResponseWriter, request *apiRequest)
+	contentType string
+}
+
+// apiRequest is a request with the parameters of its path.
+type apiRequest struct {
+	*http.Request
+	server *Server
+	params map[string]string
+	status int // overrides the route status
+}
+
+// match reports whether path matches the pattern and returns its
+// parameters.
+func (route *apiRoute) match(path string) (map[string]string, bool) {
+	patternSegments := strings.Split(strings.Trim(route.pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if len(pathSegments[i]) == 0 {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = pathSegments[i]
+		} else if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// Handler returns the management API; GET /api/openapi.json describes it.
+func (server *Server) Handler() http.Handler {
+	routes := server.routes()
+	return server.logRequests(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		pathMatched := false
+		for _, route := range routes {
+			params, ok := route.match(request.URL.Path)
+			if !ok {
+				continue
+			}
+			pathMatched = true
+			if route.method != request.Method {
+				continue
+			}
+			server.serveRoute(writer, &apiRequest{Request: request, server: server, params: params, status: route.status}, route)
+			return
+		}
+		if pathMatched {
+			writeError(writer, &apiError{Code: http.StatusMethodNotAllowed, Message: "method not allowed"})
+			return
+		}
+		writeError(writer, &apiError{Code: http.StatusNotFound, Message: "not found"})
+	}))
+}
+
+func (server *Server) serveRoute(writer http.ResponseWriter, request *apiRequest, route *apiRoute) {
+	if route.serve != nil {
+		route.serve(writer, request)
+		return
+	}
+	result, err := route.handle(request)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	if result == nil {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(writer, request.status, result)
+}
+
+// deviceID returns the valid device id of the path.
+func (request *apiRequest) deviceID() (string, error) {
+	deviceID := request.params["id"]
+	if err := id.Validate(deviceID); err != nil {
+		return "", badRequest("device %s", err.Error())
+	}
+	return deviceID, nil
+}
+
+// channelID returns the valid channel id of the path.
+func (request *apiRequest) channelID() (string, error) {
+	channelID := request.params["channel"]
+	if err := id.Validate(channelID); err != nil {
+		return "", badRequest("channel %s", err.Error())
+	}
+	return channelID, nil
+}
+
+// device returns the registered device of the path.
+func (request *apiRequest) device() (*platform.Device, error) {
+	deviceID, err := request.deviceID()
+	if err != nil {
+		return nil, err
+	}
+	device := request.server.Device(deviceID)
+	if device == nil {
+		return nil, ErrNotRegistered
+	}
+	return device, nil
+}
+
+// decode reads the JSON body into v, rejecting unknown fields.
+func (request *apiRequest) decode(v interface{}) error {
+	decoder := json.NewDecoder(io.LimitReader(request.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if err == io.EOF {
+			return badRequest("the request body is empty")
+		}
+		return badRequest("request body error : %s", err.Error())
+	}
+	return nil
+}
+
+// queryInt reads an integer query parameter between min and max.
+func (request *apiRequest) queryInt(name string, fallback, min, max int) (int, error) {
+	raw := request.URL.Query().Get(name)
+	if len(raw) == 0 {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < min || value > max {
+		return 0, badRequest("%s must be an integer between %d and %d", name, min, max)
+	}
+	return value, nil
+}
+
+// statusWriter keeps the status code written, for the request log.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (writer *statusWriter) WriteHeader(status int) {
+	writer.status = status
+	writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *statusWriter) Flush() {
+	if flusher, ok := writer.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (writer *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := writer.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the connection cannot be taken over")
+	}
+	writer.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (server *Server) logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &statusWriter{ResponseWriter: writer, status: http.StatusOK}
+		handler.ServeHTTP(recorder, request)
+		server.logger.Debug("api request", "method", request.Method, "path", request.URL.Path,
+			"status", recorder.status, "remote", request.RemoteAddr, "duration", time.Since(start))
+	})
+}
+
+func writeJSON(writer http.ResponseWriter, status int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(body)
+}
+
+func writeError(writer http.ResponseWriter, err error) {
+	status := httpStatus(err)
+	writeJSON(writer, status, &apiError{Code: status, Message: err.Error()})
+}
@@ -0,0 +1,342 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/media/rtp"
+	"github.com/kokutas/gb28181/platform"
+	"github.com/kokutas/gb28181/simulator"
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+const testChannelID = "34020000001320000001"
+
+func newTestDevice(t *testing.T, server *Server) *simulator.Device {
+	clip, err := simulator.LoadClip("../media/ps/testdata/h264_g711.ps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := simulator.NewDevice(&simulator.Config{
+		DeviceID:      testDeviceID,
+		LocalAddress:  "127.0.0.1:0",
+		ServerID:      testServerID,
+		ServerAddress: server.GetUserAgent().Addr().String(),
+		Name:          "nvr",
+		Channels: []*manscdp.CatalogItem{
+			{DeviceID: testChannelID, Name: "gate", CivilCode: "340200"},
+			{DeviceID: "34020000001320000002", Name: "hall", Status: manscdp.StatusOff},
+		},
+		Records: []*manscdp.RecordItem{
+			{DeviceID: testChannelID, Name: "gate", StartTime: "2024-05-01T08:00:00", EndTime: "2024-05-01T09:00:00", Type: manscdp.RecordTypeTime},
+		},
+		PerPacket: 1,
+		Clip:      clip,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device.GetUserAgent().SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := device.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { device.Close() })
+	waitFor(t, "the catalog was not refreshed", func() bool {
+		return len(server.GetPlatform().GetCatalogStore().Channels(testDeviceID)) == 2
+	})
+	return device
+}
+
+func sendJSON(t *testing.T, server *Server, method, path string, body, v interface{}) int {
+	raw, _ := json.Marshal(body)
+	request, _ := http.NewRequest(method, "http://"+server.GetAPIAddr().String()+path, bytes.NewReader(raw))
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return response.StatusCode
+}
+
+func TestAPI_Devices(t *testing.T) {
+	server := newTestServer(t, &Config{})
+	newTestDevice(t, server)
+	devicePath := "/api/devices/" + testDeviceID
+
+	list := new(DeviceList)
+	if status := getJSON(t, server, "GET", "/api/devices?q=NVR&kind=device", list); status != 200 || list.Total != 1 || list.Items[0].OnlineChannels != 1 {
+		t.Fatalf("unexpected search %d %+v", status, list)
+	}
+	if getJSON(t, server, "GET", "/api/devices?q=camera", list); list.Total != 0 || len(list.Items) != 0 {
+		t.Fatalf("unexpected search %+v", list)
+	}
+	if getJSON(t, server, "GET", "/api/devices?page=2", list); list.Total != 1 || len(list.Items) != 0 {
+		t.Fatalf("unexpected page %+v", list)
+	}
+	var channels []*Channel
+	if status := getJSON(t, server, "GET", devicePath+"/channels?status=offline", &channels); status != 200 || len(channels) != 1 || channels[0].Name != "hall" || channels[0].DeviceID != testDeviceID {
+		t.Fatalf("unexpected channels %d %+v", status, channels)
+	}
+	refresh := new(CatalogRefresh)
+	if status := sendJSON(t, server, "POST", devicePath+"/catalog", nil, refresh); status != 200 || refresh.Changes != 0 || len(refresh.Channels) != 2 {
+		t.Fatalf("unexpected refresh %d %+v", status, refresh)
+	}
+	tree := new(RegionTree)
+	getJSON(t, server, "GET", "/api/regions", tree)
+	if len(tree.Regions) != 1 || tree.Regions[0].Code != "34" || len(tree.Regions[0].Regions) != 1 ||
+		tree.Regions[0].Regions[0].Channels[0].ID != testChannelID || len(tree.Others) != 1 {
+		t.Fatalf("unexpected regions %+v", tree)
+	}
+
+	failure := new(apiError)
+	for _, test := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/api/devices/3402", 400},
+		{"GET", "/api/devices/34020000001110000009", 404},
+		{"GET", devicePath + "/channels?status=broken", 400},
+		{"GET", "/api/devices?size=0", 400},
+		{"PUT", devicePath, 405},
+		{"GET", "/api/unknown", 404},
+		{"GET", devicePath + "/channels/" + testChannelID + "/records?start=2024-05-01T00:00:00", 400},
+		{"GET", devicePath + "/channels/" + testChannelID + "/records?start=2024-05-01T00:00:00&end=2024-07-01T00:00:00", 400},
+	} {
+		if status := getJSON(t, server, test.method, test.path, failure); status != test.status || failure.Code != test.status {
+			t.Fatalf("%s %s answered %d %+v, expected %d", test.method, test.path, status, failure, test.status)
+		}
+	}
+
+	var records []*Record
+	path := devicePath + "/channels/" + testChannelID + "/records?start=2024-05-01T00:00:00&end=2024-05-02T00:00:00&type=time"
+	if status := getJSON(t, server, "GET", path, &records); status != 200 || len(records) != 1 || records[0].End.Sub(records[0].Start) != time.Hour {
+		t.Fatalf("unexpected records %d %+v", status, records)
+	}
+	// the device answers 404 for a channel it does not know
+	if status := sendJSON(t, server, "POST", devicePath+"/catalog", nil, nil); status != 200 {
+		t.Fatalf("unexpected refresh status %d", status)
+	}
+	if status := sendJSON(t, server, "POST", devicePath+"/channels/34020000001320000099/live", nil, failure); status != 503 {
+		t.Fatalf("live without media server answered %d %+v", status, failure)
+	}
+}
+
+func TestAPI_Control(t *testing.T) {
+	server := newTestServer(t, &Config{})
+	device := newTestDevice(t, server)
+	controls := make(chan *manscdp.Control, 4)
+	device.OnControl(func(control *manscdp.Control) { controls <- control })
+	devicePath := "/api/devices/" + testDeviceID
+
+	if status := sendJSON(t, server, "POST", devicePath+"/channels/"+testChannelID+"/ptz", &PTZRequest{Action: "move", Pan: "right", Speed: 16}, nil); status != 204 {
+		t.Fatalf("unexpected ptz status %d", status)
+	}
+	select {
+	case <-controls:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the ptz command was not executed")
+	}
+	if state, _ := device.GetPTZ(testChannelID); state.Pan != 16 || !state.Moving {
+		t.Fatalf("unexpected ptz state %+v", state)
+	}
+	failure := new(apiError)
+	for _, body := range []interface{}{
+		&PTZRequest{Action: "move"},
+		&PTZRequest{Action: "move", Pan: "up"},
+		&PTZRequest{Action: "preset_call", Preset: 256},
+		&PTZRequest{Action: "spin"},
+		map[string]interface{}{"action": "stop", "unknown": 1},
+	} {
+		if status := sendJSON(t, server, "POST", devicePath+"/channels/"+testChannelID+"/ptz", body, failure); status != 400 {
+			t.Fatalf("ptz %+v answered %d", body, status)
+		}
+	}
+
+	result := new(ControlResult)
+	if status := sendJSON(t, server, "POST", devicePath+"/control", &ControlRequest{Command: "record", Target: testChannelID}, result); status != 200 || result.Result != manscdp.ResultOK {
+		t.Fatalf("unexpected control %d %+v", status, result)
+	}
+	if !device.IsRecording(testChannelID) {
+		t.Fatal("the channel is not recording")
+	}
+	if status := sendJSON(t, server, "POST", devicePath+"/control", &ControlRequest{Command: "explode"}, failure); status != 400 {
+		t.Fatalf("unexpected status %d of an unknown command", status)
+	}
+	if status := sendJSON(t, server, "POST", devicePath+"/control", &ControlRequest{Command: "record", Target: "34020000001320000099"}, failure); status != 404 {
+		t.Fatalf("the rejection of an unknown target answered %d %+v", status, failure)
+	}
+}
+
+func TestAPI_Live(t *testing.T) {
+	var receiver *rtp.Receiver
+	frames := make(chan *rtp.Frame, 64)
+	var port int
+	for receiver == nil || port%2 == 1 {
+		if receiver != nil {
+			receiver.Close()
+		}
+		receiver = rtp.NewReceiver("udp", "127.0.0.1:0", 16, func(frame *rtp.Frame) {
+			select {
+			case frames <- frame:
+			default:
+			}
+		})
+		if err := receiver.Listen(); err != nil {
+			t.Fatal(err)
+		}
+		_, raw, _ := net.SplitHostPort(receiver.Addr().String())
+		port, _ = strconv.Atoi(raw)
+	}
+	defer receiver.Close()
+	server := newTestServer(t, &Config{MediaServers: []*MediaServer{
+		{ID: "media", Host: "127.0.0.1", PortMin: uint16(port), PortMax: uint16(port), URL: "http://127.0.0.1/rtp/{ssrc}.flv?channel={channel}"},
+	}})
+	device := newTestDevice(t, server)
+	livePath := "/api/devices/" + testDeviceID + "/channels/" + testChannelID + "/live"
+
+	stream := new(Stream)
+	if status := sendJSON(t, server, "POST", livePath, nil, stream); status != 201 || stream.Port != uint16(port) ||
+		stream.URL != "http://127.0.0.1/rtp/"+stream.SSRC+".flv?channel="+testChannelID {
+		t.Fatalf("unexpected stream %d %+v", status, stream)
+	}
+	select {
+	case <-frames:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no media streamed")
+	}
+	again := new(Stream)
+	if status := sendJSON(t, server, "POST", livePath, nil, again); status != 200 || again.SSRC != stream.SSRC {
+		t.Fatalf("unexpected second start %d %+v", status, again)
+	}
+	failure := new(apiError)
+	if status := sendJSON(t, server, "POST", "/api/devices/"+testDeviceID+"/channels/34020000001320000002/live", nil, failure); status != 503 {
+		t.Fatalf("a start without free port answered %d %+v", status, failure)
+	}
+	var streams []*Stream
+	if getJSON(t, server, "GET", "/api/streams", &streams); len(streams) != 1 || streams[0].ChannelID != testChannelID {
+		t.Fatalf("unexpected streams %+v", streams)
+	}
+	if status := sendJSON(t, server, "DELETE", livePath, nil, nil); status != 204 {
+		t.Fatalf("unexpected stop status %d", status)
+	}
+	if status := sendJSON(t, server, "DELETE", livePath, nil, failure); status != 404 {
+		t.Fatalf("a second stop answered %d", status)
+	}
+	if len(device.GetStreams()) != 0 {
+		t.Fatal("the device still streams")
+	}
+
+	// a channel ending its stream frees the port
+	if status := sendJSON(t, server, "POST", livePath, nil, stream); status != 201 {
+		t.Fatalf("unexpected restart status %d", status)
+	}
+	if err := device.Bye(testChannelID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the stream ended by the device was kept", func() bool {
+		return len(server.GetStreams()) == 0
+	})
+	if status := sendJSON(t, server, "POST", "/api/devices/"+testDeviceID+"/channels/34020000001320000002/live", nil, failure); status != 503 {
+		t.Fatalf("the offline channel answered %d %+v", status, failure)
+	}
+}
+
+func TestAPI_StreamInfo(t *testing.T) {
+	var port int
+	for port == 0 || port%2 == 1 {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port = conn.LocalAddr().(*net.UDPAddr).Port
+		conn.Close()
+	}
+	server := newTestServer(t, &Config{MediaServers: []*MediaServer{
+		{ID: "probe", Host: "127.0.0.1", PortMin: uint16(port), PortMax: uint16(port), Analyze: true},
+	}})
+	newTestDevice(t, server)
+	subscriber := server.events.Subscribe(&EventFilter{Types: []string{EventStreamInfo}}, 0)
+	defer server.events.Unsubscribe(subscriber)
+
+	stream := new(Stream)
+	if status := sendJSON(t, server, "POST", "/api/devices/"+testDeviceID+"/channels/"+testChannelID+"/live", nil, stream); status != 201 {
+		t.Fatalf("unexpected stream %d %+v", status, stream)
+	}
+	select {
+	case event := <-subscriber.C:
+		info := event.Data.(*StreamInfoEvent)
+		if event.DeviceID != testDeviceID || info.ChannelID != testChannelID || info.Session != stream.SSRC || info.VideoCodec != "H.264" {
+			t.Fatalf("unexpected stream info %+v %+v", event, info.Info)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no stream info")
+	}
+	waitFor(t, "the stream info was not kept", func() bool {
+		streams := server.GetStreams()
+		return len(streams) == 1 && streams[0].Info != nil && streams[0].Info.Width > 0
+	})
+}
+
+func TestHTTPStatus(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+	}{
+		{lib.NewSipError(400, "Bad Request"), 400},
+		{lib.NewSipError(404, "Not Found"), 404},
+		{lib.NewSipError(480, "Temporarily Unavailable"), 503},
+		{lib.NewSipError(486, "Busy Here"), 409},
+		{lib.NewSipError(488, "Not Acceptable Here"), 502},
+		{lib.NewSipError(500, "Server Internal Error"), 502},
+		{lib.NewSipError(603, "Decline"), 403},
+		{platform.ErrNoResponse, 504},
+		{ua.ErrTimeout, 504},
+		{ErrNotRegistered, 404},
+		{ErrNoMediaPort, 503},
+		{badRequest("bad"), 400},
+		{errors.New("incomplete"), 502},
+	} {
+		if status := httpStatus(test.err); status != test.status {
+			t.Fatalf("%v mapped to %d, expected %d", test.err, status, test.status)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	server := newTestServer(t, &Config{})
+	document := make(map[string]interface{})
+	if status := getJSON(t, server, "GET", "/api/openapi.json", &document); status != 200 || document["openapi"] != "3.0.3" {
+		t.Fatalf("unexpected document %d %v", status, document)
+	}
+	paths := document["paths"].(map[string]interface{})
+	live := paths["/api/devices/{id}/channels/{channel}/live"].(map[string]interface{})
+	post := live["post"].(map[string]interface{})
+	if post["operationId"] != "postDevicesIdChannelsChannelLive" || len(post["parameters"].([]interface{})) != 2 || live["delete"] == nil {
+		t.Fatalf("unexpected live operations %v", live)
+	}
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	detail := schemas["DeviceDetail"].(map[string]interface{})["properties"].(map[string]interface{})
+	if detail["id"] == nil || detail["channels"] == nil || detail["callId"] != nil {
+		t.Fatalf("unexpected device detail schema %v", detail)
+	}
+	node := schemas["RegionNode"].(map[string]interface{})["properties"].(map[string]interface{})
+	if node["regions"].(map[string]interface{})["items"].(map[string]interface{})["$ref"] != "#/components/schemas/RegionNode" {
+		t.Fatalf("unexpected region schema %v", node)
+	}
+	if schemas["Stream"] == nil || schemas["PTZRequest"] == nil || schemas["apiError"] == nil {
+		t.Fatalf("missing schemas %v", schemas)
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/kokutas/gb28181/id"
+)
+
+// Defaults of a Config.
+const (
+	DefaultListen            = "0.0.0.0:5060"
+	DefaultKeepaliveInterval = 60 * time.Second
+	DefaultKeepaliveTimeouts = 3
+	DefaultMinExpires        = 60
+	DefaultMaxExpires        = 86400
+)
+
+// Duration is a time.Duration read from JSON as a string such as "60s" or
+// as a number of seconds.
+type Duration time.Duration
+
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
+}
+
+func (duration *Duration) UnmarshalJSON(raw []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case float64:
+		*duration = Duration(value * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("duration %s error : %s", value, err.Error())
+		}
+		*duration = Duration(parsed)
+	default:
+		return fmt.Errorf("duration %s error : not a string or a number", string(raw))
+	}
+	return nil
+}
+
+// Config configures a server. Zero values take the defaults.
+type Config struct {
+	ID        string `json:"id"`        // SIP id of the platform
+	Realm     string `json:"realm"`     // SIP domain, ID[:10] when empty
+	Listen    string `json:"listen"`    // SIP listen address
+	Transport string `json:"transport"` // udp or tcp, udp when empty
+	// Host is the IP address announced in Contact headers when the listen
+	// address is a wildcard.
+	Host string     `json:"host"`
+	Auth AuthConfig `json:"auth"`
+	// Registrations are granted between MinExpires and MaxExpires seconds.
+	MinExpires uint `json:"min_expires"`
+	MaxExpires uint `json:"max_expires"`
+	// A device is offline once KeepaliveTimeouts keepalives of
+	// KeepaliveInterval went missing.
+	KeepaliveInterval Duration       `json:"keepalive_interval"`
+	KeepaliveTimeouts int            `json:"keepalive_timeouts"`
+	QueryTimeout      Duration       `json:"query_timeout"` // wait for MANSCDP responses
+	MediaServers      []*MediaServer `json:"media_servers"`
+	API               string         `json:"api"` // management API listen address, disabled when empty
+	// EventHistory is the number of events kept for event stream clients
+	// resuming after a reconnection.
+	EventHistory int `json:"event_history"`
+	// Store is the BoltDB file keeping devices, channels and registrations
+	// across restarts; they are kept in memory when empty.
+	Store string    `json:"store"`
+	Log   LogConfig `json:"log"`
+}
+
+// AuthConfig is the password policy of registrations. Devices use their
+// own password, else the shared one; without any password registrations
+// are not authenticated.
+type AuthConfig struct {
+	Password string            `json:"password"`
+	Devices  map[string]string `json:"devices"` // passwords by device id
+	// Allow lists the id prefixes allowed to register, all when empty.
+	Allow []string `json:"allow"`
+}
+
+// MediaServer is a media server the devices stream to.
+type MediaServer struct {
+	ID      string `json:"id"`
+	Host    string `json:"host"` // IP address receiving RTP, announced in SDP offers
+	PortMin uint16 `json:"port_min"`
+	PortMax uint16 `json:"port_max"`
+	// URL is the template of the playback URL of a stream, with {ssrc},
+	// {device} and {channel} substituted, e.g. http://host/rtp/{ssrc}.flv.
+	URL string `json:"url"`
+	// Analyze makes this server receive the streams on Host itself and
+	// publish their stream info, e.g. to probe devices without a media
+	// server; Host must then be an address of this server.
+	Analyze bool `json:"analyze"`
+}
+
+type LogConfig struct {
+	Format string `json:"format"` // text or json
+	Level  string `json:"level"`  // debug, info, warn or error
+}
+
+// LoadConfig reads a JSON config file and checks it.
+func LoadConfig(path string) (*Config, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := new(Config)
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("config %s error : %s", path, err.Error())
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("config %s error : %s", path, err.Error())
+	}
+	return config, nil
+}
+
+// Validate fills the defaults in and checks the config.
+func (config *Config) Validate() error {
+	if err := id.Validate(config.ID); err != nil {
+		return err
+	}
+	if len(config.Realm) == 0 {
+		config.Realm = config.ID[:10]
+	}
+	if len(config.Listen) == 0 {
+		config.Listen = DefaultListen
+	}
+	if _, _, err := net.SplitHostPort(config.Listen); err != nil {
+		return fmt.Errorf("listen address error : %s", err.Error())
+	}
+	config.Transport = strings.ToLower(config.Transport)
+	if len(config.Transport) == 0 {
+		config.Transport = "udp"
+	}
+	if config.Transport != "udp" && config.Transport != "tcp" {
+		return fmt.Errorf("transport error : %s", config.Transport)
+	}
+	if len(config.Host) > 0 && net.ParseIP(config.Host) == nil {
+		return fmt.Errorf("host error : %s", config.Host)
+	}
+	for deviceID := range config.Auth.Devices {
+		if err := id.Validate(deviceID); err != nil {
+			return fmt.Errorf("auth device %s", err.Error())
+		}
+	}
+	if config.MinExpires == 0 {
+		config.MinExpires = DefaultMinExpires
+	}
+	if config.MaxExpires == 0 {
+		config.MaxExpires = DefaultMaxExpires
+	}
+	if config.MaxExpires < config.MinExpires {
+		return fmt.Errorf("max expires %d below min expires %d", config.MaxExpires, config.MinExpires)
+	}
+	if config.KeepaliveInterval <= 0 {
+		config.KeepaliveInterval = Duration(DefaultKeepaliveInterval)
+	}
+	if config.KeepaliveTimeouts <= 0 {
+		config.KeepaliveTimeouts = DefaultKeepaliveTimeouts
+	}
+	seen := make(map[string]bool)
+	for _, media := range config.MediaServers {
+		if len(media.ID) == 0 {
+			return errors.New("a media server has no id")
+		}
+		if seen[media.ID] {
+			return fmt.Errorf("media server %s repeated", media.ID)
+		}
+		seen[media.ID] = true
+		if net.ParseIP(media.Host) == nil {
+			return fmt.Errorf("media server %s host error : %s", media.ID, media.Host)
+		}
+		if media.PortMin == 0 || media.PortMax < media.PortMin {
+			return fmt.Errorf("media server %s port range error : %d-%d", media.ID, media.PortMin, media.PortMax)
+		}
+	}
+	if len(config.API) > 0 {
+		if _, _, err := net.SplitHostPort(config.API); err != nil {
+			return fmt.Errorf("api address error : %s", err.Error())
+		}
+	}
+	if config.EventHistory < 0 {
+		return fmt.Errorf("event history error : %d", config.EventHistory)
+	}
+	if config.EventHistory == 0 {
+		config.EventHistory = DefaultEventHistory
+	}
+	if _, err := ParseLevel(config.Log.Level); err != nil {
+		return err
+	}
+	if format := config.Log.Format; len(format) > 0 && format != "text" && format != "json" {
+		return fmt.Errorf("log format error : %s", format)
+	}
+	return nil
+}
+
+// Credentials returns the password of a device and whether it may
+// register, following the policy.
+func (auth *AuthConfig) Credentials(deviceID string) (string, bool) {
+	if len(auth.Allow) > 0 {
+		allowed := false
+		for _, prefix := range auth.Allow {
+			if strings.HasPrefix(deviceID, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", false
+		}
+	}
+	if password, ok := auth.Devices[deviceID]; ok {
+		return password, true
+	}
+	return auth.Password, true
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig("../cmd/gb28181-server/config.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Realm != "3402000000" || time.Duration(config.KeepaliveInterval) != time.Minute ||
+		len(config.MediaServers) != 1 || config.MediaServers[0].PortMax != 30500 || config.Log.Format != "json" {
+		t.Fatalf("unexpected config %+v", config)
+	}
+	if password, ok := config.Auth.Credentials("34020000001110000001"); !ok || password != "device-password" {
+		t.Fatalf("unexpected device password %q %v", password, ok)
+	}
+	if password, ok := config.Auth.Credentials("34020000001110000002"); !ok || password != "12345678" {
+		t.Fatalf("unexpected shared password %q %v", password, ok)
+	}
+	if _, ok := config.Auth.Credentials("11010000001110000001"); ok {
+		t.Fatal("an id outside of the allowed prefixes must not register")
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	ioutil.WriteFile(path, []byte(`{"id": "34020000002000000001", "keepalive_interval": 30}`), 0644)
+	config, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Realm != "3402000000" || config.Listen != DefaultListen || config.Transport != "udp" ||
+		time.Duration(config.KeepaliveInterval) != 30*time.Second || config.MaxExpires != DefaultMaxExpires ||
+		config.EventHistory != DefaultEventHistory {
+		t.Fatalf("unexpected defaults %+v", config)
+	}
+	raw, _ := json.Marshal(config.KeepaliveInterval)
+	if string(raw) != `"30s"` {
+		t.Fatalf("unexpected duration %s", raw)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for _, config := range []*Config{
+		{ID: "3402000000200000001"},
+		{ID: "34020000002000000001", Transport: "sctp"},
+		{ID: "34020000002000000001", MinExpires: 600, MaxExpires: 60},
+		{ID: "34020000002000000001", MediaServers: []*MediaServer{{ID: "a", Host: "media", PortMin: 1, PortMax: 2}}},
+		{ID: "34020000002000000001", MediaServers: []*MediaServer{{ID: "a", Host: "10.0.0.1", PortMin: 2, PortMax: 1}}},
+		{ID: "34020000002000000001", Auth: AuthConfig{Devices: map[string]string{"1": "x"}}},
+		{ID: "34020000002000000001", Log: LogConfig{Level: "verbose"}},
+		{ID: "34020000002000000001", EventHistory: -1},
+	} {
+		if err := config.Validate(); err == nil {
+			t.Fatalf("config %+v must be rejected", config)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	mediastream "github.com/kokutas/gb28181/media/stream"
+	"github.com/kokutas/gb28181/platform"
+)
+
+// DefaultEventHistory is the number of events kept for clients resuming
+// after a reconnection.
+const DefaultEventHistory = 1024
+
+// subscriberBuffer is the number of events a subscriber may lag behind
+// before it is dropped.
+const subscriberBuffer = 256
+
+// Event types.
+const (
+	EventOnline      = "device.online"
+	EventOffline     = "device.offline"
+	EventAlarm       = "alarm"
+	EventCatalog     = "catalog"
+	EventPosition    = "position"
+	EventStreamStart = "stream.start"
+	EventStreamStop  = "stream.stop"
+	EventStreamInfo  = "stream.info"
+)
+
+// EventTypes lists the event types.
+var EventTypes = []string{EventOnline, EventOffline, EventAlarm, EventCatalog, EventPosition, EventStreamStart, EventStreamStop, EventStreamInfo}
+
+// Event is a change pushed to the event stream clients. IDs grow by one
+// from 1 for the life of the server.
+type Event struct {
+	ID       uint64      `json:"id"`
+	Type     string      `json:"type"`
+	DeviceID string      `json:"device_id"`
+	Time     time.Time   `json:"time"`
+	Data     interface{} `json:"data"`
+}
+
+// RegistrationEvent is the data of the online and offline events; Reason
+// is one of the Reason values.
+type RegistrationEvent struct {
+	*Registration
+	Reason string `json:"reason"`
+}
+
+// AlarmEvent is the data of alarm events.
+type AlarmEvent struct {
+	DeviceID    string    `json:"device_id"` // device or alarm input raising the alarm
+	Priority    int       `json:"priority"`
+	Method      int       `json:"method"`
+	Type        int       `json:"type"`
+	EventType   int       `json:"event_type,omitempty"`
+	Time        time.Time `json:"time"`
+	Description string    `json:"description,omitempty"`
+	Longitude   float64   `json:"longitude,omitempty"`
+	Latitude    float64   `json:"latitude,omitempty"`
+}
+
+// CatalogEvent is the data of catalog events; Event is ADD, UPDATE, DEL
+// or another manscdp.CatalogEvent value.
+type CatalogEvent struct {
+	Event   string   `json:"event"`
+	Channel *Channel `json:"channel"`
+}
+
+// PositionEvent is the data of position events.
+type PositionEvent struct {
+	Time      time.Time `json:"time"`
+	Longitude float64   `json:"longitude"`
+	Latitude  float64   `json:"latitude"`
+	Speed     float64   `json:"speed"`     // km/h
+	Direction float64   `json:"direction"` // degrees clockwise from north
+	Altitude  float64   `json:"altitude"`  // meters
+}
+
+// StreamInfoEvent is the data of stream info events, published when the
+// coding of an analyzed stream changes; its session is the SSRC.
+type StreamInfoEvent struct {
+	ChannelID string `json:"channel_id"`
+	*mediastream.Info
+}
+
+// EventFilter selects events by type and device; empty lists select all.
+type EventFilter struct {
+	Types   []string
+	Devices []string
+}
+
+// Match reports whether the filter selects an event.
+func (filter *EventFilter) Match(event *Event) bool {
+	return matchAny(filter.Types, event.Type) && matchAny(filter.Devices, event.DeviceID)
+}
+
+func matchAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// EventBus fans events out to subscribers and keeps the latest ones in a
+// ring buffer for subscribers resuming from an event ID.
+type EventBus struct {
+	mutex       sync.Mutex
+	history     []*Event
+	next        int // index of the next event in history
+	full        bool
+	lastID      uint64
+	subscribers map[*Subscriber]bool
+	closed      bool
+}
+
+// Subscriber receives the events of its filter on C, closed by
+// Unsubscribe, when the bus closes or when the subscriber lags more than
+// subscriberBuffer events behind; it may then resume from its last event.
+type Subscriber struct {
+	C      <-chan *Event
+	events chan *Event
+	filter EventFilter
+}
+
+// NewEventBus keeps history events; history ≤ 0 means DefaultEventHistory.
+func NewEventBus(history int) *EventBus {
+	if history <= 0 {
+		history = DefaultEventHistory
+	}
+	return &EventBus{
+		history:     make([]*Event, history),
+		subscribers: make(map[*Subscriber]bool),
+	}
+}
+
+// Publish numbers an event and sends it to the subscribers.
+func (bus *EventBus) Publish(eventType, deviceID string, data interface{}) *Event {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	if bus.closed {
+		return nil
+	}
+	bus.lastID++
+	event := &Event{ID: bus.lastID, Type: eventType, DeviceID: deviceID, Time: time.Now(), Data: data}
+	bus.history[bus.next] = event
+	bus.next = (bus.next + 1) % len(bus.history)
+	if bus.next == 0 {
+		bus.full = true
+	}
+	for subscriber := range bus.subscribers {
+		if !subscriber.filter.Match(event) {
+			continue
+		}
+		select {
+		case subscriber.events <- event:
+		default:
+			delete(bus.subscribers, subscriber)
+			close(subscriber.events)
+		}
+	}
+	return event
+}
+
+// Subscribe returns a subscriber with the kept events of the filter
+// following lastID already queued; lastID 0 resumes nothing. An ID beyond
+// the last one was issued before a restart and resumes all kept events.
+func (bus *EventBus) Subscribe(filter *EventFilter, lastID uint64) *Subscriber {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	var missed []*Event
+	if lastID > 0 {
+		if lastID > bus.lastID {
+			lastID = 0
+		}
+		for _, event := range bus.events() {
+			if event.ID > lastID && filter.Match(event) {
+				missed = append(missed, event)
+			}
+		}
+	}
+	events := make(chan *Event, subscriberBuffer+len(missed))
+	for _, event := range missed {
+		events <- event
+	}
+	subscriber := &Subscriber{C: events, events: events, filter: *filter}
+	if bus.closed {
+		close(events)
+	} else {
+		bus.subscribers[subscriber] = true
+	}
+	return subscriber
+}
+
+// Unsubscribe stops the events of a subscriber and closes its channel.
+func (bus *EventBus) Unsubscribe(subscriber *Subscriber) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	if bus.subscribers[subscriber] {
+		delete(bus.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
+
+// Events returns the kept events, oldest first.
+func (bus *EventBus) Events() []*Event {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	return bus.events()
+}
+
+func (bus *EventBus) events() []*Event {
+	if !bus.full {
+		return append([]*Event(nil), bus.history[:bus.next]...)
+	}
+	return append(append([]*Event(nil), bus.history[bus.next:]...), bus.history[:bus.next]...)
+}
+
+// Close ends all subscribers; later events are dropped.
+func (bus *EventBus) Close() {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	bus.closed = true
+	for subscriber := range bus.subscribers {
+		close(subscriber.events)
+	}
+	bus.subscribers = make(map[*Subscriber]bool)
+}
+
+// publishAlarm, publishCatalogChange and publishPosition forward the
+// platform notifications to the event bus.
+func (server *Server) publishAlarm(alarm *platform.Alarm) {
+	// the alarm of an input names the input, the event its device
+	server.events.Publish(EventAlarm, alarm.From, &AlarmEvent{
+		DeviceID:    alarm.DeviceID,
+		Priority:    alarm.Priority,
+		Method:      alarm.Method,
+		Type:        alarm.Type,
+		EventType:   alarm.EventType,
+		Time:        alarm.Time,
+		Description: alarm.Description,
+		Longitude:   alarm.Longitude,
+		Latitude:    alarm.Latitude,
+	})
+}
+
+func (server *Server) publishCatalogChange(change *platform.CatalogChange) {
+	server.events.Publish(EventCatalog, change.DeviceID, &CatalogEvent{
+		Event:   change.Event,
+		Channel: newChannel(change.DeviceID, change.Channel),
+	})
+}
+
+func (server *Server) publishPosition(position *platform.Position) {
+	server.events.Publish(EventPosition, position.DeviceID, &PositionEvent{
+		Time:      position.Time,
+		Longitude: position.Longitude,
+		Latitude:  position.Latitude,
+		Speed:     position.Speed,
+		Direction: position.Direction,
+		Altitude:  position.Altitude,
+	})
+}
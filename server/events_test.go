@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus(4)
+	for i := 0; i < 6; i++ {
+		bus.Publish(EventOnline, "3402000000111000000"+strconv.Itoa(i%2), nil)
+	}
+	events := bus.Events()
+	if len(events) != 4 || events[0].ID != 3 || events[3].ID != 6 {
+		t.Fatalf("unexpected history %+v", events)
+	}
+
+	filter := &EventFilter{Devices: []string{"34020000001110000001"}}
+	subscriber := bus.Subscribe(filter, 2)
+	for _, expected := range []uint64{4, 6} {
+		if event := <-subscriber.C; event.ID != expected {
+			t.Fatalf("resumed event %d, expected %d", event.ID, expected)
+		}
+	}
+	bus.Publish(EventOffline, "34020000001110000000", nil)
+	bus.Publish(EventOffline, "34020000001110000001", nil)
+	if event := <-subscriber.C; event.ID != 8 || event.Type != EventOffline {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	bus.Unsubscribe(subscriber)
+	if _, ok := <-subscriber.C; ok {
+		t.Fatal("the channel of an unsubscribed subscriber is open")
+	}
+
+	// an id of a previous run resumes all kept events
+	if subscriber := bus.Subscribe(&EventFilter{Types: []string{EventOffline}}, 100); len(subscriber.C) != 2 {
+		t.Fatalf("unexpected resume of %d events", len(subscriber.C))
+	}
+	if subscriber := bus.Subscribe(&EventFilter{}, 0); len(subscriber.C) != 0 {
+		t.Fatal("a new subscriber got past events")
+	}
+
+	lagging := bus.Subscribe(&EventFilter{}, 0)
+	for i := 0; i <= subscriberBuffer; i++ {
+		bus.Publish(EventAlarm, "34020000001110000001", nil)
+	}
+	for range lagging.C {
+	}
+	bus.Close()
+	if event := bus.Publish(EventAlarm, "34020000001110000001", nil); event != nil {
+		t.Fatal("a closed bus published")
+	}
+	if _, ok := <-bus.Subscribe(&EventFilter{}, 0).C; ok {
+		t.Fatal("a subscriber of a closed bus is open")
+	}
+}
+
+// readEvent reads the next server-sent event, skipping comments and
+// fields other than id, event and data.
+func readEvent(t *testing.T, reader *bufio.Reader) (string, *Event) {
+	var id, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case len(line) == 0 && len(data) > 0:
+			event := new(Event)
+			if err := json.Unmarshal([]byte(data), event); err != nil {
+				t.Fatal(err)
+			}
+			return id, event
+		case strings.HasPrefix(line, "id: "):
+			id = line[4:]
+		case strings.HasPrefix(line, "data: "):
+			data = line[6:]
+		}
+	}
+}
+
+func openEvents(t *testing.T, server *Server, query, lastID string) (*http.Response, *bufio.Reader) {
+	request, _ := http.NewRequest("GET", "http://"+server.GetAPIAddr().String()+"/api/events"+query, nil)
+	if len(lastID) > 0 {
+		request.Header.Set("Last-Event-ID", lastID)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	if response.StatusCode != 200 || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected answer %d %s", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+	return response, bufio.NewReader(response.Body)
+}
+
+func TestAPI_Events(t *testing.T) {
+	server := newTestServer(t, &Config{})
+	_, reader := openEvents(t, server, "?type=device.online,alarm&device="+testDeviceID, "")
+	device := newTestDevice(t, server)
+
+	id, event := readEvent(t, reader)
+	if event.Type != EventOnline || event.DeviceID != testDeviceID || id != strconv.FormatUint(event.ID, 10) {
+		t.Fatalf("unexpected event %s %+v", id, event)
+	}
+	if data := event.Data.(map[string]interface{}); data["reason"] != ReasonRegister || data["id"] != testDeviceID {
+		t.Fatalf("unexpected online data %v", data)
+	}
+	alarm := manscdp.NewAlarmNotify(1, testChannelID, 1, 5, time.Now())
+	if err := device.GetClient().Send(alarm); err != nil {
+		t.Fatal(err)
+	}
+	// catalog events are filtered out
+	if _, event = readEvent(t, reader); event.Type != EventAlarm || event.DeviceID != testDeviceID ||
+		event.Data.(map[string]interface{})["device_id"] != testChannelID {
+		t.Fatalf("unexpected alarm %+v", event)
+	}
+
+	// a client reconnecting gets the events it missed
+	_, resumed := openEvents(t, server, "?type=catalog", id)
+	for _, channelID := range []string{testChannelID, "34020000001320000002"} {
+		_, event := readEvent(t, resumed)
+		channel := event.Data.(map[string]interface{})["channel"].(map[string]interface{})
+		if event.Type != EventCatalog || channel["id"] != channelID {
+			t.Fatalf("unexpected resumed event %+v", event)
+		}
+	}
+
+	failure := new(apiError)
+	for _, query := range []string{"?type=reboot", "?device=3402", "?last_event_id=x"} {
+		if status := getJSON(t, server, "GET", "/api/events"+query, failure); status != 400 {
+			t.Fatalf("%s answered %d", query, status)
+		}
+	}
+	if status := getJSON(t, server, "GET", "/api/events/ws", failure); status != 400 {
+		t.Fatalf("a request without handshake answered %d", status)
+	}
+
+	// closing the server ends the streams
+	done := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, reader)
+		close(done)
+	}()
+	server.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the event stream outlived the server")
+	}
+}
+
+// readFrame reads an unmasked server frame.
+func readFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(reader, head); err != nil {
+		t.Fatal(err)
+	}
+	length := int(head[1] & 0x7f)
+	if length == 126 {
+		extended := make([]byte, 2)
+		io.ReadFull(reader, extended)
+		length = int(binary.BigEndian.Uint16(extended))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0f, payload
+}
+
+func TestAPI_EventSocket(t *testing.T) {
+	server := newTestServer(t, &Config{MediaServers: []*MediaServer{
+		{ID: "media", Host: "127.0.0.1", PortMin: 30000, PortMax: 30010},
+	}})
+	newTestDevice(t, server)
+	conn, err := net.Dial("tcp", server.GetAPIAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	conn.Write([]byte("GET /api/events/ws?type=stream.start,stream.stop&last_event_id=1 HTTP/1.1\r\n" +
+		"Host: " + server.GetAPIAddr().String() + "\r\n" +
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 101 || response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected handshake %d %v", response.StatusCode, response.Header)
+	}
+
+	livePath := "/api/devices/" + testDeviceID + "/channels/" + testChannelID + "/live"
+	stream := new(Stream)
+	if status := sendJSON(t, server, "POST", livePath, nil, stream); status != 201 {
+		t.Fatalf("unexpected start status %d", status)
+	}
+	sendJSON(t, server, "DELETE", livePath, nil, nil)
+	for _, expected := range []string{EventStreamStart, EventStreamStop} {
+		opcode, payload := readFrame(t, reader)
+		event := new(Event)
+		if err := json.Unmarshal(payload, event); opcode != opText || err != nil {
+			t.Fatalf("unexpected frame %d %s", opcode, payload)
+		}
+		if event.Type != expected || event.Data.(map[string]interface{})["ssrc"] != stream.SSRC {
+			t.Fatalf("unexpected event %+v, expected %s", event, expected)
+		}
+	}
+
+	// a masked ping is answered, then a close is echoed
+	mask := []byte{1, 2, 3, 4}
+	ping := []byte("hi")
+	conn.Write(append([]byte{0x80 | opPing, 0x80 | byte(len(ping))}, append(mask, ping[0]^mask[0], ping[1]^mask[1])...))
+	if opcode, payload := readFrame(t, reader); opcode != opPong || string(payload) != "hi" {
+		t.Fatalf("unexpected pong %d %q", opcode, payload)
+	}
+	conn.Write(append([]byte{0x80 | opClose, 0x80 | 2}, append(mask, 0x03^mask[0], 0xe8^mask[1])...))
+	if opcode, payload := readFrame(t, reader); opcode != opClose || binary.BigEndian.Uint16(payload) != 1000 {
+		t.Fatalf("unexpected close %d %v", opcode, payload)
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Fatalf("the connection is open after a close : %v", err)
+	}
+}
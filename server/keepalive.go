@@ -0,0 +1,90 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// maxCheckPeriod bounds the delay before a silent device goes offline.
+const maxCheckPeriod = time.Second
+
+// Monitor records the keepalives of registered devices and takes devices
+// offline once their registration expired or their keepalives stopped.
+type Monitor struct {
+	registrar *Registrar
+	interval  time.Duration
+	timeouts  int
+
+	mutex  sync.Mutex
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// NewMonitor takes devices offline after timeouts keepalives of interval
+// went missing.
+func NewMonitor(registrar *Registrar, interval time.Duration, timeouts int) *Monitor {
+	return &Monitor{
+		registrar: registrar,
+		interval:  interval,
+		timeouts:  timeouts,
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// ServeKeepalive serves Notify/Keepalive as a platform.MessageHandler. A
+// device not registered gets 403, to make it register again.
+func (monitor *Monitor) ServeKeepalive(tx *ua.ServerTransaction, envelope *manscdp.Envelope) int {
+	keepalive := new(manscdp.KeepaliveNotify)
+	if err := manscdp.Unmarshal(tx.GetRequest().GetBody(), keepalive); err != nil {
+		return 400
+	}
+	var faults []string
+	if keepalive.Info != nil {
+		faults = keepalive.Info.DeviceIDs
+	}
+	if !monitor.registrar.Touch(keepalive.DeviceID, tx.GetSource(), faults) {
+		return 403
+	}
+	return 200
+}
+
+// Start checks the registrations in the background until Close.
+func (monitor *Monitor) Start() {
+	go monitor.run()
+}
+
+// Close stops the checks.
+func (monitor *Monitor) Close() {
+	monitor.mutex.Lock()
+	select {
+	case <-monitor.closed:
+		monitor.mutex.Unlock()
+		return
+	default:
+	}
+	close(monitor.closed)
+	monitor.mutex.Unlock()
+	<-monitor.done
+}
+
+func (monitor *Monitor) run() {
+	defer close(monitor.done)
+	period := monitor.interval
+	if period > maxCheckPeriod {
+		period = maxCheckPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			monitor.registrar.Expire(now, monitor.interval*time.Duration(monitor.timeouts))
+		case <-monitor.closed:
+			return
+		}
+	}
+}
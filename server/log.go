@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log record.
+type Level int
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (level Level) String() string {
+	switch level {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return strconv.Itoa(int(level))
+}
+
+// ParseLevel parses a level name, info when empty.
+func ParseLevel(raw string) (Level, error) {
+	switch strings.ToLower(raw) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("log level error : %s", raw)
+}
+
+// Logger writes structured records, a message with key value pairs, as
+// logfmt text or JSON lines.
+type Logger struct {
+	output *loggerOutput
+	level  Level
+	fields []interface{}
+}
+
+// loggerOutput is the writer the loggers derived by With share.
+type loggerOutput struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	json   bool
+}
+
+// NewLogger writes the records of level and above to writer, as JSON lines
+// when format is json.
+func NewLogger(writer io.Writer, format string, level Level) *Logger {
+	return &Logger{output: &loggerOutput{writer: writer, json: format == "json"}, level: level}
+}
+
+// With returns a logger adding the key value pairs to every record.
+func (logger *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(logger.fields)+len(keyvals))
+	fields = append(fields, logger.fields...)
+	return &Logger{output: logger.output, level: logger.level, fields: append(fields, keyvals...)}
+}
+
+func (logger *Logger) Debug(msg string, keyvals ...interface{}) {
+	logger.Log(LevelDebug, msg, keyvals...)
+}
+func (logger *Logger) Info(msg string, keyvals ...interface{}) {
+	logger.Log(LevelInfo, msg, keyvals...)
+}
+func (logger *Logger) Warn(msg string, keyvals ...interface{}) {
+	logger.Log(LevelWarn, msg, keyvals...)
+}
+func (logger *Logger) Error(msg string, keyvals ...interface{}) {
+	logger.Log(LevelError, msg, keyvals...)
+}
+
+// Log writes a record of level. Keys are strings; a key missing its value
+// gets an empty one.
+func (logger *Logger) Log(level Level, msg string, keyvals ...interface{}) {
+	if level < logger.level {
+		return
+	}
+	fields := make([]interface{}, 0, 6+len(logger.fields)+len(keyvals))
+	fields = append(fields, "time", time.Now().Format(time.RFC3339Nano), "level", level.String(), "msg", msg)
+	fields = append(fields, logger.fields...)
+	fields = append(fields, keyvals...)
+	if len(fields)%2 == 1 {
+		fields = append(fields, "")
+	}
+	var buffer bytes.Buffer
+	if logger.output.json {
+		buffer.WriteByte('{')
+		for i := 0; i < len(fields); i += 2 {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+			key, _ := json.Marshal(fmt.Sprint(fields[i]))
+			buffer.Write(key)
+			buffer.WriteByte(':')
+			buffer.Write(jsonValue(fields[i+1]))
+		}
+		buffer.WriteByte('}')
+	} else {
+		for i := 0; i < len(fields); i += 2 {
+			if i > 0 {
+				buffer.WriteByte(' ')
+			}
+			buffer.WriteString(fmt.Sprint(fields[i]))
+			buffer.WriteByte('=')
+			buffer.WriteString(textValue(fields[i+1]))
+		}
+	}
+	buffer.WriteByte('\n')
+	logger.output.mutex.Lock()
+	defer logger.output.mutex.Unlock()
+	logger.output.writer.Write(buffer.Bytes())
+}
+
+// Writer returns a writer logging each line written to it as the message
+// of a record of level, e.g. to route the standard logger.
+func (logger *Logger) Writer(level Level) io.Writer {
+	return &logWriter{logger: logger, level: level}
+}
+
+type logWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (writer *logWriter) Write(raw []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(raw), "\n"), "\n") {
+		writer.logger.Log(writer.level, line)
+	}
+	return len(raw), nil
+}
+
+func jsonValue(value interface{}) []byte {
+	switch value := value.(type) {
+	case error:
+		raw, _ := json.Marshal(value.Error())
+		return raw
+	case time.Duration:
+		raw, _ := json.Marshal(value.String())
+		return raw
+	case fmt.Stringer:
+		raw, _ := json.Marshal(value.String())
+		return raw
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		raw, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return raw
+}
+
+// textValue quotes values with spaces, quotes or equal signs.
+func textValue(value interface{}) string {
+	text := fmt.Sprint(value)
+	if len(text) == 0 || strings.ContainsAny(text, " \t\"=\n") {
+		return strconv.Quote(text)
+	}
+	return text
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := NewLogger(&buffer, "text", LevelInfo).With("device", "34020000001110000001")
+	logger.Debug("hidden")
+	logger.Info("device online", "address", "127.0.0.1:5070", "reason", "keepalive timeout")
+	line := buffer.String()
+	if strings.Contains(line, "hidden") || !strings.Contains(line, `level=info msg="device online" device=34020000001110000001 address=127.0.0.1:5070 reason="keepalive timeout"`) {
+		t.Fatalf("unexpected text record %q", line)
+	}
+
+	buffer.Reset()
+	logger = NewLogger(&buffer, "json", LevelDebug)
+	logger.Warn("query failed", "error", errors.New("timed out"), "channels", 3, "odd")
+	record := make(map[string]interface{})
+	if err := json.Unmarshal(buffer.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["level"] != "warn" || record["msg"] != "query failed" || record["error"] != "timed out" || record["channels"] != 3.0 || record["odd"] != "" {
+		t.Fatalf("unexpected json record %v", record)
+	}
+
+	buffer.Reset()
+	standard := log.New(logger.Writer(LevelInfo), "", 0)
+	standard.Printf("register to %s error : %s", "34020000002000000001", "Forbidden")
+	if !strings.Contains(buffer.String(), `"msg":"register to 34020000002000000001 error : Forbidden"`) {
+		t.Fatalf("unexpected routed record %q", buffer.String())
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// openAPIBuilder derives an OpenAPI 3.0 document from the routes, and the
+// schemas of their models from the json tags.
+type openAPIBuilder struct {
+	schemas map[string]interface{}
+}
+
+func (server *Server) getOpenAPI(request *apiRequest) (interface{}, error) {
+	return server.openAPI(server.routes()), nil
+}
+
+// openAPI returns the OpenAPI document of routes.
+func (server *Server) openAPI(routes []*apiRoute) map[string]interface{} {
+	builder := &openAPIBuilder{schemas: make(map[string]interface{})}
+	errorSchema := builder.schema(reflect.TypeOf(apiError{}))
+	paths := make(map[string]interface{})
+	for _, route := range routes {
+		operation := map[string]interface{}{
+			"summary":     route.summary,
+			"operationId": operationID(route),
+			"tags":        []string{route.tag},
+		}
+		var params []interface{}
+		for _, param := range route.params {
+			params = append(params, map[string]interface{}{
+				"name":        param.name,
+				"in":          param.in,
+				"required":    param.required,
+				"description": param.description,
+				"schema":      map[string]interface{}{"type": param.kind},
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if route.body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(builder.schema(reflect.TypeOf(route.body))),
+			}
+		}
+		success := map[string]interface{}{"description": http.StatusText(route.status)}
+		if route.result != nil {
+			schema := builder.schema(reflect.TypeOf(route.result))
+			if len(route.contentType) > 0 {
+				success["content"] = map[string]interface{}{route.contentType: map[string]interface{}{"schema": schema}}
+			} else {
+				success["content"] = jsonContent(schema)
+			}
+		}
+		operation["responses"] = map[string]interface{}{
+			strconv.Itoa(route.status): success,
+			"default": map[string]interface{}{
+				"description": "error; SIP rejections of the device map to 4xx and 5xx statuses",
+				"content":     jsonContent(errorSchema),
+			},
+		}
+		item, ok := paths[route.pattern].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[route.pattern] = item
+		}
+		item[strings.ToLower(route.method)] = operation
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "GB28181 server " + server.config.ID,
+			"version": "1.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": builder.schemas},
+	}
+}
+
+// operationID names an operation after its method and path, e.g.
+// postDevicesIdChannelsChannelLive.
+func operationID(route *apiRoute) string {
+	name := strings.ToLower(route.method)
+	for _, segment := range strings.Split(strings.TrimPrefix(route.pattern, apiPrefix), "/") {
+		segment = strings.Trim(segment, "{}")
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '.' || r == '_' }) {
+			name += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return name
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// schema returns the schema of a type, a reference for named structs.
+func (builder *openAPIBuilder) schema(t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": builder.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": builder.schema(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if len(name) == 0 {
+			return builder.object(t)
+		}
+		if _, ok := builder.schemas[name]; !ok {
+			// reserved first, for models referring to themselves
+			builder.schemas[name] = nil
+			builder.schemas[name] = builder.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// object returns the object schema of a struct; embedded structs lend
+// their fields, as in encoding/json.
+func (builder *openAPIBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options := tag, ""
+			if index := strings.Index(tag, ","); index >= 0 {
+				name, options = tag[:index], tag[index+1:]
+			}
+			fieldType := field.Type
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if field.Anonymous && len(name) == 0 && fieldType.Kind() == reflect.Struct {
+				collect(fieldType)
+				continue
+			}
+			if len(field.PkgPath) > 0 {
+				continue
+			}
+			if len(name) == 0 {
+				name = field.Name
+			}
+			properties[name] = builder.schema(field.Type)
+			if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+				required = append(required, name)
+			}
+		}
+	}
+	collect(t)
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
@@ -0,0 +1,545 @@
+package server
+
+import (
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/id"
+	"github.com/kokutas/gb28181/sip/auth"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+	"github.com/kokutas/gb28181/store"
+)
+
+// nonceLifetime bounds the use of a digest challenge, which is also used
+// up by the registration it authorizes.
+const nonceLifetime = 5 * time.Minute
+
+// Reasons of registration changes.
+const (
+	ReasonRegister   = "register"
+	ReasonRestart    = "restart"
+	ReasonUnregister = "unregister"
+	ReasonExpired    = "expired"
+	ReasonKeepalive  = "keepalive timeout"
+	ReasonRemoved    = "removed"
+	ReasonRestored   = "restored"
+)
+
+// Registration is a device, or a lower-level platform, registered with
+// the server.
+type Registration struct {
+	ID            string      `json:"id"`
+	Kind          string      `json:"kind"`
+	Address       string      `json:"address"` // host:port its requests come from
+	Network       string      `json:"network"`
+	Contact       string      `json:"contact,omitempty"`
+	UserAgent     string      `json:"user_agent,omitempty"`
+	RegisteredAt  time.Time   `json:"registered_at"`
+	Expiry        time.Time   `json:"expiry"`
+	LastKeepalive time.Time   `json:"last_keepalive"`
+	Faults        []string    `json:"faults,omitempty"` // devices in fault by the last keepalive
+	Info          *DeviceInfo `json:"info,omitempty"`
+	callId        string
+}
+
+// DeviceInfo is what a device answered to a DeviceInfo query.
+type DeviceInfo struct {
+	Name         string `json:"name,omitempty"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Firmware     string `json:"firmware,omitempty"`
+	Channels     int    `json:"channels"`
+}
+
+// Credentials returns the password of a device and whether it may
+// register; an empty password registers it without authentication.
+type Credentials func(deviceID string) (string, bool)
+
+// RegistrationHandler is told when a device comes online, registering or
+// registering again after a restart, and when it goes offline.
+type RegistrationHandler func(registration *Registration, online bool, reason string)
+
+// Registrar serves the REGISTER requests of devices and lower-level
+// platforms: it checks their ids, asks for digest authentication and keeps
+// their registrations.
+type Registrar struct {
+	realm       string
+	credentials Credentials
+	minExpires  uint
+	maxExpires  uint
+	logger      *Logger
+
+	mutex         sync.Mutex
+	registrations map[string]*Registration
+	nonces        map[string]time.Time
+	handlers      []RegistrationHandler
+	repository    store.Repository
+	writes        map[string]*registrationWrite // by device id
+}
+
+// registrationWrite is the last change of a registration to store; one
+// writer at a time stores the changes of a device, outside the mutex.
+type registrationWrite struct {
+	registration *store.Registration // nil deletes it
+	pending      bool
+	busy         bool
+}
+
+// NewRegistrar builds a registrar of realm. Without credentials every
+// device registers without authentication.
+func NewRegistrar(realm string, credentials Credentials) *Registrar {
+	return &Registrar{
+		realm:         realm,
+		credentials:   credentials,
+		minExpires:    DefaultMinExpires,
+		maxExpires:    DefaultMaxExpires,
+		logger:        NewLogger(ioutil.Discard, "text", LevelInfo),
+		registrations: make(map[string]*Registration),
+		nonces:        make(map[string]time.Time),
+		writes:        make(map[string]*registrationWrite),
+	}
+}
+
+// SetExpires bounds the registration time granted.
+func (registrar *Registrar) SetExpires(min, max uint) {
+	registrar.mutex.Lock()
+	defer registrar.mutex.Unlock()
+	registrar.minExpires, registrar.maxExpires = min, max
+}
+
+// SetLogger sets the logger of failed responses and store writes, which
+// are discarded by default.
+func (registrar *Registrar) SetLogger(logger *Logger) {
+	registrar.logger = logger
+}
+
+// SetRepository keeps the registrations in repository from now on.
+func (registrar *Registrar) SetRepository(repository store.Repository) {
+	registrar.mutex.Lock()
+	defer registrar.mutex.Unlock()
+	registrar.repository = repository
+}
+
+// Restore registers again the devices of the registrations kept in the
+// repository which have not expired at now, with their remaining time,
+// and deletes the expired ones. Their keepalives are counted from now.
+func (registrar *Registrar) Restore(now time.Time) (int, error) {
+	registrar.mutex.Lock()
+	repository := registrar.repository
+	registrar.mutex.Unlock()
+	if repository == nil {
+		return 0, nil
+	}
+	stored, err := repository.GetRegistrations()
+	if err != nil {
+		return 0, err
+	}
+	var restored []*Registration
+	for _, entry := range stored {
+		if !now.Before(entry.Expiry) {
+			registrar.mutex.Lock()
+			// unless the device registered again meanwhile
+			if _, registered := registrar.registrations[entry.DeviceID]; !registered {
+				registrar.forget(entry.DeviceID)
+			}
+			registrar.mutex.Unlock()
+			registrar.persist(entry.DeviceID)
+			continue
+		}
+		registration := &Registration{
+			ID:            entry.DeviceID,
+			Kind:          entry.Kind,
+			Address:       entry.Address,
+			Network:       entry.Network,
+			Contact:       entry.Contact,
+			UserAgent:     entry.UserAgent,
+			RegisteredAt:  entry.RegisteredAt,
+			Expiry:        entry.Expiry,
+			LastKeepalive: now,
+			callId:        entry.CallID,
+		}
+		if device, err := repository.GetDevice(entry.DeviceID); err == nil && len(device.Name) > 0 {
+			registration.Info = &DeviceInfo{
+				Name:         device.Name,
+				Manufacturer: device.Manufacturer,
+				Model:        device.Model,
+				Firmware:     device.Firmware,
+				Channels:     device.Channels,
+			}
+		}
+		registrar.mutex.Lock()
+		_, registered := registrar.registrations[registration.ID]
+		if !registered {
+			registrar.registrations[registration.ID] = registration
+		}
+		registrar.mutex.Unlock()
+		if !registered {
+			copied := *registration
+			restored = append(restored, &copied)
+		}
+	}
+	for _, registration := range restored {
+		registrar.emit(registration, true, ReasonRestored)
+	}
+	return len(restored), nil
+}
+
+// save and forget record the change of a registration to store. They are
+// called with the mutex held, so that the changes of a device are stored
+// in the order they were made; persist stores them once it is released.
+func (registrar *Registrar) save(registration *Registration) {
+	registrar.queue(registration.ID, &store.Registration{
+		DeviceID:     registration.ID,
+		Kind:         registration.Kind,
+		Address:      registration.Address,
+		Network:      registration.Network,
+		Contact:      registration.Contact,
+		UserAgent:    registration.UserAgent,
+		CallID:       registration.callId,
+		RegisteredAt: registration.RegisteredAt,
+		Expiry:       registration.Expiry,
+	})
+}
+
+func (registrar *Registrar) forget(deviceID string) {
+	registrar.queue(deviceID, nil)
+}
+
+func (registrar *Registrar) queue(deviceID string, registration *store.Registration) {
+	if registrar.repository == nil {
+		return
+	}
+	write, ok := registrar.writes[deviceID]
+	if !ok {
+		write = new(registrationWrite)
+		registrar.writes[deviceID] = write
+	}
+	write.registration = registration
+	write.pending = true
+}
+
+// persist stores the last change of the registration of deviceID, unless
+// another call is storing changes of that device and will store it too.
+// Changes made meanwhile are merged into the next write.
+func (registrar *Registrar) persist(deviceID string) {
+	registrar.mutex.Lock()
+	defer registrar.mutex.Unlock()
+	write, ok := registrar.writes[deviceID]
+	if !ok || write.busy {
+		return
+	}
+	for write.pending {
+		registration := write.registration
+		write.pending, write.busy = false, true
+		repository := registrar.repository
+		registrar.mutex.Unlock()
+		var err error
+		if registration != nil {
+			err = repository.PutRegistration(registration)
+		} else {
+			err = repository.DeleteRegistration(deviceID)
+		}
+		if err != nil {
+			registrar.logger.Warn("registration store failed", "device", deviceID, "error", err)
+		}
+		registrar.mutex.Lock()
+		write.busy = false
+	}
+	delete(registrar.writes, deviceID)
+}
+
+// OnChange adds a registration handler.
+func (registrar *Registrar) OnChange(handler RegistrationHandler) {
+	registrar.mutex.Lock()
+	defer registrar.mutex.Unlock()
+	registrar.handlers = append(registrar.handlers, handler)
+}
+
+// Get returns a copy of the registration of deviceID, nil when it is not
+// registered.
+func (registrar *Registrar) Get(deviceID string) *Registration {
+	registrar.mutex.Lock()
+	defer registrar.mutex.Unlock()
+	registration, ok := registrar.registrations[deviceID]
+	if !ok {
+		return nil
+	}
+	copied := *registration
+	return &copied
+}
+
+// GetRegistrations returns copies of the registrations sorted by id.
+func (registrar *Registrar) GetRegistrations() []*Registration {
+	registrar.mutex.Lock()
+	registrations := make([]*Registration, 0, len(registrar.registrations))
+	for _, registration := range registrar.registrations {
+		copied := *registration
+		registrations = append(registrations, &copied)
+	}
+	registrar.mutex.Unlock()
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].ID < registrations[j].ID
+	})
+	return registrations
+}
+
+// Touch records a keepalive of a registered device coming from address
+// and reports false when the device is not registered.
+func (registrar *Registrar) Touch(deviceID, address string, faults []string) bool {
+	registrar.mutex.Lock()
+	defer registrar.mutex.Unlock()
+	registration, ok := registrar.registrations[deviceID]
+	if !ok {
+		return false
+	}
+	registration.LastKeepalive = time.Now()
+	registration.Address = address
+	registration.Faults = faults
+	return true
+}
+
+// SetInfo keeps the information of a registered device.
+func (registrar *Registrar) SetInfo(deviceID string, info *DeviceInfo) {
+	registrar.mutex.Lock()
+	defer registrar.mutex.Unlock()
+	if registration, ok := registrar.registrations[deviceID]; ok {
+		registration.Info = info
+	}
+}
+
+// Remove drops the registration of deviceID for reason and reports false
+// when it is not registered.
+func (registrar *Registrar) Remove(deviceID, reason string) bool {
+	registrar.mutex.Lock()
+	registration, ok := registrar.registrations[deviceID]
+	delete(registrar.registrations, deviceID)
+	if ok {
+		registrar.forget(deviceID)
+	}
+	registrar.mutex.Unlock()
+	if ok {
+		registrar.persist(deviceID)
+		registrar.emit(registration, false, reason)
+	}
+	return ok
+}
+
+// Expire drops the registrations expired at now, or whose last keepalive,
+// or registration, is older than silence.
+func (registrar *Registrar) Expire(now time.Time, silence time.Duration) {
+	type expired struct {
+		registration *Registration
+		reason       string
+	}
+	var removed []expired
+	registrar.mutex.Lock()
+	for deviceID, registration := range registrar.registrations {
+		last := registration.LastKeepalive
+		if last.Before(registration.RegisteredAt) {
+			last = registration.RegisteredAt
+		}
+		reason := ""
+		if now.After(registration.Expiry) {
+			reason = ReasonExpired
+		} else if silence > 0 && now.Sub(last) > silence {
+			reason = ReasonKeepalive
+		}
+		if len(reason) > 0 {
+			delete(registrar.registrations, deviceID)
+			registrar.forget(deviceID)
+			removed = append(removed, expired{registration, reason})
+		}
+	}
+	for nonce, expiry := range registrar.nonces {
+		if now.After(expiry) {
+			delete(registrar.nonces, nonce)
+		}
+	}
+	registrar.mutex.Unlock()
+	for _, entry := range removed {
+		registrar.persist(entry.registration.ID)
+		registrar.emit(entry.registration, false, entry.reason)
+	}
+}
+
+// ServeRegister serves a REGISTER request.
+func (registrar *Registrar) ServeRegister(tx *ua.ServerTransaction) {
+	request := tx.GetRequest()
+	head := request.GetHeader()
+	if head.From == nil || head.From.GetAddress() == nil {
+		registrar.respond(tx, message.NewResponseTo(request, 400))
+		return
+	}
+	deviceID := head.From.GetAddress().GetUser()
+	parsed, err := id.Parse(deviceID)
+	if err != nil {
+		registrar.respond(tx, message.NewResponseTo(request, 400))
+		return
+	}
+	switch parsed.GetKind() {
+	case id.KindDevice, id.KindChannel, id.KindPlatform:
+	default:
+		registrar.respond(tx, message.NewResponseTo(request, 403))
+		return
+	}
+	password, allowed := "", true
+	if registrar.credentials != nil {
+		password, allowed = registrar.credentials(deviceID)
+	}
+	if !allowed {
+		registrar.respond(tx, message.NewResponseTo(request, 403))
+		return
+	}
+	if len(password) > 0 {
+		authorization := head.Authorization
+		if authorization == nil || !registrar.knowsNonce(authorization.GetNonce()) {
+			registrar.challenge(tx)
+			return
+		}
+		if authorization.GetUserName() != deviceID || authorization.GetRealm() != registrar.realm ||
+			!auth.Verify(authorization, password, "REGISTER") {
+			registrar.respond(tx, message.NewResponseTo(request, 403))
+			return
+		}
+		// a nonce authorizes one registration, so a captured request
+		// cannot be replayed
+		if !registrar.useNonce(authorization.GetNonce()) {
+			registrar.challenge(tx)
+			return
+		}
+	}
+
+	expires := registrar.requestedExpires(request)
+	// a wildcard Contact stands alone and only removes (RFC 3261 10.3)
+	if head.Contact != nil && head.Contact.IsWildcard() && (expires != 0 || len(head.GetContacts()) > 1) {
+		registrar.respond(tx, message.NewResponseTo(request, 400))
+		return
+	}
+	if expires == 0 {
+		registrar.Remove(deviceID, ReasonUnregister)
+		registrar.respond(tx, message.NewResponseTo(request, 200))
+		return
+	}
+	registrar.mutex.Lock()
+	if expires < registrar.minExpires {
+		expires = registrar.minExpires
+	}
+	if expires > registrar.maxExpires {
+		expires = registrar.maxExpires
+	}
+	now := time.Now()
+	callId := ""
+	if head.CallID != nil {
+		callId = head.CallID.GetId()
+	}
+	registration, registered := registrar.registrations[deviceID]
+	reason := ""
+	if !registered {
+		registration = &Registration{ID: deviceID, Kind: parsed.GetKind().String(), RegisteredAt: now}
+		registrar.registrations[deviceID] = registration
+		reason = ReasonRegister
+	} else if registration.callId != callId {
+		// a new Call-ID is a device restarted meanwhile
+		registration.RegisteredAt = now
+		registration.Info = nil
+		reason = ReasonRestart
+	}
+	registration.Address = tx.GetSource()
+	registration.Network = tx.GetNetwork()
+	registration.Expiry = now.Add(time.Duration(expires) * time.Second)
+	registration.callId = callId
+	registration.Contact = ""
+	if head.Contact != nil && head.Contact.GetUri() != nil {
+		registration.Contact = head.Contact.GetUri().String()
+	}
+	registration.UserAgent = ""
+	if head.UserAgent != nil {
+		registration.UserAgent = head.UserAgent.GetServer()
+	}
+	registrar.save(registration)
+	copied := *registration
+	registrar.mutex.Unlock()
+	registrar.persist(deviceID)
+
+	response := message.NewResponseTo(request, 200)
+	response.GetHeader().Expires = header.NewExpires(expires)
+	response.GetHeader().SetContacts(head.GetContacts()...)
+	registrar.respond(tx, response)
+	if len(reason) > 0 {
+		registrar.emit(&copied, true, reason)
+	}
+}
+
+// requestedExpires reads the Expires header, else the expires parameter
+// of the Contact, else takes the maximum.
+func (registrar *Registrar) requestedExpires(request *message.Request) uint {
+	head := request.GetHeader()
+	if head.Expires != nil {
+		return head.Expires.GetSeconds()
+	}
+	if head.Contact != nil {
+		if raw, ok := head.Contact.GetParameters().Get("expires"); ok {
+			if seconds, err := strconv.ParseUint(raw, 10, 32); err == nil {
+				return uint(seconds)
+			}
+		}
+	}
+	registrar.mutex.Lock()
+	defer registrar.mutex.Unlock()
+	return registrar.maxExpires
+}
+
+// challenge answers 401 with a fresh nonce.
+func (registrar *Registrar) challenge(tx *ua.ServerTransaction) {
+	nonce := message.NewTag() + message.NewTag()
+	registrar.mutex.Lock()
+	registrar.nonces[nonce] = time.Now().Add(nonceLifetime)
+	registrar.mutex.Unlock()
+	response := message.NewResponseTo(tx.GetRequest(), 401)
+	response.GetHeader().WWWAuthenticate = header.NewWWWAuthenticate("Digest", registrar.realm, nonce, "MD5")
+	registrar.respond(tx, response)
+}
+
+// knowsNonce reports whether nonce was issued and has not expired.
+func (registrar *Registrar) knowsNonce(nonce string) bool {
+	registrar.mutex.Lock()
+	defer registrar.mutex.Unlock()
+	expiry, ok := registrar.nonces[nonce]
+	return ok && time.Now().Before(expiry)
+}
+
+// useNonce forgets nonce and reports whether it was still valid; of two
+// requests using the same nonce only one succeeds.
+func (registrar *Registrar) useNonce(nonce string) bool {
+	registrar.mutex.Lock()
+	defer registrar.mutex.Unlock()
+	expiry, ok := registrar.nonces[nonce]
+	delete(registrar.nonces, nonce)
+	return ok && time.Now().Before(expiry)
+}
+
+// respond sends a response, logging a failure.
+func (registrar *Registrar) respond(tx *ua.ServerTransaction, response *message.Response) {
+	if err := tx.Respond(response); err != nil {
+		deviceID := ""
+		if from := tx.GetRequest().GetHeader().From; from != nil && from.GetAddress() != nil {
+			deviceID = from.GetAddress().GetUser()
+		}
+		registrar.logger.Warn("register response failed", "device", deviceID, "address", tx.GetSource(),
+			"status", response.GetStatusCode(), "error", err)
+	}
+}
+
+func (registrar *Registrar) emit(registration *Registration, online bool, reason string) {
+	registrar.mutex.Lock()
+	handlers := append([]RegistrationHandler(nil), registrar.handlers...)
+	registrar.mutex.Unlock()
+	for _, handler := range handlers {
+		handler(registration, online, reason)
+	}
+}
@@ -0,0 +1,321 @@
+// Package server is a GB28181 SIP server: a registrar of devices and
+// lower-level platforms, a keepalive monitor, the MANSCDP handlers of the
+// platform and a management API.
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/platform"
+	"github.com/kokutas/gb28181/sip/ua"
+	"github.com/kokutas/gb28181/store"
+)
+
+// shutdownTimeout bounds the wait for API requests in progress on Close.
+const shutdownTimeout = 5 * time.Second
+
+// Server runs a platform serving the devices registered with it.
+type Server struct {
+	config    Config
+	logger    *Logger
+	userAgent *ua.UserAgent
+	platform  *platform.Platform
+	registrar *Registrar
+	monitor   *Monitor
+	events    *EventBus
+	// repository keeps devices, channels and registrations across
+	// restarts.
+	repository store.Repository
+	api        *http.Server
+	apiAddr    net.Addr
+	started    time.Time
+
+	streamMutex  sync.Mutex
+	streams      map[string]*Stream
+	ports        map[string]map[uint16]bool // ports in use by media server
+	nextMedia    int
+	ssrcSequence int
+}
+
+// NewServer builds a server of a validated config; Start runs it.
+func NewServer(config *Config, logger *Logger) *Server {
+	server := &Server{
+		config:    *config,
+		logger:    logger,
+		userAgent: ua.NewUserAgent(config.ID, config.Realm, config.Transport, config.Listen),
+		events:    NewEventBus(config.EventHistory),
+		streams:   make(map[string]*Stream),
+		ports:     make(map[string]map[uint16]bool),
+	}
+	if len(config.Host) > 0 {
+		_, port, _ := net.SplitHostPort(config.Listen)
+		portNumber, _ := strconv.Atoi(port)
+		server.userAgent.SetHost(config.Host, uint16(portNumber))
+	}
+	server.platform = platform.NewPlatform(server.userAgent)
+	if config.QueryTimeout > 0 {
+		server.platform.SetTimeout(time.Duration(config.QueryTimeout))
+	}
+	var credentials Credentials
+	if len(config.Auth.Password) > 0 || len(config.Auth.Devices) > 0 || len(config.Auth.Allow) > 0 {
+		credentials = server.config.Auth.Credentials
+	}
+	server.registrar = NewRegistrar(config.Realm, credentials)
+	server.registrar.SetLogger(logger)
+	server.registrar.SetExpires(config.MinExpires, config.MaxExpires)
+	server.registrar.OnChange(server.registrationChanged)
+	server.monitor = NewMonitor(server.registrar, time.Duration(config.KeepaliveInterval), config.KeepaliveTimeouts)
+	server.userAgent.Handle("REGISTER", server.registrar.ServeRegister)
+	server.platform.Handle(manscdp.RootNotify, manscdp.CmdTypeKeepalive, server.monitor.ServeKeepalive)
+	server.platform.OnAlarm(func(alarm *platform.Alarm) {
+		logger.Info("alarm", "device", alarm.DeviceID, "priority", alarm.Priority, "method", alarm.Method,
+			"type", alarm.Type, "description", alarm.Description)
+		server.publishAlarm(alarm)
+	})
+	server.platform.OnCatalogChange(func(change *platform.CatalogChange) {
+		logger.Debug("catalog change", "device", change.DeviceID, "event", change.Event, "channel", change.Channel.DeviceID)
+		server.saveCatalogChange(change)
+		server.publishCatalogChange(change)
+	})
+	server.platform.OnPosition(server.publishPosition)
+	if len(config.API) > 0 {
+		server.api = &http.Server{Addr: config.API, Handler: server.Handler()}
+	}
+	return server
+}
+
+func (server *Server) GetConfig() *Config {
+	config := server.config
+	return &config
+}
+func (server *Server) GetUserAgent() *ua.UserAgent {
+	return server.userAgent
+}
+func (server *Server) GetPlatform() *platform.Platform {
+	return server.platform
+}
+func (server *Server) GetRegistrar() *Registrar {
+	return server.registrar
+}
+func (server *Server) GetEvents() *EventBus {
+	return server.events
+}
+func (server *Server) GetRepository() store.Repository {
+	return server.repository
+}
+
+// SetRepository sets the repository before Start in place of the one of
+// the config; the server closes it.
+func (server *Server) SetRepository(repository store.Repository) {
+	server.repository = repository
+}
+
+// GetAPIAddr returns the bound address of the management API, nil when
+// disabled or not started.
+func (server *Server) GetAPIAddr() net.Addr {
+	return server.apiAddr
+}
+
+// Start opens the repository, restores the catalogs and registrations it
+// keeps, then opens the SIP transport and the management API.
+func (server *Server) Start() error {
+	if server.repository == nil {
+		if len(server.config.Store) > 0 {
+			repository, err := store.OpenBolt(server.config.Store)
+			if err != nil {
+				return err
+			}
+			server.repository = repository
+		} else {
+			server.repository = store.NewMemory()
+		}
+	}
+	if err := server.restore(); err != nil {
+		server.repository.Close()
+		return err
+	}
+	if err := server.userAgent.Listen(); err != nil {
+		server.repository.Close()
+		return err
+	}
+	server.started = time.Now()
+	if server.api != nil {
+		listener, err := net.Listen("tcp", server.api.Addr)
+		if err != nil {
+			server.userAgent.Close()
+			server.repository.Close()
+			return err
+		}
+		server.apiAddr = listener.Addr()
+		go func() {
+			if err := server.api.Serve(listener); err != nil && err != http.ErrServerClosed {
+				server.logger.Error("api stopped", "error", err)
+			}
+		}()
+	}
+	server.monitor.Start()
+	server.logger.Info("server started", "id", server.config.ID, "realm", server.config.Realm,
+		"sip", server.userAgent.Addr().String(), "transport", server.config.Transport, "api", server.apiAddr)
+	return nil
+}
+
+// Close ends the event streams, stops the management API, waiting for
+// requests in progress, ends the calls and closes the SIP transport.
+func (server *Server) Close() error {
+	server.events.Close()
+	if server.api != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := server.api.Shutdown(ctx); err != nil {
+			server.logger.Warn("api shutdown", "error", err)
+		}
+		cancel()
+	}
+	server.monitor.Close()
+	for _, call := range server.platform.GetCalls() {
+		if err := server.platform.Bye(call); err != nil {
+			server.logger.Warn("bye on close", "device", call.GetDevice().ID, "channel", call.GetChannelID(), "error", err)
+		}
+	}
+	err := server.userAgent.Close()
+	if server.repository != nil {
+		if storeErr := server.repository.Close(); storeErr != nil && err == nil {
+			err = storeErr
+		}
+	}
+	server.logger.Info("server stopped", "id", server.config.ID)
+	return err
+}
+
+// restore loads the catalogs of the known devices and registers again the
+// devices whose registration has not expired.
+func (server *Server) restore() error {
+	devices, err := server.repository.GetDevices()
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		channels, err := server.repository.GetChannels(device.ID)
+		if err != nil {
+			return err
+		}
+		if len(channels) > 0 {
+			server.platform.GetCatalogStore().Replace(device.ID, channels)
+		}
+	}
+	server.registrar.SetRepository(server.repository)
+	restored, err := server.registrar.Restore(time.Now())
+	if err != nil {
+		return err
+	}
+	if len(devices) > 0 || restored > 0 {
+		server.logger.Info("state restored", "devices", len(devices), "registrations", restored)
+	}
+	return nil
+}
+
+// Device returns a registered device as the platform reaches it, nil when
+// it is not registered.
+func (server *Server) Device(deviceID string) *platform.Device {
+	registration := server.registrar.Get(deviceID)
+	if registration == nil {
+		return nil
+	}
+	return &platform.Device{ID: registration.ID, Address: registration.Address}
+}
+
+// registrationChanged logs and publishes the change and, when a device
+// comes online, queries its information and catalog.
+func (server *Server) registrationChanged(registration *Registration, online bool, reason string) {
+	logger := server.logger.With("device", registration.ID, "kind", registration.Kind)
+	if !online {
+		logger.Info("device offline", "reason", reason)
+		server.events.Publish(EventOffline, registration.ID, &RegistrationEvent{Registration: registration, Reason: reason})
+		return
+	}
+	server.events.Publish(EventOnline, registration.ID, &RegistrationEvent{Registration: registration, Reason: reason})
+	logger.Info("device online", "reason", reason, "address", registration.Address, "network", registration.Network,
+		"expiry", registration.Expiry.Format(time.RFC3339))
+	if reason == ReasonRestored {
+		// the repository kept its information and catalog
+		return
+	}
+	server.saveDevice(registration.ID, func(device *store.Device) {
+		device.Kind = registration.Kind
+		device.Address = registration.Address
+		device.Network = registration.Network
+		device.UserAgent = registration.UserAgent
+		device.LastSeen = registration.RegisteredAt
+	})
+	device := &platform.Device{ID: registration.ID, Address: registration.Address}
+	go server.queryDevice(device, logger)
+}
+
+// saveDevice updates the stored device of deviceID, created when unknown.
+func (server *Server) saveDevice(deviceID string, update func(device *store.Device)) {
+	device, err := server.repository.GetDevice(deviceID)
+	if err == store.ErrNotFound {
+		device, err = &store.Device{ID: deviceID, FirstSeen: time.Now()}, nil
+	}
+	if err == nil {
+		update(device)
+		err = server.repository.PutDevice(device)
+	}
+	if err != nil {
+		server.logger.Warn("device store failed", "device", deviceID, "error", err)
+	}
+}
+
+// saveCatalogChange keeps a channel as changed, or deletes it.
+func (server *Server) saveCatalogChange(change *platform.CatalogChange) {
+	var err error
+	if change.Event == manscdp.CatalogEventDel {
+		err = server.repository.DeleteChannel(change.DeviceID, change.Channel.DeviceID)
+	} else {
+		err = server.repository.PutChannel(change.DeviceID, change.Channel)
+	}
+	if err != nil {
+		server.logger.Warn("channel store failed", "device", change.DeviceID, "channel", change.Channel.DeviceID, "error", err)
+	}
+}
+
+// queryDevice asks a device for its information and refreshes its catalog.
+func (server *Server) queryDevice(device *platform.Device, logger *Logger) {
+	query := manscdp.NewDeviceInfoQuery(server.platform.NextSN(), device.ID)
+	raw, err := server.platform.Query(device, device.ID, query, manscdp.CmdTypeDeviceInfo, query.SN)
+	if err == nil {
+		info := new(manscdp.DeviceInfoResponse)
+		if err = manscdp.Unmarshal(raw, info); err == nil {
+			server.registrar.SetInfo(device.ID, &DeviceInfo{
+				Name:         info.DeviceName,
+				Manufacturer: info.Manufacturer,
+				Model:        info.Model,
+				Firmware:     info.Firmware,
+				Channels:     info.Channel,
+			})
+			server.saveDevice(device.ID, func(stored *store.Device) {
+				stored.Name = info.DeviceName
+				stored.Manufacturer = info.Manufacturer
+				stored.Model = info.Model
+				stored.Firmware = info.Firmware
+				stored.Channels = info.Channel
+			})
+			logger.Info("device info", "name", info.DeviceName, "manufacturer", info.Manufacturer,
+				"model", info.Model, "firmware", info.Firmware, "channels", info.Channel)
+		}
+	}
+	if err != nil {
+		logger.Warn("device info query failed", "error", err)
+	}
+	changes, err := server.platform.RefreshCatalog(device)
+	if err != nil {
+		logger.Warn("catalog query failed", "error", err)
+		return
+	}
+	logger.Info("catalog refreshed", "channels", len(server.platform.GetCatalogStore().Channels(device.ID)), "changes", len(changes))
+}
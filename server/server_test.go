@@ -0,0 +1,535 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/cascade"
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/simulator"
+	"github.com/kokutas/gb28181/sip/auth"
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/store"
+)
+
+const (
+	testServerID = "34020000002000000001"
+	testDeviceID = "34020000001110000001"
+	testPassword = "12345678"
+)
+
+func newTestServer(t *testing.T, config *Config) *Server {
+	config.ID = testServerID
+	config.Listen = "127.0.0.1:0"
+	config.API = "127.0.0.1:0"
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(config, NewLogger(ioutil.Discard, "text", LevelDebug))
+	server.GetUserAgent().SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	server.GetPlatform().SetTimeout(2 * time.Second)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func newTestClient(t *testing.T, server *Server, deviceID, password string) *cascade.Client {
+	client := cascade.NewClient(&cascade.Upstream{
+		LocalID:      deviceID,
+		LocalAddress: "127.0.0.1:0",
+		RemoteID:     testServerID,
+		Address:      server.GetUserAgent().Addr().String(),
+		Password:     password,
+	})
+	client.GetUserAgent().SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := client.GetUserAgent().Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.GetUserAgent().Close() })
+	return client
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal(what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func getJSON(t *testing.T, server *Server, method, path string, v interface{}) int {
+	request, _ := http.NewRequest(method, "http://"+server.GetAPIAddr().String()+path, nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return response.StatusCode
+}
+
+func TestServer_Device(t *testing.T) {
+	server := newTestServer(t, &Config{
+		Auth:              AuthConfig{Password: testPassword},
+		KeepaliveInterval: Duration(200 * time.Millisecond),
+	})
+	device, err := simulator.NewDevice(&simulator.Config{
+		DeviceID:          testDeviceID,
+		LocalAddress:      "127.0.0.1:0",
+		ServerID:          testServerID,
+		ServerAddress:     server.GetUserAgent().Addr().String(),
+		Password:          testPassword,
+		KeepaliveInterval: 50 * time.Millisecond,
+		Name:              "nvr",
+		Channels: []*manscdp.CatalogItem{
+			{DeviceID: "34020000001320000001", Name: "gate"},
+			{DeviceID: "34020000001320000002", Name: "hall"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device.GetUserAgent().SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := device.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+
+	waitFor(t, "the device info was not queried", func() bool {
+		registration := server.GetRegistrar().Get(testDeviceID)
+		return registration != nil && registration.Info != nil
+	})
+	waitFor(t, "the catalog was not refreshed", func() bool {
+		return len(server.GetPlatform().GetCatalogStore().Channels(testDeviceID)) == 2
+	})
+	waitFor(t, "no keepalive was recorded", func() bool {
+		return !server.GetRegistrar().Get(testDeviceID).LastKeepalive.IsZero()
+	})
+	registration := server.GetRegistrar().Get(testDeviceID)
+	if registration.Kind != "device" || registration.Info.Name != "nvr" || registration.Info.Channels != 2 {
+		t.Fatalf("unexpected registration %+v", registration)
+	}
+	// keepalives keep the device online beyond the keepalive timeout
+	time.Sleep(700 * time.Millisecond)
+	if server.GetRegistrar().Get(testDeviceID) == nil {
+		t.Fatal("the device went offline while sending keepalives")
+	}
+
+	health := new(Health)
+	if status := getJSON(t, server, "GET", "/api/health", health); status != 200 || health.ID != testServerID || health.Registrations != 1 {
+		t.Fatalf("unexpected health %d %+v", status, health)
+	}
+	list := new(DeviceList)
+	if status := getJSON(t, server, "GET", "/api/devices", list); status != 200 || list.Total != 1 || list.Items[0].ID != testDeviceID || list.Items[0].Channels != 2 {
+		t.Fatalf("unexpected devices %d %+v", status, list)
+	}
+	detail := new(DeviceDetail)
+	if status := getJSON(t, server, "GET", "/api/devices/"+testDeviceID, detail); status != 200 || detail.Info.Name != "nvr" || len(detail.Channels) != 2 {
+		t.Fatalf("unexpected device %d %+v", status, detail)
+	}
+	if status := getJSON(t, server, "GET", "/api/devices/34020000001110000009", nil); status != 404 {
+		t.Fatalf("unexpected status %d of an unknown device", status)
+	}
+
+	changes := make(chan string, 4)
+	server.GetRegistrar().OnChange(func(registration *Registration, online bool, reason string) {
+		changes <- reason
+	})
+	if status := getJSON(t, server, "DELETE", "/api/devices/"+testDeviceID, nil); status != 204 {
+		t.Fatalf("unexpected delete status %d", status)
+	}
+	// the device gets its keepalives rejected and registers again
+	for _, expected := range []string{ReasonRemoved, ReasonRegister} {
+		select {
+		case reason := <-changes:
+			if reason != expected {
+				t.Fatalf("unexpected change %s, expected %s", reason, expected)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("no %s change", expected)
+		}
+	}
+}
+
+func TestServer_KeepaliveTimeout(t *testing.T) {
+	server := newTestServer(t, &Config{KeepaliveInterval: Duration(50 * time.Millisecond), KeepaliveTimeouts: 2})
+	changes := make(chan string, 4)
+	server.GetRegistrar().OnChange(func(registration *Registration, online bool, reason string) {
+		changes <- reason
+	})
+	client := newTestClient(t, server, testDeviceID, "")
+	granted, err := client.Register(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if granted != DefaultMinExpires {
+		t.Fatalf("unexpected grant %d", granted)
+	}
+	for _, expected := range []string{ReasonRegister, ReasonKeepalive} {
+		select {
+		case reason := <-changes:
+			if reason != expected {
+				t.Fatalf("unexpected change %s, expected %s", reason, expected)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("no %s change", expected)
+		}
+	}
+	if server.GetRegistrar().Get(testDeviceID) != nil {
+		t.Fatal("the silent device is still registered")
+	}
+	if err := client.Keepalive(); err == nil {
+		t.Fatal("a keepalive of an unregistered device must be rejected")
+	}
+}
+
+func TestRegistrar_Rejects(t *testing.T) {
+	server := newTestServer(t, &Config{Auth: AuthConfig{Password: testPassword, Allow: []string{"3402"}}})
+	for _, test := range []struct {
+		deviceID string
+		password string
+		code     int
+	}{
+		{testDeviceID, "wrong", 403},
+		{"11010000001110000001", testPassword, 403},
+		{"34020000004000000001", testPassword, 403},
+	} {
+		client := newTestClient(t, server, test.deviceID, test.password)
+		_, err := client.Register(3600)
+		if sipError, ok := err.(*lib.SipError); !ok || sipError.Code != test.code {
+			t.Fatalf("unexpected registration of %s : %v", test.deviceID, err)
+		}
+	}
+	client := newTestClient(t, server, testDeviceID, testPassword)
+	if _, err := client.Register(3600); err != nil {
+		t.Fatal(err)
+	}
+	if registration := server.GetRegistrar().Get(testDeviceID); registration == nil || time.Until(registration.Expiry) < time.Hour-time.Minute {
+		t.Fatalf("unexpected registration %+v", registration)
+	}
+	if _, err := client.Register(0); err != nil {
+		t.Fatal(err)
+	}
+	if server.GetRegistrar().Get(testDeviceID) != nil {
+		t.Fatal("the device did not unregister")
+	}
+}
+
+func TestRegistrar_Replay(t *testing.T) {
+	server := newTestServer(t, &Config{Auth: AuthConfig{Password: testPassword}})
+	userAgent := newTestClient(t, server, testDeviceID, testPassword).GetUserAgent()
+	target := header.NewUri("sip", testServerID, testServerID[:10], 0, nil)
+	register := func(authorization *header.Authorization) *message.Response {
+		request := userAgent.NewRequest("REGISTER", target, nil, "")
+		head := request.GetHeader()
+		head.From = header.NewFrom("", userAgent.GetUri(), "abc")
+		head.To = header.NewTo("", userAgent.GetUri(), "")
+		head.Expires = header.NewExpires(3600)
+		head.Authorization = authorization
+		response, err := userAgent.Request(request, server.GetUserAgent().Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	challenge := register(nil)
+	if challenge.GetStatusCode() != 401 {
+		t.Fatalf("unexpected challenge %d", challenge.GetStatusCode())
+	}
+	authorization, err := auth.Authorize(challenge.GetHeader().WWWAuthenticate, testDeviceID, testPassword, "REGISTER", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := register(authorization).GetStatusCode(); code != 200 {
+		t.Fatalf("the registration was answered %d", code)
+	}
+	// the same authorization replayed is challenged again
+	if code := register(authorization).GetStatusCode(); code != 401 {
+		t.Fatalf("the replayed registration was answered %d", code)
+	}
+}
+
+func TestRegistrar_Wildcard(t *testing.T) {
+	server := newTestServer(t, &Config{})
+	client := newTestClient(t, server, testDeviceID, "")
+	if _, err := client.Register(3600); err != nil {
+		t.Fatal(err)
+	}
+	userAgent := client.GetUserAgent()
+	target := header.NewUri("sip", testServerID, testServerID[:10], 0, nil)
+	for _, expires := range []uint{3600, 0} {
+		request := userAgent.NewRequest("REGISTER", target, nil, "")
+		head := request.GetHeader()
+		head.From = header.NewFrom("", userAgent.GetUri(), "abc")
+		head.To = header.NewTo("", userAgent.GetUri(), "")
+		head.Contact = header.NewWildcardContact()
+		head.Expires = header.NewExpires(expires)
+		response, err := userAgent.Request(request, server.GetUserAgent().Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expires > 0 && response.GetStatusCode() != 400 {
+			t.Fatalf("a wildcard registration was answered %d", response.GetStatusCode())
+		}
+		if expires == 0 && response.GetStatusCode() != 200 {
+			t.Fatalf("a wildcard removal was answered %d", response.GetStatusCode())
+		}
+	}
+	if server.GetRegistrar().Get(testDeviceID) != nil {
+		t.Fatal("the wildcard did not remove the registration")
+	}
+}
+
+func TestServer_Restore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.db")
+	server := newTestServer(t, &Config{Store: path})
+	newTestDevice(t, server)
+	waitFor(t, "the device info was not stored", func() bool {
+		device, err := server.GetRepository().GetDevice(testDeviceID)
+		return err == nil && device.Name == "nvr"
+	})
+	registration := server.GetRegistrar().Get(testDeviceID)
+	address := server.GetUserAgent().Addr().String()
+	server.Close()
+
+	repository, err := store.OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository.PutRegistration(&store.Registration{DeviceID: "34020000001110000002", Kind: "device", Expiry: time.Now().Add(-time.Second)})
+	repository.Close()
+
+	// the device answers on the address of the server it registered with
+	config := &Config{ID: testServerID, Listen: address, Store: path}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewServer(config, NewLogger(ioutil.Discard, "text", LevelDebug))
+	subscriber := restarted.GetEvents().Subscribe(&EventFilter{}, 0)
+	if err := restarted.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	restored := restarted.GetRegistrar().Get(testDeviceID)
+	if restored == nil || !restored.Expiry.Equal(registration.Expiry) || restored.Info == nil || restored.Info.Name != "nvr" ||
+		time.Since(restored.LastKeepalive) > time.Second {
+		t.Fatalf("unexpected restored registration %+v", restored)
+	}
+	if len(restarted.GetRegistrar().GetRegistrations()) != 1 {
+		t.Fatal("an expired registration was restored")
+	}
+	if registrations, _ := restarted.GetRepository().GetRegistrations(); len(registrations) != 1 {
+		t.Fatalf("the expired registration is kept %+v", registrations)
+	}
+	if len(restarted.GetPlatform().GetCatalogStore().Channels(testDeviceID)) != 2 {
+		t.Fatal("the catalog was not restored")
+	}
+	if event := <-subscriber.C; event.Type != EventOnline || event.Data.(*RegistrationEvent).Reason != ReasonRestored {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	// the restored device is reachable
+	device := restarted.Device(testDeviceID)
+	if _, err := restarted.GetPlatform().RefreshCatalog(device); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistrar_Restore(t *testing.T) {
+	repository := store.NewMemory()
+	now := time.Now()
+	repository.PutDevice(&store.Device{ID: testDeviceID, Name: "nvr", Channels: 2})
+	repository.PutRegistration(&store.Registration{DeviceID: testDeviceID, Kind: "device", CallID: "a", RegisteredAt: now.Add(-time.Hour), Expiry: now.Add(time.Hour)})
+	repository.PutRegistration(&store.Registration{DeviceID: "34020000001110000002", Kind: "device", Expiry: now})
+	registrar := NewRegistrar("3402000000", nil)
+	var reasons []string
+	registrar.OnChange(func(registration *Registration, online bool, reason string) {
+		reasons = append(reasons, reason)
+	})
+	if restored, err := registrar.Restore(now); err != nil || restored != 0 {
+		t.Fatalf("restored %d %v without repository", restored, err)
+	}
+	registrar.SetRepository(repository)
+	if restored, err := registrar.Restore(now); err != nil || restored != 1 || len(reasons) != 1 || reasons[0] != ReasonRestored {
+		t.Fatalf("unexpected restore %d %v %v", restored, err, reasons)
+	}
+	if registration := registrar.Get(testDeviceID); registration.Info.Channels != 2 || !registration.LastKeepalive.Equal(now) {
+		t.Fatalf("unexpected registration %+v", registration)
+	}
+	if restored, _ := registrar.Restore(now); restored != 0 {
+		t.Fatal("a registration was restored twice")
+	}
+	// silence is counted from the restore, expiry from the registration
+	registrar.Expire(now.Add(time.Minute), 2*time.Minute)
+	if registrar.Get(testDeviceID) == nil {
+		t.Fatal("the restored registration expired early")
+	}
+	registrar.Expire(now.Add(time.Hour+time.Second), 0)
+	if registrations, _ := repository.GetRegistrations(); len(registrations) != 0 || reasons[1] != ReasonExpired {
+		t.Fatalf("unexpected registrations %+v %v", registrations, reasons)
+	}
+}
+
+// blockingRepository holds registration writes until release is closed.
+type blockingRepository struct {
+	*store.Memory
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (repository *blockingRepository) PutRegistration(registration *store.Registration) error {
+	select {
+	case repository.writing <- struct{}{}:
+	default:
+	}
+	<-repository.release
+	return repository.Memory.PutRegistration(registration)
+}
+
+func TestRegistrar_StoreOutsideLock(t *testing.T) {
+	repository := &blockingRepository{Memory: store.NewMemory(), writing: make(chan struct{}, 1), release: make(chan struct{})}
+	registrar := NewRegistrar("3402000000", nil)
+	registrar.SetRepository(repository)
+	server := newTestServer(t, &Config{})
+	server.GetUserAgent().Handle("REGISTER", registrar.ServeRegister)
+	client := newTestClient(t, server, testDeviceID, "")
+	registered := make(chan error, 1)
+	go func() {
+		_, err := client.Register(3600)
+		registered <- err
+	}()
+	select {
+	case <-repository.writing:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the registration was not stored")
+	}
+	// the registrar serves lookups and keepalives while the write is held
+	done := make(chan struct{})
+	go func() {
+		registrar.Touch(testDeviceID, "127.0.0.1:5060", nil)
+		registrar.GetRegistrations()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the registrar is locked during a store write")
+	}
+	// a removal during the write is stored after it
+	registrar.Remove(testDeviceID, ReasonRemoved)
+	close(repository.release)
+	if err := <-registered; err != nil {
+		t.Fatal(err)
+	}
+	if registrations, _ := repository.GetRegistrations(); len(registrations) != 0 {
+		t.Fatalf("unexpected stored registrations %+v", registrations)
+	}
+}
+
+// failingRepository fails to delete registrations.
+type failingRepository struct {
+	*store.Memory
+}
+
+func (repository *failingRepository) DeleteRegistration(deviceID string) error {
+	return errors.New("disk full")
+}
+
+func TestRegistrar_LogStoreFailure(t *testing.T) {
+	repository := &failingRepository{Memory: store.NewMemory()}
+	repository.PutRegistration(&store.Registration{DeviceID: testDeviceID, Kind: "device", Expiry: time.Now().Add(time.Hour)})
+	var output bytes.Buffer
+	registrar := NewRegistrar("3402000000", nil)
+	registrar.SetLogger(NewLogger(&output, "text", LevelInfo))
+	registrar.SetRepository(repository)
+	registrar.Restore(time.Now())
+	registrar.Remove(testDeviceID, ReasonRemoved)
+	if record := output.String(); !strings.Contains(record, "level=warn") || !strings.Contains(record, "device="+testDeviceID) ||
+		!strings.Contains(record, "disk full") {
+		t.Fatalf("unexpected log %q", record)
+	}
+}
+
+func TestRegistrar_DigestVariants(t *testing.T) {
+	server := newTestServer(t, &Config{Auth: AuthConfig{Password: testPassword}})
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	serverAddr := server.GetUserAgent().Addr()
+	uri := "sip:" + testServerID + "@" + testServerID[:10]
+	cseq := 0
+	register := func(authorization string) *message.Response {
+		cseq++
+		raw := fmt.Sprintf("REGISTER %s SIP/2.0\r\n"+
+			"Via: SIP/2.0/UDP %s;rport;branch=z9hG4bK%d\r\n"+
+			"From: <sip:%s@%s>;tag=abc\r\n"+
+			"To: <sip:%s@%s>\r\n"+
+			"Call-ID: digest-variants\r\n"+
+			"CSeq: %d REGISTER\r\n"+
+			"Contact: <sip:%s@%s>\r\n"+
+			"Max-Forwards: 70\r\n"+
+			"Expires: 3600\r\n%s"+
+			"Content-Length: 0\r\n\r\n",
+			uri, conn.LocalAddr(), cseq, testDeviceID, testDeviceID[:10], testDeviceID, testDeviceID[:10], cseq,
+			testDeviceID, conn.LocalAddr(), authorization)
+		if _, err := conn.WriteTo([]byte(raw), serverAddr); err != nil {
+			t.Fatal(err)
+		}
+		// the server queries the registered device meanwhile
+		buf := make([]byte, 4096)
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := message.Parse(buf[:n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response, ok := msg.(*message.Response); ok {
+				return response
+			}
+		}
+	}
+	for _, qop := range []string{"auth", ""} {
+		challenge := register("")
+		if challenge.GetStatusCode() != 401 {
+			t.Fatalf("unexpected challenge %d", challenge.GetStatusCode())
+		}
+		nonce := challenge.GetHeader().WWWAuthenticate.GetNonce()
+		response := auth.GenDigestResponse(&auth.DigestParams{
+			Digest: auth.Digest{Realm: testServerID[:10], UserName: testDeviceID, Password: testPassword},
+			Method: "REGISTER", URI: uri, Nonce: nonce, Qop: qop, Cnonce: "0a4f113b", Nc: 1,
+		})
+		// neither carries algorithm, which defaults to MD5
+		authorization := fmt.Sprintf(`Authorization: Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+			testDeviceID, testServerID[:10], nonce, uri, response)
+		if len(qop) > 0 {
+			authorization += `, cnonce="0a4f113b", qop=auth, nc=00000001`
+		}
+		if code := register(authorization + "\r\n").GetStatusCode(); code != 200 {
+			t.Fatalf("the registration with qop %q was answered %d", qop, code)
+		}
+	}
+}
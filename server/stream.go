@@ -0,0 +1,273 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kokutas/gb28181/media/ps"
+	"github.com/kokutas/gb28181/media/rtp"
+	"github.com/kokutas/gb28181/media/sdp"
+	mediastream "github.com/kokutas/gb28181/media/stream"
+	"github.com/kokutas/gb28181/platform"
+)
+
+// analyzeJitter is the jitter buffer capacity, in packets, of the streams
+// analyzed by the server.
+const analyzeJitter = 64
+
+var (
+	ErrNotRegistered  = errors.New("the device is not registered")
+	ErrNoMediaServer  = errors.New("no media server is configured")
+	ErrNoMediaPort    = errors.New("no media server port is free")
+	ErrStreamNotFound = errors.New("the channel is not streaming")
+)
+
+// Stream is the live stream of a channel sent to a media server.
+type Stream struct {
+	SSRC        string    `json:"ssrc"`
+	DeviceID    string    `json:"device_id"`
+	ChannelID   string    `json:"channel_id"`
+	MediaServer string    `json:"media_server"`
+	Port        uint16    `json:"port"`
+	URL         string    `json:"url,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	// Info is the latest stream info of a stream analyzed by the server.
+	Info *mediastream.Info `json:"info,omitempty"`
+
+	call     *platform.Call
+	receiver *rtp.Receiver // of an analyzed stream
+	ready    chan struct{}
+	err      error
+}
+
+func streamKey(deviceID, channelID string) string {
+	return deviceID + "/" + channelID
+}
+
+// StartLive invites a channel to stream to a media server, or returns its
+// stream when it streams already; created tells a new stream.
+func (server *Server) StartLive(deviceID, channelID string) (*Stream, bool, error) {
+	key := streamKey(deviceID, channelID)
+	server.streamMutex.Lock()
+	if existing, ok := server.streams[key]; ok {
+		server.streamMutex.Unlock()
+		<-existing.ready
+		if existing.err != nil {
+			return nil, false, existing.err
+		}
+		return server.copyStream(existing), false, nil
+	}
+	stream := &Stream{DeviceID: deviceID, ChannelID: channelID, ready: make(chan struct{})}
+	server.streams[key] = stream
+	server.streamMutex.Unlock()
+
+	err := server.invite(stream)
+	server.streamMutex.Lock()
+	stream.err = err
+	if err != nil {
+		delete(server.streams, key)
+	}
+	close(stream.ready)
+	server.streamMutex.Unlock()
+	if err != nil {
+		return nil, false, err
+	}
+	go func() {
+		<-stream.call.Done()
+		server.endStream(stream)
+	}()
+	copied := server.copyStream(stream)
+	server.events.Publish(EventStreamStart, deviceID, copied)
+	return copied, true, nil
+}
+
+// copyStream copies a stream whose info may be changing.
+func (server *Server) copyStream(stream *Stream) *Stream {
+	server.streamMutex.Lock()
+	defer server.streamMutex.Unlock()
+	copied := *stream
+	return &copied
+}
+
+// invite picks a media server and port and invites the channel to stream
+// there.
+func (server *Server) invite(stream *Stream) error {
+	device := server.Device(stream.DeviceID)
+	if device == nil {
+		return ErrNotRegistered
+	}
+	media, port, err := server.allocatePort()
+	if err != nil {
+		return err
+	}
+	stream.MediaServer, stream.Port = media.ID, port
+	stream.SSRC = server.nextSSRC()
+	if media.Analyze {
+		if err := server.analyze(stream, media.Host); err != nil {
+			server.releasePort(media.ID, port)
+			return err
+		}
+	}
+	offered := sdp.NewMedia("video", port, sdp.ProtoUDP, "96")
+	offered.AddAttribute("recvonly", "")
+	offered.AddAttribute("rtpmap", "96 PS/90000")
+	offer := sdp.NewSession(sdp.NewOrigin(server.config.ID, media.Host), "Play", sdp.NewConnection(media.Host), stream.SSRC, offered)
+	call, err := server.platform.Invite(device, stream.ChannelID, offer)
+	if err != nil {
+		if stream.receiver != nil {
+			_ = stream.receiver.Close()
+		}
+		server.releasePort(media.ID, port)
+		return err
+	}
+	stream.call = call
+	stream.StartedAt = time.Now()
+	stream.URL = strings.NewReplacer(
+		"{ssrc}", stream.SSRC,
+		"{device}", stream.DeviceID,
+		"{channel}", stream.ChannelID,
+		"{port}", strconv.Itoa(int(port)),
+	).Replace(media.URL)
+	server.logger.Info("live started", "device", stream.DeviceID, "channel", stream.ChannelID,
+		"ssrc", stream.SSRC, "media_server", media.ID, "port", port)
+	return nil
+}
+
+// analyze receives a stream on host and publishes the stream info found in
+// its demuxed frames. The receiver delivers one frame at a time, so the
+// demuxer and the analyzer need no lock.
+func (server *Server) analyze(stream *Stream, host string) error {
+	analyzer := mediastream.NewAnalyzer(stream.SSRC, func(info *mediastream.Info) {
+		server.streamMutex.Lock()
+		stream.Info = info
+		server.streamMutex.Unlock()
+		server.events.Publish(EventStreamInfo, stream.DeviceID, &StreamInfoEvent{ChannelID: stream.ChannelID, Info: info})
+	})
+	demuxer := ps.NewDemuxer(func(frame *ps.Frame) {
+		analyzer.Analyze(frame)
+	})
+	address := net.JoinHostPort(host, strconv.Itoa(int(stream.Port)))
+	receiver := rtp.NewReceiver("udp", address, analyzeJitter, func(frame *rtp.Frame) {
+		if frame.Incomplete {
+			// resynchronize on the next pack instead of parsing a hole
+			demuxer.Reset()
+			return
+		}
+		// the demuxer skips malformed input by itself
+		_ = demuxer.Write(frame.Data)
+	})
+	if err := receiver.Listen(); err != nil {
+		return fmt.Errorf("stream %s receive error : %s", stream.SSRC, err.Error())
+	}
+	stream.receiver = receiver
+	return nil
+}
+
+// StopLive ends the live stream of a channel.
+func (server *Server) StopLive(deviceID, channelID string) error {
+	server.streamMutex.Lock()
+	stream, ok := server.streams[streamKey(deviceID, channelID)]
+	server.streamMutex.Unlock()
+	if !ok {
+		return ErrStreamNotFound
+	}
+	<-stream.ready
+	if stream.err != nil {
+		return ErrStreamNotFound
+	}
+	err := server.platform.Bye(stream.call)
+	server.endStream(stream)
+	if err == platform.ErrCallEnded {
+		return nil
+	}
+	return err
+}
+
+// GetStreams returns the live streams sorted by device and channel.
+func (server *Server) GetStreams() []*Stream {
+	server.streamMutex.Lock()
+	streams := make([]*Stream, 0, len(server.streams))
+	for _, stream := range server.streams {
+		select {
+		case <-stream.ready:
+			if stream.err == nil {
+				copied := *stream
+				streams = append(streams, &copied)
+			}
+		default:
+		}
+	}
+	server.streamMutex.Unlock()
+	sort.Slice(streams, func(i, j int) bool {
+		return streamKey(streams[i].DeviceID, streams[i].ChannelID) < streamKey(streams[j].DeviceID, streams[j].ChannelID)
+	})
+	return streams
+}
+
+// endStream forgets a stream once and frees its port.
+func (server *Server) endStream(stream *Stream) {
+	key := streamKey(stream.DeviceID, stream.ChannelID)
+	server.streamMutex.Lock()
+	current, ok := server.streams[key]
+	if !ok || current != stream {
+		server.streamMutex.Unlock()
+		return
+	}
+	delete(server.streams, key)
+	server.streamMutex.Unlock()
+	if stream.receiver != nil {
+		_ = stream.receiver.Close()
+	}
+	server.releasePort(stream.MediaServer, stream.Port)
+	server.events.Publish(EventStreamStop, stream.DeviceID, server.copyStream(stream))
+	server.logger.Info("live stopped", "device", stream.DeviceID, "channel", stream.ChannelID, "ssrc", stream.SSRC)
+}
+
+// allocatePort takes a free port of the media servers in turn.
+func (server *Server) allocatePort() (*MediaServer, uint16, error) {
+	servers := server.config.MediaServers
+	if len(servers) == 0 {
+		return nil, 0, ErrNoMediaServer
+	}
+	server.streamMutex.Lock()
+	defer server.streamMutex.Unlock()
+	for i := 0; i < len(servers); i++ {
+		media := servers[(server.nextMedia+i)%len(servers)]
+		used := server.ports[media.ID]
+		if used == nil {
+			used = make(map[uint16]bool)
+			server.ports[media.ID] = used
+		}
+		// RTP takes even ports, leaving the odd ones to RTCP
+		first := media.PortMin + media.PortMin%2
+		for port := int(first); port <= int(media.PortMax); port += 2 {
+			if !used[uint16(port)] {
+				used[uint16(port)] = true
+				server.nextMedia = (server.nextMedia + i + 1) % len(servers)
+				return media, uint16(port), nil
+			}
+		}
+	}
+	return nil, 0, ErrNoMediaPort
+}
+
+func (server *Server) releasePort(mediaID string, port uint16) {
+	server.streamMutex.Lock()
+	defer server.streamMutex.Unlock()
+	delete(server.ports[mediaID], port)
+}
+
+// nextSSRC returns a live GB28181 SSRC: 0, digits 4 to 8 of our domain and
+// a sequence number.
+func (server *Server) nextSSRC() string {
+	server.streamMutex.Lock()
+	server.ssrcSequence = (server.ssrcSequence + 1) % 10000
+	sequence := server.ssrcSequence
+	server.streamMutex.Unlock()
+	return fmt.Sprintf("0%s%04d", server.config.ID[3:8], sequence)
+}
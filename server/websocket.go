@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is the key suffix of the handshake, RFC 6455 section 1.3.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxControlPayload bounds the payload of the frames read from clients,
+// which only send control frames to the event stream.
+const maxControlPayload = 4096
+
+// WebSocket opcodes.
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xa
+)
+
+var errNotWebSocket = errors.New("not a websocket handshake")
+
+// websocketConn is the server side of a WebSocket connection sending text
+// messages; frames read from the client are answered as the protocol
+// requires and otherwise ignored.
+type websocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mutex  sync.Mutex // serializes writes
+	closed chan struct{}
+	once   sync.Once
+}
+
+// websocketAccept returns the Sec-WebSocket-Accept value of a key.
+func websocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket checks the handshake of a request before anything was
+// written, takes the connection over and answers 101.
+func upgradeWebSocket(writer http.ResponseWriter, request *http.Request) (*websocketConn, error) {
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if request.Method != http.MethodGet || !headerContains(request.Header, "Connection", "upgrade") ||
+		!headerContains(request.Header, "Upgrade", "websocket") || len(key) == 0 {
+		return nil, errNotWebSocket
+	}
+	if request.Header.Get("Sec-WebSocket-Version") != "13" {
+		writer.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, errors.New("websocket version error : " + request.Header.Get("Sec-WebSocket-Version"))
+	}
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("the connection cannot be taken over")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	websocket := &websocketConn{conn: conn, reader: buffered.Reader, closed: make(chan struct{})}
+	go websocket.readLoop()
+	return websocket, nil
+}
+
+// Closed is closed once the connection ends.
+func (websocket *websocketConn) Closed() <-chan struct{} {
+	return websocket.closed
+}
+
+// WriteText sends a text message in a single frame.
+func (websocket *websocketConn) WriteText(payload []byte) error {
+	return websocket.writeFrame(opText, payload)
+}
+
+// Close sends a close frame of status code and ends the connection.
+func (websocket *websocketConn) Close(code uint16) error {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, code)
+	websocket.writeFrame(opClose, payload)
+	return websocket.shutdown()
+}
+
+func (websocket *websocketConn) shutdown() error {
+	var err error
+	websocket.once.Do(func() {
+		close(websocket.closed)
+		err = websocket.conn.Close()
+	})
+	return err
+}
+
+// writeFrame writes an unmasked final frame, as servers do.
+func (websocket *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, 127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+	frame = append(frame, payload...)
+	websocket.mutex.Lock()
+	defer websocket.mutex.Unlock()
+	websocket.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := websocket.conn.Write(frame)
+	return err
+}
+
+// readLoop answers pings and close frames until the connection ends.
+func (websocket *websocketConn) readLoop() {
+	defer websocket.shutdown()
+	for {
+		opcode, payload, err := websocket.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case opPing:
+			if websocket.writeFrame(opPong, payload) != nil {
+				return
+			}
+		case opClose:
+			// echo the status code of the client
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			websocket.writeFrame(opClose, payload)
+			return
+		}
+	}
+}
+
+// readFrame reads a masked client frame; fragments are returned as they
+// come, which is enough to skip them.
+func (websocket *websocketConn) readFrame() (byte, []byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(websocket.reader, head); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0f
+	if head[1]&0x80 == 0 {
+		return 0, nil, errors.New("websocket client frame is not masked")
+	}
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(websocket.reader, extended); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(websocket.reader, extended); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > maxControlPayload {
+		return 0, nil, errors.New("websocket frame too large")
+	}
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(websocket.reader, mask); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(websocket.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
@@ -0,0 +1,174 @@
+package simulator
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kokutas/gb28181/media/ps"
+	"github.com/kokutas/gb28181/media/rtp"
+)
+
+// defaultFrameInterval separates the last frame of a clip from the first
+// one of the next loop, 40 ms at 90 kHz.
+const defaultFrameInterval = 3600
+
+// clipFrame is one or more PS packs sent under one RTP timestamp.
+type clipFrame struct {
+	timestamp uint32 // 90 kHz, relative to the first frame
+	data      []byte
+}
+
+// Clip is a PS stream loaded in memory and played in a loop.
+type Clip struct {
+	frames   []*clipFrame
+	duration uint32 // 90 kHz, one loop including the gap to the next one
+}
+
+// LoadClip loads a clip from a file: .rtp files hold RFC 4571 framed RTP
+// packets of a PS stream, as recorded from a device; other files are raw
+// PS streams.
+func LoadClip(path string) (*Clip, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".rtp") {
+		return ParseRTPClip(raw)
+	}
+	return ParsePSClip(raw)
+}
+
+// ParsePSClip splits a PS stream into access units and packs each of them
+// again, timed by its DTS.
+func ParsePSClip(raw []byte) (*Clip, error) {
+	var frames []*ps.Frame
+	demuxer := ps.NewDemuxer(func(frame *ps.Frame) {
+		frames = append(frames, frame)
+	})
+	if err := demuxer.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := demuxer.Flush(); err != nil {
+		return nil, err
+	}
+	muxer := ps.NewMuxer()
+	streamIDs := make(map[uint8]uint8)
+	clip := new(Clip)
+	for _, frame := range frames {
+		streamID, ok := streamIDs[frame.StreamID]
+		if !ok {
+			var err error
+			if streamID, err = muxer.AddStream(frame.StreamType); err != nil {
+				// streams the muxer cannot carry are left out
+				continue
+			}
+			streamIDs[frame.StreamID] = streamID
+		}
+		pack, err := muxer.Mux(streamID, frame.PTS, frame.DTS, frame.Data)
+		if err != nil {
+			return nil, err
+		}
+		clip.frames = append(clip.frames, &clipFrame{timestamp: uint32(frame.DTS), data: pack})
+	}
+	return clip, clip.normalize()
+}
+
+// ParseRTPClip joins the packets of an RFC 4571 framed RTP recording into
+// frames timed by their RTP timestamps.
+func ParseRTPClip(raw []byte) (*Clip, error) {
+	reader := bytes.NewReader(raw)
+	assembler := rtp.NewAssembler()
+	clip := new(Clip)
+	add := func(frames ...*rtp.Frame) {
+		for _, frame := range frames {
+			if frame != nil && !frame.Incomplete {
+				clip.frames = append(clip.frames, &clipFrame{timestamp: frame.Timestamp, data: frame.Data})
+			}
+		}
+	}
+	for {
+		packetRaw, err := rtp.ReadFramed(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		packet := new(rtp.Packet)
+		if err := packet.Parse(packetRaw); err != nil {
+			return nil, err
+		}
+		add(assembler.Push(packet)...)
+	}
+	add(assembler.Flush())
+	return clip, clip.normalize()
+}
+
+// normalize makes timestamps relative to the first frame and computes the
+// loop duration. Frames going back in time are sent with the previous
+// timestamp.
+func (clip *Clip) normalize() error {
+	if len(clip.frames) == 0 {
+		return errors.New("the clip has no frames")
+	}
+	first := clip.frames[0].timestamp
+	var last uint32
+	for _, frame := range clip.frames {
+		timestamp := frame.timestamp - first
+		if timestamp < last || timestamp > 0x7fffffff {
+			timestamp = last
+		}
+		frame.timestamp = timestamp
+		last = timestamp
+	}
+	interval := uint32(defaultFrameInterval)
+	if len(clip.frames) > 1 && last > 0 {
+		interval = last / uint32(len(clip.frames)-1)
+	}
+	clip.duration = last + interval
+	return nil
+}
+
+// GetFrames returns the number of frames of a loop.
+func (clip *Clip) GetFrames() int {
+	return len(clip.frames)
+}
+
+// GetDuration returns the duration of a loop.
+func (clip *Clip) GetDuration() time.Duration {
+	return time.Duration(clip.duration) * time.Second / 90000
+}
+
+// Play sends the clip over sender in real time, looping until stop closes.
+// Frames the sender cannot send, e.g. before a passive TCP peer connected,
+// are dropped.
+func (clip *Clip) Play(sender *rtp.Sender, stop <-chan struct{}) {
+	start := time.Now()
+	for loop := uint32(0); ; loop++ {
+		for _, frame := range clip.frames {
+			timestamp := loop*clip.duration + frame.timestamp
+			wait := time.Until(start.Add(time.Duration(timestamp) * time.Second / 90000))
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-stop:
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			} else {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+			_ = sender.WriteFrame(timestamp, frame.data)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package simulator
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/media/ps"
+)
+
+func TestLoadClip(t *testing.T) {
+	for _, path := range []string{"../media/ps/testdata/h264_g711.ps", "../media/rtp/testdata/ps_h264_g711.rtp"} {
+		clip, err := LoadClip(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if clip.GetFrames() == 0 || clip.GetDuration() <= 0 {
+			t.Fatalf("%s: unexpected clip of %d frames lasting %s", path, clip.GetFrames(), clip.GetDuration())
+		}
+		video := 0
+		demuxer := ps.NewDemuxer(func(frame *ps.Frame) {
+			if frame.IsVideo() {
+				video++
+			}
+		})
+		var last uint32
+		for i, frame := range clip.frames {
+			if frame.timestamp < last {
+				t.Fatalf("%s: frame %d goes back in time", path, i)
+			}
+			last = frame.timestamp
+			if !bytes.HasPrefix(frame.data, []byte{0x00, 0x00, 0x01, 0xba}) {
+				t.Fatalf("%s: frame %d does not start with a pack header", path, i)
+			}
+			demuxer.Write(frame.data)
+		}
+		demuxer.Flush()
+		if video == 0 {
+			t.Fatalf("%s: no video in the clip", path)
+		}
+	}
+	if _, err := ParsePSClip([]byte{0x00, 0x00, 0x01, 0xb9}); err == nil {
+		t.Fatal("an empty stream must be rejected")
+	}
+	if clip, _ := LoadClip("../media/ps/testdata/h264_g711.ps"); clip.GetDuration() > time.Minute {
+		t.Fatalf("unexpected duration %s", clip.GetDuration())
+	}
+}
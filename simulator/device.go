@@ -0,0 +1,704 @@
+// Package simulator plays a GB28181 device for integration tests: it
+// registers with a platform, keeps alive, answers catalog, information,
+// status and record queries from its configured channels, streams a clip
+// when invited and keeps the state PTZ and control commands change.
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/cascade"
+	"github.com/kokutas/gb28181/id"
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/media/rtp"
+	"github.com/kokutas/gb28181/media/sdp"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// DefaultPerPacket is the number of catalog and record items per Response
+// packet.
+const DefaultPerPacket = 4
+
+// Config describes a simulated device and the platform it registers with.
+type Config struct {
+	DeviceID          string
+	LocalAddress      string // host:port of the SIP socket, port 0 picks one
+	Transport         string // udp / tcp
+	ServerID          string
+	ServerRealm       string // ServerID[:10] when empty
+	ServerAddress     string // host:port
+	Password          string
+	Expires           uint
+	KeepaliveInterval time.Duration
+
+	Name         string
+	Manufacturer string
+	Model        string
+	Firmware     string
+	Channels     []*manscdp.CatalogItem
+	Records      []*manscdp.RecordItem // answered to RecordInfo queries of their DeviceID
+	PerPacket    int
+	Clip         *Clip  // streamed when invited, nil answers INVITE with 488
+	MediaHost    string // local IP address media is sent from
+}
+
+// PTZState is the simulated position of a channel, moved one step of the
+// speed per PTZ move command, and its presets.
+type PTZState struct {
+	Pan     int
+	Tilt    int
+	Zoom    int
+	Moving  bool
+	Presets map[uint8][3]int
+}
+
+// ControlHandler receives every control command the device executed.
+type ControlHandler func(control *manscdp.Control)
+
+type channelState struct {
+	item      *manscdp.CatalogItem
+	ptz       PTZState
+	recording bool
+	guarded   bool
+}
+
+// Device is a simulated device.
+type Device struct {
+	config Config
+	client *cascade.Client
+
+	mutex    sync.Mutex
+	name     string
+	channels map[string]*channelState
+	guarded  bool
+	streams  map[string]*Stream
+	handlers []ControlHandler
+}
+
+// Stream is a media session the device is playing.
+type Stream struct {
+	channelID string
+	callId    string
+	dialog    *ua.Dialog
+	sender    *rtp.Sender
+	started   bool
+	stop      chan struct{}
+}
+
+func (stream *Stream) GetChannelID() string {
+	return stream.channelID
+}
+func (stream *Stream) GetSender() *rtp.Sender {
+	return stream.sender
+}
+
+// NewDevice builds the device; Start registers it.
+func NewDevice(config *Config) (*Device, error) {
+	if err := id.Validate(config.DeviceID); err != nil {
+		return nil, err
+	}
+	device := &Device{
+		config:   *config,
+		name:     config.Name,
+		channels: make(map[string]*channelState),
+		streams:  make(map[string]*Stream),
+	}
+	if device.config.PerPacket <= 0 {
+		device.config.PerPacket = DefaultPerPacket
+	}
+	if len(device.config.MediaHost) == 0 {
+		device.config.MediaHost = "127.0.0.1"
+	}
+	for _, channel := range config.Channels {
+		if err := id.Validate(channel.DeviceID); err != nil {
+			return nil, fmt.Errorf("channel %s", err.Error())
+		}
+		item := *channel
+		if len(item.ParentID) == 0 {
+			item.ParentID = config.DeviceID
+		}
+		if len(item.Status) == 0 {
+			item.Status = manscdp.StatusOn
+		}
+		device.channels[item.DeviceID] = &channelState{item: &item, ptz: PTZState{Presets: make(map[uint8][3]int)}}
+	}
+	device.client = cascade.NewClient(&cascade.Upstream{
+		LocalID:           config.DeviceID,
+		LocalAddress:      config.LocalAddress,
+		RemoteID:          config.ServerID,
+		Realm:             config.ServerRealm,
+		Address:           config.ServerAddress,
+		Transport:         config.Transport,
+		Password:          config.Password,
+		Expires:           config.Expires,
+		KeepaliveInterval: config.KeepaliveInterval,
+	})
+	userAgent := device.client.GetUserAgent()
+	userAgent.Handle("MESSAGE", device.serveMessage)
+	userAgent.Handle("INVITE", device.serveInvite)
+	userAgent.Handle("ACK", device.serveAck)
+	userAgent.Handle("BYE", device.serveBye)
+	return device, nil
+}
+
+// GetClient returns the registration client, e.g. to watch the
+// registration state.
+func (device *Device) GetClient() *cascade.Client {
+	return device.client
+}
+func (device *Device) GetUserAgent() *ua.UserAgent {
+	return device.client.GetUserAgent()
+}
+
+// Start opens the SIP socket and registers in the background.
+func (device *Device) Start() error {
+	return device.client.Start()
+}
+
+// Close stops the streams, unregisters and closes the SIP socket.
+func (device *Device) Close() error {
+	device.mutex.Lock()
+	streams := device.streams
+	device.streams = make(map[string]*Stream)
+	device.mutex.Unlock()
+	for _, stream := range streams {
+		stream.close()
+	}
+	return device.client.Close()
+}
+
+// OnControl adds a handler of executed control commands.
+func (device *Device) OnControl(handler ControlHandler) {
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	device.handlers = append(device.handlers, handler)
+}
+
+// GetName returns the device name, which DeviceConfig may change.
+func (device *Device) GetName() string {
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	return device.name
+}
+
+// GetChannels returns the catalog of the device sorted by id.
+func (device *Device) GetChannels() []*manscdp.CatalogItem {
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	channels := make([]*manscdp.CatalogItem, 0, len(device.channels))
+	for _, channel := range device.channels {
+		item := *channel.item
+		channels = append(channels, &item)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].DeviceID < channels[j].DeviceID
+	})
+	return channels
+}
+
+// GetPTZ returns the PTZ state of a channel.
+func (device *Device) GetPTZ(channelID string) (PTZState, bool) {
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	channel, ok := device.channels[channelID]
+	if !ok {
+		return PTZState{}, false
+	}
+	state := channel.ptz
+	state.Presets = make(map[uint8][3]int, len(channel.ptz.Presets))
+	for preset, position := range channel.ptz.Presets {
+		state.Presets[preset] = position
+	}
+	return state, true
+}
+
+// IsRecording reports whether a channel records after a record command.
+func (device *Device) IsRecording(channelID string) bool {
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	channel, ok := device.channels[channelID]
+	return ok && channel.recording
+}
+
+// IsGuarded reports whether the device or a channel is armed.
+func (device *Device) IsGuarded(targetID string) bool {
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	if targetID == device.config.DeviceID {
+		return device.guarded
+	}
+	channel, ok := device.channels[targetID]
+	return ok && channel.guarded
+}
+
+// GetStreams returns the streams being played.
+func (device *Device) GetStreams() []*Stream {
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	streams := make([]*Stream, 0, len(device.streams))
+	for _, stream := range device.streams {
+		streams = append(streams, stream)
+	}
+	return streams
+}
+
+// knows reports whether targetID is the device or one of its channels.
+func (device *Device) knows(targetID string) bool {
+	if targetID == device.config.DeviceID {
+		return true
+	}
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	_, ok := device.channels[targetID]
+	return ok
+}
+
+func (device *Device) serveMessage(tx *ua.ServerTransaction) {
+	body := tx.GetRequest().GetBody()
+	envelope, err := manscdp.Decode(body)
+	if err != nil {
+		log.Printf("simulated device %s message error : %s", device.config.DeviceID, err.Error())
+		respond(tx, 400)
+		return
+	}
+	switch envelope.GetRoot() {
+	case manscdp.RootQuery, manscdp.RootControl:
+	default:
+		// responses to our keepalives need no answer
+		respond(tx, 200)
+		return
+	}
+	if !device.knows(envelope.DeviceID) {
+		respond(tx, 404)
+		return
+	}
+	var answer func() []interface{}
+	switch envelope.CmdType {
+	case manscdp.CmdTypeCatalog:
+		query := new(manscdp.CatalogQuery)
+		if err = manscdp.Unmarshal(body, query); err == nil {
+			answer = func() []interface{} { return device.catalog(query) }
+		}
+	case manscdp.CmdTypeDeviceInfo:
+		query := new(manscdp.DeviceInfoQuery)
+		if err = manscdp.Unmarshal(body, query); err == nil {
+			answer = func() []interface{} { return device.deviceInfo(query) }
+		}
+	case manscdp.CmdTypeDeviceStatus:
+		query := new(manscdp.DeviceStatusQuery)
+		if err = manscdp.Unmarshal(body, query); err == nil {
+			answer = func() []interface{} { return device.deviceStatus(query) }
+		}
+	case manscdp.CmdTypeRecordInfo:
+		query := new(manscdp.RecordInfoQuery)
+		if err = manscdp.Unmarshal(body, query); err == nil {
+			answer = func() []interface{} { return device.recordInfo(query) }
+		}
+	case manscdp.CmdTypeDeviceControl, manscdp.CmdTypeDeviceConfig:
+		control := new(manscdp.Control)
+		if err = manscdp.Unmarshal(body, control); err == nil {
+			answer = func() []interface{} { return device.control(control) }
+		}
+	default:
+		respond(tx, 200)
+		return
+	}
+	if err != nil {
+		log.Printf("simulated device %s %s error : %s", device.config.DeviceID, envelope.CmdType, err.Error())
+		respond(tx, 400)
+		return
+	}
+	respond(tx, 200)
+	go func() {
+		for _, response := range answer() {
+			if err := device.client.Send(response); err != nil {
+				log.Printf("simulated device %s %s response error : %s", device.config.DeviceID, envelope.CmdType, err.Error())
+				return
+			}
+		}
+	}()
+}
+
+func (device *Device) catalog(query *manscdp.CatalogQuery) []interface{} {
+	channels := device.GetChannels()
+	if query.DeviceID != device.config.DeviceID {
+		for _, channel := range channels {
+			if channel.DeviceID == query.DeviceID {
+				channels = []*manscdp.CatalogItem{channel}
+				break
+			}
+		}
+	}
+	var responses []interface{}
+	for _, response := range manscdp.NewCatalogResponses(query.SN, query.DeviceID, channels, device.config.PerPacket) {
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func (device *Device) deviceInfo(query *manscdp.DeviceInfoQuery) []interface{} {
+	response := manscdp.NewDeviceInfoResponse(query)
+	response.Manufacturer = device.config.Manufacturer
+	response.Model = device.config.Model
+	response.Firmware = device.config.Firmware
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	if channel, ok := device.channels[query.DeviceID]; ok {
+		response.DeviceName = channel.item.Name
+		response.Channel = 1
+	} else {
+		response.DeviceName = device.name
+		response.Channel = len(device.channels)
+	}
+	return []interface{}{response}
+}
+
+func (device *Device) deviceStatus(query *manscdp.DeviceStatusQuery) []interface{} {
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	online, recording := true, false
+	if channel, ok := device.channels[query.DeviceID]; ok {
+		online = channel.item.IsOnline()
+		recording = channel.recording
+	} else {
+		for _, channel := range device.channels {
+			recording = recording || channel.recording
+		}
+	}
+	response := manscdp.NewDeviceStatusResponse(query, online, time.Now())
+	response.Encode = manscdp.StatusOn
+	response.Record = manscdp.StatusOff
+	if recording {
+		response.Record = manscdp.StatusOn
+	}
+	return []interface{}{response}
+}
+
+// recordInfo answers with the configured records of the channel that
+// overlap the queried period and match its type.
+func (device *Device) recordInfo(query *manscdp.RecordInfoQuery) []interface{} {
+	start, startErr := manscdp.ParseTime(query.StartTime, time.Local)
+	end, endErr := manscdp.ParseTime(query.EndTime, time.Local)
+	var items []*manscdp.RecordItem
+	for _, record := range device.config.Records {
+		if record.DeviceID != query.DeviceID {
+			continue
+		}
+		if len(query.Type) > 0 && query.Type != manscdp.RecordTypeAll && len(record.Type) > 0 && record.Type != query.Type {
+			continue
+		}
+		recordStart, err := manscdp.ParseTime(record.StartTime, time.Local)
+		if err == nil && endErr == nil && !recordStart.Before(end) {
+			continue
+		}
+		recordEnd, err := manscdp.ParseTime(record.EndTime, time.Local)
+		if err == nil && startErr == nil && !recordEnd.After(start) {
+			continue
+		}
+		item := *record
+		items = append(items, &item)
+	}
+	name := device.GetName()
+	device.mutex.Lock()
+	if channel, ok := device.channels[query.DeviceID]; ok {
+		name = channel.item.Name
+	}
+	device.mutex.Unlock()
+	var responses []interface{}
+	for _, response := range manscdp.NewRecordInfoResponses(query, name, items, device.config.PerPacket) {
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+// control executes a control command and returns its Response, if the
+// command has one.
+func (device *Device) control(control *manscdp.Control) []interface{} {
+	ok := device.execute(control)
+	device.mutex.Lock()
+	handlers := append([]ControlHandler(nil), device.handlers...)
+	device.mutex.Unlock()
+	if ok {
+		for _, handler := range handlers {
+			handler(control)
+		}
+	}
+	if !control.HasResponse() {
+		return nil
+	}
+	return []interface{}{manscdp.NewControlResponse(control, ok)}
+}
+
+func (device *Device) execute(control *manscdp.Control) bool {
+	if control.CmdType == manscdp.CmdTypeDeviceConfig {
+		if control.BasicParam != nil && len(control.BasicParam.Name) > 0 {
+			device.mutex.Lock()
+			device.name = control.BasicParam.Name
+			device.mutex.Unlock()
+		}
+		return true
+	}
+	switch {
+	case len(control.TeleBoot) > 0:
+		go device.reboot()
+		return true
+	case len(control.GuardCmd) > 0:
+		guarded := control.GuardCmd == manscdp.GuardCmdSet
+		device.mutex.Lock()
+		defer device.mutex.Unlock()
+		if channel, ok := device.channels[control.DeviceID]; ok {
+			channel.guarded = guarded
+		} else {
+			device.guarded = guarded
+		}
+		return true
+	case len(control.AlarmCmd) > 0, len(control.IFameCmd) > 0, control.HomePosition != nil,
+		control.DragZoomIn != nil, control.DragZoomOut != nil:
+		return true
+	}
+	device.mutex.Lock()
+	defer device.mutex.Unlock()
+	channel, ok := device.channels[control.DeviceID]
+	if !ok {
+		return false
+	}
+	switch {
+	case len(control.RecordCmd) > 0:
+		channel.recording = control.RecordCmd == manscdp.RecordCmdRecord
+		return true
+	case len(control.PTZCmd) > 0:
+		ptzCmd, err := manscdp.ParsePTZCmd(control.PTZCmd)
+		if err != nil {
+			log.Printf("simulated device %s ptz error : %s", device.config.DeviceID, err.Error())
+			return false
+		}
+		return channel.ptz.apply(ptzCmd)
+	}
+	return false
+}
+
+// apply moves the position or changes the presets.
+func (state *PTZState) apply(ptzCmd *manscdp.PTZCmd) bool {
+	switch ptzCmd.GetKind() {
+	case manscdp.PTZKindStop:
+		state.Moving = false
+	case manscdp.PTZKindMove:
+		pan, panSpeed := ptzCmd.GetPan()
+		tilt, tiltSpeed := ptzCmd.GetTilt()
+		zoom, zoomSpeed := ptzCmd.GetZoom()
+		state.Pan += step(pan == manscdp.PanRight, pan == manscdp.PanLeft, panSpeed)
+		state.Tilt += step(tilt == manscdp.TiltUp, tilt == manscdp.TiltDown, tiltSpeed)
+		state.Zoom += step(zoom == manscdp.ZoomIn, zoom == manscdp.ZoomOut, zoomSpeed)
+		state.Moving = true
+	case manscdp.PTZKindPreset:
+		preset := ptzCmd.GetPreset()
+		switch ptzCmd.GetCommand() {
+		case manscdp.PTZPresetSet:
+			state.Presets[preset] = [3]int{state.Pan, state.Tilt, state.Zoom}
+		case manscdp.PTZPresetCall:
+			position, ok := state.Presets[preset]
+			if !ok {
+				return false
+			}
+			state.Pan, state.Tilt, state.Zoom = position[0], position[1], position[2]
+			state.Moving = false
+		case manscdp.PTZPresetDelete:
+			delete(state.Presets, preset)
+		}
+	case manscdp.PTZKindUnknown:
+		return false
+	}
+	return true
+}
+
+func step(positive, negative bool, speed uint8) int {
+	switch {
+	case positive:
+		return int(speed)
+	case negative:
+		return -int(speed)
+	}
+	return 0
+}
+
+// reboot ends the streams and registers again, as a rebooted device does.
+func (device *Device) reboot() {
+	device.mutex.Lock()
+	streams := device.streams
+	device.streams = make(map[string]*Stream)
+	device.mutex.Unlock()
+	for _, stream := range streams {
+		stream.close()
+		device.bye(stream)
+	}
+	if _, err := device.client.Register(0); err != nil {
+		log.Printf("simulated device %s reboot error : %s", device.config.DeviceID, err.Error())
+	}
+	if _, err := device.client.Register(device.client.GetUpstream().Expires); err != nil {
+		log.Printf("simulated device %s reboot error : %s", device.config.DeviceID, err.Error())
+	}
+}
+
+func (device *Device) serveInvite(tx *ua.ServerTransaction) {
+	request := tx.GetRequest()
+	channelID := request.GetRequestLine().GetReqUri().GetUser()
+	device.mutex.Lock()
+	channel, ok := device.channels[channelID]
+	online := ok && channel.item.IsOnline()
+	device.mutex.Unlock()
+	if !ok {
+		respond(tx, 404)
+		return
+	}
+	if !online {
+		respond(tx, 480)
+		return
+	}
+	offer := new(sdp.Session)
+	if err := offer.Parse(string(request.GetBody())); err != nil {
+		respond(tx, 400)
+		return
+	}
+	var media *sdp.Media
+	for _, offered := range offer.GetMedia() {
+		if strings.EqualFold(offered.GetMediaType(), "video") && offered.GetPort() > 0 {
+			media = offered
+			break
+		}
+	}
+	if media == nil || device.config.Clip == nil {
+		respond(tx, 488)
+		return
+	}
+	sender, err := rtp.NewSenderForOffer(offer, media, net.JoinHostPort(device.config.MediaHost, "0"), 96)
+	if err == nil {
+		err = sender.Start()
+	}
+	if err != nil {
+		log.Printf("simulated device %s invite error : %s", device.config.DeviceID, err.Error())
+		respond(tx, 488)
+		return
+	}
+	response := message.NewResponseTo(request, 200)
+	response.GetHeader().Contact = header.NewContact("", device.GetUserAgent().GetContactUri(), nil)
+	response.GetHeader().ContentType = header.NewContentType(sdp.ContentType)
+	body, _ := device.answer(offer, media, sender).Raw()
+	response.SetBody([]byte(body))
+	stream := &Stream{
+		channelID: channelID,
+		callId:    request.GetHeader().CallID.GetId(),
+		dialog:    ua.NewServerDialog(request, response),
+		sender:    sender,
+		stop:      make(chan struct{}),
+	}
+	device.mutex.Lock()
+	device.streams[stream.callId] = stream
+	device.mutex.Unlock()
+	if err := tx.Respond(response); err != nil {
+		device.end(stream.callId)
+	}
+}
+
+// answer announces the stream the sender sends under the offered SSRC.
+func (device *Device) answer(offer *sdp.Session, media *sdp.Media, sender *rtp.Sender) *sdp.Session {
+	port := 0
+	if local := sender.LocalAddr(); local != nil {
+		_, localPort, _ := net.SplitHostPort(local.String())
+		port, _ = strconv.Atoi(localPort)
+	}
+	answer := sdp.NewMedia(media.GetMediaType(), uint16(port), media.GetProto(), "96")
+	answer.AddAttribute("sendonly", "")
+	answer.AddAttribute("rtpmap", "96 PS/90000")
+	if media.IsTCP() {
+		answer.AddAttribute("setup", sender.GetSetup())
+		answer.AddAttribute("connection", "new")
+	}
+	return sdp.NewSession(sdp.NewOrigin(device.config.DeviceID, device.config.MediaHost), offer.GetSessionName(),
+		sdp.NewConnection(device.config.MediaHost), offer.GetSSRC(), answer)
+}
+
+// serveAck starts the stream the ACK confirms.
+func (device *Device) serveAck(tx *ua.ServerTransaction) {
+	device.mutex.Lock()
+	stream, ok := device.streams[tx.GetRequest().GetHeader().CallID.GetId()]
+	start := ok && !stream.started
+	if start {
+		stream.started = true
+	}
+	device.mutex.Unlock()
+	if start {
+		go device.config.Clip.Play(stream.sender, stream.stop)
+	}
+}
+
+func (device *Device) serveBye(tx *ua.ServerTransaction) {
+	if !device.end(tx.GetRequest().GetHeader().CallID.GetId()) {
+		respond(tx, 481)
+		return
+	}
+	respond(tx, 200)
+}
+
+// end stops a stream and reports whether it was playing.
+func (device *Device) end(callId string) bool {
+	device.mutex.Lock()
+	stream, ok := device.streams[callId]
+	delete(device.streams, callId)
+	device.mutex.Unlock()
+	if ok {
+		stream.close()
+	}
+	return ok
+}
+
+// Bye hangs up the streams of a channel.
+func (device *Device) Bye(channelID string) error {
+	var ended []*Stream
+	device.mutex.Lock()
+	for callId, stream := range device.streams {
+		if stream.channelID == channelID {
+			delete(device.streams, callId)
+			ended = append(ended, stream)
+		}
+	}
+	device.mutex.Unlock()
+	if len(ended) == 0 {
+		return errors.New("no stream of " + channelID)
+	}
+	var err error
+	for _, stream := range ended {
+		stream.close()
+		if byeErr := device.bye(stream); err == nil {
+			err = byeErr
+		}
+	}
+	return err
+}
+
+func (device *Device) bye(stream *Stream) error {
+	userAgent := device.GetUserAgent()
+	request := userAgent.NewDialogRequest(stream.dialog, "BYE", nil, "")
+	_, err := userAgent.Request(request, device.config.ServerAddress)
+	return err
+}
+
+func (stream *Stream) close() {
+	close(stream.stop)
+	_ = stream.sender.Close()
+}
+
+func respond(tx *ua.ServerTransaction, statusCode int) {
+	if err := tx.RespondCode(statusCode); err != nil {
+		log.Printf("sip response to %s error : %s", tx.GetSource(), err.Error())
+	}
+}
@@ -0,0 +1,281 @@
+package simulator
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/media/rtp"
+	"github.com/kokutas/gb28181/media/sdp"
+	"github.com/kokutas/gb28181/platform"
+	"github.com/kokutas/gb28181/sip/auth"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+const (
+	testServerID  = "34020000002000000001"
+	testDeviceID  = "34020000001110000001"
+	testChannelID = "34020000001320000001"
+	testPassword  = "12345678"
+)
+
+// testServer is a platform accepting digest-authorized registrations.
+type testServer struct {
+	platform *platform.Platform
+
+	mutex     sync.Mutex
+	registers int
+	source    string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	userAgent := ua.NewUserAgent(testServerID, "3402000000", "udp", "127.0.0.1:0")
+	userAgent.SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	server := &testServer{platform: platform.NewPlatform(userAgent)}
+	server.platform.SetTimeout(2 * time.Second)
+	userAgent.Handle("REGISTER", server.serveRegister)
+	if err := userAgent.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { userAgent.Close() })
+	return server
+}
+
+func (server *testServer) serveRegister(tx *ua.ServerTransaction) {
+	request := tx.GetRequest()
+	authorization := request.GetHeader().Authorization
+	if authorization == nil {
+		response := message.NewResponseTo(request, 401)
+		response.GetHeader().WWWAuthenticate = header.NewWWWAuthenticate("Digest", "3402000000", message.NewTag(), "MD5")
+		tx.Respond(response)
+		return
+	}
+	if !auth.Verify(authorization, testPassword, "REGISTER") {
+		tx.RespondCode(403)
+		return
+	}
+	server.mutex.Lock()
+	server.registers++
+	server.source = tx.GetSource()
+	server.mutex.Unlock()
+	tx.RespondCode(200)
+}
+
+// device returns the registered device as the platform reaches it.
+func (server *testServer) device() *platform.Device {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return &platform.Device{ID: testDeviceID, Address: server.source}
+}
+
+func newTestDevice(t *testing.T, server *testServer) *Device {
+	clip, err := LoadClip("../media/ps/testdata/h264_g711.ps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := NewDevice(&Config{
+		DeviceID:      testDeviceID,
+		LocalAddress:  "127.0.0.1:0",
+		ServerID:      testServerID,
+		ServerAddress: server.platform.GetUserAgent().Addr().String(),
+		Password:      testPassword,
+		Name:          "nvr",
+		Manufacturer:  "gb28181",
+		Channels: []*manscdp.CatalogItem{
+			{DeviceID: testChannelID, Name: "gate"},
+			{DeviceID: "34020000001320000002", Name: "hall", Status: manscdp.StatusOff},
+		},
+		Records: []*manscdp.RecordItem{
+			{DeviceID: testChannelID, Name: "gate", StartTime: "2024-05-01T08:00:00", EndTime: "2024-05-01T09:00:00", Type: manscdp.RecordTypeTime},
+			{DeviceID: testChannelID, Name: "gate", StartTime: "2024-05-01T10:00:00", EndTime: "2024-05-01T10:30:00", Type: manscdp.RecordTypeAlarm},
+			{DeviceID: testChannelID, Name: "gate", StartTime: "2024-05-02T08:00:00", EndTime: "2024-05-02T09:00:00", Type: manscdp.RecordTypeTime},
+		},
+		PerPacket: 1,
+		Clip:      clip,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device.GetUserAgent().SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := device.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { device.Close() })
+	deadline := time.Now().Add(3 * time.Second)
+	for !device.GetClient().IsRegistered() {
+		if time.Now().After(deadline) {
+			t.Fatal("the device did not register")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return device
+}
+
+func TestDevice_Queries(t *testing.T) {
+	server := newTestServer(t)
+	newTestDevice(t, server)
+	target := server.device()
+
+	items, err := server.platform.QueryCatalog(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].DeviceID != testChannelID || items[0].ParentID != testDeviceID || items[1].IsOnline() {
+		t.Fatalf("unexpected catalog %+v", items)
+	}
+
+	query := manscdp.NewDeviceInfoQuery(server.platform.NextSN(), testDeviceID)
+	raw, err := server.platform.Query(target, testDeviceID, query, manscdp.CmdTypeDeviceInfo, query.SN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := new(manscdp.DeviceInfoResponse)
+	if err := manscdp.Unmarshal(raw, info); err != nil || info.DeviceName != "nvr" || info.Channel != 2 {
+		t.Fatalf("unexpected device info %+v %v", info, err)
+	}
+
+	status := manscdp.NewDeviceStatusQuery(server.platform.NextSN(), "34020000001320000002")
+	raw, err = server.platform.Query(target, status.DeviceID, status, manscdp.CmdTypeDeviceStatus, status.SN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusResponse := new(manscdp.DeviceStatusResponse)
+	if err := manscdp.Unmarshal(raw, statusResponse); err != nil || statusResponse.IsOnline() {
+		t.Fatalf("unexpected channel status %+v %v", statusResponse, err)
+	}
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	records, err := server.platform.RecordInfo(target, testChannelID, start, start.Add(24*time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("unexpected %d records", len(records))
+	}
+	records, err = server.platform.RecordInfo(target, testChannelID, start, start.Add(24*time.Hour), manscdp.RecordTypeAlarm)
+	if err != nil || len(records) != 1 || records[0].StartTime != "2024-05-01T10:00:00" {
+		t.Fatalf("unexpected alarm records %+v %v", records, err)
+	}
+
+	if err := server.platform.Send(target, "34020000001320000099", manscdp.NewCatalogQuery(1, "34020000001320000099")); err == nil {
+		t.Fatal("a query of an unknown channel must be rejected")
+	}
+}
+
+func TestDevice_Control(t *testing.T) {
+	server := newTestServer(t)
+	device := newTestDevice(t, server)
+	target := server.device()
+	controls := make(chan *manscdp.Control, 8)
+	device.OnControl(func(control *manscdp.Control) { controls <- control })
+	wait := func() {
+		select {
+		case <-controls:
+		case <-time.After(2 * time.Second):
+			t.Fatal("the control was not executed")
+		}
+	}
+
+	if err := server.platform.PTZ(target, testChannelID, manscdp.NewPTZMove(manscdp.PanRight, manscdp.TiltUp, manscdp.ZoomStop, 10, 20, 0), 0); err != nil {
+		t.Fatal(err)
+	}
+	wait()
+	preset, _ := manscdp.NewPreset(manscdp.PTZPresetSet, 3)
+	server.platform.PTZ(target, testChannelID, preset, 0)
+	wait()
+	server.platform.PTZ(target, testChannelID, manscdp.NewPTZMove(manscdp.PanLeft, manscdp.TiltStop, manscdp.ZoomIn, 30, 0, 5), 0)
+	wait()
+	if state, _ := device.GetPTZ(testChannelID); state.Pan != -20 || state.Tilt != 20 || state.Zoom != 5 || !state.Moving {
+		t.Fatalf("unexpected ptz state %+v", state)
+	}
+	call, _ := manscdp.NewPreset(manscdp.PTZPresetCall, 3)
+	server.platform.PTZ(target, testChannelID, call, 0)
+	wait()
+	if state, _ := device.GetPTZ(testChannelID); state.Pan != 10 || state.Tilt != 20 || state.Zoom != 0 || state.Moving {
+		t.Fatalf("unexpected ptz state after the preset %+v", state)
+	}
+
+	response, err := server.platform.Record(target, testChannelID, true)
+	if err != nil || !response.IsOK() || !device.IsRecording(testChannelID) {
+		t.Fatalf("unexpected record response %+v %v", response, err)
+	}
+	response, err = server.platform.Guard(target, testDeviceID, true)
+	if err != nil || !response.IsOK() || !device.IsGuarded(testDeviceID) || device.IsGuarded(testChannelID) {
+		t.Fatalf("unexpected guard response %+v %v", response, err)
+	}
+	response, err = server.platform.DeviceConfig(target, &manscdp.BasicParam{Name: "renamed"})
+	if err != nil || !response.IsOK() || device.GetName() != "renamed" {
+		t.Fatalf("unexpected config response %+v %v", response, err)
+	}
+}
+
+func TestDevice_Invite(t *testing.T) {
+	server := newTestServer(t)
+	device := newTestDevice(t, server)
+	target := server.device()
+	frames := make(chan *rtp.Frame, 64)
+	receiver := rtp.NewReceiver("udp", "127.0.0.1:0", 16, func(frame *rtp.Frame) {
+		select {
+		case frames <- frame:
+		default:
+		}
+	})
+	if err := receiver.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	_, port, _ := net.SplitHostPort(receiver.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	media := sdp.NewMedia("video", uint16(portNumber), sdp.ProtoUDP, "96")
+	media.AddAttribute("recvonly", "")
+	media.AddAttribute("rtpmap", "96 PS/90000")
+	offer := sdp.NewSession(sdp.NewOrigin(testServerID, "127.0.0.1"), "Play", sdp.NewConnection("127.0.0.1"), "0200000001", media)
+
+	call, err := server.platform.Invite(target, testChannelID, offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call.GetAnswer().GetSSRC() != "0200000001" || call.GetAnswer().GetMedia()[0].GetDirection() != "sendonly" {
+		t.Fatalf("unexpected answer %s", call.GetAnswer())
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case frame := <-frames:
+			if frame.SSRC != 200000001 {
+				t.Fatalf("unexpected ssrc %d", frame.SSRC)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no media streamed")
+		}
+	}
+	if streams := device.GetStreams(); len(streams) != 1 || streams[0].GetChannelID() != testChannelID {
+		t.Fatalf("unexpected streams %v", streams)
+	}
+	if err := server.platform.Bye(call); err != nil {
+		t.Fatal(err)
+	}
+	if len(device.GetStreams()) != 0 {
+		t.Fatal("the stream is still playing")
+	}
+
+	if _, err := server.platform.Invite(target, "34020000001320000002", offer); err == nil {
+		t.Fatal("an offline channel must not be invited")
+	}
+	call, err = server.platform.Invite(target, testChannelID, offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := device.Bye(testChannelID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-call.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("the platform call was not ended")
+	}
+}
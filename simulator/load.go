@@ -0,0 +1,505 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/cascade"
+	"github.com/kokutas/gb28181/id"
+	"github.com/kokutas/gb28181/manscdp"
+	"github.com/kokutas/gb28181/media/rtp"
+	"github.com/kokutas/gb28181/media/sdp"
+	"github.com/kokutas/gb28181/platform"
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// keepaliveJitter is the fraction by which the keepalive interval of each
+// device varies, so that devices started together drift apart.
+const keepaliveJitter = 0.1
+
+// LoadConfig configures a load test of many simulated devices registering
+// with one platform. Zero values take the defaults of Config.
+type LoadConfig struct {
+	Devices           int
+	FirstID           string // id of the first device, the serials of the others follow
+	Host              string // local IP address of the devices, 127.0.0.1 when empty
+	Transport         string
+	ServerID          string
+	ServerRealm       string
+	ServerAddress     string
+	Password          string
+	Expires           uint
+	KeepaliveInterval time.Duration
+	// RampUp spreads the starts of the devices evenly over its duration.
+	RampUp time.Duration
+	// Each device gets a random number of channels between MinChannels and
+	// MaxChannels.
+	MinChannels int
+	MaxChannels int
+	Clip        *Clip
+	// ChurnInterval is the mean delay between two INVITEs the load test
+	// sends to random channels of registered devices; each call is held up
+	// to HoldTime. Zero disables the churn.
+	ChurnInterval time.Duration
+	HoldTime      time.Duration
+	Seed          int64
+}
+
+// LoadReport sums up a load test. Codes count the outcome of registrations
+// and their refreshes by status code, 408 for transactions timing out;
+// Failures include registrations lost to unanswered keepalives.
+type LoadReport struct {
+	Devices     int
+	Started     int
+	Registered  int
+	Latencies   []time.Duration // first registrations, sorted
+	Failures    int
+	Codes       map[int]int
+	Errors      int // failures without a status code
+	Invites     int
+	InviteCodes map[int]int
+	InviteFails int
+	Packets     uint64 // media packets received from invited channels
+}
+
+// Percentile returns the registration latency below which p percent of
+// the samples lie, zero without samples.
+func (report *LoadReport) Percentile(p float64) time.Duration {
+	if len(report.Latencies) == 0 {
+		return 0
+	}
+	rank := int(float64(len(report.Latencies))*p/100+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(report.Latencies) {
+		rank = len(report.Latencies) - 1
+	}
+	return report.Latencies[rank]
+}
+
+func (report *LoadReport) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "devices %d, started %d, registered %d\n", report.Devices, report.Started, report.Registered)
+	fmt.Fprintf(&builder, "register latency p50 %s p90 %s p99 %s max %s (%d samples)\n",
+		report.Percentile(50), report.Percentile(90), report.Percentile(99), report.Percentile(100), len(report.Latencies))
+	fmt.Fprintf(&builder, "register failures %d, errors %d, responses %s\n", report.Failures, report.Errors, formatCodes(report.Codes))
+	fmt.Fprintf(&builder, "invites %d, failures %d, responses %s, media packets %d", report.Invites, report.InviteFails, formatCodes(report.InviteCodes), report.Packets)
+	return builder.String()
+}
+
+func formatCodes(codes map[int]int) string {
+	if len(codes) == 0 {
+		return "none"
+	}
+	keys := make([]int, 0, len(codes))
+	for code := range codes {
+		keys = append(keys, code)
+	}
+	sort.Ints(keys)
+	fields := make([]string, 0, len(keys))
+	for _, code := range keys {
+		fields = append(fields, fmt.Sprintf("%d:%d", code, codes[code]))
+	}
+	return strings.Join(fields, " ")
+}
+
+// loadDevice is a device of a load test with its first registration.
+type loadDevice struct {
+	device     *Device
+	started    time.Time
+	registered bool
+}
+
+// Load runs a load test: it starts the devices staggered over the ramp-up,
+// measures their registrations and, with churn, invites random channels
+// from a platform user agent of its own.
+type Load struct {
+	config   LoadConfig
+	devices  []*loadDevice
+	inviter  *platform.Platform
+	receiver *rtp.Receiver
+	ssrc     int
+
+	mutex  sync.Mutex
+	random *rand.Rand
+	report LoadReport
+
+	stop chan struct{}
+	wait sync.WaitGroup
+}
+
+// NewLoad builds the devices of a load test; Start runs it.
+func NewLoad(config *LoadConfig) (*Load, error) {
+	if config.Devices <= 0 {
+		return nil, errors.New("the load test needs devices")
+	}
+	first, err := id.Parse(config.FirstID)
+	if err != nil {
+		return nil, err
+	}
+	load := &Load{
+		config: *config,
+		random: rand.New(rand.NewSource(config.Seed)),
+		report: LoadReport{Devices: config.Devices, Codes: make(map[int]int), InviteCodes: make(map[int]int)},
+		stop:   make(chan struct{}),
+	}
+	if len(load.config.Host) == 0 {
+		load.config.Host = "127.0.0.1"
+	}
+	if load.config.MinChannels < 0 {
+		load.config.MinChannels = 0
+	}
+	if load.config.MaxChannels < load.config.MinChannels {
+		load.config.MaxChannels = load.config.MinChannels
+	}
+	if load.config.KeepaliveInterval <= 0 {
+		load.config.KeepaliveInterval = cascade.DefaultKeepaliveInterval
+	}
+	serial, _ := strconv.Atoi(first.GetSerial())
+	channelSerial := serial
+	for i := 0; i < config.Devices; i++ {
+		deviceID, err := id.New(first.GetCenter(), first.GetIndustry(), first.GetType(), first.GetNetwork(), serial+i)
+		if err != nil {
+			return nil, fmt.Errorf("device %d %s", i+1, err.Error())
+		}
+		count := load.config.MinChannels + load.random.Intn(load.config.MaxChannels-load.config.MinChannels+1)
+		var channels []*manscdp.CatalogItem
+		for j := 0; j < count; j++ {
+			channelID, err := id.New(first.GetCenter(), first.GetIndustry(), id.TypeIPC, first.GetNetwork(), channelSerial)
+			if err != nil {
+				return nil, fmt.Errorf("channel of device %s %s", deviceID, err.Error())
+			}
+			channelSerial++
+			channels = append(channels, &manscdp.CatalogItem{
+				DeviceID:  channelID.String(),
+				Name:      fmt.Sprintf("camera %d", j+1),
+				CivilCode: first.GetCenter()[:6],
+				Status:    manscdp.StatusOn,
+			})
+		}
+		interval := load.config.KeepaliveInterval
+		interval += time.Duration((load.random.Float64()*2 - 1) * keepaliveJitter * float64(interval))
+		device, err := NewDevice(&Config{
+			DeviceID:          deviceID.String(),
+			LocalAddress:      net.JoinHostPort(load.config.Host, "0"),
+			Transport:         load.config.Transport,
+			ServerID:          load.config.ServerID,
+			ServerRealm:       load.config.ServerRealm,
+			ServerAddress:     load.config.ServerAddress,
+			Password:          load.config.Password,
+			Expires:           load.config.Expires,
+			KeepaliveInterval: interval,
+			Name:              fmt.Sprintf("load %d", i+1),
+			Manufacturer:      "gb28181",
+			Model:             "simulator",
+			Channels:          channels,
+			Clip:              load.config.Clip,
+			MediaHost:         load.config.Host,
+		})
+		if err != nil {
+			return nil, err
+		}
+		member := &loadDevice{device: device}
+		device.GetClient().OnStateChange(func(registered bool, err error) {
+			load.record(member, registered, err)
+		})
+		load.devices = append(load.devices, member)
+	}
+	if load.config.ChurnInterval > 0 {
+		realm := load.config.ServerRealm
+		if len(realm) == 0 && len(load.config.ServerID) >= 10 {
+			realm = load.config.ServerID[:10]
+		}
+		transport := load.config.Transport
+		if len(transport) == 0 {
+			transport = "udp"
+		}
+		load.inviter = platform.NewPlatform(ua.NewUserAgent(load.config.ServerID, realm, transport, net.JoinHostPort(load.config.Host, "0")))
+		load.receiver = rtp.NewReceiver("udp", net.JoinHostPort(load.config.Host, "0"), 16, func(*rtp.Frame) {})
+	}
+	return load, nil
+}
+
+// GetDevices returns the devices of the load test.
+func (load *Load) GetDevices() []*Device {
+	devices := make([]*Device, 0, len(load.devices))
+	for _, member := range load.devices {
+		devices = append(devices, member.device)
+	}
+	return devices
+}
+
+// GetInviter returns the platform sending the churn INVITEs, nil without
+// churn.
+func (load *Load) GetInviter() *platform.Platform {
+	return load.inviter
+}
+
+// Start opens the churn sockets and starts the devices in the background.
+func (load *Load) Start() error {
+	if load.inviter != nil {
+		if err := load.receiver.Listen(); err != nil {
+			return err
+		}
+		if err := load.inviter.GetUserAgent().Listen(); err != nil {
+			load.receiver.Close()
+			return err
+		}
+		load.wait.Add(1)
+		go load.churn()
+	}
+	load.wait.Add(1)
+	go load.ramp()
+	return nil
+}
+
+// Stop ends the churn calls, unregisters the started devices and closes
+// everything.
+func (load *Load) Stop() {
+	select {
+	case <-load.stop:
+		return
+	default:
+	}
+	close(load.stop)
+	load.wait.Wait()
+	var closing sync.WaitGroup
+	for _, member := range load.devices {
+		load.mutex.Lock()
+		started := !member.started.IsZero()
+		load.mutex.Unlock()
+		if !started {
+			continue
+		}
+		closing.Add(1)
+		go func(device *Device) {
+			defer closing.Done()
+			device.Close()
+		}(member.device)
+	}
+	closing.Wait()
+	if load.inviter != nil {
+		load.inviter.GetUserAgent().Close()
+		load.receiver.Close()
+	}
+}
+
+// Report returns the figures so far.
+func (load *Load) Report() *LoadReport {
+	load.mutex.Lock()
+	report := load.report
+	report.Latencies = append([]time.Duration(nil), load.report.Latencies...)
+	report.Codes = make(map[int]int, len(load.report.Codes))
+	for code, count := range load.report.Codes {
+		report.Codes[code] = count
+	}
+	report.InviteCodes = make(map[int]int, len(load.report.InviteCodes))
+	for code, count := range load.report.InviteCodes {
+		report.InviteCodes[code] = count
+	}
+	load.mutex.Unlock()
+	for _, member := range load.devices {
+		if member.device.GetClient().IsRegistered() {
+			report.Registered++
+		}
+	}
+	if load.receiver != nil {
+		report.Packets, _, _, _ = load.receiver.Stats()
+	}
+	sort.Slice(report.Latencies, func(i, j int) bool {
+		return report.Latencies[i] < report.Latencies[j]
+	})
+	return &report
+}
+
+// ramp starts the devices evenly over the ramp-up.
+func (load *Load) ramp() {
+	defer load.wait.Done()
+	begin := time.Now()
+	for i, member := range load.devices {
+		delay := load.config.RampUp * time.Duration(i) / time.Duration(len(load.devices))
+		if !load.sleep(time.Until(begin.Add(delay))) {
+			return
+		}
+		load.mutex.Lock()
+		member.started = time.Now()
+		load.mutex.Unlock()
+		if err := member.device.Start(); err != nil {
+			log.Printf("load device %s start error : %s", member.device.config.DeviceID, err.Error())
+			load.mutex.Lock()
+			member.started = time.Time{}
+			load.report.Errors++
+			load.mutex.Unlock()
+			continue
+		}
+		load.mutex.Lock()
+		load.report.Started++
+		load.mutex.Unlock()
+	}
+}
+
+// record counts a registration state change of a device.
+func (load *Load) record(member *loadDevice, registered bool, err error) {
+	load.mutex.Lock()
+	defer load.mutex.Unlock()
+	if registered {
+		load.report.Codes[200]++
+		if !member.registered {
+			member.registered = true
+			load.report.Latencies = append(load.report.Latencies, time.Since(member.started))
+		}
+		return
+	}
+	if err == nil {
+		return
+	}
+	load.report.Failures++
+	if code := statusCode(err); code > 0 {
+		load.report.Codes[code]++
+	} else {
+		load.report.Errors++
+	}
+}
+
+// statusCode returns the status code an error stands for, 0 for none.
+func statusCode(err error) int {
+	switch err {
+	case ua.ErrTimeout:
+		return 408
+	case cascade.ErrUnauthorized:
+		return 401
+	}
+	if sipError, ok := err.(*lib.SipError); ok {
+		return sipError.Code
+	}
+	return 0
+}
+
+// churn invites a random channel of a random registered device at random
+// intervals averaging the churn interval.
+func (load *Load) churn() {
+	defer load.wait.Done()
+	for {
+		load.mutex.Lock()
+		delay := time.Duration(load.random.Int63n(int64(2*load.config.ChurnInterval) + 1))
+		load.mutex.Unlock()
+		if !load.sleep(delay) {
+			return
+		}
+		device, channelID := load.pick()
+		if device == nil {
+			continue
+		}
+		load.invite(device, channelID)
+	}
+}
+
+// pick returns a random online channel of a random registered device.
+func (load *Load) pick() (*Device, string) {
+	var registered []*Device
+	for _, member := range load.devices {
+		if member.device.GetClient().IsRegistered() {
+			registered = append(registered, member.device)
+		}
+	}
+	if len(registered) == 0 {
+		return nil, ""
+	}
+	load.mutex.Lock()
+	device := registered[load.random.Intn(len(registered))]
+	load.mutex.Unlock()
+	var channels []string
+	for _, channel := range device.GetChannels() {
+		if channel.IsOnline() {
+			channels = append(channels, channel.DeviceID)
+		}
+	}
+	if len(channels) == 0 {
+		return nil, ""
+	}
+	load.mutex.Lock()
+	defer load.mutex.Unlock()
+	return device, channels[load.random.Intn(len(channels))]
+}
+
+// invite calls channelID of the device and holds the call for a random
+// time in the background.
+func (load *Load) invite(device *Device, channelID string) {
+	_, port, _ := net.SplitHostPort(load.receiver.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	media := sdp.NewMedia("video", uint16(portNumber), sdp.ProtoUDP, "96")
+	media.AddAttribute("recvonly", "")
+	media.AddAttribute("rtpmap", "96 PS/90000")
+	load.mutex.Lock()
+	load.ssrc = (load.ssrc + 1) % 10000
+	ssrc := load.ssrc
+	load.mutex.Unlock()
+	domain := "00000"
+	if len(load.config.ServerID) >= 8 {
+		domain = load.config.ServerID[3:8]
+	}
+	offer := sdp.NewSession(sdp.NewOrigin(load.config.ServerID, load.config.Host), "Play",
+		sdp.NewConnection(load.config.Host), fmt.Sprintf("0%s%04d", domain, ssrc), media)
+	target := &platform.Device{ID: device.config.DeviceID, Address: device.GetUserAgent().Addr().String()}
+	call, err := load.inviter.Invite(target, channelID, offer)
+	load.mutex.Lock()
+	load.report.Invites++
+	if err != nil {
+		load.report.InviteFails++
+		if code := statusCode(err); code > 0 {
+			load.report.InviteCodes[code]++
+		}
+	} else {
+		load.report.InviteCodes[200]++
+	}
+	hold := time.Duration(load.random.Int63n(int64(load.config.HoldTime) + 1))
+	load.mutex.Unlock()
+	if err != nil {
+		return
+	}
+	load.wait.Add(1)
+	go func() {
+		defer load.wait.Done()
+		timer := time.NewTimer(hold)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-call.Done():
+			return
+		case <-load.stop:
+		}
+		if err := load.inviter.Bye(call); err != nil && err != platform.ErrCallEnded {
+			log.Printf("load call of %s bye error : %s", channelID, err.Error())
+		}
+	}()
+}
+
+// sleep waits for delay and reports false when stopped meanwhile.
+func (load *Load) sleep(delay time.Duration) bool {
+	if delay <= 0 {
+		select {
+		case <-load.stop:
+			return false
+		default:
+			return true
+		}
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-load.stop:
+		return false
+	}
+}
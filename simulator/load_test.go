@@ -0,0 +1,105 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	server := newTestServer(t)
+	clip, err := LoadClip("../media/ps/testdata/h264_g711.ps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	load, err := NewLoad(&LoadConfig{
+		Devices:           5,
+		FirstID:           "34020000001110000101",
+		ServerID:          testServerID,
+		ServerAddress:     server.platform.GetUserAgent().Addr().String(),
+		Password:          testPassword,
+		KeepaliveInterval: time.Second,
+		RampUp:            100 * time.Millisecond,
+		MinChannels:       1,
+		MaxChannels:       3,
+		Clip:              clip,
+		ChurnInterval:     20 * time.Millisecond,
+		HoldTime:          100 * time.Millisecond,
+		Seed:              1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := load.GetDevices()
+	if len(devices) != 5 || devices[4].config.DeviceID != "34020000001110000105" {
+		t.Fatalf("unexpected devices %d", len(devices))
+	}
+	seen := make(map[string]bool)
+	for _, device := range devices {
+		device.GetUserAgent().SetTimers(20*time.Millisecond, 80*time.Millisecond)
+		channels := device.GetChannels()
+		if len(channels) < 1 || len(channels) > 3 {
+			t.Fatalf("unexpected %d channels", len(channels))
+		}
+		for _, channel := range channels {
+			if seen[channel.DeviceID] {
+				t.Fatalf("channel %s repeated", channel.DeviceID)
+			}
+			seen[channel.DeviceID] = true
+		}
+	}
+	if err := load.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer load.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		report := load.Report()
+		if report.Registered == 5 && report.InviteCodes[200] >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the load test did not progress\n%s", report)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	load.Stop()
+
+	report := load.Report()
+	if report.Started != 5 || len(report.Latencies) != 5 || report.Codes[200] < 5 || report.Failures != 0 {
+		t.Fatalf("unexpected report\n%s", report)
+	}
+	if report.Percentile(50) > report.Percentile(99) || report.Percentile(100) != report.Latencies[4] {
+		t.Fatalf("unexpected percentiles %v", report.Latencies)
+	}
+	if report.Registered != 0 || len(load.GetInviter().GetCalls()) != 0 {
+		t.Fatal("the load test did not clean up")
+	}
+}
+
+func TestLoad_Failures(t *testing.T) {
+	server := newTestServer(t)
+	load, err := NewLoad(&LoadConfig{
+		Devices:       3,
+		FirstID:       "34020000001110000201",
+		ServerID:      testServerID,
+		ServerAddress: server.platform.GetUserAgent().Addr().String(),
+		Password:      "wrong",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := load.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer load.Stop()
+	deadline := time.Now().Add(3 * time.Second)
+	for load.Report().Failures < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the failures were not counted\n%s", load.Report())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if report := load.Report(); report.Codes[403] < 3 || len(report.Latencies) != 0 || report.Registered != 0 {
+		t.Fatalf("unexpected report\n%s", report)
+	}
+}
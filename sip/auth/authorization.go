@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/kokutas/gb28181/sip/message/header"
+)
+
+// Authorize answers challenge for a request of method to uri with the MD5
+// digest of RFC 2617 without qop.
+func Authorize(challenge *header.WWWAuthenticate, username, password, method string, uri *header.Uri) (*header.Authorization, error) {
+	if challenge == nil {
+		return nil, errors.New("the www-authenticate challenge is missing")
+	}
+	if err := challenge.Validator(); err != nil {
+		return nil, err
+	}
+	uriStr, err := uri.Raw()
+	if err != nil {
+		return nil, err
+	}
+	response := GenDigestResponse(&DigestParams{
+		Digest:    Digest{Realm: challenge.GetRealm(), UserName: username, Password: password},
+		Algorithm: "MD5",
+		Method:    strings.ToUpper(method),
+		URI:       uriStr,
+		Nonce:     challenge.GetNonce(),
+	})
+	return header.NewAuthorization("Digest", username, challenge.GetRealm(), challenge.GetNonce(), uri, response, "MD5"), nil
+}
+
+// Verify reports whether authorization carries the digest of password for
+// a request of method, with or without qop.
+func Verify(authorization *header.Authorization, password, method string) bool {
+	if authorization == nil || authorization.Validator() != nil {
+		return false
+	}
+	uriStr, err := authorization.GetUri().Raw()
+	if err != nil {
+		return false
+	}
+	var nc uint64
+	if len(authorization.GetQop()) > 0 {
+		if len(authorization.GetCnonce()) == 0 {
+			return false
+		}
+		if nc, err = strconv.ParseUint(authorization.GetNc(), 16, 32); err != nil {
+			return false
+		}
+	}
+	expected := GenDigestResponse(&DigestParams{
+		Digest:    Digest{Realm: authorization.GetRealm(), UserName: authorization.GetUserName(), Password: password},
+		Algorithm: "MD5",
+		Method:    strings.ToUpper(method),
+		URI:       uriStr,
+		Nonce:     authorization.GetNonce(),
+		Qop:       authorization.GetQop(),
+		Cnonce:    authorization.GetCnonce(),
+		Nc:        uint32(nc),
+	})
+	return strings.EqualFold(expected, authorization.GetResponse())
+}
@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"strings"
+)
+
+// Parameter is a name with an optional value, such as the lr of a URI or
+// the tag of a From header field; a value-less parameter has an empty one.
+type Parameter struct {
+	name  string // name
+	value string // value
+}
+
+func (parameter *Parameter) SetName(name string) {
+	parameter.name = name
+}
+func (parameter *Parameter) GetName() string {
+	return parameter.name
+}
+func (parameter *Parameter) SetValue(value string) {
+	parameter.value = value
+}
+func (parameter *Parameter) GetValue() string {
+	return parameter.value
+}
+func NewParameter(name, value string) *Parameter {
+	return &Parameter{
+		name:  name,
+		value: value,
+	}
+}
+
+// Parameters are parameters in the order they are written. Names are
+// compared case-insensitively.
+type Parameters []*Parameter
+
+// Get returns the value of the first parameter of a name and whether there
+// is one.
+func (parameters Parameters) Get(name string) (string, bool) {
+	for _, parameter := range parameters {
+		if strings.EqualFold(parameter.name, name) {
+			return parameter.value, true
+		}
+	}
+	return "", false
+}
+
+// Set sets the value of the first parameter of a name, or appends the
+// parameter when there is none.
+func (parameters *Parameters) Set(name, value string) {
+	for _, parameter := range *parameters {
+		if strings.EqualFold(parameter.name, name) {
+			parameter.value = value
+			return
+		}
+	}
+	*parameters = append(*parameters, NewParameter(name, value))
+}
+
+// Del removes the parameters of a name.
+func (parameters *Parameters) Del(name string) {
+	kept := make(Parameters, 0, len(*parameters))
+	for _, parameter := range *parameters {
+		if !strings.EqualFold(parameter.name, name) {
+			kept = append(kept, parameter)
+		}
+	}
+	*parameters = kept
+}
+
+// Clone copies the parameters.
+func (parameters Parameters) Clone() Parameters {
+	if parameters == nil {
+		return nil
+	}
+	cloned := make(Parameters, 0, len(parameters))
+	for _, parameter := range parameters {
+		cloned = append(cloned, NewParameter(parameter.name, parameter.value))
+	}
+	return cloned
+}
@@ -1,5 +1,7 @@
 package lib
 
+import "strings"
+
 // Informational  =  "100"  ;  Trying
 //               /   "180"  ;  Ringing
 //               /   "181"  ;  Call Is Being Forwarded
@@ -14,8 +16,10 @@ var Informational = map[int]string{
 }
 
 // Success  =  "200"  ;  OK
+//          /  "202"  ;  Accepted (RFC 3265)
 var Success = map[int]string{
 	200: "OK",
+	202: "Accepted",
 }
 
 // Redirection  =  "300"  ;  Multiple Choices
@@ -36,7 +40,7 @@ var Redirection = map[int]string{
 //              /   "402"  ;  Payment Required
 //              /   "403"  ;  Forbidden
 //              /   "404"  ;  Not Found
-//              /   "405"  ;   Not Allowed
+//              /   "405"  ;  Method Not Allowed
 //              /   "406"  ;  Not Acceptable
 //              /   "407"  ;  Proxy Authentication Required
 //              /   "408"  ;  Request Timeout
@@ -57,6 +61,7 @@ var Redirection = map[int]string{
 //              /   "486"  ;  Busy Here
 //              /   "487"  ;  Request Terminated
 //              /   "488"  ;  Not Acceptable Here
+//              /   "489"  ;  Bad Event (RFC 3265)
 //              /   "491"  ;  Request Pending
 //              /   "493"  ;  Undecipherable
 var ClientError = map[int]string{
@@ -65,7 +70,7 @@ var ClientError = map[int]string{
 	402: "Payment Required",
 	403: "Forbidden",
 	404: "Not Found",
-	405: " Not Allowed",
+	405: "Method Not Allowed",
 	406: "Not Acceptable",
 	407: "Proxy Authentication Required",
 	408: "Request Timeout",
@@ -86,6 +91,7 @@ var ClientError = map[int]string{
 	486: "Busy Here",
 	487: "Request Terminated",
 	488: "Not Acceptable Here",
+	489: "Bad Event",
 	491: "Request Pending",
 	493: "Undecipherable",
 }
@@ -143,3 +149,14 @@ func NewSipError(code int, message string) error {
 func (me *SipError) Error() string {
 	return me.Message
 }
+
+// ReasonPhrase returns the reason-phrase of a status-code, or "" if the
+// code is unknown.
+func ReasonPhrase(code int) string {
+	for _, phrases := range []map[int]string{Informational, Success, Redirection, ClientError, ServerError, GlobalFailure} {
+		if phrase, ok := phrases[code]; ok {
+			return strings.TrimSpace(phrase)
+		}
+	}
+	return ""
+}
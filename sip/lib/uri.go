@@ -0,0 +1,425 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The characters besides the unreserved ones that each URI component
+// keeps unescaped (RFC 3261 25.1).
+const (
+	userUnreserved     = "&=+$,;?/"
+	passwordUnreserved = "&=+$,"
+	paramUnreserved    = "[]/:&+$"
+	hnvUnreserved      = "[]/?:+$"
+)
+
+var hostnameRegexp = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?\.)*[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?\.?$`)
+
+// Uri is a SIP or SIPS URI of RFC 3261 19.1:
+//
+//	sip:user:password@host:port;uri-parameters?headers
+//
+// The user, password, parameters and headers are kept unescaped and
+// escaped again when written; the host of an IPv6 reference is kept
+// without its brackets.
+type Uri struct {
+	schema     string     // sip or sips
+	user       string     // user
+	password   string     // password
+	host       string     // host
+	port       uint16     // port, 0 when absent
+	parameters Parameters // uri-parameters
+	headers    Parameters // headers
+}
+
+func (uri *Uri) SetSchema(schema string) {
+	uri.schema = schema
+}
+func (uri *Uri) GetSchema() string {
+	return uri.schema
+}
+func (uri *Uri) SetUser(user string) {
+	uri.user = user
+}
+func (uri *Uri) GetUser() string {
+	return uri.user
+}
+func (uri *Uri) SetPassword(password string) {
+	uri.password = password
+}
+func (uri *Uri) GetPassword() string {
+	return uri.password
+}
+func (uri *Uri) SetHost(host string) {
+	uri.host = host
+}
+func (uri *Uri) GetHost() string {
+	return uri.host
+}
+func (uri *Uri) SetPort(port uint16) {
+	uri.port = port
+}
+func (uri *Uri) GetPort() uint16 {
+	return uri.port
+}
+func (uri *Uri) SetParameters(parameters Parameters) {
+	uri.parameters = parameters
+}
+func (uri *Uri) GetParameters() Parameters {
+	return uri.parameters
+}
+func (uri *Uri) SetParameter(name, value string) {
+	uri.parameters.Set(name, value)
+}
+func (uri *Uri) GetParameter(name string) (string, bool) {
+	return uri.parameters.Get(name)
+}
+func (uri *Uri) DelParameter(name string) {
+	uri.parameters.Del(name)
+}
+func (uri *Uri) SetHeaders(headers Parameters) {
+	uri.headers = headers
+}
+func (uri *Uri) GetHeaders() Parameters {
+	return uri.headers
+}
+func (uri *Uri) SetHeader(name, value string) {
+	uri.headers.Set(name, value)
+}
+func (uri *Uri) GetHeader(name string) (string, bool) {
+	return uri.headers.Get(name)
+}
+func (uri *Uri) DelHeader(name string) {
+	uri.headers.Del(name)
+}
+
+// SetExtension sets the parameters from a map, in the order of their names.
+func (uri *Uri) SetExtension(extension map[string]interface{}) {
+	names := make([]string, 0, len(extension))
+	for name := range extension {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	uri.parameters = make(Parameters, 0, len(names))
+	for _, name := range names {
+		uri.parameters = append(uri.parameters, NewParameter(name, fmt.Sprintf("%v", extension[name])))
+	}
+}
+
+// GetExtension returns the parameters as a map, which loses their order;
+// GetParameters keeps it.
+func (uri *Uri) GetExtension() map[string]interface{} {
+	if len(uri.parameters) == 0 {
+		return nil
+	}
+	extension := make(map[string]interface{}, len(uri.parameters))
+	for _, parameter := range uri.parameters {
+		if _, ok := extension[parameter.name]; !ok {
+			extension[parameter.name] = parameter.value
+		}
+	}
+	return extension
+}
+
+// NewUri returns a URI with the parameters of extension in the order of
+// their names.
+func NewUri(schema, user, host string, port uint16, extension map[string]interface{}) *Uri {
+	uri := &Uri{
+		schema: schema,
+		user:   user,
+		host:   host,
+		port:   port,
+	}
+	if extension != nil {
+		uri.SetExtension(extension)
+	}
+	return uri
+}
+
+// Clone copies the URI with its parameters and headers.
+func (uri *Uri) Clone() *Uri {
+	cloned := *uri
+	cloned.parameters = uri.parameters.Clone()
+	cloned.headers = uri.headers.Clone()
+	return &cloned
+}
+
+func (uri *Uri) Raw() (string, error) {
+	result := ""
+	if err := uri.Validator(); err != nil {
+		return result, err
+	}
+	result += uri.String()
+	return result, nil
+}
+func (uri *Uri) Parse(raw string) error {
+	if reflect.DeepEqual(nil, uri) {
+		return errors.New("uri caller is not allowed to be nil")
+	}
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimSuffix(strings.TrimPrefix(raw, "<"), ">")
+	if len(raw) == 0 {
+		return errors.New("the raw parameter is not allowed to be empty")
+	}
+	*uri = Uri{}
+	index := strings.Index(raw, ":")
+	if index < 0 {
+		return fmt.Errorf("uri %q has no schema", raw)
+	}
+	uri.schema = strings.ToLower(raw[:index])
+	raw = raw[index+1:]
+
+	// the host part has no @, so the last one ends the userinfo
+	if index := strings.LastIndex(raw, "@"); index >= 0 {
+		userinfo, password := raw[:index], ""
+		raw = raw[index+1:]
+		if index := strings.Index(userinfo, ":"); index >= 0 {
+			userinfo, password = userinfo[:index], userinfo[index+1:]
+		}
+		var err error
+		if uri.user, err = Unescape(userinfo); err != nil {
+			return fmt.Errorf("uri user error : %s", err.Error())
+		}
+		if uri.password, err = Unescape(password); err != nil {
+			return fmt.Errorf("uri password error : %s", err.Error())
+		}
+	}
+	if index := strings.Index(raw, "?"); index >= 0 {
+		headers, err := parseParameters(raw[index+1:], "&")
+		if err != nil {
+			return fmt.Errorf("uri headers error : %s", err.Error())
+		}
+		uri.headers = headers
+		raw = raw[:index]
+	}
+	if index := strings.Index(raw, ";"); index >= 0 {
+		parameters, err := parseParameters(raw[index+1:], ";")
+		if err != nil {
+			return fmt.Errorf("uri parameters error : %s", err.Error())
+		}
+		uri.parameters = parameters
+		raw = raw[:index]
+	}
+
+	hostport := raw
+	if strings.HasPrefix(hostport, "[") {
+		index := strings.Index(hostport, "]")
+		if index < 0 {
+			return fmt.Errorf("uri host %q is not closed", hostport)
+		}
+		uri.host, hostport = hostport[1:index], hostport[index+1:]
+		if len(hostport) > 0 && !strings.HasPrefix(hostport, ":") {
+			return fmt.Errorf("uri host %q is followed by %q", uri.host, hostport)
+		}
+	} else if index := strings.Index(hostport, ":"); index >= 0 {
+		uri.host, hostport = hostport[:index], hostport[index:]
+	} else {
+		uri.host, hostport = hostport, ""
+	}
+	if len(hostport) > 0 {
+		port, err := strconv.ParseUint(hostport[1:], 10, 16)
+		if err != nil || port == 0 {
+			return fmt.Errorf("uri port %q error", hostport[1:])
+		}
+		uri.port = uint16(port)
+	}
+	return uri.Validator()
+}
+
+// parseParameters parses parameters split by separator, unescaping their
+// names and values.
+func parseParameters(raw, separator string) (Parameters, error) {
+	parameters := make(Parameters, 0)
+	for _, pair := range strings.Split(raw, separator) {
+		if len(pair) == 0 {
+			continue
+		}
+		name, value := pair, ""
+		if index := strings.Index(pair, "="); index >= 0 {
+			name, value = pair[:index], pair[index+1:]
+		}
+		name, err := Unescape(name)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = Unescape(value); err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, NewParameter(name, value))
+	}
+	return parameters, nil
+}
+
+func (uri *Uri) Validator() error {
+	if reflect.DeepEqual(nil, uri) {
+		return errors.New("uri caller is not allowed to be nil")
+	}
+	if len(strings.TrimSpace(uri.schema)) == 0 {
+		return errors.New("the schema field is not allowed to be empty")
+	}
+	if !strings.EqualFold(uri.schema, "sip") && !strings.EqualFold(uri.schema, "sips") {
+		return fmt.Errorf("the value of the schema field must be sip or sips, not %s", uri.schema)
+	}
+	if len(uri.password) > 0 && len(uri.user) == 0 {
+		return errors.New("the password field is not allowed without a user")
+	}
+	if len(strings.TrimSpace(uri.host)) == 0 {
+		return errors.New("the host field is not allowed to be empty")
+	}
+	if net.ParseIP(uri.host) == nil && !hostnameRegexp.MatchString(uri.host) {
+		return fmt.Errorf("the host field %q is neither an ip address nor a host name", uri.host)
+	}
+	for _, parameter := range uri.parameters {
+		if len(parameter.name) == 0 {
+			return errors.New("the name of a uri parameter is not allowed to be empty")
+		}
+	}
+	for _, header := range uri.headers {
+		if len(header.name) == 0 {
+			return errors.New("the name of a uri header is not allowed to be empty")
+		}
+	}
+	return nil
+}
+
+func (uri *Uri) String() string {
+	result := ""
+	if len(strings.TrimSpace(uri.schema)) > 0 {
+		result += fmt.Sprintf("%s:", strings.ToLower(uri.schema))
+	}
+	if len(uri.user) > 0 {
+		result += Escape(uri.user, userUnreserved)
+		if len(uri.password) > 0 {
+			result += ":" + Escape(uri.password, passwordUnreserved)
+		}
+		result += "@"
+	}
+	if strings.Contains(uri.host, ":") {
+		result += fmt.Sprintf("[%s]", uri.host)
+	} else {
+		result += uri.host
+	}
+	if uri.port > 0 {
+		result += fmt.Sprintf(":%d", uri.port)
+	}
+	for _, parameter := range uri.parameters {
+		result += ";" + Escape(parameter.name, paramUnreserved)
+		if len(parameter.value) > 0 {
+			result += "=" + Escape(parameter.value, paramUnreserved)
+		}
+	}
+	for i, header := range uri.headers {
+		if i == 0 {
+			result += "?"
+		} else {
+			result += "&"
+		}
+		result += Escape(header.name, hnvUnreserved) + "=" + Escape(header.value, hnvUnreserved)
+	}
+	return result
+}
+
+// Equal compares two URIs by the rules of RFC 3261 19.1.4: the user and
+// password case-sensitively and the rest case-insensitively, an absent port
+// differs from any one, the user, ttl, method and maddr parameters must be
+// in both or neither while other parameters in only one are ignored, and
+// the headers must all match.
+func (uri *Uri) Equal(other *Uri) bool {
+	if uri == nil || other == nil {
+		return uri == other
+	}
+	if !strings.EqualFold(uri.schema, other.schema) || uri.user != other.user || uri.password != other.password ||
+		uri.port != other.port || !equalHost(uri.host, other.host) {
+		return false
+	}
+	for _, parameter := range uri.parameters {
+		if value, ok := other.parameters.Get(parameter.name); ok {
+			if !strings.EqualFold(value, parameter.value) {
+				return false
+			}
+		} else if isStrictParameter(parameter.name) {
+			return false
+		}
+	}
+	for _, parameter := range other.parameters {
+		if _, ok := uri.parameters.Get(parameter.name); !ok && isStrictParameter(parameter.name) {
+			return false
+		}
+	}
+	if len(uri.headers) != len(other.headers) {
+		return false
+	}
+	for _, header := range uri.headers {
+		if value, ok := other.headers.Get(header.name); !ok || value != header.value {
+			return false
+		}
+	}
+	return true
+}
+
+func equalHost(host, other string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.Equal(net.ParseIP(other))
+	}
+	return strings.EqualFold(strings.TrimSuffix(host, "."), strings.TrimSuffix(other, "."))
+}
+
+// isStrictParameter tells whether a uri-parameter in only one URI makes
+// them differ.
+func isStrictParameter(name string) bool {
+	switch strings.ToLower(name) {
+	case "user", "ttl", "method", "maddr":
+		return true
+	}
+	return false
+}
+
+// Escape percent-encodes the characters of value besides the unreserved
+// ones of RFC 3261 25.1 and those of unreserved.
+func Escape(value, unreserved string) string {
+	var result strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if isUnreserved(c) || strings.IndexByte(unreserved, c) >= 0 {
+			result.WriteByte(c)
+		} else {
+			fmt.Fprintf(&result, "%%%02X", c)
+		}
+	}
+	return result.String()
+}
+
+// Unescape decodes the percent-encoded characters of value.
+func Unescape(value string) (string, error) {
+	if !strings.Contains(value, "%") {
+		return value, nil
+	}
+	var result strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			result.WriteByte(value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", fmt.Errorf("the escape of %q is cut", value)
+		}
+		c, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("the escape %q of %q error", value[i:i+3], value)
+		}
+		result.WriteByte(byte(c))
+		i += 2
+	}
+	return result.String(), nil
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.!~*'()", c) >= 0
+}
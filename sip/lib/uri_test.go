@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestUri_Parse(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"sip:34020000001320000001@3402000000":                            "sip:34020000001320000001@3402000000",
+		"SIP:34020000001320000001@192.168.1.2:5060;transport=udp;lr":     "sip:34020000001320000001@192.168.1.2:5060;transport=udp;lr",
+		"sips:alice:secret@[2001:db8::1]:5061":                           "sips:alice:secret@[2001:db8::1]:5061",
+		"<sip:192.168.1.3;lr>":                                           "sip:192.168.1.3;lr",
+		"sip:atlanta.com;method=REGISTER?to=alice%40atlanta.com":         "sip:atlanta.com;method=REGISTER?to=alice%40atlanta.com",
+		"sip:%61lice;day=tuesday@atlanta.com;maddr=239.255.255.1;ttl=15": "sip:alice;day=tuesday@atlanta.com;maddr=239.255.255.1;ttl=15",
+		"sip:+1-212-555-1212:1234@gateway.com;user=phone":                "sip:+1-212-555-1212:1234@gateway.com;user=phone",
+	} {
+		uri := new(Uri)
+		if err := uri.Parse(raw); err != nil {
+			t.Fatalf("%q : %s", raw, err)
+		}
+		if str, err := uri.Raw(); err != nil || str != expected {
+			t.Fatalf("unexpected uri %q %v of %q", str, err, raw)
+		}
+	}
+
+	uri := new(Uri)
+	if err := uri.Parse("sips:alice%20b:p%40ss@[::1]:5061;z=1;a;m=x%3By?subject=project%20x&priority=urgent"); err != nil {
+		t.Fatal(err)
+	}
+	if uri.GetSchema() != "sips" || uri.GetUser() != "alice b" || uri.GetPassword() != "p@ss" || uri.GetHost() != "::1" || uri.GetPort() != 5061 {
+		t.Fatalf("unexpected uri %+v", uri)
+	}
+	parameters := uri.GetParameters()
+	if len(parameters) != 3 || parameters[0].GetName() != "z" || parameters[1].GetName() != "a" || parameters[2].GetValue() != "x;y" {
+		t.Fatalf("unexpected parameters %v", parameters)
+	}
+	if subject, ok := uri.GetHeader("Subject"); !ok || subject != "project x" {
+		t.Fatalf("unexpected subject %q", subject)
+	}
+	if str := uri.String(); str != "sips:alice%20b:p%40ss@[::1]:5061;z=1;a;m=x%3By?subject=project%20x&priority=urgent" {
+		t.Fatalf("unexpected uri %q", str)
+	}
+
+	for _, raw := range []string{
+		"",
+		"34020000001320000001@3402000000",
+		"tel:+1-212-555-1212",
+		"sip:34020000001320000001@",
+		"sip:alice@atlanta.com:port",
+		"sip:alice@atlanta.com:70000",
+		"sip:alice@[::1",
+		"sip:alice@bad_host",
+		"sip:alice%2@atlanta.com",
+		"sip::secret@atlanta.com",
+	} {
+		if err := new(Uri).Parse(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestUri_Parameters(t *testing.T) {
+	uri := NewUri("sip", "34020000001320000001", "3402000000", 0, map[string]interface{}{"transport": "udp", "lr": "", "expires": 60})
+	if str := uri.String(); str != "sip:34020000001320000001@3402000000;expires=60;lr;transport=udp" {
+		t.Fatalf("unexpected uri %q", str)
+	}
+	uri.SetParameter("LR", "")
+	uri.SetParameter("maddr", "239.255.255.1")
+	uri.DelParameter("Expires")
+	uri.SetHeader("subject", "a b")
+	if str := uri.String(); str != "sip:34020000001320000001@3402000000;lr;transport=udp;maddr=239.255.255.1?subject=a%20b" {
+		t.Fatalf("unexpected uri %q", str)
+	}
+	if extension := uri.GetExtension(); len(extension) != 3 || extension["transport"] != "udp" {
+		t.Fatalf("unexpected extension %v", extension)
+	}
+
+	cloned := uri.Clone()
+	cloned.SetParameter("transport", "tcp")
+	cloned.SetHeader("subject", "c")
+	if transport, _ := uri.GetParameter("transport"); transport != "udp" {
+		t.Fatal("the clone shares its parameters")
+	}
+	if subject, _ := uri.GetHeader("subject"); subject != "a b" {
+		t.Fatal("the clone shares its headers")
+	}
+}
+
+func TestUri_Equal(t *testing.T) {
+	parse := func(raw string) *Uri {
+		uri := new(Uri)
+		if err := uri.Parse(raw); err != nil {
+			t.Fatalf("%q : %s", raw, err)
+		}
+		return uri
+	}
+	// the examples of RFC 3261 19.1.4
+	for _, pair := range [][2]string{
+		{"sip:%61lice@atlanta.com;transport=TCP", "sip:alice@AtLanTa.CoM;Transport=tcp"},
+		{"sip:carol@chicago.com", "sip:carol@chicago.com;newparam=5"},
+		{"sip:carol@chicago.com;security=on", "sip:carol@chicago.com;newparam=5"},
+		{"sip:biloxi.com;transport=tcp;method=REGISTER?to=sip:bob%40biloxi.com", "sip:biloxi.com;method=REGISTER;transport=tcp?to=sip:bob%40biloxi.com"},
+		{"sip:alice@atlanta.com?subject=project%20x&priority=urgent", "sip:alice@atlanta.com?priority=urgent&subject=project%20x"},
+		{"sip:alice@[2001:db8::1]", "sip:alice@[2001:DB8:0::1]"},
+	} {
+		if !parse(pair[0]).Equal(parse(pair[1])) || !parse(pair[1]).Equal(parse(pair[0])) {
+			t.Fatalf("%q and %q are equal", pair[0], pair[1])
+		}
+	}
+	for _, pair := range [][2]string{
+		{"SIP:ALICE@AtLanTa.CoM;Transport=udp", "sip:alice@AtLanTa.CoM;Transport=UDP"},
+		{"sip:bob@biloxi.com", "sip:bob@biloxi.com:5060"},
+		{"sip:bob@biloxi.com", "sip:bob@biloxi.com;transport=udp;user=ip"},
+		{"sip:carol@chicago.com", "sip:carol@chicago.com;maddr=239.255.255.1"},
+		{"sip:carol@chicago.com;security=on", "sip:carol@chicago.com;security=off"},
+		{"sip:carol@chicago.com", "sips:carol@chicago.com"},
+		{"sip:carol@chicago.com", "sip:carol@chicago.com?Subject=next%20meeting"},
+		{"sip:bob@phone21.boxesbybob.com", "sip:bob@192.0.2.4"},
+	} {
+		if parse(pair[0]).Equal(parse(pair[1])) || parse(pair[1]).Equal(parse(pair[0])) {
+			t.Fatalf("%q and %q are not equal", pair[0], pair[1])
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if escaped := Escape("alice b;c@d%", userUnreserved); escaped != "alice%20b;c%40d%25" {
+		t.Fatalf("unexpected escape %q", escaped)
+	}
+	if value, err := Unescape("alice%20b;c%40d%25"); err != nil || value != "alice b;c@d%" {
+		t.Fatalf("unexpected value %q %v", value, err)
+	}
+	for _, value := range []string{"%", "%4", "%zz"} {
+		if _, err := Unescape(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
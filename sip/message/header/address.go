@@ -0,0 +1,238 @@
+package header
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/kokutas/gb28181/sip/lib"
+)
+
+// Address is the value of the address header fields From, To, Contact and
+// Route (RFC 3261 20.10): a name-addr, "display name" <uri>, or a bare
+// addr-spec, followed by header parameters in order. The parameters of a
+// bare addr-spec are those of the header field, not of its URI; quoted
+// parameter values keep their quotes.
+type Address struct {
+	displayName string         // display-name, unquoted
+	uri         *Uri           // name-addr or addr-spec
+	parameters  lib.Parameters // header parameters
+}
+
+func (address *Address) SetDisplayName(displayName string) {
+	address.displayName = displayName
+}
+func (address *Address) GetDisplayName() string {
+	return address.displayName
+}
+func (address *Address) SetUri(uri *Uri) {
+	address.uri = uri
+}
+func (address *Address) GetUri() *Uri {
+	return address.uri
+}
+func (address *Address) SetParameters(parameters lib.Parameters) {
+	address.parameters = parameters
+}
+func (address *Address) GetParameters() lib.Parameters {
+	return address.parameters
+}
+func NewAddress(displayName string, uri *Uri, parameters lib.Parameters) *Address {
+	return &Address{
+		displayName: displayName,
+		uri:         uri,
+		parameters:  parameters,
+	}
+}
+
+func (address *Address) Raw() (string, error) {
+	result := ""
+	if err := address.Validator(); err != nil {
+		return result, err
+	}
+	result += address.String()
+	return result, nil
+}
+func (address *Address) Parse(raw string) error {
+	if reflect.DeepEqual(nil, address) {
+		return errors.New("address caller is not allowed to be nil")
+	}
+	raw = strings.TrimSpace(raw)
+	if len(raw) == 0 {
+		return errors.New("the raw parameter is not allowed to be empty")
+	}
+	*address = Address{}
+	rest := ""
+	// the < of a name-addr after a token display name comes before any
+	// parameter
+	angle, semicolon := strings.Index(raw, "<"), strings.Index(raw, ";")
+	switch {
+	case strings.HasPrefix(raw, "\""):
+		displayName, after, err := unquoteString(raw)
+		if err != nil {
+			return err
+		}
+		address.displayName = displayName
+		after = strings.TrimSpace(after)
+		// some devices send a display name before a bare addr-spec
+		uri, after, err := addrSpec(after)
+		if err != nil {
+			return err
+		}
+		address.uri, rest = uri, after
+	case angle > 0 && (semicolon < 0 || angle < semicolon):
+		address.displayName = strings.Join(strings.Fields(raw[:angle]), " ")
+		uri, after, err := addrSpec(raw[angle:])
+		if err != nil {
+			return err
+		}
+		address.uri, rest = uri, after
+	default:
+		uri, after, err := addrSpec(raw)
+		if err != nil {
+			return err
+		}
+		address.uri, rest = uri, after
+	}
+	parameters, err := parseHeaderParameters(rest)
+	if err != nil {
+		return fmt.Errorf("the parameters of %q error : %s", raw, err.Error())
+	}
+	address.parameters = parameters
+	return address.Validator()
+}
+func (address *Address) Validator() error {
+	if reflect.DeepEqual(nil, address) {
+		return errors.New("address caller is not allowed to be nil")
+	}
+	if address.uri == nil {
+		return errors.New("the uri field is not allowed to be nil")
+	}
+	if err := address.uri.Validator(); err != nil {
+		return err
+	}
+	for _, parameter := range address.parameters {
+		if !tokenRegexp.MatchString(parameter.GetName()) {
+			return fmt.Errorf("the parameter name %q is not a token", parameter.GetName())
+		}
+	}
+	return nil
+}
+func (address *Address) String() string {
+	result := ""
+	if len(address.displayName) > 0 {
+		result += quoteString(address.displayName) + " "
+	}
+	if address.uri != nil {
+		result += fmt.Sprintf("<%s>", address.uri.String())
+	}
+	result += formatHeaderParameters(address.parameters)
+	return result
+}
+
+// addrSpec parses the <uri> or bare addr-spec raw starts with and returns
+// the rest; a bare addr-spec ends at the first semicolon.
+func addrSpec(raw string) (*Uri, string, error) {
+	spec, rest := raw, ""
+	if strings.HasPrefix(raw, "<") {
+		index := strings.Index(raw, ">")
+		if index < 0 {
+			return nil, "", fmt.Errorf("the uri of %q is not closed by >", raw)
+		}
+		spec, rest = raw[1:index], raw[index+1:]
+	} else if index := strings.Index(raw, ";"); index >= 0 {
+		spec, rest = raw[:index], raw[index:]
+	}
+	uri := new(Uri)
+	if err := uri.Parse(spec); err != nil {
+		return nil, "", err
+	}
+	return uri, rest, nil
+}
+
+// quoteString writes value as a quoted-string, escaping quotes and
+// backslashes.
+func quoteString(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "\"", "\\\"")
+	return "\"" + value + "\""
+}
+
+// unquoteString reads the quoted-string raw starts with and returns its
+// value and the rest.
+func unquoteString(raw string) (string, string, error) {
+	var value strings.Builder
+	for i := 1; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			if i+1 == len(raw) {
+				return "", "", fmt.Errorf("the quoted string %q is cut", raw)
+			}
+			i++
+			value.WriteByte(raw[i])
+		case '"':
+			return value.String(), raw[i+1:], nil
+		default:
+			value.WriteByte(raw[i])
+		}
+	}
+	return "", "", fmt.Errorf("the quoted string %q is not closed", raw)
+}
+
+// parseHeaderParameters parses the ;name=value header parameters raw is
+// made of, leaving the semicolons of quoted values alone.
+func parseHeaderParameters(raw string) (lib.Parameters, error) {
+	raw = strings.TrimSpace(raw)
+	parameters := make(lib.Parameters, 0)
+	if len(raw) == 0 {
+		return parameters, nil
+	}
+	if !strings.HasPrefix(raw, ";") {
+		return nil, fmt.Errorf("%q is not a parameter", raw)
+	}
+	quoted, escaped := false, false
+	start := 1
+	for i := 1; i <= len(raw); i++ {
+		if i < len(raw) {
+			switch c := raw[i]; {
+			case escaped:
+				escaped = false
+				continue
+			case quoted && c == '\\':
+				escaped = true
+				continue
+			case c == '"':
+				quoted = !quoted
+				continue
+			case quoted || c != ';':
+				continue
+			}
+		} else if quoted {
+			return nil, fmt.Errorf("the quoted value of %q is not closed", raw)
+		}
+		pair := strings.TrimSpace(raw[start:i])
+		start = i + 1
+		if len(pair) == 0 {
+			continue
+		}
+		name, value := pair, ""
+		if index := strings.Index(pair, "="); index >= 0 {
+			name, value = strings.TrimSpace(pair[:index]), strings.TrimSpace(pair[index+1:])
+		}
+		parameters = append(parameters, lib.NewParameter(name, value))
+	}
+	return parameters, nil
+}
+
+// formatHeaderParameters writes parameters as ;name=value.
+func formatHeaderParameters(parameters lib.Parameters) string {
+	result := ""
+	for _, parameter := range parameters {
+		result += ";" + parameter.GetName()
+		if len(parameter.GetValue()) > 0 {
+			result += "=" + parameter.GetValue()
+		}
+	}
+	return result
+}
@@ -0,0 +1,132 @@
+package header
+
+import (
+	"testing"
+)
+
+func TestAddress_Parse(t *testing.T) {
+	for raw, expected := range map[string]string{
+		`<sip:34020000001320000001@3402000000>`:                        `<sip:34020000001320000001@3402000000>`,
+		`sip:34020000001320000001@3402000000;tag=abc`:                  `<sip:34020000001320000001@3402000000>;tag=abc`,
+		`Camera  1 <sip:34020000001320000001@3402000000;lr>;tag=abc`:   `"Camera 1" <sip:34020000001320000001@3402000000;lr>;tag=abc`,
+		`"Gate <east>; \"B\" \\ 1" <sip:alice@atlanta.com>;tag=1928`:   `"Gate <east>; \"B\" \\ 1" <sip:alice@atlanta.com>;tag=1928`,
+		`"nvr" sip:34020000001110000001@192.168.1.2:5060;expires=60`:   `"nvr" <sip:34020000001110000001@192.168.1.2:5060>;expires=60`,
+		`<sips:[2001:db8::1]:5061;transport=tls> ; q=0.7 ; expires=0`:  `<sips:[2001:db8::1]:5061;transport=tls>;q=0.7;expires=0`,
+		`<sip:a@b.com>;+sip.instance="<urn:uuid:f81d4fae;x>";reg-id=1`: `<sip:a@b.com>;+sip.instance="<urn:uuid:f81d4fae;x>";reg-id=1`,
+		`sip:a@b.com;+sip.instance="<urn:uuid:1>"`:                     `<sip:a@b.com>;+sip.instance="<urn:uuid:1>"`,
+	} {
+		address := new(Address)
+		if err := address.Parse(raw); err != nil {
+			t.Fatalf("%q : %s", raw, err)
+		}
+		if str, err := address.Raw(); err != nil || str != expected {
+			t.Fatalf("unexpected address %q %v of %q", str, err, raw)
+		}
+	}
+
+	address := new(Address)
+	if err := address.Parse(`"Gate <east>; \"B\"" <sip:alice@atlanta.com;transport=tcp>;expires=60;+sip.instance="<urn:uuid:1>";lr`); err != nil {
+		t.Fatal(err)
+	}
+	if address.GetDisplayName() != `Gate <east>; "B"` {
+		t.Fatalf("unexpected display name %q", address.GetDisplayName())
+	}
+	if transport, _ := address.GetUri().GetParameter("transport"); transport != "tcp" {
+		t.Fatalf("unexpected uri %s", address.GetUri())
+	}
+	parameters := address.GetParameters()
+	if len(parameters) != 3 || parameters[0].GetName() != "expires" || parameters[1].GetValue() != `"<urn:uuid:1>"` || parameters[2].GetName() != "lr" {
+		t.Fatalf("unexpected parameters %v", parameters)
+	}
+
+	for _, raw := range []string{
+		"",
+		`"open <sip:alice@atlanta.com>`,
+		`"a\`,
+		`<sip:alice@atlanta.com`,
+		`<sip:alice@atlanta.com> tag=1`,
+		`<sip:alice@atlanta.com>;ta g=1`,
+		`<sip:alice@atlanta.com>;x="open`,
+		`alice@atlanta.com`,
+	} {
+		if err := new(Address).Parse(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestAddressHeaders(t *testing.T) {
+	from := new(From)
+	if err := from.Parse(`From: "Doe, John" <sip:34020000001320000001@3402000000>;x-vendor=1;tag=abc`); err != nil {
+		t.Fatal(err)
+	}
+	if from.GetDisplayName() != "Doe, John" || from.GetTag() != "abc" || len(from.GetParameters()) != 1 {
+		t.Fatalf("unexpected from %s", from)
+	}
+	if raw, _ := from.Raw(); raw != "From: \"Doe, John\" <sip:34020000001320000001@3402000000>;tag=abc;x-vendor=1\r\n" {
+		t.Fatalf("unexpected from %q", raw)
+	}
+
+	to := new(To)
+	if err := to.Parse(`t: sip:34020000001320000001@3402000000`); err != nil {
+		t.Fatal(err)
+	}
+	to.SetTag("xyz")
+	if raw, _ := to.Raw(); raw != "To: <sip:34020000001320000001@3402000000>;tag=xyz\r\n" {
+		t.Fatalf("unexpected to %q", raw)
+	}
+
+	contact := new(Contact)
+	if err := contact.Parse(`Contact: <sip:34020000001320000001@192.168.1.2:5060>;expires=60;+sip.instance="<urn:uuid:1>"`); err != nil {
+		t.Fatal(err)
+	}
+	if expires, _ := contact.GetParameters().Get("expires"); expires != "60" || contact.IsWildcard() {
+		t.Fatalf("unexpected contact %s", contact)
+	}
+	if err := contact.Parse("Contact:  * "); err != nil || !contact.IsWildcard() || contact.GetUri() != nil {
+		t.Fatalf("unexpected wildcard contact %s %v", contact, err)
+	}
+	if raw, _ := NewWildcardContact().Raw(); raw != "Contact: *\r\n" {
+		t.Fatalf("unexpected wildcard contact %q", raw)
+	}
+	contact.SetParameters(nil)
+	contact.SetDisplayName("x")
+	if _, err := contact.Raw(); err == nil {
+		t.Fatal("expected error for a wildcard contact with a display name")
+	}
+
+	route := new(Route)
+	if err := route.Parse("Route: <sip:proxy.example.com;lr>;x=1, <sip:34020000002000000001@192.168.1.3:5060;lr>"); err != nil {
+		t.Fatal(err)
+	}
+	if len(route.GetUris()) != 2 || len(route.GetParameters()) != 1 {
+		t.Fatalf("unexpected route %s", route)
+	}
+	if raw, _ := route.Raw(); raw != "Route: <sip:proxy.example.com;lr>;x=1, <sip:34020000002000000001@192.168.1.3:5060;lr>\r\n" {
+		t.Fatalf("unexpected route %q", raw)
+	}
+}
+
+func TestHeader_Parse_Contacts(t *testing.T) {
+	head := new(Header)
+	raw := "Contact: \"a, b\" <sip:34020000001320000001@192.168.1.2:5060>;expires=60, <sip:34020000001320000001@192.168.1.5:5060>;q=0.5\r\n" +
+		"m: sip:34020000001320000001@192.168.1.6:5060;expires=0\r\n"
+	if err := head.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	contacts := head.GetContacts()
+	if len(contacts) != 3 || contacts[0].GetDisplayName() != "a, b" || contacts[2].GetUri().GetHost() != "192.168.1.6" {
+		t.Fatalf("unexpected contacts %v", contacts)
+	}
+	if q, _ := contacts[1].GetParameters().Get("q"); q != "0.5" {
+		t.Fatalf("unexpected contact %s", contacts[1])
+	}
+
+	head = new(Header)
+	if err := head.Parse("Contact: *\r\nExpires: 0\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if !head.Contact.IsWildcard() || head.Expires.GetSeconds() != 0 {
+		t.Fatalf("unexpected wildcard %s", head.Contact)
+	}
+}
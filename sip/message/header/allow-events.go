@@ -0,0 +1,82 @@
+package header
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+type AllowEvents struct {
+	events []string // event-type list
+}
+
+func (allowEvents *AllowEvents) SetEvents(events ...string) {
+	allowEvents.events = events
+}
+func (allowEvents *AllowEvents) GetEvents() []string {
+	return allowEvents.events
+}
+func NewAllowEvents(events ...string) *AllowEvents {
+	return &AllowEvents{
+		events: events,
+	}
+}
+
+// Allows reports whether eventType is one of the listed event types.
+func (allowEvents *AllowEvents) Allows(eventType string) bool {
+	for _, event := range allowEvents.events {
+		if strings.EqualFold(event, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (allowEvents *AllowEvents) Raw() (string, error) {
+	result := ""
+	if err := allowEvents.Validator(); err != nil {
+		return result, err
+	}
+	result += fmt.Sprintf("Allow-Events: %s", allowEvents.String())
+	result += "\r\n"
+	return result, nil
+}
+func (allowEvents *AllowEvents) Parse(raw string) error {
+	if reflect.DeepEqual(nil, allowEvents) {
+		return errors.New("allow-events caller is not allowed to be nil")
+	}
+	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
+	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
+	raw = strings.TrimPrefix(raw, " ")
+	raw = strings.TrimSuffix(raw, " ")
+	if len(strings.TrimSpace(raw)) == 0 {
+		return errors.New("the raw parameter is not allowed to be empty")
+	}
+	// allow-events field regexp, u is the compact form
+	fieldRegexp := regexp.MustCompile(`^(?i)(allow-events|u)\s*:`)
+	if !fieldRegexp.MatchString(raw) {
+		return errors.New("raw is not a allow-events header field")
+	}
+	raw = fieldRegexp.ReplaceAllString(raw, "")
+	allowEvents.events = nil
+	for _, event := range strings.Split(raw, ",") {
+		if event = strings.TrimSpace(event); len(event) > 0 {
+			allowEvents.events = append(allowEvents.events, event)
+		}
+	}
+	return allowEvents.Validator()
+}
+func (allowEvents *AllowEvents) Validator() error {
+	if reflect.DeepEqual(nil, allowEvents) {
+		return errors.New("allow-events caller is not allowed to be nil")
+	}
+	if len(allowEvents.events) == 0 {
+		return errors.New("the event-type list is not allowed to be empty")
+	}
+	return nil
+}
+func (allowEvents *AllowEvents) String() string {
+	return strings.Join(allowEvents.events, ", ")
+}
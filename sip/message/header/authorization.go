@@ -15,7 +15,10 @@ type Authorization struct {
 	nonce      string // nonce
 	uri        *Uri   // Uri
 	response   string // response
-	algorithm  string // algorithm
+	algorithm  string // algorithm, MD5 when absent
+	qop        string // qop: auth / auth-int, empty without
+	cnonce     string // cnonce, with qop
+	nc         string // nonce-count, 8 hex digits, with qop
 }
 
 func (authorization *Authorization) SetAuthSchema(authSchema string) {
@@ -61,6 +64,24 @@ func (authorization *Authorization) SetAlgorithm(algorithm string) {
 func (authorization *Authorization) GetAlgorithm() string {
 	return authorization.algorithm
 }
+func (authorization *Authorization) SetQop(qop string) {
+	authorization.qop = qop
+}
+func (authorization *Authorization) GetQop() string {
+	return authorization.qop
+}
+func (authorization *Authorization) SetCnonce(cnonce string) {
+	authorization.cnonce = cnonce
+}
+func (authorization *Authorization) GetCnonce() string {
+	return authorization.cnonce
+}
+func (authorization *Authorization) SetNc(nc string) {
+	authorization.nc = nc
+}
+func (authorization *Authorization) GetNc() string {
+	return authorization.nc
+}
 func NewAuthorization(authSchema string, username string, realm string, nonce string, uri *Uri, response string, algorithm string) *Authorization {
 	return &Authorization{
 		authSchema: authSchema,
@@ -84,6 +105,9 @@ func (authorization *Authorization) Raw() (string, error) {
 	}
 	result += fmt.Sprintf("Authorization: %s username=\"%s\",realm=\"%s\",nonce=\"%s\",uri=\"%s\",response=\"%s\",algorithm=%s",
 		strings.Title(authorization.authSchema), authorization.username, authorization.realm, authorization.nonce, uriStr, authorization.response, strings.ToUpper(authorization.algorithm))
+	if len(authorization.qop) > 0 {
+		result += fmt.Sprintf(",qop=%s,nc=%s,cnonce=\"%s\"", authorization.qop, authorization.nc, authorization.cnonce)
+	}
 	result += "\r\n"
 	return result, nil
 }
@@ -99,7 +123,7 @@ func (authorization *Authorization) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// authorization field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(Authorization).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(authorization)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a authorization header field")
 	}
@@ -107,36 +131,35 @@ func (authorization *Authorization) Parse(raw string) error {
 	raw = strings.TrimPrefix(raw, " ")
 	raw = strings.TrimSuffix(raw, " ")
 	// auth schema regexp
-	authSchemaRegexp := regexp.MustCompile(`(?i)(digest|basic)`)
+	authSchemaRegexp := regexp.MustCompile(`^(?i)(digest|basic)`)
 	if authSchemaRegexp.MatchString(raw) {
 		authorization.authSchema = authSchemaRegexp.FindString(raw)
 	}
 	raw = authSchemaRegexp.ReplaceAllString(raw, "")
 	raw = strings.TrimPrefix(raw, " ")
 	raw = strings.TrimSuffix(raw, " ")
-	// username regexp
-	usernameRegexp := regexp.MustCompile(`(?i)(username).*?=`)
-	// realm regexp
-	realmRegexp := regexp.MustCompile(`(?i)(realm).*?=`)
-	// nonce regexp
-	nonceRegexp := regexp.MustCompile(`(?i)(nonce).*?=`)
-	// uri regexp
-	uriRegexp := regexp.MustCompile(`(?i)(uri).*?=`)
-	// response regexp
-	responseRegexp := regexp.MustCompile(`(?i)(response).*?=`)
-	// algorithm regexp
-	algorithmRegexp := regexp.MustCompile(`(?i)(algorithm).*?=`)
+	// parameter regexps, the name is the whole text before = so that nonce
+	// does not match cnonce
+	usernameRegexp := regexp.MustCompile(`^\s*(?i)(username)\s*=`)
+	realmRegexp := regexp.MustCompile(`^\s*(?i)(realm)\s*=`)
+	nonceRegexp := regexp.MustCompile(`^\s*(?i)(nonce)\s*=`)
+	uriRegexp := regexp.MustCompile(`^\s*(?i)(uri)\s*=`)
+	responseRegexp := regexp.MustCompile(`^\s*(?i)(response)\s*=`)
+	algorithmRegexp := regexp.MustCompile(`^\s*(?i)(algorithm)\s*=`)
+	qopRegexp := regexp.MustCompile(`^\s*(?i)(qop)\s*=`)
+	cnonceRegexp := regexp.MustCompile(`^\s*(?i)(cnonce)\s*=`)
+	ncRegexp := regexp.MustCompile(`^\s*(?i)(nc)\s*=`)
 	raw = strings.TrimPrefix(raw, ",")
 	raw = strings.TrimSuffix(raw, ",")
 	rawSlice := strings.Split(raw, ",")
 	for _, raws := range rawSlice {
 		switch {
 		case usernameRegexp.MatchString(raws):
-			authorization.username = usernameRegexp.ReplaceAllString(raws, "")
+			authorization.username = unquote(usernameRegexp.ReplaceAllString(raws, ""))
 		case realmRegexp.MatchString(raws):
-			authorization.realm = realmRegexp.ReplaceAllString(raws, "")
+			authorization.realm = unquote(realmRegexp.ReplaceAllString(raws, ""))
 		case nonceRegexp.MatchString(raws):
-			authorization.nonce = nonceRegexp.ReplaceAllString(raws, "")
+			authorization.nonce = unquote(nonceRegexp.ReplaceAllString(raws, ""))
 		case uriRegexp.MatchString(raws):
 			authorization.uri = new(Uri)
 			uriStr := uriRegexp.ReplaceAllString(raws, "")
@@ -147,12 +170,22 @@ func (authorization *Authorization) Parse(raw string) error {
 				return err
 			}
 		case responseRegexp.MatchString(raws):
-			authorization.response = responseRegexp.ReplaceAllString(raws, "")
+			authorization.response = unquote(responseRegexp.ReplaceAllString(raws, ""))
 
 		case algorithmRegexp.MatchString(raws):
-			authorization.algorithm = algorithmRegexp.ReplaceAllString(raws, "")
+			authorization.algorithm = unquote(algorithmRegexp.ReplaceAllString(raws, ""))
+		case qopRegexp.MatchString(raws):
+			authorization.qop = unquote(qopRegexp.ReplaceAllString(raws, ""))
+		case cnonceRegexp.MatchString(raws):
+			authorization.cnonce = unquote(cnonceRegexp.ReplaceAllString(raws, ""))
+		case ncRegexp.MatchString(raws):
+			authorization.nc = unquote(ncRegexp.ReplaceAllString(raws, ""))
 		}
 	}
+	// the algorithm defaults to MD5 (RFC 2617 3.2.2)
+	if len(authorization.algorithm) == 0 {
+		authorization.algorithm = "MD5"
+	}
 	return authorization.Validator()
 }
 func (authorization *Authorization) Validator() error {
@@ -231,5 +264,8 @@ func (authorization *Authorization) String() string {
 			result += fmt.Sprintf("algorithm=%s", strings.ToUpper(authorization.algorithm))
 		}
 	}
+	if len(strings.TrimSpace(authorization.qop)) > 0 {
+		result += fmt.Sprintf(",qop=%s,nc=%s,cnonce=\"%s\"", authorization.qop, authorization.nc, authorization.cnonce)
+	}
 	return result
 }
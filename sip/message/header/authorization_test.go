@@ -15,3 +15,15 @@ func TestAuthorization_Raw(t *testing.T) {
 
 	fmt.Print(authorization.Raw())
 }
+
+func TestAuthorization_Parse(t *testing.T) {
+	authorization := new(Authorization)
+	raw := `Authorization: Digest username="34020000001320000001", realm="3402000000", nonce="9bd055", uri="sip:34020000002000000001@3402000000", response="6629fae49393a05397450978507c4ef1", cnonce="0a4f113b", qop=auth, nc=00000001`
+	if err := authorization.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	if authorization.GetNonce() != "9bd055" || authorization.GetCnonce() != "0a4f113b" || authorization.GetQop() != "auth" ||
+		authorization.GetNc() != "00000001" || authorization.GetAlgorithm() != "MD5" {
+		t.Fatalf("unexpected authorization %s", authorization.String())
+	}
+}
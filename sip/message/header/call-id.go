@@ -56,8 +56,8 @@ func (callId *CallID) Parse(raw string) error {
 	if len(strings.TrimSpace(raw)) == 0 {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
-	// call-id field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(call-id).*?:`)
+	// call-id field regexp, the full or the compact name
+	fieldRegexp := regexp.MustCompile(`^(?i)(call-id|i)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a call-id header field")
 	}
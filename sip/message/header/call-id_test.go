@@ -23,7 +23,7 @@ func TestCallID_Raw(t *testing.T) {
 func TestCallID_Parse(t *testing.T) {
 	raws := []string{
 		"Call-ID: 140a92f15c94d76d62a4fcd2d3558000",
-		"Call-IDs: 140a92f15c94d76d62a4fcd2d3558000@192.168.0.26:5060",
+		"i: 140a92f15c94d76d62a4fcd2d3558000@192.168.0.26:5060",
 	}
 	for _, raw := range raws {
 		callId := new(CallID)
@@ -32,4 +32,7 @@ func TestCallID_Parse(t *testing.T) {
 		}
 		fmt.Print(callId.Raw())
 	}
+	if err := new(CallID).Parse("Call-IDs: 140a92f15c94d76d62a4fcd2d3558000"); err == nil {
+		log.Fatal("a field of another name must be rejected")
+	}
 }
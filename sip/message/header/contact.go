@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
+
+	"github.com/kokutas/gb28181/sip/lib"
 )
 
 type Contact struct {
-	displayName string                 // display-name
-	uri         *Uri                   // uri
-	extension   map[string]interface{} // extension
+	displayName string         // display-name
+	uri         *Uri           // uri
+	parameters  lib.Parameters // contact-params, such as expires or +sip.instance
+	wildcard    bool           // the * of a REGISTER removing all bindings
 }
 
 func (contact *Contact) SetDisplayName(displayName string) {
@@ -26,47 +30,74 @@ func (contact *Contact) SetUri(uri *Uri) {
 func (contact *Contact) GetUri() *Uri {
 	return contact.uri
 }
+func (contact *Contact) SetParameters(parameters lib.Parameters) {
+	contact.parameters = parameters
+}
+func (contact *Contact) GetParameters() lib.Parameters {
+	return contact.parameters
+}
+func (contact *Contact) SetWildcard(wildcard bool) {
+	contact.wildcard = wildcard
+}
+func (contact *Contact) IsWildcard() bool {
+	return contact.wildcard
+}
+
+// SetExtension sets the parameters from a map, in the order of their names.
 func (contact *Contact) SetExtension(extensions map[string]interface{}) {
-	contact.extension = extensions
+	names := make([]string, 0, len(extensions))
+	for name := range extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	contact.parameters = make(lib.Parameters, 0, len(names))
+	for _, name := range names {
+		contact.parameters = append(contact.parameters, lib.NewParameter(name, fmt.Sprintf("%v", extensions[name])))
+	}
 }
+
+// GetExtension returns the parameters as a map, which loses their order;
+// GetParameters keeps it.
 func (contact *Contact) GetExtension() map[string]interface{} {
-	return contact.extension
+	if len(contact.parameters) == 0 {
+		return nil
+	}
+	extension := make(map[string]interface{}, len(contact.parameters))
+	for _, parameter := range contact.parameters {
+		if _, ok := extension[parameter.GetName()]; !ok {
+			extension[parameter.GetName()] = parameter.GetValue()
+		}
+	}
+	return extension
 }
 
+// NewContact returns a contact with the parameters of extension in the
+// order of their names.
 func NewContact(displayName string, uri *Uri, extension map[string]interface{}) *Contact {
-	return &Contact{
+	contact := &Contact{
 		displayName: displayName,
 		uri:         uri,
-		extension:   extension,
 	}
+	if extension != nil {
+		contact.SetExtension(extension)
+	}
+	return contact
 }
+
+// NewWildcardContact returns the Contact: * of a REGISTER removing all the
+// bindings, with Expires: 0.
+func NewWildcardContact() *Contact {
+	return &Contact{
+		wildcard: true,
+	}
+}
+
 func (contact *Contact) Raw() (string, error) {
 	result := ""
 	if err := contact.Validator(); err != nil {
 		return result, err
 	}
-	uri, err := contact.uri.Raw()
-	if err != nil {
-		return result, err
-	}
-	if len(strings.TrimSpace(contact.displayName)) == 0 {
-		result += fmt.Sprintf("Contact: <%s>", uri)
-	} else {
-		result += fmt.Sprintf("Contact: \"%s\" %s", contact.displayName, uri)
-	}
-	if contact.extension != nil {
-		extensions := ""
-		for k, v := range contact.extension {
-			if len(strings.TrimSpace(fmt.Sprintf("%v", v))) == 0 {
-				extensions += fmt.Sprintf(";%s", k)
-			} else {
-				extensions += fmt.Sprintf(";%s=%v", k, v)
-			}
-		}
-		if len(strings.TrimSpace(extensions)) > 0 {
-			result += extensions
-		}
-	}
+	result += fmt.Sprintf("Contact: %s", contact.String())
 	result += "\r\n"
 	return result, nil
 }
@@ -82,102 +113,43 @@ func (contact *Contact) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// contact field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(contact).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(contact|m)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a contact header field")
 	}
-	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = strings.TrimPrefix(raw, " ")
-	raw = strings.TrimSuffix(raw, " ")
-
-	// extensions regexp
-	extensionsRegexp := regexp.MustCompile(`>;.*`)
-	if extensionsRegexp.MatchString(raw) {
-		m := make(map[string]interface{})
-		extension := extensionsRegexp.FindString(raw)
-		extension = regexp.MustCompile(`>`).ReplaceAllString(extension, "")
-		extension = strings.TrimPrefix(extension, ";")
-		extension = strings.TrimSuffix(extension, ";")
-		extensions := strings.Split(extension, ";")
-		for _, v := range extensions {
-			if strings.Contains(v, "=") {
-				vs := strings.Split(v, "=")
-				if len(vs) > 1 {
-					m[vs[0]] = vs[1]
-				} else {
-					m[vs[0]] = ""
-				}
-			} else {
-				m[v] = ""
-			}
-		}
-		if len(m) > 0 {
-			contact.extension = m
-		}
-	}
-	raw = extensionsRegexp.ReplaceAllString(raw, "")
-	raw = strings.TrimPrefix(raw, " ")
-	raw = strings.TrimSuffix(raw, " ")
-
-	// uri regexp
-	uriRegex := regexp.MustCompile(`(?i)(sip).*?:.*`)
-	if uriRegex.MatchString(raw) {
-		uris := uriRegex.FindString(raw)
-		uris = regexp.MustCompile(`>`).ReplaceAllString(uris, "")
-		uris = regexp.MustCompile(`<`).ReplaceAllString(uris, "")
-		contact.uri = new(Uri)
-		if err := contact.uri.Parse(uris); err != nil {
-			return err
-		}
+	raw = strings.TrimSpace(fieldRegexp.ReplaceAllString(raw, ""))
+	*contact = Contact{}
+	if raw == "*" {
+		contact.wildcard = true
+		return contact.Validator()
 	}
-
-	raw = uriRegex.ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`>`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`<`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`"`).ReplaceAllString(raw, "")
-	raw = regexp.MustCompile(`"`).ReplaceAllString(raw, "")
-	raw = strings.TrimPrefix(raw, " ")
-	raw = strings.TrimSuffix(raw, " ")
-	// display name regexp
-	if len(strings.TrimSpace(raw)) > 0 {
-		contact.displayName = raw
+	address := new(Address)
+	if err := address.Parse(raw); err != nil {
+		return fmt.Errorf("contact address error : %s", err.Error())
 	}
-
+	contact.displayName = address.GetDisplayName()
+	contact.uri = address.GetUri()
+	contact.parameters = address.GetParameters()
 	return contact.Validator()
 }
 func (contact *Contact) Validator() error {
 	if reflect.DeepEqual(nil, contact) {
 		return errors.New("contact caller is not allowed to be nil")
 	}
-	if err := contact.uri.Validator(); err != nil {
+	if contact.wildcard {
+		if contact.uri != nil || len(contact.displayName) > 0 || len(contact.parameters) > 0 {
+			return errors.New("the wildcard contact has no address or parameters")
+		}
+		return nil
+	}
+	if err := NewAddress(contact.displayName, contact.uri, contact.parameters).Validator(); err != nil {
 		return fmt.Errorf("contact uri validator error : %s", err.Error())
 	}
 	return nil
 }
 func (contact *Contact) String() string {
-	result := ""
-	if len(strings.TrimSpace(contact.displayName)) > 0 {
-		result += fmt.Sprintf("\"%s\"", contact.displayName)
-	}
-	if !reflect.DeepEqual(nil, contact.uri) {
-		result += fmt.Sprintf(" %s", contact.uri.String())
-	}
-	if !reflect.DeepEqual(nil, contact.extension) {
-		extensions := ""
-		for k, v := range contact.extension {
-			if len(strings.TrimSpace(fmt.Sprintf("%v", v))) == 0 {
-				extensions += fmt.Sprintf(";%s", k)
-			} else {
-				extensions += fmt.Sprintf(";%s=%v", k, v)
-			}
-		}
-		if len(strings.TrimSpace(extensions)) > 0 {
-			if len(result) == 0 {
-				extensions = strings.TrimPrefix(extensions, ";")
-			}
-			result += extensions
-		}
+	if contact.wildcard {
+		return "*"
 	}
-
-	return result
+	return NewAddress(contact.displayName, contact.uri, contact.parameters).String()
 }
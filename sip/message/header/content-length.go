@@ -47,7 +47,7 @@ func (contentLength *ContentLength) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// content-length field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(content-length).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(content-length|l)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a content-length header field")
 	}
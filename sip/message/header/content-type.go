@@ -44,7 +44,7 @@ func (contentType *ContentType) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// content-type field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(content-type).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(content-type|c)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a content-type header field")
 	}
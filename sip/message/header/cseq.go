@@ -56,7 +56,7 @@ func (cseq *CSeq) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// cseq field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(cseq).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(cseq)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a cseq header field")
 	}
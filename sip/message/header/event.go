@@ -0,0 +1,90 @@
+package header
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+type Event struct {
+	eventType string // event-type, e.g. presence
+	id        string // id parameter
+}
+
+func (event *Event) SetEventType(eventType string) {
+	event.eventType = eventType
+}
+func (event *Event) GetEventType() string {
+	return event.eventType
+}
+func (event *Event) SetId(id string) {
+	event.id = id
+}
+func (event *Event) GetId() string {
+	return event.id
+}
+func NewEvent(eventType string, id string) *Event {
+	return &Event{
+		eventType: eventType,
+		id:        id,
+	}
+}
+
+func (event *Event) Raw() (string, error) {
+	result := ""
+	if err := event.Validator(); err != nil {
+		return result, err
+	}
+	result += fmt.Sprintf("Event: %s", event.String())
+	result += "\r\n"
+	return result, nil
+}
+func (event *Event) Parse(raw string) error {
+	if reflect.DeepEqual(nil, event) {
+		return errors.New("event caller is not allowed to be nil")
+	}
+	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
+	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
+	raw = strings.TrimPrefix(raw, " ")
+	raw = strings.TrimSuffix(raw, " ")
+	if len(strings.TrimSpace(raw)) == 0 {
+		return errors.New("the raw parameter is not allowed to be empty")
+	}
+	// event field regexp, o is the compact form
+	fieldRegexp := regexp.MustCompile(`^(?i)(event|o)\s*:`)
+	if !fieldRegexp.MatchString(raw) {
+		return errors.New("raw is not a event header field")
+	}
+	raw = fieldRegexp.ReplaceAllString(raw, "")
+	params := strings.Split(raw, ";")
+	event.eventType = strings.TrimSpace(params[0])
+	event.id = ""
+	for _, param := range params[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "id") {
+			event.id = strings.TrimSpace(kv[1])
+		}
+	}
+	return event.Validator()
+}
+func (event *Event) Validator() error {
+	if reflect.DeepEqual(nil, event) {
+		return errors.New("event caller is not allowed to be nil")
+	}
+	if len(strings.TrimSpace(event.eventType)) == 0 {
+		return errors.New("the event-type field is not allowed to be empty")
+	}
+	if strings.ContainsAny(event.eventType, " ;,") {
+		return errors.New("the event-type field is not a token")
+	}
+	return nil
+}
+func (event *Event) String() string {
+	result := event.eventType
+	if len(strings.TrimSpace(event.id)) > 0 {
+		result += fmt.Sprintf(";id=%s", event.id)
+	}
+	return result
+}
@@ -0,0 +1,34 @@
+package header
+
+import (
+	"testing"
+)
+
+func TestEvent_Raw(t *testing.T) {
+	raw, err := NewEvent("presence", "12").Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != "Event: presence;id=12\r\n" {
+		t.Fatalf("unexpected raw %q", raw)
+	}
+	if _, err := NewEvent("", "").Raw(); err == nil {
+		t.Fatal("expected an error for an empty event type")
+	}
+}
+
+func TestEvent_Parse(t *testing.T) {
+	for raw, want := range map[string]string{
+		"Event: presence\r\n":            "presence",
+		"event:Catalog;id=7":             "Catalog;id=7",
+		"o: presence ; ID = 3 ; x=1\r\n": "presence;id=3",
+	} {
+		event := new(Event)
+		if err := event.Parse(raw); err != nil {
+			t.Fatal(err)
+		}
+		if event.String() != want {
+			t.Fatalf("%q parsed as %q", raw, event.String())
+		}
+	}
+}
@@ -47,7 +47,7 @@ func (expires *Expires) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// expires field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(expires).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(expires)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a expires header field")
 	}
@@ -0,0 +1,89 @@
+package header
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// tokenRegexp matches an RFC 3261 token, the syntax of header field names.
+var tokenRegexp = regexp.MustCompile("^[A-Za-z0-9.!%*_+`'~-]+$")
+
+// Field is a header field without a typed value, such as Date, Allow or a
+// vendor X- field, or a repeat of a single-valued one; its value is kept
+// verbatim.
+type Field struct {
+	name  string // field-name
+	value string // field-value
+}
+
+func (field *Field) SetName(name string) {
+	field.name = name
+}
+func (field *Field) GetName() string {
+	return field.name
+}
+func (field *Field) SetValue(value string) {
+	field.value = value
+}
+func (field *Field) GetValue() string {
+	return field.value
+}
+
+// GetValues returns the values of a list field such as Allow, Supported or
+// Require split at their commas, and the value alone for other fields.
+func (field *Field) GetValues() []string {
+	if !isList(field.name) {
+		return []string{field.value}
+	}
+	return splitValues(field.value)
+}
+func NewField(name, value string) *Field {
+	return &Field{
+		name:  name,
+		value: value,
+	}
+}
+
+func (field *Field) Raw() (string, error) {
+	result := ""
+	if err := field.Validator(); err != nil {
+		return result, err
+	}
+	result += fmt.Sprintf("%s: %s", field.name, field.value)
+	result += "\r\n"
+	return result, nil
+}
+func (field *Field) Parse(raw string) error {
+	if reflect.DeepEqual(nil, field) {
+		return errors.New("field caller is not allowed to be nil")
+	}
+	raw = strings.TrimRight(raw, "\r\n")
+	if len(strings.TrimSpace(raw)) == 0 {
+		return errors.New("the raw parameter is not allowed to be empty")
+	}
+	index := strings.Index(raw, ":")
+	if index < 0 {
+		return errors.New("raw is not a header field")
+	}
+	field.name = strings.TrimSpace(raw[:index])
+	field.value = strings.TrimSpace(raw[index+1:])
+	return field.Validator()
+}
+func (field *Field) Validator() error {
+	if reflect.DeepEqual(nil, field) {
+		return errors.New("field caller is not allowed to be nil")
+	}
+	if !tokenRegexp.MatchString(field.name) {
+		return fmt.Errorf("the field name %q is not a token", field.name)
+	}
+	if strings.ContainsAny(field.value, "\r\n") {
+		return fmt.Errorf("the value of the %s field is not allowed to break lines", field.name)
+	}
+	return nil
+}
+func (field *Field) String() string {
+	return field.value
+}
@@ -6,12 +6,15 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+
+	"github.com/kokutas/gb28181/sip/lib"
 )
 
 type From struct {
-	displayName string // display-name
-	address     *Uri   // SIP from Address"`
-	tag         string // SIP from Tag"`
+	displayName string         // display-name
+	address     *Uri           // SIP from Address
+	tag         string         // SIP from Tag
+	parameters  lib.Parameters // the parameters besides the tag
 }
 
 func (from *From) SetDisplayName(displayName string) {
@@ -32,6 +35,12 @@ func (from *From) SetTag(tag string) {
 func (from *From) GetTag() string {
 	return from.tag
 }
+func (from *From) SetParameters(parameters lib.Parameters) {
+	from.parameters = parameters
+}
+func (from *From) GetParameters() lib.Parameters {
+	return from.parameters
+}
 
 func NewFrom(displayName string, address *Uri, tag string) *From {
 	return &From{
@@ -45,18 +54,7 @@ func (from *From) Raw() (string, error) {
 	if err := from.Validator(); err != nil {
 		return result, err
 	}
-	address, err := from.address.Raw()
-	if err != nil {
-		return result, err
-	}
-	if len(strings.TrimSpace(from.displayName)) == 0 {
-		result += fmt.Sprintf("From: <%s>", address)
-	} else {
-		result += fmt.Sprintf("From: \"%s\" %s", from.displayName, address)
-	}
-	if len(strings.TrimSpace(from.tag)) > 0 {
-		result += fmt.Sprintf(";tag=%s", from.tag)
-	}
+	result += fmt.Sprintf("From: %s", from.String())
 	result += "\r\n"
 	return result, nil
 }
@@ -72,79 +70,36 @@ func (from *From) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// from field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(from).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(from|f)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a from header field")
 	}
 	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = strings.TrimPrefix(raw, " ")
-	raw = strings.TrimSuffix(raw, " ")
-	// address and tag regexp
-	addressAndTagRegexp := regexp.MustCompile(`(?i)(sip).*?:.*`)
-	// tag regexp
-	tagRegexp := regexp.MustCompile(`(?i)(tag)=.*`)
-	// display-name
-	displayNameStr := addressAndTagRegexp.ReplaceAllString(raw, "")
-	displayNameStr = regexp.MustCompile(`<`).ReplaceAllString(displayNameStr, "")
-	displayNameStr = regexp.MustCompile(`>`).ReplaceAllString(displayNameStr, "")
-	displayNameStr = regexp.MustCompile(`"`).ReplaceAllString(displayNameStr, "")
-	displayNameStr = strings.TrimPrefix(displayNameStr, " ")
-	displayNameStr = strings.TrimSuffix(displayNameStr, " ")
-	if len(strings.TrimSpace(displayNameStr)) > 0 {
-		from.displayName = displayNameStr
+	address := new(Address)
+	if err := address.Parse(raw); err != nil {
+		return fmt.Errorf("from address error : %s", err.Error())
 	}
-	if addressAndTagRegexp.MatchString(raw) {
-		addressAndTag := addressAndTagRegexp.FindString(raw)
-		if tagRegexp.MatchString(addressAndTag) {
-			from.tag = regexp.MustCompile(`(?i)(tag)=`).ReplaceAllString(tagRegexp.FindString(addressAndTag), "")
-			addressAndTag = tagRegexp.ReplaceAllString(addressAndTag, "")
-		}
-		addressAndTag = regexp.MustCompile(`<`).ReplaceAllString(addressAndTag, "")
-		addressAndTag = regexp.MustCompile(`>`).ReplaceAllString(addressAndTag, "")
-		addressAndTag = strings.TrimPrefix(addressAndTag, ";")
-		addressAndTag = strings.TrimSuffix(addressAndTag, ";")
-		addressAndTag = strings.TrimPrefix(addressAndTag, " ")
-		addressAndTag = strings.TrimSuffix(addressAndTag, " ")
-		from.address = new(Uri)
-		if err := from.address.Parse(addressAndTag); err != nil {
-			return err
-		}
-	}
-
+	from.displayName = address.GetDisplayName()
+	from.address = address.GetUri()
+	parameters := address.GetParameters()
+	from.tag, _ = parameters.Get("tag")
+	parameters.Del("tag")
+	from.parameters = parameters
 	return from.Validator()
 }
 func (from *From) Validator() error {
 	if reflect.DeepEqual(nil, from) {
 		return errors.New("from caller is not allowed to be nil")
 	}
-	if err := from.address.Validator(); err != nil {
+	if err := NewAddress(from.displayName, from.address, from.parameters).Validator(); err != nil {
 		return fmt.Errorf("from address validator error : %s", err.Error())
 	}
 	return nil
 }
 func (from *From) String() string {
-	result := ""
-	if len(strings.TrimSpace(from.displayName)) > 0 {
-		result += fmt.Sprintf(" \"%s\"", from.displayName)
-		if !reflect.DeepEqual(nil, from.address) {
-			if len(result) > 0 {
-				result += fmt.Sprintf(" %s", from.address.String())
-			}
-		}
-	} else {
-		if !reflect.DeepEqual(nil, from.address) {
-			if len(result) > 0 {
-				result += fmt.Sprintf("<%s>", from.address.String())
-			}
-		}
-	}
-
+	parameters := make(lib.Parameters, 0, len(from.parameters)+1)
 	if len(strings.TrimSpace(from.tag)) > 0 {
-		if len(result) > 0 {
-			result += fmt.Sprintf(";tag=%s", from.tag)
-		} else {
-			result += fmt.Sprintf("tag=%s", from.tag)
-		}
+		parameters = append(parameters, lib.NewParameter("tag", from.tag))
 	}
-	return result
+	return NewAddress(from.displayName, from.address, append(parameters, from.parameters...)).String()
 }
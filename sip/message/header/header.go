@@ -2,27 +2,33 @@ package header
 
 import (
 	"errors"
-	"fmt"
 	"reflect"
-	"regexp"
 	"strings"
 )
 
 type Header struct {
+	*AllowEvents
 	*Authorization
 	*CallID
 	*Contact
 	*ContentLength
 	*ContentType
 	*CSeq
+	*Event
 	*Expires
 	*From
 	*MaxForwards
 	*Route
+	*SubscriptionState
 	*To
 	*UserAgent
 	*Via
 	*WWWAuthenticate
+
+	moreVias     []*Via     // the vias below the topmost one
+	moreContacts []*Contact // the contacts after the first one
+	moreRoutes   []*Route   // the routes after the first one
+	fields       []*Field   // unknown and repeated fields, verbatim and in order
 }
 
 func NewHeader(
@@ -60,49 +66,196 @@ func NewHeader(
 	}
 }
 
+// GetVias returns the vias from the topmost one down.
+func (head *Header) GetVias() []*Via {
+	vias := make([]*Via, 0, 1+len(head.moreVias))
+	if head.Via != nil {
+		vias = append(vias, head.Via)
+	}
+	return append(vias, head.moreVias...)
+}
+func (head *Header) SetVias(vias ...*Via) {
+	head.Via, head.moreVias = nil, nil
+	if len(vias) > 0 {
+		head.Via, head.moreVias = vias[0], append([]*Via(nil), vias[1:]...)
+	}
+}
+
+// PushVia adds a via above the others, as a proxy forwarding a request does.
+func (head *Header) PushVia(via *Via) {
+	head.SetVias(append([]*Via{via}, head.GetVias()...)...)
+}
+
+// PopVia removes and returns the topmost via, as a proxy forwarding a
+// response does; it returns nil without vias.
+func (head *Header) PopVia() *Via {
+	vias := head.GetVias()
+	if len(vias) == 0 {
+		return nil
+	}
+	head.SetVias(vias[1:]...)
+	return vias[0]
+}
+func (head *Header) GetContacts() []*Contact {
+	contacts := make([]*Contact, 0, 1+len(head.moreContacts))
+	if head.Contact != nil {
+		contacts = append(contacts, head.Contact)
+	}
+	return append(contacts, head.moreContacts...)
+}
+func (head *Header) SetContacts(contacts ...*Contact) {
+	head.Contact, head.moreContacts = nil, nil
+	if len(contacts) > 0 {
+		head.Contact, head.moreContacts = contacts[0], append([]*Contact(nil), contacts[1:]...)
+	}
+}
+func (head *Header) GetRoutes() []*Route {
+	routes := make([]*Route, 0, 1+len(head.moreRoutes))
+	if head.Route != nil {
+		routes = append(routes, head.Route)
+	}
+	return append(routes, head.moreRoutes...)
+}
+func (head *Header) SetRoutes(routes ...*Route) {
+	head.Route, head.moreRoutes = nil, nil
+	if len(routes) > 0 {
+		head.Route, head.moreRoutes = routes[0], append([]*Route(nil), routes[1:]...)
+	}
+}
+
+// GetFields returns the fields without a typed accessor in order: unknown
+// ones such as Record-Route, Date or X- fields, and repeats of single-valued
+// ones.
+func (head *Header) GetFields() []*Field {
+	return head.fields
+}
+
+// GetField returns the first field of a name, matched case-insensitively
+// and whether in compact form or not, or nil.
+func (head *Header) GetField(name string) *Field {
+	for _, field := range head.fields {
+		if sameName(field.name, name) {
+			return field
+		}
+	}
+	return nil
+}
+
+// GetValues returns the values of the fields of a name in order, the
+// values of list fields such as Allow one by one.
+func (head *Header) GetValues(name string) []string {
+	values := make([]string, 0)
+	for _, field := range head.fields {
+		if sameName(field.name, name) {
+			values = append(values, field.GetValues()...)
+		}
+	}
+	return values
+}
+
+// AddField appends a field after the others of its name.
+func (head *Header) AddField(field *Field) {
+	head.fields = append(head.fields, field)
+}
+
+// SetField replaces the fields of the name of a field by it, in place of
+// the first one.
+func (head *Header) SetField(field *Field) {
+	fields := make([]*Field, 0, len(head.fields)+1)
+	set := false
+	for _, kept := range head.fields {
+		if !sameName(kept.name, field.name) {
+			fields = append(fields, kept)
+		} else if !set {
+			fields = append(fields, field)
+			set = true
+		}
+	}
+	if !set {
+		fields = append(fields, field)
+	}
+	head.fields = fields
+}
+
+// DelField removes the fields of a name.
+func (head *Header) DelField(name string) {
+	fields := make([]*Field, 0, len(head.fields))
+	for _, field := range head.fields {
+		if !sameName(field.name, name) {
+			fields = append(fields, field)
+		}
+	}
+	head.fields = fields
+}
+
 func (head *Header) Raw() (string, error) {
 	result := ""
 	if err := head.Validator(); err != nil {
 		return result, err
 	}
-	via, err := head.Via.Raw()
-	if err != nil {
-		return result, err
+	// header fields in the order they are written, absent ones are skipped
+	fields := make([]interface{ Raw() (string, error) }, 0, 17+len(head.fields))
+	for _, via := range head.GetVias() {
+		fields = append(fields, via)
 	}
-	from, err := head.From.Raw()
-	if err != nil {
-		return result, err
+	if head.From != nil {
+		fields = append(fields, head.From)
 	}
-	to, err := head.To.Raw()
-	if err != nil {
-		return result, err
+	if head.To != nil {
+		fields = append(fields, head.To)
 	}
-	callId, err := head.CallID.Raw()
-	if err != nil {
-		return result, err
+	if head.CallID != nil {
+		fields = append(fields, head.CallID)
 	}
-	cseq, err := head.CSeq.Raw()
-	if err != nil {
-		return result, err
+	if head.CSeq != nil {
+		fields = append(fields, head.CSeq)
 	}
-	contact, err := head.Contact.Raw()
-	if err != nil {
-		return result, err
+	for _, contact := range head.GetContacts() {
+		fields = append(fields, contact)
 	}
-	maxForwards, err := head.MaxForwards.Raw()
-	if err != nil {
-		return result, err
+	for _, route := range head.GetRoutes() {
+		fields = append(fields, route)
 	}
-	expires, err := head.Expires.Raw()
-	if err != nil {
-		return result, err
+	if head.Authorization != nil {
+		fields = append(fields, head.Authorization)
 	}
-	contentLength, err := head.ContentLength.Raw()
-	if err != nil {
-		return result, err
+	if head.WWWAuthenticate != nil {
+		fields = append(fields, head.WWWAuthenticate)
+	}
+	if head.MaxForwards != nil {
+		fields = append(fields, head.MaxForwards)
+	}
+	if head.UserAgent != nil {
+		fields = append(fields, head.UserAgent)
+	}
+	if head.Expires != nil {
+		fields = append(fields, head.Expires)
+	}
+	if head.Event != nil {
+		fields = append(fields, head.Event)
+	}
+	if head.SubscriptionState != nil {
+		fields = append(fields, head.SubscriptionState)
+	}
+	if head.AllowEvents != nil {
+		fields = append(fields, head.AllowEvents)
+	}
+	for _, field := range head.fields {
+		fields = append(fields, field)
+	}
+	if head.ContentType != nil {
+		fields = append(fields, head.ContentType)
+	}
+	if head.ContentLength != nil {
+		fields = append(fields, head.ContentLength)
+	}
+	for _, field := range fields {
+		str, err := field.Raw()
+		if err != nil {
+			return "", err
+		}
+		result += str
 	}
-
-	result += fmt.Sprintf("%s%s%s%s%s%s%s%s%s", via, from, to, callId, cseq, contact, maxForwards, expires, contentLength)
 	result += "\r\n"
 	return result, nil
 }
@@ -116,65 +269,136 @@ func (head *Header) Parse(raw string) error {
 	if len(strings.TrimSpace(raw)) == 0 {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
-	// regexp
-	viaRegexp := regexp.MustCompile(`^(?i)(via).*?:.*`)
-	fromRegexp := regexp.MustCompile(`^(?i)(from).*?:.*`)
-	toRegexp := regexp.MustCompile(`^(?i)(to).*?:.*`)
-	callIdRegexp := regexp.MustCompile(`^(?i)(call-id).*?:.*`)
-	cseqRegexp := regexp.MustCompile(`^(?i)(cseq).*?:.*`)
-	contactRegexp := regexp.MustCompile(`(?i)(contact).*?:.*`)
-	maxForwardsRegexp := regexp.MustCompile(`(?i)(max-forwards).*?:.*`)
-	expiresRegexp := regexp.MustCompile(`(?i)(expires).*?:.*`)
-	contentLengthRegexp := regexp.MustCompile(`(?i)(content-length).*?:.*`)
-
-	rawSlice := strings.Split(raw, "\n")
-	for _, raws := range rawSlice {
+	head.moreVias, head.moreContacts, head.moreRoutes, head.fields = nil, nil, nil, nil
+	// the single-valued fields parsed, a repeat of one is kept verbatim
+	parsed := make(map[string]bool)
+	repeated := func(name string) bool {
+		if parsed[name] {
+			return true
+		}
+		parsed[name] = true
+		return false
+	}
+	for _, line := range unfold(raw) {
+		name, value, ok := splitField(line)
+		if !ok {
+			continue
+		}
+		canonical := strings.ToLower(CanonicalName(name))
 		switch {
-		case viaRegexp.MatchString(raws):
-			head.Via = new(Via)
-			if err := head.Via.Parse(raws); err != nil {
-				return err
+		case canonical == "via":
+			for _, value := range splitValues(value) {
+				via := new(Via)
+				if err := via.Parse(name + ": " + value); err != nil {
+					return err
+				}
+				// the topmost via identifies the transaction
+				if repeated("via") {
+					head.moreVias = append(head.moreVias, via)
+				} else {
+					head.Via = via
+				}
 			}
-		case fromRegexp.MatchString(raws):
+		case canonical == "contact":
+			for _, value := range splitValues(value) {
+				contact := new(Contact)
+				if err := contact.Parse(name + ": " + value); err != nil {
+					return err
+				}
+				if repeated("contact") {
+					head.moreContacts = append(head.moreContacts, contact)
+				} else {
+					head.Contact = contact
+				}
+			}
+		case canonical == "route":
+			for _, value := range splitValues(value) {
+				route := new(Route)
+				if err := route.Parse(name + ": " + value); err != nil {
+					return err
+				}
+				if repeated("route") {
+					head.moreRoutes = append(head.moreRoutes, route)
+				} else {
+					head.Route = route
+				}
+			}
+		case canonical == "from" && !repeated(canonical):
 			head.From = new(From)
-			if err := head.From.Parse(raws); err != nil {
+			if err := head.From.Parse(line); err != nil {
 				return err
 			}
-		case toRegexp.MatchString(raws):
+		case canonical == "to" && !repeated(canonical):
 			head.To = new(To)
-			if err := head.To.Parse(raws); err != nil {
+			if err := head.To.Parse(line); err != nil {
 				return err
 			}
-		case callIdRegexp.MatchString(raws):
+		case canonical == "call-id" && !repeated(canonical):
 			head.CallID = new(CallID)
-			if err := head.CallID.Parse(raws); err != nil {
+			if err := head.CallID.Parse(line); err != nil {
 				return err
 			}
-		case cseqRegexp.MatchString(raws):
+		case canonical == "cseq" && !repeated(canonical):
 			head.CSeq = new(CSeq)
-			if err := head.CSeq.Parse(raws); err != nil {
-				return err
-			}
-		case contactRegexp.MatchString(raws):
-			head.Contact = new(Contact)
-			if err := head.Contact.Parse(raws); err != nil {
+			if err := head.CSeq.Parse(line); err != nil {
 				return err
 			}
-		case maxForwardsRegexp.MatchString(raws):
+		case canonical == "max-forwards" && !repeated(canonical):
 			head.MaxForwards = new(MaxForwards)
-			if err := head.MaxForwards.Parse(raws); err != nil {
+			if err := head.MaxForwards.Parse(line); err != nil {
 				return err
 			}
-		case expiresRegexp.MatchString(raws):
+		case canonical == "expires" && !repeated(canonical):
 			head.Expires = new(Expires)
-			if err := head.Expires.Parse(raws); err != nil {
+			if err := head.Expires.Parse(line); err != nil {
+				return err
+			}
+		case canonical == "event" && !repeated(canonical):
+			head.Event = new(Event)
+			if err := head.Event.Parse(line); err != nil {
+				return err
+			}
+		case canonical == "subscription-state" && !repeated(canonical):
+			head.SubscriptionState = new(SubscriptionState)
+			if err := head.SubscriptionState.Parse(line); err != nil {
+				return err
+			}
+		case canonical == "allow-events" && !repeated(canonical):
+			head.AllowEvents = new(AllowEvents)
+			if err := head.AllowEvents.Parse(line); err != nil {
 				return err
 			}
-		case contentLengthRegexp.MatchString(raws):
+		case canonical == "content-length" && !repeated(canonical):
 			head.ContentLength = new(ContentLength)
-			if err := head.ContentLength.Parse(raws); err != nil {
+			if err := head.ContentLength.Parse(line); err != nil {
 				return err
 			}
+		case canonical == "content-type" && !repeated(canonical):
+			head.ContentType = new(ContentType)
+			if err := head.ContentType.Parse(line); err != nil {
+				return err
+			}
+		case canonical == "user-agent" && !repeated(canonical):
+			head.UserAgent = new(UserAgent)
+			if err := head.UserAgent.Parse(line); err != nil {
+				return err
+			}
+		case canonical == "authorization" && !repeated(canonical):
+			head.Authorization = new(Authorization)
+			if err := head.Authorization.Parse(line); err != nil {
+				return err
+			}
+		case canonical == "www-authenticate" && !repeated(canonical):
+			head.WWWAuthenticate = new(WWWAuthenticate)
+			if err := head.WWWAuthenticate.Parse(line); err != nil {
+				return err
+			}
+		default:
+			field := new(Field)
+			if err := field.Parse(line); err != nil {
+				return err
+			}
+			head.fields = append(head.fields, field)
 		}
 	}
 
@@ -185,80 +409,120 @@ func (head *Header) Validator() error {
 		return errors.New("head caller is not allowed to be nil")
 	}
 	// via,from,to,callid,contact,length,expires
-	if !reflect.DeepEqual(nil, head.Authorization) {
+	if head.AllowEvents != nil {
+		if err := head.AllowEvents.Validator(); err != nil {
+			return err
+		}
+	}
+	if head.Authorization != nil {
 		if err := head.Authorization.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.CallID) {
+	if head.CallID != nil {
 		if err := head.CallID.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.Contact) {
+	if head.Contact != nil {
 		if err := head.Contact.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.ContentLength) {
+	if head.ContentLength != nil {
 		if err := head.ContentLength.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.ContentType) {
+	if head.ContentType != nil {
 		if err := head.ContentType.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.CSeq) {
+	if head.CSeq != nil {
 		if err := head.CSeq.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.Expires) {
+	if head.Expires != nil {
 		if err := head.Expires.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.From) {
+	if head.Event != nil {
+		if err := head.Event.Validator(); err != nil {
+			return err
+		}
+	}
+	if head.SubscriptionState != nil {
+		if err := head.SubscriptionState.Validator(); err != nil {
+			return err
+		}
+	}
+	if head.From != nil {
 		if err := head.From.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.MaxForwards) {
+	if head.MaxForwards != nil {
 		if err := head.MaxForwards.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.Route) {
+	if head.Route != nil {
 		if err := head.Route.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.To) {
-		if err := head.Route.Validator(); err != nil {
+	if head.To != nil {
+		if err := head.To.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.UserAgent) {
+	if head.UserAgent != nil {
 		if err := head.UserAgent.Validator(); err != nil {
 			return err
 		}
 	}
-	if !reflect.DeepEqual(nil, head.Via) {
+	if head.Via != nil {
 		if err := head.Via.Validator(); err != nil {
 			return err
 		}
 
 	}
-	if !reflect.DeepEqual(nil, head.WWWAuthenticate) {
+	if head.WWWAuthenticate != nil {
 		if err := head.WWWAuthenticate.Validator(); err != nil {
 			return err
 		}
 	}
+	for _, via := range head.moreVias {
+		if err := via.Validator(); err != nil {
+			return err
+		}
+	}
+	for _, contact := range head.moreContacts {
+		if err := contact.Validator(); err != nil {
+			return err
+		}
+	}
+	for _, route := range head.moreRoutes {
+		if err := route.Validator(); err != nil {
+			return err
+		}
+	}
+	for _, field := range head.fields {
+		if err := field.Validator(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 func (head *Header) String() string {
 	result := ""
 	return result
 }
+
+// unquote trims the blanks and double quotes around an auth-param value.
+func unquote(value string) string {
+	return strings.Trim(strings.TrimSpace(value), "\"")
+}
@@ -37,3 +37,151 @@ func TestNewHead(t *testing.T) {
 	}
 	fmt.Println(runtime.NumGoroutine())
 }
+
+const testHeader = "Via: SIP/2.0/UDP 192.168.1.3:5060;branch=z9hG4bK456\r\n" +
+	"Via: SIP/2.0/UDP 192.168.1.2;rport;branch=z9hG4bK123;x-foo=bar\r\n" +
+	"From: <sip:34020000002000000001@3402000000>;tag=abc\r\n" +
+	"To: <sip:34020000001320000001@3402000000>\r\n" +
+	"Call-ID: 12345@192.168.1.2\r\n" +
+	"CSeq: 1 REGISTER\r\n" +
+	"Contact: <sip:34020000001320000001@192.168.1.2:5060>\r\n" +
+	"Route: <sip:34020000002000000001@192.168.1.3:5060>\r\n" +
+	"Date: 2021-06-01T12:00:00.000\r\n" +
+	"Route: <sip:34020000002000000001@192.168.1.4:5060>\r\n" +
+	"Contact: <sip:34020000001320000001@192.168.1.5:5060>\r\n" +
+	"X-Vendor: a, b\r\n" +
+	"x-vendor: c\r\n" +
+	"Expires: 3600\r\n" +
+	"Expires: 60\r\n" +
+	"Content-Length: 0\r\n"
+
+func TestHeader_Parse(t *testing.T) {
+	head := new(Header)
+	if err := head.Parse(testHeader); err != nil {
+		t.Fatal(err)
+	}
+	if vias := head.GetVias(); len(vias) != 2 || head.Via != vias[0] || vias[1].GetSentByAddress() != "192.168.1.2" {
+		t.Fatalf("unexpected vias %v", vias)
+	}
+	// a lower via keeps its unknown parameters and its default port
+	if via := head.GetVias()[1]; via.GetSentBy() != "192.168.1.2:5060" || via.GetParameters()[2].GetName() != "x-foo" {
+		t.Fatalf("unexpected via %s", via.String())
+	}
+	if contacts := head.GetContacts(); len(contacts) != 2 || contacts[1].GetUri().GetHost() != "192.168.1.5" {
+		t.Fatalf("unexpected contacts %v", contacts)
+	}
+	if routes := head.GetRoutes(); len(routes) != 2 || routes[1].GetUris()[0].GetHost() != "192.168.1.4" {
+		t.Fatalf("unexpected routes %v", routes)
+	}
+	if head.Expires.GetSeconds() != 3600 {
+		t.Fatalf("unexpected expires %s", head.Expires)
+	}
+	if field := head.GetField("date"); field == nil || field.GetValue() != "2021-06-01T12:00:00.000" {
+		t.Fatalf("unexpected date %v", field)
+	}
+	if values := head.GetValues("X-Vendor"); len(values) != 2 || values[0] != "a, b" || values[1] != "c" {
+		t.Fatalf("unexpected vendor values %v", values)
+	}
+	if values := head.GetValues("Expires"); len(values) != 1 || values[0] != "60" {
+		t.Fatalf("unexpected repeated expires %v", values)
+	}
+
+	raw, err := head.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := new(Header)
+	if err := parsed.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	again, err := parsed.Raw()
+	if err != nil || again != raw {
+		t.Fatalf("unexpected round trip %q %v, expected %q", again, err, raw)
+	}
+	if len(parsed.GetVias()) != 2 || len(parsed.GetContacts()) != 2 || len(parsed.GetRoutes()) != 2 || len(parsed.GetFields()) != 4 {
+		t.Fatalf("unexpected fields of %q", raw)
+	}
+
+	if err := new(Header).Parse(testHeader + "X Bad: 1\r\n"); err == nil {
+		t.Fatal("expected error for a field name which is not a token")
+	}
+}
+
+func TestHeader_Fields(t *testing.T) {
+	head := new(Header)
+	head.AddField(NewField("Allow", "INVITE"))
+	head.AddField(NewField("Subject", "34020000001320000001:1"))
+	head.AddField(NewField("allow", "BYE"))
+	head.SetField(NewField("Allow", "INVITE, BYE, MESSAGE"))
+	if fields := head.GetFields(); len(fields) != 2 || fields[0].GetValue() != "INVITE, BYE, MESSAGE" {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	if values := head.GetValues("allow"); len(values) != 3 || values[0] != "INVITE" || values[2] != "MESSAGE" {
+		t.Fatalf("unexpected allow values %v", values)
+	}
+	head.DelField("SUBJECT")
+	if head.GetField("subject") != nil || len(head.GetFields()) != 1 {
+		t.Fatalf("unexpected fields %v", head.GetFields())
+	}
+	head.AddField(NewField("X-Bad", "a\r\nVia: b"))
+	if _, err := head.Raw(); err == nil {
+		t.Fatal("expected error for a value breaking lines")
+	}
+}
+
+func TestHeader_PushVia(t *testing.T) {
+	head := new(Header)
+	if head.PopVia() != nil {
+		t.Fatal("popped a via of an empty header")
+	}
+	device := NewVia("SIP", 2.0, "UDP", "192.168.1.2", 5060, 0, "z9hG4bK123", "")
+	proxy := NewVia("SIP", 2.0, "UDP", "192.168.1.3", 5060, 0, "z9hG4bK456", "")
+	head.PushVia(device)
+	head.PushVia(proxy)
+	if vias := head.GetVias(); len(vias) != 2 || head.Via != proxy || vias[1] != device {
+		t.Fatalf("unexpected vias %v", vias)
+	}
+	if head.PopVia() != proxy || head.Via != device || len(head.GetVias()) != 1 {
+		t.Fatalf("unexpected vias %v", head.GetVias())
+	}
+	head.SetVias()
+	if head.Via != nil || len(head.GetVias()) != 0 {
+		t.Fatalf("unexpected vias %v", head.GetVias())
+	}
+}
+
+func TestHeader_Parse_Compact(t *testing.T) {
+	raw := "v: SIP/2.0/UDP 192.168.1.3:5060;branch=z9hG4bK456,\r\n SIP/2.0/UDP 192.168.1.2:5060;rport;branch=z9hG4bK123\r\n" +
+		"f: <sip:34020000002000000001@3402000000>;tag=abc\r\n" +
+		"t: <sip:34020000001320000001@3402000000>\r\n" +
+		"i: 12345@192.168.1.2\r\n" +
+		"CSEQ: 1 REGISTER\r\n" +
+		"m: <sip:34020000001320000001@192.168.1.2:5060>, <sip:34020000001320000001@192.168.1.5:5060>\r\n" +
+		"s: 34020000001320000001:1,\r\n\t34020000002000000001:0\r\n" +
+		"Subject-Extra: x\r\n" +
+		"k: timer, 100rel\r\n" +
+		"Require: 100rel\r\n" +
+		"c: Application/MANSCDP+xml\r\n" +
+		"l: 0\r\n"
+	head := new(Header)
+	if err := head.Parse(raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(head.GetVias()) != 2 || head.Via.GetBranch() != "z9hG4bK456" || head.From.GetTag() != "abc" ||
+		head.To == nil || head.CallID == nil || head.CSeq == nil || len(head.GetContacts()) != 2 ||
+		head.ContentType == nil || head.ContentLength == nil {
+		t.Fatalf("unexpected header of %q", raw)
+	}
+	if field := head.GetField("Subject"); field == nil || field.GetValue() != "34020000001320000001:1, 34020000002000000001:0" {
+		t.Fatalf("unexpected subject %v", field)
+	}
+	if values := head.GetValues("s"); len(values) != 1 {
+		t.Fatalf("unexpected subject values %v", values)
+	}
+	if values := head.GetValues("Supported"); len(values) != 2 || values[0] != "timer" || values[1] != "100rel" {
+		t.Fatalf("unexpected supported values %v", values)
+	}
+	if values := head.GetField("require").GetValues(); len(values) != 1 || values[0] != "100rel" {
+		t.Fatalf("unexpected require values %v", values)
+	}
+}
@@ -46,7 +46,7 @@ func (maxForwards *MaxForwards) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// max-forwards field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(max-forwards).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(max-forwards)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a max-forwards header field")
 	}
@@ -6,11 +6,14 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+
+	"github.com/kokutas/gb28181/sip/lib"
 )
 
 type Route struct {
-	displayName string // display-name
-	uris        []*Uri // route uri
+	displayName string         // display-name
+	uris        []*Uri         // route uri
+	parameters  lib.Parameters // rr-params of the first route
 }
 
 func (route *Route) SetDisplayName(displayName string) {
@@ -26,6 +29,12 @@ func (route *Route) SetUris(uris ...*Uri) {
 func (route *Route) GetUris() []*Uri {
 	return route.uris
 }
+func (route *Route) SetParameters(parameters lib.Parameters) {
+	route.parameters = parameters
+}
+func (route *Route) GetParameters() lib.Parameters {
+	return route.parameters
+}
 func NewRoute(displayName string, uris ...*Uri) *Route {
 	return &Route{
 		displayName: displayName,
@@ -38,24 +47,7 @@ func (route *Route) Raw() (string, error) {
 	if err := route.Validator(); err != nil {
 		return result, err
 	}
-	result += "Route:"
-	addQuoteTag := true
-	if len(strings.TrimSpace(route.displayName)) > 0 {
-		addQuoteTag = false
-		result += fmt.Sprintf(" \"%s\"", route.displayName)
-	}
-	for _, uri := range route.uris {
-		uriStr, err := uri.Raw()
-		if err != nil {
-			return "", err
-		}
-		if !addQuoteTag {
-			result += fmt.Sprintf(" %s,", uriStr)
-		} else {
-			result += fmt.Sprintf(" <%s>,", uriStr)
-		}
-	}
-	result = strings.TrimSuffix(result, ",")
+	result += fmt.Sprintf("Route: %s", route.String())
 	result += "\r\n"
 	return result, nil
 }
@@ -71,56 +63,24 @@ func (route *Route) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// route field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(route).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(route)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a route header field")
 	}
 	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = strings.TrimPrefix(raw, " ")
-	raw = strings.TrimSuffix(raw, " ")
-
-	// address and tag regexp
-	addressAndTagRegexp := regexp.MustCompile(`(?i)(sip).*?:.*`)
-	// display-name
-	displayNameStr := addressAndTagRegexp.ReplaceAllString(raw, "")
-	displayNameStr = regexp.MustCompile(`<`).ReplaceAllString(displayNameStr, "")
-	displayNameStr = regexp.MustCompile(`>`).ReplaceAllString(displayNameStr, "")
-	displayNameStr = regexp.MustCompile(`"`).ReplaceAllString(displayNameStr, "")
-	displayNameStr = strings.TrimPrefix(displayNameStr, " ")
-	displayNameStr = strings.TrimSuffix(displayNameStr, " ")
-	if len(strings.TrimSpace(displayNameStr)) > 0 {
-		route.displayName = displayNameStr
-		raw = regexp.MustCompile(`.*`+displayNameStr).ReplaceAllString(raw, "")
-	}
-	raw = strings.TrimPrefix(raw, " ")
-	raw = strings.TrimSuffix(raw, " ")
-	raw = strings.TrimPrefix(raw, ",")
-	raw = strings.TrimSuffix(raw, ",")
 
-	if strings.Contains(raw, ",") {
-		rawSlice := strings.Split(raw, ",")
-		route.uris = make([]*Uri, 0, len(rawSlice))
-		for _, raws := range rawSlice {
-			raws = regexp.MustCompile(`<`).ReplaceAllString(raws, "")
-			raws = regexp.MustCompile(`>`).ReplaceAllString(raws, "")
-			uri := new(Uri)
-			if err := uri.Parse(raws); err != nil {
-				return err
-			}
-			route.uris = append(route.uris, uri)
+	*route = Route{}
+	for i, value := range splitValues(raw) {
+		address := new(Address)
+		if err := address.Parse(value); err != nil {
+			return fmt.Errorf("route address error : %s", err.Error())
 		}
-
-	} else {
-		raw = regexp.MustCompile(`<`).ReplaceAllString(raw, "")
-		raw = regexp.MustCompile(`>`).ReplaceAllString(raw, "")
-		route.uris = make([]*Uri, 0, 1)
-		uri := new(Uri)
-		if err := uri.Parse(raw); err != nil {
-			return err
+		if i == 0 {
+			route.displayName = address.GetDisplayName()
+			route.parameters = address.GetParameters()
 		}
-		route.uris = append(route.uris, uri)
+		route.uris = append(route.uris, address.GetUri())
 	}
-
 	return route.Validator()
 }
 func (route *Route) Validator() error {
@@ -133,27 +93,26 @@ func (route *Route) Validator() error {
 	if len(route.uris) == 0 {
 		return errors.New("the uris field must has one uri")
 	}
+	for i, uri := range route.uris {
+		address := NewAddress("", uri, nil)
+		if i == 0 {
+			address = NewAddress(route.displayName, uri, route.parameters)
+		}
+		if err := address.Validator(); err != nil {
+			return fmt.Errorf("route address validator error : %s", err.Error())
+		}
+	}
 	return nil
 }
 
 func (route *Route) String() string {
 	result := ""
-	if len(strings.TrimSpace(route.displayName)) > 0 {
-		result += fmt.Sprintf("\"%s\"", route.displayName)
-		if !reflect.DeepEqual(nil, route.uris) {
-			for _, uri := range route.uris {
-				result += fmt.Sprintf("%s,", uri.String())
-			}
-			result = strings.TrimSuffix(result, ",")
-		}
-	} else {
-		if !reflect.DeepEqual(nil, route.uris) {
-			for _, uri := range route.uris {
-				result += fmt.Sprintf("<%s>,", uri.String())
-			}
-			result = strings.TrimSuffix(result, ",")
+	for i, uri := range route.uris {
+		if i == 0 {
+			result += NewAddress(route.displayName, uri, route.parameters).String()
+		} else {
+			result += fmt.Sprintf(", %s", NewAddress("", uri, nil).String())
 		}
 	}
-
 	return result
 }
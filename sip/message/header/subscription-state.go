@@ -0,0 +1,143 @@
+package header
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Subscription states of RFC 3265 3.2.4.
+const (
+	SubscriptionStateActive     = "active"
+	SubscriptionStatePending    = "pending"
+	SubscriptionStateTerminated = "terminated"
+)
+
+type SubscriptionState struct {
+	state      string // substate-value
+	expires    uint   // expires parameter, 0 if absent
+	reason     string // reason parameter of terminated
+	retryAfter uint   // retry-after parameter, 0 if absent
+}
+
+func (subscriptionState *SubscriptionState) SetState(state string) {
+	subscriptionState.state = state
+}
+func (subscriptionState *SubscriptionState) GetState() string {
+	return subscriptionState.state
+}
+func (subscriptionState *SubscriptionState) SetExpires(expires uint) {
+	subscriptionState.expires = expires
+}
+func (subscriptionState *SubscriptionState) GetExpires() uint {
+	return subscriptionState.expires
+}
+func (subscriptionState *SubscriptionState) SetReason(reason string) {
+	subscriptionState.reason = reason
+}
+func (subscriptionState *SubscriptionState) GetReason() string {
+	return subscriptionState.reason
+}
+func (subscriptionState *SubscriptionState) SetRetryAfter(retryAfter uint) {
+	subscriptionState.retryAfter = retryAfter
+}
+func (subscriptionState *SubscriptionState) GetRetryAfter() uint {
+	return subscriptionState.retryAfter
+}
+func NewSubscriptionState(state string, expires uint, reason string) *SubscriptionState {
+	return &SubscriptionState{
+		state:   state,
+		expires: expires,
+		reason:  reason,
+	}
+}
+
+// IsTerminated reports whether the state is terminated.
+func (subscriptionState *SubscriptionState) IsTerminated() bool {
+	return strings.EqualFold(subscriptionState.state, SubscriptionStateTerminated)
+}
+
+func (subscriptionState *SubscriptionState) Raw() (string, error) {
+	result := ""
+	if err := subscriptionState.Validator(); err != nil {
+		return result, err
+	}
+	result += fmt.Sprintf("Subscription-State: %s", subscriptionState.String())
+	result += "\r\n"
+	return result, nil
+}
+func (subscriptionState *SubscriptionState) Parse(raw string) error {
+	if reflect.DeepEqual(nil, subscriptionState) {
+		return errors.New("subscription-state caller is not allowed to be nil")
+	}
+	raw = regexp.MustCompile(`\r`).ReplaceAllString(raw, "")
+	raw = regexp.MustCompile(`\n`).ReplaceAllString(raw, "")
+	raw = strings.TrimPrefix(raw, " ")
+	raw = strings.TrimSuffix(raw, " ")
+	if len(strings.TrimSpace(raw)) == 0 {
+		return errors.New("the raw parameter is not allowed to be empty")
+	}
+	// subscription-state field regexp
+	fieldRegexp := regexp.MustCompile(`^(?i)(subscription-state)\s*:`)
+	if !fieldRegexp.MatchString(raw) {
+		return errors.New("raw is not a subscription-state header field")
+	}
+	raw = fieldRegexp.ReplaceAllString(raw, "")
+	params := strings.Split(raw, ";")
+	subscriptionState.state = strings.ToLower(strings.TrimSpace(params[0]))
+	subscriptionState.expires = 0
+	subscriptionState.reason = ""
+	subscriptionState.retryAfter = 0
+	for _, param := range params[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "expires":
+			expires, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return fmt.Errorf("the expires parameter is not a number : %s", err.Error())
+			}
+			subscriptionState.expires = uint(expires)
+		case "retry-after":
+			retryAfter, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return fmt.Errorf("the retry-after parameter is not a number : %s", err.Error())
+			}
+			subscriptionState.retryAfter = uint(retryAfter)
+		case "reason":
+			subscriptionState.reason = value
+		}
+	}
+	return subscriptionState.Validator()
+}
+func (subscriptionState *SubscriptionState) Validator() error {
+	if reflect.DeepEqual(nil, subscriptionState) {
+		return errors.New("subscription-state caller is not allowed to be nil")
+	}
+	if len(strings.TrimSpace(subscriptionState.state)) == 0 {
+		return errors.New("the substate-value field is not allowed to be empty")
+	}
+	if strings.ContainsAny(subscriptionState.state, " ;,") {
+		return errors.New("the substate-value field is not a token")
+	}
+	return nil
+}
+func (subscriptionState *SubscriptionState) String() string {
+	result := subscriptionState.state
+	if len(strings.TrimSpace(subscriptionState.reason)) > 0 {
+		result += fmt.Sprintf(";reason=%s", subscriptionState.reason)
+	}
+	if subscriptionState.expires > 0 {
+		result += fmt.Sprintf(";expires=%d", subscriptionState.expires)
+	}
+	if subscriptionState.retryAfter > 0 {
+		result += fmt.Sprintf(";retry-after=%d", subscriptionState.retryAfter)
+	}
+	return result
+}
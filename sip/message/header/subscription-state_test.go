@@ -0,0 +1,46 @@
+package header
+
+import (
+	"testing"
+)
+
+func TestSubscriptionState_Raw(t *testing.T) {
+	raw, err := NewSubscriptionState(SubscriptionStateActive, 3600, "").Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != "Subscription-State: active;expires=3600\r\n" {
+		t.Fatalf("unexpected raw %q", raw)
+	}
+	raw, _ = NewSubscriptionState(SubscriptionStateTerminated, 0, "timeout").Raw()
+	if raw != "Subscription-State: terminated;reason=timeout\r\n" {
+		t.Fatalf("unexpected raw %q", raw)
+	}
+}
+
+func TestSubscriptionState_Parse(t *testing.T) {
+	subscriptionState := new(SubscriptionState)
+	if err := subscriptionState.Parse("Subscription-State: Terminated; reason=rejected;retry-after=30\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if !subscriptionState.IsTerminated() || subscriptionState.GetReason() != "rejected" || subscriptionState.GetRetryAfter() != 30 {
+		t.Fatalf("unexpected state %s", subscriptionState)
+	}
+	if err := subscriptionState.Parse("Subscription-State: active;expires=x"); err == nil {
+		t.Fatal("expected an error for a bad expires")
+	}
+}
+
+func TestAllowEvents_Parse(t *testing.T) {
+	allowEvents := new(AllowEvents)
+	if err := allowEvents.Parse("u: presence,Catalog , message-summary"); err != nil {
+		t.Fatal(err)
+	}
+	if len(allowEvents.GetEvents()) != 3 || !allowEvents.Allows("catalog") || allowEvents.Allows("dialog") {
+		t.Fatalf("unexpected events %v", allowEvents.GetEvents())
+	}
+	raw, _ := allowEvents.Raw()
+	if raw != "Allow-Events: presence, Catalog, message-summary\r\n" {
+		t.Fatalf("unexpected raw %q", raw)
+	}
+}
@@ -6,12 +6,15 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+
+	"github.com/kokutas/gb28181/sip/lib"
 )
 
 type To struct {
-	displayName string // display-name
-	address     *Uri   // SIP to Address
-	tag         string // SIP to Tag
+	displayName string         // display-name
+	address     *Uri           // SIP to Address
+	tag         string         // SIP to Tag
+	parameters  lib.Parameters // the parameters besides the tag
 }
 
 func (to *To) SetDisplayName(displayName string) {
@@ -32,6 +35,12 @@ func (to *To) SetTag(tag string) {
 func (to *To) GetTag() string {
 	return to.tag
 }
+func (to *To) SetParameters(parameters lib.Parameters) {
+	to.parameters = parameters
+}
+func (to *To) GetParameters() lib.Parameters {
+	return to.parameters
+}
 
 func NewTo(displayName string, address *Uri, tag string) *To {
 	return &To{
@@ -45,18 +54,7 @@ func (to *To) Raw() (string, error) {
 	if err := to.Validator(); err != nil {
 		return result, err
 	}
-	address, err := to.address.Raw()
-	if err != nil {
-		return result, err
-	}
-	if len(strings.TrimSpace(to.displayName)) == 0 {
-		result += fmt.Sprintf("To: <%s>", address)
-	} else {
-		result += fmt.Sprintf("To: \"%s\" %s", to.displayName, address)
-	}
-	if len(strings.TrimSpace(to.tag)) > 0 {
-		result += fmt.Sprintf(";tag=%s", to.tag)
-	}
+	result += fmt.Sprintf("To: %s", to.String())
 	result += "\r\n"
 	return result, nil
 }
@@ -72,79 +70,36 @@ func (to *To) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// to field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(to).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(to|t)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a to header field")
 	}
 	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = strings.TrimPrefix(raw, " ")
-	raw = strings.TrimSuffix(raw, " ")
-	// address and tag regexp
-	addressAndTagRegexp := regexp.MustCompile(`(?i)(sip).*?:.*`)
-	// tag regexp
-	tagRegexp := regexp.MustCompile(`(?i)(tag)=.*`)
-	// display-name
-	displayNameStr := addressAndTagRegexp.ReplaceAllString(raw, "")
-	displayNameStr = regexp.MustCompile(`<`).ReplaceAllString(displayNameStr, "")
-	displayNameStr = regexp.MustCompile(`>`).ReplaceAllString(displayNameStr, "")
-	displayNameStr = regexp.MustCompile(`"`).ReplaceAllString(displayNameStr, "")
-	displayNameStr = strings.TrimPrefix(displayNameStr, " ")
-	displayNameStr = strings.TrimSuffix(displayNameStr, " ")
-	if len(strings.TrimSpace(displayNameStr)) > 0 {
-		to.displayName = displayNameStr
+	address := new(Address)
+	if err := address.Parse(raw); err != nil {
+		return fmt.Errorf("to address error : %s", err.Error())
 	}
-	if addressAndTagRegexp.MatchString(raw) {
-		addressAndTag := addressAndTagRegexp.FindString(raw)
-		if tagRegexp.MatchString(addressAndTag) {
-			to.tag = regexp.MustCompile(`(?i)(tag)=`).ReplaceAllString(tagRegexp.FindString(addressAndTag), "")
-			addressAndTag = tagRegexp.ReplaceAllString(addressAndTag, "")
-		}
-		addressAndTag = regexp.MustCompile(`<`).ReplaceAllString(addressAndTag, "")
-		addressAndTag = regexp.MustCompile(`>`).ReplaceAllString(addressAndTag, "")
-		addressAndTag = strings.TrimPrefix(addressAndTag, ";")
-		addressAndTag = strings.TrimSuffix(addressAndTag, ";")
-		addressAndTag = strings.TrimPrefix(addressAndTag, " ")
-		addressAndTag = strings.TrimSuffix(addressAndTag, " ")
-		to.address = new(Uri)
-		if err := to.address.Parse(addressAndTag); err != nil {
-			return err
-		}
-	}
-
+	to.displayName = address.GetDisplayName()
+	to.address = address.GetUri()
+	parameters := address.GetParameters()
+	to.tag, _ = parameters.Get("tag")
+	parameters.Del("tag")
+	to.parameters = parameters
 	return to.Validator()
 }
 func (to *To) Validator() error {
 	if reflect.DeepEqual(nil, to) {
 		return errors.New("to caller is not allowed to be nil")
 	}
-	if err := to.address.Validator(); err != nil {
+	if err := NewAddress(to.displayName, to.address, to.parameters).Validator(); err != nil {
 		return fmt.Errorf("to address validator error : %s", err.Error())
 	}
 	return nil
 }
 func (to *To) String() string {
-	result := ""
-	if len(strings.TrimSpace(to.displayName)) > 0 {
-		result += fmt.Sprintf(" \"%s\"", to.displayName)
-		if !reflect.DeepEqual(nil, to.address) {
-			if len(result) > 0 {
-				result += fmt.Sprintf(" %s", to.address.String())
-			}
-		}
-	} else {
-		if !reflect.DeepEqual(nil, to.address) {
-			if len(result) > 0 {
-				result += fmt.Sprintf("<%s>", to.address.String())
-			}
-		}
-	}
-
+	parameters := make(lib.Parameters, 0, len(to.parameters)+1)
 	if len(strings.TrimSpace(to.tag)) > 0 {
-		if len(result) > 0 {
-			result += fmt.Sprintf(";tag=%s", to.tag)
-		} else {
-			result += fmt.Sprintf("tag=%s", to.tag)
-		}
+		parameters = append(parameters, lib.NewParameter("tag", to.tag))
 	}
-	return result
+	return NewAddress(to.displayName, to.address, append(parameters, to.parameters...)).String()
 }
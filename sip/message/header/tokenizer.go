@@ -0,0 +1,128 @@
+package header
+
+import (
+	"strings"
+)
+
+// compactForms maps the compact forms of RFC 3261 7.3.3 and of the
+// extensions registered with IANA to the field names.
+var compactForms = map[string]string{
+	"a": "Accept-Contact",
+	"b": "Referred-By",
+	"c": "Content-Type",
+	"d": "Request-Disposition",
+	"e": "Content-Encoding",
+	"f": "From",
+	"i": "Call-ID",
+	"j": "Reject-Contact",
+	"k": "Supported",
+	"l": "Content-Length",
+	"m": "Contact",
+	"n": "Identity-Info",
+	"o": "Event",
+	"r": "Refer-To",
+	"s": "Subject",
+	"t": "To",
+	"u": "Allow-Events",
+	"v": "Via",
+	"x": "Session-Expires",
+	"y": "Identity",
+}
+
+// CanonicalName returns the field name of a compact form, and the name
+// itself otherwise. Field names are compared case-insensitively.
+func CanonicalName(name string) string {
+	name = strings.TrimSpace(name)
+	if long, ok := compactForms[strings.ToLower(name)]; ok {
+		return long
+	}
+	return name
+}
+
+// listFields are the fields without a typed value whose value is a
+// comma-separated list (RFC 3261 20), keyed by lower-case name.
+var listFields = map[string]bool{
+	"accept":           true,
+	"accept-encoding":  true,
+	"accept-language":  true,
+	"allow":            true,
+	"allow-events":     true,
+	"content-encoding": true,
+	"content-language": true,
+	"in-reply-to":      true,
+	"proxy-require":    true,
+	"record-route":     true,
+	"require":          true,
+	"supported":        true,
+	"unsupported":      true,
+	"warning":          true,
+}
+
+// isList tells whether a field name, maybe compact, is a list field.
+func isList(name string) bool {
+	return listFields[strings.ToLower(CanonicalName(name))]
+}
+
+// sameName tells whether two field names, either maybe compact, are the
+// same field.
+func sameName(name, other string) bool {
+	return strings.EqualFold(CanonicalName(name), CanonicalName(other))
+}
+
+// unfold splits header fields into lines, joining a line that starts with
+// a blank to the previous one by a single space (RFC 3261 7.3.1).
+func unfold(raw string) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] = strings.TrimRight(lines[len(lines)-1], " \t") + " " + strings.TrimLeft(line, " \t")
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// splitField cuts a header field line into its name and value, trimming
+// the blanks around both; ok is false when the line has no colon.
+func splitField(line string) (name, value string, ok bool) {
+	index := strings.Index(line, ":")
+	if index < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(line[:index]), strings.TrimSpace(line[index+1:]), true
+}
+
+// splitValues splits a field value made of comma-separated values (RFC
+// 3261 7.3.1), leaving the commas of quoted strings and of URIs between
+// angle brackets alone. Empty values are dropped.
+func splitValues(value string) []string {
+	values := make([]string, 0, 1)
+	quoted, escaped, bracketed := false, false, false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '<':
+			bracketed = true
+		case c == '>':
+			bracketed = false
+		case c == ',' && !bracketed:
+			if part := strings.TrimSpace(value[start:i]); len(part) > 0 {
+				values = append(values, part)
+			}
+			start = i + 1
+		}
+	}
+	if part := strings.TrimSpace(value[start:]); len(part) > 0 {
+		values = append(values, part)
+	}
+	return values
+}
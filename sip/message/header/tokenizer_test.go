@@ -0,0 +1,50 @@
+package header
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"v": "Via", "I": "Call-ID", "m": "Contact", " l ": "Content-Length", "Subject": "Subject", "X-Vendor": "X-Vendor",
+	} {
+		if canonical := CanonicalName(name); canonical != expected {
+			t.Fatalf("unexpected name %q of %q", canonical, name)
+		}
+	}
+	if !sameName("s", "SUBJECT") || sameName("to", "t-o") {
+		t.Fatal("unexpected name comparison")
+	}
+}
+
+func TestUnfold(t *testing.T) {
+	lines := unfold("Subject: I know you're there,\r\n   pick up the phone\r\n\tand talk to me!\r\nTo: <sip:a@b>\r\n")
+	expected := []string{"Subject: I know you're there, pick up the phone and talk to me!", "To: <sip:a@b>", ""}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+}
+
+func TestSplitField(t *testing.T) {
+	name, value, ok := splitField("Via  :  SIP/2.0/UDP 192.168.1.2:5060")
+	if !ok || name != "Via" || value != "SIP/2.0/UDP 192.168.1.2:5060" {
+		t.Fatalf("unexpected field %q %q %v", name, value, ok)
+	}
+	if _, _, ok := splitField("no colon"); ok {
+		t.Fatal("expected no field")
+	}
+}
+
+func TestSplitValues(t *testing.T) {
+	for value, expected := range map[string][]string{
+		"SIP/2.0/UDP a:5060;branch=z9hG4bK1, SIP/2.0/TCP b": {"SIP/2.0/UDP a:5060;branch=z9hG4bK1", "SIP/2.0/TCP b"},
+		`"Doe, John" <sip:a@b;x=1,2>;expires=60 ,<sip:c@d>`: {`"Doe, John" <sip:a@b;x=1,2>;expires=60`, "<sip:c@d>"},
+		`"a \", b" <sip:a@b>, , `:                           {`"a \", b" <sip:a@b>`},
+		"":                                                  {},
+	} {
+		if values := splitValues(value); !reflect.DeepEqual(values, expected) {
+			t.Fatalf("unexpected values %q of %q", values, value)
+		}
+	}
+}
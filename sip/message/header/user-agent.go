@@ -45,7 +45,7 @@ func (userAgent *UserAgent) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// user-agent field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(user-agent).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(user-agent)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a user-agent header field")
 	}
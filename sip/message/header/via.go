@@ -8,17 +8,22 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/kokutas/gb28181/sip/lib"
 )
 
+// DefaultSipPort is the port of a sent-by without one (RFC 3261 18.2.2).
+const DefaultSipPort = 5060
+
+// Via is a Via header field value. Its parameters, branch, rport and
+// received as well as the others, are kept in the order they are written.
 type Via struct {
-	schema        string  // schema
-	version       float64 // version
-	transport     string  // transport
-	sentByAddress string  // Sent-by Address
-	sentByPort    uint16  // Sent-by port
-	rport         uint16  // rport
-	branch        string  // branch
-	received      string  // received
+	schema        string         // schema
+	version       float64        // version
+	transport     string         // transport
+	sentByAddress string         // Sent-by Address
+	sentByPort    uint16         // Sent-by port, 0 when absent
+	parameters    lib.Parameters // via parameters
 }
 
 func (via *Via) SetSchema(schema string) {
@@ -52,54 +57,104 @@ func (via *Via) SetSentByPort(sentByPort uint16) {
 func (via *Via) GetSentByPort() uint16 {
 	return via.sentByPort
 }
+
+// GetSentBy returns the sent-by host:port, the port defaulting to 5060
+// when absent (RFC 3261 18.2.2).
+func (via *Via) GetSentBy() string {
+	port := via.sentByPort
+	if port == 0 {
+		port = DefaultSipPort
+	}
+	return net.JoinHostPort(strings.Trim(via.sentByAddress, "[]"), strconv.Itoa(int(port)))
+}
+
+// SetRPort sets the rport parameter: 0 removes it, 1 writes it without a
+// value, as a request asks for it.
 func (via *Via) SetRPort(rPort uint16) {
-	via.rport = rPort
+	switch rPort {
+	case 0:
+		via.parameters.Del("rport")
+	case 1:
+		via.parameters.Set("rport", "")
+	default:
+		via.parameters.Set("rport", strconv.Itoa(int(rPort)))
+	}
 }
 func (via *Via) GetRPort() uint16 {
-	return via.rport
+	value, ok := via.parameters.Get("rport")
+	if !ok {
+		return 0
+	}
+	if len(value) == 0 {
+		return 1
+	}
+	rport, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(rport)
 }
 func (via *Via) SetBranch(branch string) {
-	via.branch = branch
+	via.setParameter("branch", branch)
 }
 func (via *Via) GetBranch() string {
-	return via.branch
+	branch, _ := via.parameters.Get("branch")
+	return branch
 }
 func (via *Via) SetReceived(received string) {
-	via.received = received
+	via.setParameter("received", received)
 }
 func (via *Via) GetReceived() string {
-	return via.received
+	received, _ := via.parameters.Get("received")
+	return received
 }
+func (via *Via) SetParameters(parameters lib.Parameters) {
+	via.parameters = parameters
+}
+func (via *Via) GetParameters() lib.Parameters {
+	return via.parameters
+}
+
+// Clone copies the via with its parameters.
+func (via *Via) Clone() *Via {
+	cloned := *via
+	cloned.parameters = via.parameters.Clone()
+	return &cloned
+}
+
+// setParameter sets a valued parameter, removing it when value is empty.
+func (via *Via) setParameter(name, value string) {
+	if len(value) == 0 {
+		via.parameters.Del(name)
+		return
+	}
+	via.parameters.Set(name, value)
+}
+
 func NewVia(schema string, version float64, transport string, sentByAddress string, sentByPort uint16, rPort uint16, branch string, received string) *Via {
-	return &Via{
+	via := &Via{
 		schema:        schema,
 		version:       version,
 		transport:     transport,
 		sentByAddress: sentByAddress,
 		sentByPort:    sentByPort,
-		rport:         rPort,
-		branch:        branch,
-		received:      received,
+		parameters:    make(lib.Parameters, 0, 3),
 	}
+	via.SetRPort(rPort)
+	via.SetBranch(branch)
+	via.SetReceived(received)
+	return via
 }
 func (via *Via) Raw() (string, error) {
 	result := ""
 	if err := via.Validator(); err != nil {
 		return result, err
 	}
-	result += fmt.Sprintf("Via: %s/%1.1f/%s", strings.ToUpper(via.schema), via.version, strings.ToUpper(via.transport))
-	if ip := net.ParseIP(via.sentByAddress); ip != nil {
-		result += fmt.Sprintf(" %s:%d", via.sentByAddress, via.sentByPort)
-	} else {
-		result += fmt.Sprintf(" %s", via.sentByAddress)
-	}
-	if via.rport == 1 {
-		result += fmt.Sprintf(";%s;branch=%s", "rport", via.branch)
-	} else if via.rport > 1 {
-		result += fmt.Sprintf(";rport=%d;branch=%s;received=%s", via.rport, via.branch, via.received)
-	} else {
-		result += fmt.Sprintf(";branch=%s", via.branch)
+	result += fmt.Sprintf("Via: %s/%1.1f/%s %s", strings.ToUpper(via.schema), via.version, strings.ToUpper(via.transport), via.sentByAddress)
+	if via.sentByPort > 0 {
+		result += fmt.Sprintf(":%d", via.sentByPort)
 	}
+	result += formatHeaderParameters(via.parameters)
 	result += "\r\n"
 	return result, nil
 }
@@ -115,102 +170,51 @@ func (via *Via) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// via field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(via).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(via|v)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a via header field")
 	}
 	raw = fieldRegexp.ReplaceAllString(raw, "")
-	raw = strings.TrimPrefix(raw, " ")
-	raw = strings.TrimSuffix(raw, " ")
-	// schema/version/transport regexp
-	schemaAndVersionAndTransportRegexp := regexp.MustCompile(`(?i)(sip)/2\.0/(?i)(udp|tcp) `)
-	if !schemaAndVersionAndTransportRegexp.MatchString(raw) {
+	raw = strings.TrimSpace(raw)
+	// sent-protocol: schema/version/transport
+	protocolRegexp := regexp.MustCompile(`^(?i)(sip)\s*/\s*(2\.0)\s*/\s*(udp|tcp)\s+`)
+	protocol := protocolRegexp.FindStringSubmatch(raw)
+	if protocol == nil {
 		return errors.New("the values of the schema, version and transport fields cannot match")
 	}
-	// schema regexp
-	schemaRegexp := regexp.MustCompile(`(?i)(sip)`)
-	if !schemaRegexp.MatchString(schemaAndVersionAndTransportRegexp.FindString(raw)) {
-		return errors.New("the values of the schema field cannot match")
-	}
-	via.schema = strings.ToUpper(schemaRegexp.FindString(schemaAndVersionAndTransportRegexp.FindString(raw)))
-	// version regexp
-	versionRegexp := regexp.MustCompile(`2\.0`)
-	if !versionRegexp.MatchString(schemaAndVersionAndTransportRegexp.FindString(raw)) {
-		return errors.New("the value of the version field cannot match")
-	}
-	versionStr := versionRegexp.FindString(schemaAndVersionAndTransportRegexp.FindString(raw))
-	version, err := strconv.ParseFloat(versionStr, 64)
+	via.schema = strings.ToUpper(protocol[1])
+	version, err := strconv.ParseFloat(protocol[2], 64)
 	if err != nil {
 		return err
 	}
 	via.version = version
-	// transport regexp
-	transportRegexp := regexp.MustCompile(`(?i)(udp|tcp)`)
-	if !transportRegexp.MatchString(schemaAndVersionAndTransportRegexp.FindString(raw)) {
-		return errors.New("the value of the transport field cannot match")
+	via.transport = strings.ToUpper(protocol[3])
+	raw = raw[len(protocol[0]):]
+	// sent-by, up to the parameters
+	sentBy, rest := raw, ""
+	if index := strings.Index(raw, ";"); index >= 0 {
+		sentBy, rest = raw[:index], raw[index:]
 	}
-	via.transport = strings.ToUpper(transportRegexp.FindString(schemaAndVersionAndTransportRegexp.FindString(raw)))
-	raw = schemaAndVersionAndTransportRegexp.ReplaceAllString(raw, "")
-	raw = strings.TrimPrefix(raw, " ")
-	raw = strings.TrimSuffix(raw, " ")
-	if len(strings.TrimSpace(raw)) == 0 {
+	sentBy = strings.TrimSpace(sentBy)
+	if len(sentBy) == 0 {
 		return errors.New("the sent-by data cannot be parsed")
 	}
-	raw = strings.TrimPrefix(raw, ";")
-	raw = strings.TrimSuffix(raw, ";")
-	raw = strings.TrimPrefix(raw, " ")
-	raw = strings.TrimSuffix(raw, " ")
-	// port regexp
-	portRegexp := regexp.MustCompile(`:\d+`)
-	// response port regexp
-	rPortRegexp := regexp.MustCompile(`(?i)(rport).*`)
-	// branch regexp
-	branchRegexp := regexp.MustCompile(`(?i)(branch).*`)
-	// received regexp
-	receivedRegexp := regexp.MustCompile(`(?i)(received).*`)
-	rawSlice := strings.Split(raw, ";")
-	for v, raws := range rawSlice {
-		// sent-by address and port
-		if v == 0 {
-			if portRegexp.MatchString(raws) {
-				ports := portRegexp.FindString(raws)
-				ports = regexp.MustCompile(`:`).ReplaceAllString(ports, "")
-				port, err := strconv.Atoi(ports)
-				if err != nil {
-					return err
-				}
-				via.sentByPort = uint16(port)
-			}
-			via.sentByAddress = portRegexp.ReplaceAllString(raws, "")
-			continue
+	via.sentByAddress, via.sentByPort = sentBy, 0
+	if index := strings.LastIndex(sentBy, ":"); index >= 0 && index > strings.LastIndex(sentBy, "]") {
+		port, err := strconv.ParseUint(strings.TrimSpace(sentBy[index+1:]), 10, 16)
+		if err != nil {
+			return fmt.Errorf("the sent-by port of %q error : %s", sentBy, err.Error())
 		}
-		switch {
-		// response port
-		case rPortRegexp.MatchString(raws):
-			rPorts := regexp.MustCompile(`(?i)(rport)`).ReplaceAllString(rPortRegexp.FindString(raws), "")
-			rPorts = regexp.MustCompile(`=`).ReplaceAllString(rPorts, "")
-			if len(strings.TrimSpace(rPorts)) == 0 {
-				via.rport = 1
-			} else {
-				rport, err := strconv.Atoi(rPorts)
-				if err != nil {
-					return err
-				}
-				via.rport = uint16(rport)
-			}
-		// branch
-		case branchRegexp.MatchString(raws):
-			branchs := regexp.MustCompile(`(?i)(branch)`).ReplaceAllString(branchRegexp.FindString(raws), "")
-			via.branch = regexp.MustCompile(`=`).ReplaceAllString(branchs, "")
-		// received
-		case receivedRegexp.MatchString(raws):
-			receivedStr := regexp.MustCompile(`(?i)(received)`).ReplaceAllString(receivedRegexp.FindString(raws), "")
-			via.received = regexp.MustCompile(`=`).ReplaceAllString(receivedStr, "")
-		default:
-			// other
-			if strings.Contains(raws, "=") {
-				fmt.Println(raws)
-			}
+		via.sentByAddress, via.sentByPort = strings.TrimSpace(sentBy[:index]), uint16(port)
+	}
+	parameters, err := parseHeaderParameters(rest)
+	if err != nil {
+		return fmt.Errorf("the parameters of %q error : %s", raw, err.Error())
+	}
+	via.parameters = parameters
+	if value, ok := via.parameters.Get("rport"); ok && len(value) > 0 {
+		if _, err := strconv.ParseUint(value, 10, 16); err != nil {
+			return fmt.Errorf("the rport %q error : %s", value, err.Error())
 		}
 	}
 	return via.Validator()
@@ -237,17 +241,12 @@ func (via *Via) Validator() error {
 	if len(strings.TrimSpace(via.sentByAddress)) == 0 {
 		return errors.New("the sent-by address field is not allowed to be empty")
 	}
-	if ip := net.ParseIP(via.sentByAddress); ip != nil {
-		if via.sentByPort == 0 {
-			return errors.New("the sent-by address field gives the ip address, the sent-by port must be given")
-		}
-	}
-	if via.rport > 1 {
-		if len(strings.TrimSpace(via.received)) == 0 {
+	if via.GetRPort() > 1 {
+		if len(strings.TrimSpace(via.GetReceived())) == 0 {
 			return errors.New("the rport field gives the response port value, the receive must be given")
 		}
 	}
-	if len(strings.TrimSpace(via.branch)) == 0 {
+	if len(strings.TrimSpace(via.GetBranch())) == 0 {
 		return errors.New("the branch field is not allowed to be empty")
 	}
 	return nil
@@ -269,16 +268,6 @@ func (via *Via) String() string {
 	if via.sentByPort > 0 {
 		result += fmt.Sprintf(":%d", via.sentByPort)
 	}
-	if via.rport == 1 {
-		result += ";rport"
-	} else if via.rport > 1 {
-		result += fmt.Sprintf(";rport=%d", via.rport)
-	}
-	if len(strings.TrimSpace(via.branch)) > 0 {
-		result += fmt.Sprintf(";branch=%s", via.branch)
-	}
-	if len(strings.TrimSpace(via.received)) > 0 {
-		result += fmt.Sprintf(";received=%s", via.received)
-	}
+	result += formatHeaderParameters(via.parameters)
 	return result
 }
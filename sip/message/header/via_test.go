@@ -44,3 +44,29 @@ func TestVia_Parse(t *testing.T) {
 
 	}
 }
+
+func TestVia_Parameters(t *testing.T) {
+	via := new(Via)
+	if err := via.Parse("Via: SIP/2.0/UDP 192.168.0.1;branch=z9hG4bK776;x-foo=bar;rport=5062;received=10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if via.GetSentByPort() != 0 || via.GetSentBy() != "192.168.0.1:5060" || via.GetBranch() != "z9hG4bK776" ||
+		via.GetRPort() != 5062 || via.GetReceived() != "10.0.0.1" {
+		t.Fatalf("unexpected via %s", via.String())
+	}
+	if value, ok := via.GetParameters().Get("x-foo"); !ok || value != "bar" {
+		t.Fatalf("unexpected parameters %s", via.String())
+	}
+	raw, err := via.Raw()
+	if err != nil || raw != "Via: SIP/2.0/UDP 192.168.0.1;branch=z9hG4bK776;x-foo=bar;rport=5062;received=10.0.0.1\r\n" {
+		t.Fatalf("unexpected raw %q %v", raw, err)
+	}
+	via.SetRPort(0)
+	via.SetReceived("")
+	if raw, _ := via.Raw(); raw != "Via: SIP/2.0/UDP 192.168.0.1;branch=z9hG4bK776;x-foo=bar\r\n" {
+		t.Fatalf("unexpected raw %q", raw)
+	}
+	if err := via.Parse("Via: SIP/2.0/TCP [2001:db8::1]:5070;branch=z9hG4bK1"); err != nil || via.GetSentBy() != "[2001:db8::1]:5070" {
+		t.Fatalf("unexpected via %s %v", via.String(), err)
+	}
+}
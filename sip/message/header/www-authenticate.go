@@ -72,7 +72,7 @@ func (wwwAuthenticate *WWWAuthenticate) Parse(raw string) error {
 		return errors.New("the raw parameter is not allowed to be empty")
 	}
 	// www-authenticate field regexp
-	fieldRegexp := regexp.MustCompile(`(?i)(www-authenticate).*?:`)
+	fieldRegexp := regexp.MustCompile(`^(?i)(www-authenticate)\s*:`)
 	if !fieldRegexp.MatchString(raw) {
 		return errors.New("raw is not a www-authenticate header field")
 	}
@@ -100,11 +100,11 @@ func (wwwAuthenticate *WWWAuthenticate) Parse(raw string) error {
 	for _, raws := range rawSlice {
 		switch {
 		case realmRegexp.MatchString(raws):
-			wwwAuthenticate.realm = realmRegexp.ReplaceAllString(raws, "")
+			wwwAuthenticate.realm = unquote(realmRegexp.ReplaceAllString(raws, ""))
 		case nonceRegexp.MatchString(raws):
-			wwwAuthenticate.nonce = nonceRegexp.ReplaceAllString(raws, "")
+			wwwAuthenticate.nonce = unquote(nonceRegexp.ReplaceAllString(raws, ""))
 		case algorithmRegexp.MatchString(raws):
-			wwwAuthenticate.algorithm = algorithmRegexp.ReplaceAllString(raws, "")
+			wwwAuthenticate.algorithm = unquote(algorithmRegexp.ReplaceAllString(raws, ""))
 		}
 	}
 	return wwwAuthenticate.Validator()
@@ -0,0 +1,149 @@
+package message
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kokutas/gb28181/sip/message/header"
+)
+
+// MaxMessageSize bounds a message read from a stream transport.
+const MaxMessageSize = 65535
+
+// Message is a SIP request or response.
+type Message interface {
+	GetHeader() *header.Header
+	GetBody() []byte
+	Raw() (string, error)
+	String() string
+}
+
+// Parse parses a request or a response, telling them apart by the start
+// line.
+func Parse(raw []byte) (Message, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, errors.New("the raw parameter is not allowed to be empty")
+	}
+	raw = bytes.TrimLeft(raw, "\r\n")
+	if regexp.MustCompile(`^(?i)(sip)/`).Match(raw) {
+		response := new(Response)
+		if err := response.Parse(string(raw)); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+	request := new(Request)
+	if err := request.Parse(string(raw)); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// split cuts a message into its start line, header fields and body. The
+// body is cut to the Content-Length when the header gives one.
+func split(raw string) (string, string, []byte, error) {
+	raw = strings.TrimLeft(raw, "\r\n")
+	index := strings.Index(raw, "\r\n\r\n")
+	separator := 4
+	if index < 0 {
+		index = strings.Index(raw, "\n\n")
+		separator = 2
+	}
+	head, body := raw, ""
+	if index >= 0 {
+		head, body = raw[:index], raw[index+separator:]
+	}
+	lines := strings.SplitN(head, "\n", 2)
+	if len(lines) < 2 {
+		return "", "", nil, errors.New("the message has no header fields")
+	}
+	length, ok := contentLength(lines[1])
+	if ok {
+		if length > len(body) {
+			return "", "", nil, fmt.Errorf("the body is %d bytes, content-length is %d", len(body), length)
+		}
+		body = body[:length]
+	}
+	return strings.TrimSuffix(lines[0], "\r"), lines[1], []byte(body), nil
+}
+
+var contentLengthRegexp = regexp.MustCompile(`(?im)^(content-length|l)\s*:\s*(\d+)`)
+
+func contentLength(head string) (int, bool) {
+	match := contentLengthRegexp.FindStringSubmatch(head)
+	if match == nil {
+		return 0, false
+	}
+	length, err := strconv.Atoi(match[2])
+	if err != nil {
+		return 0, false
+	}
+	return length, true
+}
+
+// ReadMessage reads one message from a stream transport, framing it by its
+// Content-Length. Keep-alive CRLFs between messages are skipped.
+func ReadMessage(reader *bufio.Reader) ([]byte, error) {
+	var head bytes.Buffer
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF && head.Len() > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			if head.Len() == 0 {
+				continue
+			}
+			head.Write(line)
+			break
+		}
+		head.Write(line)
+		if head.Len() > MaxMessageSize {
+			return nil, errors.New("the message header is too large")
+		}
+	}
+	length, _ := contentLength(head.String())
+	if head.Len()+length > MaxMessageSize {
+		return nil, fmt.Errorf("the message body of %d bytes is too large", length)
+	}
+	raw := make([]byte, head.Len()+length)
+	copy(raw, head.Bytes())
+	if _, err := io.ReadFull(reader, raw[head.Len():]); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// NewTag returns a random tag for the From and To header fields.
+func NewTag() string {
+	return randomHex(8)
+}
+
+// NewBranch returns a random RFC 3261 branch with the magic cookie.
+func NewBranch() string {
+	return "z9hG4bK" + randomHex(12)
+}
+
+// NewCallID returns a random Call-ID value.
+func NewCallID() string {
+	return randomHex(16)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,120 @@
+package message
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+const testMessage = "MESSAGE sip:34020000001320000001@3402000000 SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP 192.168.1.2:5060;rport;branch=z9hG4bK123\r\n" +
+	"From: <sip:34020000002000000001@3402000000>;tag=abc\r\n" +
+	"To: <sip:34020000001320000001@3402000000>\r\n" +
+	"Call-ID: 12345@192.168.1.2\r\n" +
+	"CSeq: 20 MESSAGE\r\n" +
+	"Content-Type: Application/MANSCDP+xml\r\n" +
+	"Max-Forwards: 70\r\n" +
+	"User-Agent: IP Camera\r\n" +
+	"Content-Length: 8\r\n" +
+	"\r\n" +
+	"<Query/>"
+
+func TestParse(t *testing.T) {
+	msg, err := Parse([]byte(testMessage + "trailing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, ok := msg.(*Request)
+	if !ok {
+		t.Fatalf("unexpected message %s", msg)
+	}
+	if request.GetMethod() != "MESSAGE" || string(request.GetBody()) != "<Query/>" {
+		t.Fatalf("unexpected request %s %q", request, request.GetBody())
+	}
+	head := request.GetHeader()
+	if head.ContentType.GetMediaType() != "Application/MANSCDP+xml" || head.UserAgent.GetServer() != "IP Camera" {
+		t.Fatalf("unexpected header %s %s", head.ContentType, head.UserAgent)
+	}
+	raw, err := request.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse([]byte(raw)); err != nil {
+		t.Fatal(err)
+	}
+
+	response := NewResponseTo(request, 200)
+	raw, err = response.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err = Parse([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, ok := msg.(*Response)
+	if !ok || parsed.GetStatusCode() != 200 || parsed.GetHeader().To.GetTag() == "" ||
+		parsed.GetHeader().Via.GetBranch() != "z9hG4bK123" {
+		t.Fatalf("unexpected response %s", raw)
+	}
+}
+
+func TestParse_Proxied(t *testing.T) {
+	raw := strings.Replace(testMessage, "Via: SIP/2.0/UDP 192.168.1.2:5060;rport;branch=z9hG4bK123\r\n",
+		"Via: SIP/2.0/UDP 192.168.1.3:5060;branch=z9hG4bK456\r\n"+
+			"Via: SIP/2.0/UDP 192.168.1.2:5060;rport;branch=z9hG4bK123\r\n"+
+			"Record-Route: <sip:192.168.1.3;lr>\r\n"+
+			"X-Channel: 34020000001320000001\r\n", 1)
+	msg, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := msg.(*Request)
+	forwarded, err := request.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Record-Route: <sip:192.168.1.3;lr>\r\n", "X-Channel: 34020000001320000001\r\n"} {
+		if !strings.Contains(forwarded, line) {
+			t.Fatalf("%q is lost in %s", line, forwarded)
+		}
+	}
+
+	head := NewResponseTo(request, 200).GetHeader()
+	if vias := head.GetVias(); len(vias) != 2 || vias[0].GetBranch() != "z9hG4bK456" || vias[1].GetBranch() != "z9hG4bK123" {
+		t.Fatalf("unexpected response vias %v", vias)
+	}
+	head.PopVia()
+	if request.GetHeader().Via.GetBranch() != "z9hG4bK456" || head.Via.GetBranch() != "z9hG4bK123" {
+		t.Fatalf("unexpected vias %s %s", request.GetHeader().Via, head.Via)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"MESSAGE sip:34020000001320000001@3402000000 SIP/2.0\r\n",
+		strings.Replace(testMessage, "CSeq: 20 MESSAGE", "CSeq: 20 INVITE", 1),
+		strings.Replace(testMessage, "Content-Length: 8", "Content-Length: 80", 1),
+	} {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("\r\n\r\n" + testMessage + testMessage))
+	for i := 0; i < 2; i++ {
+		raw, err := ReadMessage(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(raw) != testMessage {
+			t.Fatalf("unexpected message %q", raw)
+		}
+	}
+	if _, err := ReadMessage(reader); err == nil {
+		t.Fatal("expected EOF")
+	}
+}
@@ -0,0 +1,133 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/kokutas/gb28181/sip/line"
+	"github.com/kokutas/gb28181/sip/message/header"
+)
+
+type Request struct {
+	requestLine *line.RequestLine // request-line
+	header      *header.Header    // message-header
+	body        []byte            // message-body
+}
+
+func (request *Request) SetRequestLine(requestLine *line.RequestLine) {
+	request.requestLine = requestLine
+}
+func (request *Request) GetRequestLine() *line.RequestLine {
+	return request.requestLine
+}
+func (request *Request) SetHeader(header *header.Header) {
+	request.header = header
+}
+func (request *Request) GetHeader() *header.Header {
+	return request.header
+}
+
+// SetBody replaces the body and keeps Content-Length in step with it.
+func (request *Request) SetBody(body []byte) {
+	request.body = body
+	if request.header != nil {
+		request.header.ContentLength = header.NewContentLength(uint(len(body)))
+	}
+}
+func (request *Request) GetBody() []byte {
+	return request.body
+}
+
+// GetMethod returns the method of the request-line.
+func (request *Request) GetMethod() string {
+	if request.requestLine == nil {
+		return ""
+	}
+	return strings.ToUpper(request.requestLine.GetMethod())
+}
+
+func NewRequest(requestLine *line.RequestLine, header *header.Header, body []byte) *Request {
+	request := &Request{
+		requestLine: requestLine,
+		header:      header,
+	}
+	request.SetBody(body)
+	return request
+}
+
+func (request *Request) Raw() (string, error) {
+	result := ""
+	if err := request.Validator(); err != nil {
+		return result, err
+	}
+	requestLine, err := request.requestLine.Raw()
+	if err != nil {
+		return result, err
+	}
+	head, err := request.header.Raw()
+	if err != nil {
+		return result, err
+	}
+	result += requestLine + head + string(request.body)
+	return result, nil
+}
+
+func (request *Request) Parse(raw string) error {
+	if reflect.DeepEqual(nil, request) {
+		return errors.New("request caller is not allowed to be nil")
+	}
+	if len(strings.TrimSpace(raw)) == 0 {
+		return errors.New("the raw parameter is not allowed to be empty")
+	}
+	requestLine, head, body, err := split(raw)
+	if err != nil {
+		return err
+	}
+	request.requestLine = new(line.RequestLine)
+	if err := request.requestLine.Parse(requestLine); err != nil {
+		return fmt.Errorf("request-line parse error : %s", err.Error())
+	}
+	request.header = new(header.Header)
+	if err := request.header.Parse(head); err != nil {
+		return fmt.Errorf("header parse error : %s", err.Error())
+	}
+	request.body = body
+	return request.Validator()
+}
+
+func (request *Request) Validator() error {
+	if reflect.DeepEqual(nil, request) {
+		return errors.New("request caller is not allowed to be nil")
+	}
+	if request.requestLine == nil {
+		return errors.New("the request-line field is not allowed to be nil")
+	}
+	if err := request.requestLine.Validator(); err != nil {
+		return err
+	}
+	if request.header == nil {
+		return errors.New("the header field is not allowed to be nil")
+	}
+	// RFC 3261 8.1.1: the mandatory header fields of a request
+	if request.header.Via == nil || request.header.From == nil || request.header.To == nil ||
+		request.header.CallID == nil || request.header.CSeq == nil {
+		return errors.New("the request must carry via, from, to, call-id and cseq")
+	}
+	if !strings.EqualFold(request.header.CSeq.GetMethod(), request.requestLine.GetMethod()) {
+		return errors.New("the cseq method does not match the request method")
+	}
+	return request.header.Validator()
+}
+
+func (request *Request) String() string {
+	result := ""
+	if request.requestLine != nil {
+		result += request.requestLine.String()
+	}
+	if request.header != nil && request.header.CallID != nil {
+		result += fmt.Sprintf(" (call-id %s)", request.header.CallID.String())
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/line"
+	"github.com/kokutas/gb28181/sip/message/header"
+)
+
+type Response struct {
+	statusLine *line.StatusLine // status-line
+	header     *header.Header   // message-header
+	body       []byte           // message-body
+}
+
+func (response *Response) SetStatusLine(statusLine *line.StatusLine) {
+	response.statusLine = statusLine
+}
+func (response *Response) GetStatusLine() *line.StatusLine {
+	return response.statusLine
+}
+func (response *Response) SetHeader(header *header.Header) {
+	response.header = header
+}
+func (response *Response) GetHeader() *header.Header {
+	return response.header
+}
+
+// SetBody replaces the body and keeps Content-Length in step with it.
+func (response *Response) SetBody(body []byte) {
+	response.body = body
+	if response.header != nil {
+		response.header.ContentLength = header.NewContentLength(uint(len(body)))
+	}
+}
+func (response *Response) GetBody() []byte {
+	return response.body
+}
+
+// GetStatusCode returns the status-code of the status-line.
+func (response *Response) GetStatusCode() int {
+	if response.statusLine == nil {
+		return 0
+	}
+	return response.statusLine.GetStatusCode()
+}
+
+func NewResponse(statusLine *line.StatusLine, header *header.Header, body []byte) *Response {
+	response := &Response{
+		statusLine: statusLine,
+		header:     header,
+	}
+	response.SetBody(body)
+	return response
+}
+
+// NewResponseTo builds the response of RFC 3261 8.2.6 to request: the
+// Vias in order, From, Call-ID and CSeq are copied and To gets a tag when the status code
+// is above 100 and the request had none.
+func NewResponseTo(request *Request, statusCode int) *Response {
+	requestHeader := request.GetHeader()
+	head := new(header.Header)
+	vias := requestHeader.GetVias()
+	for i := range vias {
+		vias[i] = vias[i].Clone()
+	}
+	head.SetVias(vias...)
+	if requestHeader.From != nil {
+		from := *requestHeader.From
+		head.From = &from
+	}
+	if requestHeader.To != nil {
+		to := *requestHeader.To
+		if statusCode > 100 && len(strings.TrimSpace(to.GetTag())) == 0 {
+			to.SetTag(NewTag())
+		}
+		head.To = &to
+	}
+	if requestHeader.CallID != nil {
+		callId := *requestHeader.CallID
+		head.CallID = &callId
+	}
+	if requestHeader.CSeq != nil {
+		cseq := *requestHeader.CSeq
+		head.CSeq = &cseq
+	}
+	return NewResponse(line.NewStatusLine("SIP", 2.0, statusCode, lib.ReasonPhrase(statusCode)), head, nil)
+}
+
+func (response *Response) Raw() (string, error) {
+	result := ""
+	if err := response.Validator(); err != nil {
+		return result, err
+	}
+	statusLine, err := response.statusLine.Raw()
+	if err != nil {
+		return result, err
+	}
+	head, err := response.header.Raw()
+	if err != nil {
+		return result, err
+	}
+	result += statusLine + head + string(response.body)
+	return result, nil
+}
+
+func (response *Response) Parse(raw string) error {
+	if reflect.DeepEqual(nil, response) {
+		return errors.New("response caller is not allowed to be nil")
+	}
+	if len(strings.TrimSpace(raw)) == 0 {
+		return errors.New("the raw parameter is not allowed to be empty")
+	}
+	statusLine, head, body, err := split(raw)
+	if err != nil {
+		return err
+	}
+	response.statusLine = new(line.StatusLine)
+	if err := response.statusLine.Parse(statusLine); err != nil {
+		return fmt.Errorf("status-line parse error : %s", err.Error())
+	}
+	response.header = new(header.Header)
+	if err := response.header.Parse(head); err != nil {
+		return fmt.Errorf("header parse error : %s", err.Error())
+	}
+	response.body = body
+	return response.Validator()
+}
+
+func (response *Response) Validator() error {
+	if reflect.DeepEqual(nil, response) {
+		return errors.New("response caller is not allowed to be nil")
+	}
+	if response.statusLine == nil {
+		return errors.New("the status-line field is not allowed to be nil")
+	}
+	if err := response.statusLine.Validator(); err != nil {
+		return err
+	}
+	if response.header == nil {
+		return errors.New("the header field is not allowed to be nil")
+	}
+	if response.header.Via == nil || response.header.From == nil || response.header.To == nil ||
+		response.header.CallID == nil || response.header.CSeq == nil {
+		return errors.New("the response must carry via, from, to, call-id and cseq")
+	}
+	return response.header.Validator()
+}
+
+func (response *Response) String() string {
+	result := ""
+	if response.statusLine != nil {
+		result += response.statusLine.String()
+	}
+	if response.header != nil && response.header.CSeq != nil {
+		result += fmt.Sprintf(" (%s)", response.header.CSeq.String())
+	}
+	return result
+}
@@ -0,0 +1,193 @@
+package subscription
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// DefaultExpires is the subscription duration used when a SUBSCRIBE has no
+// Expires, in seconds.
+const DefaultExpires = 3600
+
+var (
+	ErrClosed     = errors.New("the subscription is closed")
+	ErrTerminated = errors.New("the subscription was terminated by the notifier")
+)
+
+// NotifyHandler serves a NOTIFY of a subscription and returns the status
+// code of the response.
+type NotifyHandler func(subscription *Subscription, tx *ua.ServerTransaction) int
+
+// SubscribeHandler accepts or rejects a new subscription by returning the
+// status code of the SUBSCRIBE response. Once it returns a 2xx code the
+// notifier sends the first NOTIFY through the subscription.
+type SubscribeHandler func(subscription *ServerSubscription, tx *ua.ServerTransaction) int
+
+// Manager keeps the subscriptions of a user agent (RFC 3265): the ones it
+// made as subscriber, whose NOTIFY requests it routes to their handler, and
+// the ones it accepted as notifier, which it refreshes and expires.
+type Manager struct {
+	userAgent  *ua.UserAgent
+	maxExpires uint
+
+	mutex               sync.Mutex
+	subscriptions       map[string]*Subscription
+	serverSubscriptions map[string]*ServerSubscription
+	handlers            map[string]SubscribeHandler
+	unmatched           ua.Handler
+}
+
+func (manager *Manager) GetUserAgent() *ua.UserAgent {
+	return manager.userAgent
+}
+
+// SetMaxExpires caps the duration granted to subscribers, in seconds.
+func (manager *Manager) SetMaxExpires(maxExpires uint) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.maxExpires = maxExpires
+}
+func (manager *Manager) GetMaxExpires() uint {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	return manager.maxExpires
+}
+
+// NewManager serves the SUBSCRIBE and NOTIFY requests of userAgent.
+func NewManager(userAgent *ua.UserAgent) *Manager {
+	manager := &Manager{
+		userAgent:           userAgent,
+		maxExpires:          DefaultExpires,
+		subscriptions:       make(map[string]*Subscription),
+		serverSubscriptions: make(map[string]*ServerSubscription),
+		handlers:            make(map[string]SubscribeHandler),
+	}
+	userAgent.Handle("SUBSCRIBE", manager.serveSubscribe)
+	userAgent.Handle("NOTIFY", manager.serveNotify)
+	return manager
+}
+
+// HandleSubscribe accepts subscriptions to eventType. SUBSCRIBE requests
+// for other events are answered 489 with the Allow-Events list.
+func (manager *Manager) HandleSubscribe(eventType string, handler SubscribeHandler) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.handlers[strings.ToLower(eventType)] = handler
+}
+
+// HandleUnmatched serves the NOTIFY requests matching no subscription,
+// which are answered 481 without a handler. Some GB28181 devices notify
+// outside of the subscription dialog.
+func (manager *Manager) HandleUnmatched(handler ua.Handler) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.unmatched = handler
+}
+
+// GetAllowEvents returns the event types subscriptions are accepted for.
+func (manager *Manager) GetAllowEvents() []string {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	events := make([]string, 0, len(manager.handlers))
+	for event := range manager.handlers {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return events
+}
+
+// GetServerSubscriptions returns the active subscriptions to eventType, or
+// to every event when eventType is empty.
+func (manager *Manager) GetServerSubscriptions(eventType string) []*ServerSubscription {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	var subscriptions []*ServerSubscription
+	for _, subscription := range manager.serverSubscriptions {
+		if len(eventType) == 0 || strings.EqualFold(subscription.event.GetEventType(), eventType) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions
+}
+
+// dialogKey identifies a subscription by its Call-ID and local tag.
+func dialogKey(callId, localTag string) string {
+	return callId + "/" + localTag
+}
+
+func (manager *Manager) serveNotify(tx *ua.ServerTransaction) {
+	request := tx.GetRequest()
+	head := request.GetHeader()
+	key := dialogKey(head.CallID.GetId(), head.To.GetTag())
+	manager.mutex.Lock()
+	subscription, ok := manager.subscriptions[key]
+	unmatched := manager.unmatched
+	manager.mutex.Unlock()
+	if !ok {
+		if unmatched != nil {
+			unmatched(tx)
+			return
+		}
+		respond(tx, 481)
+		return
+	}
+	if head.Event == nil || !strings.EqualFold(head.Event.GetEventType(), subscription.event.GetEventType()) {
+		respond(tx, 489)
+		return
+	}
+	statusCode := 200
+	if subscription.handler != nil {
+		statusCode = subscription.handler(subscription, tx)
+	}
+	respond(tx, statusCode)
+	if state := head.SubscriptionState; state != nil {
+		subscription.notified(state)
+	}
+}
+
+func (manager *Manager) serveSubscribe(tx *ua.ServerTransaction) {
+	request := tx.GetRequest()
+	head := request.GetHeader()
+	if head.Event == nil {
+		respond(tx, 400)
+		return
+	}
+	if len(head.To.GetTag()) > 0 {
+		manager.mutex.Lock()
+		subscription, ok := manager.serverSubscriptions[dialogKey(head.CallID.GetId(), head.To.GetTag())]
+		manager.mutex.Unlock()
+		if !ok {
+			respond(tx, 481)
+			return
+		}
+		subscription.refresh(tx)
+		return
+	}
+	manager.mutex.Lock()
+	handler, ok := manager.handlers[strings.ToLower(head.Event.GetEventType())]
+	manager.mutex.Unlock()
+	if !ok {
+		response := message.NewResponseTo(request, 489)
+		if events := manager.GetAllowEvents(); len(events) > 0 {
+			response.GetHeader().AllowEvents = header.NewAllowEvents(events...)
+		}
+		if err := tx.Respond(response); err != nil {
+			log.Printf("sip response to %s error : %s", tx.GetSource(), err.Error())
+		}
+		return
+	}
+	manager.accept(tx, handler)
+}
+
+func respond(tx *ua.ServerTransaction, statusCode int) {
+	if err := tx.RespondCode(statusCode); err != nil {
+		log.Printf("sip response to %s error : %s", tx.GetSource(), err.Error())
+	}
+}
@@ -0,0 +1,230 @@
+package subscription
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// Termination reasons of RFC 3265 3.2.4.
+const (
+	ReasonDeactivated = "deactivated"
+	ReasonProbation   = "probation"
+	ReasonRejected    = "rejected"
+	ReasonTimeout     = "timeout"
+	ReasonGiveUp      = "giveup"
+	ReasonNoResource  = "noresource"
+)
+
+// ServerSubscription is the notifier side of a subscription. It ends when
+// the subscriber unsubscribes, when it expires without refresh, or on
+// Terminate; each ending sends a terminated NOTIFY.
+type ServerSubscription struct {
+	manager     *Manager
+	event       *header.Event
+	request     *message.Request
+	destination string
+	dialog      *ua.Dialog
+	key         string
+
+	mutex     sync.Mutex
+	expiresAt time.Time
+	timer     *time.Timer
+	reason    string
+	done      chan struct{}
+}
+
+func (subscription *ServerSubscription) GetEvent() *header.Event {
+	return subscription.event
+}
+
+// GetRequest returns the initial SUBSCRIBE.
+func (subscription *ServerSubscription) GetRequest() *message.Request {
+	return subscription.request
+}
+
+// GetDestination returns the address the SUBSCRIBE came from, where the
+// NOTIFY requests are sent.
+func (subscription *ServerSubscription) GetDestination() string {
+	return subscription.destination
+}
+func (subscription *ServerSubscription) GetDialog() *ua.Dialog {
+	return subscription.dialog
+}
+
+// GetExpires returns the seconds left until the subscription expires.
+func (subscription *ServerSubscription) GetExpires() uint {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	return remaining(subscription.expiresAt)
+}
+
+// GetReason returns why the subscription ended, or "" while it is active.
+func (subscription *ServerSubscription) GetReason() string {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	return subscription.reason
+}
+
+// Done is closed when the subscription ends.
+func (subscription *ServerSubscription) Done() <-chan struct{} {
+	return subscription.done
+}
+
+// Notify sends body in an active NOTIFY.
+func (subscription *ServerSubscription) Notify(body []byte, contentType string) error {
+	subscription.mutex.Lock()
+	if len(subscription.reason) > 0 {
+		subscription.mutex.Unlock()
+		return ErrClosed
+	}
+	state := header.NewSubscriptionState(header.SubscriptionStateActive, remaining(subscription.expiresAt), "")
+	subscription.mutex.Unlock()
+	err := subscription.notify(state, body, contentType)
+	if sipError, ok := err.(*lib.SipError); ok && sipError.Code == 481 {
+		// the subscriber forgot the subscription
+		subscription.end(ReasonNoResource)
+	}
+	return err
+}
+
+// Terminate ends the subscription with a terminated NOTIFY giving reason.
+func (subscription *ServerSubscription) Terminate(reason string) error {
+	if !subscription.end(reason) {
+		return ErrClosed
+	}
+	return subscription.notify(header.NewSubscriptionState(header.SubscriptionStateTerminated, 0, reason), nil, "")
+}
+
+func (subscription *ServerSubscription) notify(state *header.SubscriptionState, body []byte, contentType string) error {
+	userAgent := subscription.manager.userAgent
+	request := userAgent.NewDialogRequest(subscription.dialog, "NOTIFY", body, contentType)
+	request.GetHeader().Event = subscription.event
+	request.GetHeader().SubscriptionState = state
+	response, err := userAgent.Request(request, subscription.destination)
+	if err != nil {
+		return err
+	}
+	if code := response.GetStatusCode(); code >= 300 {
+		return lib.NewSipError(code, response.GetStatusLine().GetReasonPhrase())
+	}
+	return nil
+}
+
+// end marks the subscription ended for reason unless it already was.
+func (subscription *ServerSubscription) end(reason string) bool {
+	subscription.mutex.Lock()
+	if len(subscription.reason) > 0 {
+		subscription.mutex.Unlock()
+		return false
+	}
+	subscription.reason = reason
+	if subscription.timer != nil {
+		subscription.timer.Stop()
+	}
+	close(subscription.done)
+	subscription.mutex.Unlock()
+	manager := subscription.manager
+	manager.mutex.Lock()
+	delete(manager.serverSubscriptions, subscription.key)
+	manager.mutex.Unlock()
+	return true
+}
+
+// accept serves an initial SUBSCRIBE with handler.
+func (manager *Manager) accept(tx *ua.ServerTransaction, handler SubscribeHandler) {
+	request := tx.GetRequest()
+	head := request.GetHeader()
+	expires := manager.grant(head.Expires)
+	// the 2xx response carries the local tag of the dialog
+	response := message.NewResponseTo(request, 200)
+	subscription := &ServerSubscription{
+		manager:     manager,
+		event:       head.Event,
+		request:     request,
+		destination: tx.GetSource(),
+		dialog:      ua.NewServerDialog(request, response),
+		key:         dialogKey(head.CallID.GetId(), response.GetHeader().To.GetTag()),
+		expiresAt:   time.Now().Add(time.Duration(expires) * time.Second),
+		done:        make(chan struct{}),
+	}
+	statusCode := handler(subscription, tx)
+	if statusCode < 200 || statusCode >= 300 {
+		respond(tx, statusCode)
+		return
+	}
+	if statusCode != 200 {
+		response.GetStatusLine().SetStatusCode(statusCode)
+		response.GetStatusLine().SetReasonPhrase(lib.ReasonPhrase(statusCode))
+	}
+	response.GetHeader().Expires = header.NewExpires(expires)
+	subscription.mutex.Lock()
+	subscription.timer = time.AfterFunc(time.Duration(expires)*time.Second, subscription.expire)
+	subscription.mutex.Unlock()
+	manager.mutex.Lock()
+	manager.serverSubscriptions[subscription.key] = subscription
+	manager.mutex.Unlock()
+	if err := tx.Respond(response); err != nil {
+		log.Printf("sip response to %s error : %s", tx.GetSource(), err.Error())
+	}
+}
+
+// refresh serves an in-dialog SUBSCRIBE; Expires 0 unsubscribes.
+func (subscription *ServerSubscription) refresh(tx *ua.ServerTransaction) {
+	expires := subscription.manager.grant(tx.GetRequest().GetHeader().Expires)
+	if head := tx.GetRequest().GetHeader(); head.Expires != nil && head.Expires.GetSeconds() == 0 {
+		expires = 0
+	}
+	response := message.NewResponseTo(tx.GetRequest(), 200)
+	response.GetHeader().Expires = header.NewExpires(expires)
+	subscription.mutex.Lock()
+	ended := len(subscription.reason) > 0
+	if !ended && expires > 0 {
+		subscription.expiresAt = time.Now().Add(time.Duration(expires) * time.Second)
+		subscription.timer.Reset(time.Duration(expires) * time.Second)
+	}
+	subscription.mutex.Unlock()
+	if ended {
+		respond(tx, 481)
+		return
+	}
+	if err := tx.Respond(response); err != nil {
+		log.Printf("sip response to %s error : %s", tx.GetSource(), err.Error())
+	}
+	if expires == 0 {
+		if err := subscription.Terminate(ReasonTimeout); err != nil && err != ErrClosed {
+			log.Printf("%s subscription termination error : %s", subscription.event.GetEventType(), err.Error())
+		}
+	}
+}
+
+func (subscription *ServerSubscription) expire() {
+	if err := subscription.Terminate(ReasonTimeout); err != nil && err != ErrClosed {
+		log.Printf("%s subscription expiry error : %s", subscription.event.GetEventType(), err.Error())
+	}
+}
+
+// grant returns the duration granted for a requested Expires.
+func (manager *Manager) grant(expires *header.Expires) uint {
+	granted := uint(DefaultExpires)
+	if expires != nil {
+		granted = expires.GetSeconds()
+	}
+	if maxExpires := manager.GetMaxExpires(); maxExpires > 0 && granted > maxExpires {
+		granted = maxExpires
+	}
+	return granted
+}
+
+func remaining(expiresAt time.Time) uint {
+	left := time.Until(expiresAt)
+	if left <= 0 {
+		return 0
+	}
+	return uint((left + time.Second - 1) / time.Second)
+}
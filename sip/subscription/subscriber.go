@@ -0,0 +1,245 @@
+package subscription
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/sip/lib"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+// unsubscribeLinger keeps an unsubscribed subscription matching the final
+// NOTIFY of the notifier for a while.
+const unsubscribeLinger = 32 * time.Second
+
+// Subscription is the subscriber side of a subscription. It is refreshed
+// when four fifths of the granted duration elapsed, until Unsubscribe, a
+// failed refresh or a terminated NOTIFY.
+type Subscription struct {
+	manager     *Manager
+	destination string
+	event       *header.Event
+	body        []byte
+	contentType string
+	handler     NotifyHandler
+	key         string
+	request     *message.Request
+
+	mutex   sync.Mutex
+	dialog  *ua.Dialog
+	expires uint   // granted duration in seconds
+	state   string // state of the last NOTIFY
+	reason  string // reason of the terminated NOTIFY
+	err     error
+	closing chan struct{}
+	done    chan struct{}
+}
+
+func (subscription *Subscription) GetDestination() string {
+	return subscription.destination
+}
+func (subscription *Subscription) GetEvent() *header.Event {
+	return subscription.event
+}
+
+// GetRequest returns the initial SUBSCRIBE.
+func (subscription *Subscription) GetRequest() *message.Request {
+	return subscription.request
+}
+func (subscription *Subscription) GetDialog() *ua.Dialog {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	return subscription.dialog
+}
+
+// GetExpires returns the duration granted on the last (re)subscription, in
+// seconds.
+func (subscription *Subscription) GetExpires() uint {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	return subscription.expires
+}
+
+// GetState returns the Subscription-State of the last NOTIFY, or "" before
+// the first.
+func (subscription *Subscription) GetState() string {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	return subscription.state
+}
+
+// GetReason returns the reason the notifier gave for terminating.
+func (subscription *Subscription) GetReason() string {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	return subscription.reason
+}
+
+// Done is closed when the subscription ends.
+func (subscription *Subscription) Done() <-chan struct{} {
+	return subscription.done
+}
+
+// Err returns why the subscription ended: nil while it is active, ErrClosed
+// after Unsubscribe, ErrTerminated after a terminated NOTIFY, or the
+// refresh error.
+func (subscription *Subscription) Err() error {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	return subscription.err
+}
+
+// Subscribe sends a SUBSCRIBE for event to target at destination and keeps
+// the subscription refreshed. Its NOTIFY requests go to handler; a nil
+// handler answers them 200. An expires of 0 asks for DefaultExpires.
+func (manager *Manager) Subscribe(destination string, target *header.Uri, event *header.Event, body []byte, contentType string, expires uint, handler NotifyHandler) (*Subscription, error) {
+	if expires == 0 {
+		expires = DefaultExpires
+	}
+	request := manager.userAgent.NewRequest("SUBSCRIBE", target, body, contentType)
+	request.GetHeader().Event = event
+	request.GetHeader().Expires = header.NewExpires(expires)
+	subscription := &Subscription{
+		manager:     manager,
+		destination: destination,
+		event:       event,
+		body:        body,
+		contentType: contentType,
+		handler:     handler,
+		key:         dialogKey(request.GetHeader().CallID.GetId(), request.GetHeader().From.GetTag()),
+		request:     request,
+		closing:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	// a NOTIFY may arrive before the response
+	manager.mutex.Lock()
+	manager.subscriptions[subscription.key] = subscription
+	manager.mutex.Unlock()
+	response, err := manager.userAgent.Request(request, destination)
+	if err == nil {
+		expires, err = grantedExpires(response, expires)
+	}
+	if err != nil {
+		manager.remove(subscription)
+		return nil, err
+	}
+	subscription.mutex.Lock()
+	subscription.dialog = ua.NewDialog(request, response)
+	subscription.expires = expires
+	subscription.mutex.Unlock()
+	go subscription.refresh()
+	return subscription, nil
+}
+
+// Unsubscribe ends the subscription with a SUBSCRIBE of Expires 0.
+func (subscription *Subscription) Unsubscribe() error {
+	if !subscription.stop(ErrClosed) {
+		// already ended; a failed refresh is reported
+		if err := subscription.Err(); err != ErrClosed && err != ErrTerminated {
+			return err
+		}
+		return nil
+	}
+	<-subscription.done
+	_, err := subscription.subscribe(0)
+	time.AfterFunc(unsubscribeLinger, func() { subscription.manager.remove(subscription) })
+	return err
+}
+
+// stop ends the subscription with err unless it already ended.
+func (subscription *Subscription) stop(err error) bool {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	if subscription.err != nil {
+		return false
+	}
+	subscription.err = err
+	close(subscription.closing)
+	return true
+}
+
+// notified records the Subscription-State of a NOTIFY.
+func (subscription *Subscription) notified(state *header.SubscriptionState) {
+	subscription.mutex.Lock()
+	subscription.state = strings.ToLower(state.GetState())
+	if state.IsTerminated() {
+		subscription.reason = state.GetReason()
+	}
+	subscription.mutex.Unlock()
+	if state.IsTerminated() {
+		subscription.stop(ErrTerminated)
+		subscription.manager.remove(subscription)
+	}
+}
+
+func (subscription *Subscription) refresh() {
+	defer close(subscription.done)
+	for {
+		timer := time.NewTimer(time.Duration(subscription.GetExpires()) * time.Second * 4 / 5)
+		select {
+		case <-subscription.closing:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		granted, err := subscription.subscribe(subscription.GetExpires())
+		if err != nil {
+			if subscription.stop(err) {
+				log.Printf("%s subscription refresh error : %s", subscription.event.GetEventType(), err.Error())
+				subscription.manager.remove(subscription)
+			}
+			return
+		}
+		subscription.mutex.Lock()
+		subscription.expires = granted
+		subscription.mutex.Unlock()
+	}
+}
+
+// subscribe sends an in-dialog SUBSCRIBE and returns the granted duration.
+func (subscription *Subscription) subscribe(expires uint) (uint, error) {
+	userAgent := subscription.manager.userAgent
+	request := userAgent.NewDialogRequest(subscription.GetDialog(), "SUBSCRIBE", subscription.body, subscription.contentType)
+	request.GetHeader().Event = subscription.event
+	request.GetHeader().Expires = header.NewExpires(expires)
+	response, err := userAgent.Request(request, subscription.destination)
+	if err != nil {
+		return 0, err
+	}
+	if expires == 0 {
+		if code := response.GetStatusCode(); code >= 300 {
+			return 0, lib.NewSipError(code, response.GetStatusLine().GetReasonPhrase())
+		}
+		return 0, nil
+	}
+	return grantedExpires(response, expires)
+}
+
+// grantedExpires returns the Expires of a 2xx SUBSCRIBE response, or the
+// requested one when the response has none.
+func grantedExpires(response *message.Response, requested uint) (uint, error) {
+	if code := response.GetStatusCode(); code >= 300 {
+		return 0, lib.NewSipError(code, response.GetStatusLine().GetReasonPhrase())
+	}
+	expires := response.GetHeader().Expires
+	if expires == nil {
+		return requested, nil
+	}
+	if expires.GetSeconds() == 0 {
+		return 0, errors.New("the subscription was granted no time")
+	}
+	return expires.GetSeconds(), nil
+}
+
+func (manager *Manager) remove(subscription *Subscription) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if manager.subscriptions[subscription.key] == subscription {
+		delete(manager.subscriptions, subscription.key)
+	}
+}
@@ -0,0 +1,159 @@
+package subscription
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/sip/message/header"
+	"github.com/kokutas/gb28181/sip/ua"
+)
+
+func newTestManager(t *testing.T, id string) *Manager {
+	userAgent := ua.NewUserAgent(id, "3402000000", "udp", "127.0.0.1:0")
+	userAgent.SetTimers(20*time.Millisecond, 80*time.Millisecond)
+	if err := userAgent.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { userAgent.Close() })
+	return NewManager(userAgent)
+}
+
+// newTestPair returns a subscriber and a notifier accepting presence
+// subscriptions, whose accepted subscriptions are sent on the channel
+// after a first NOTIFY.
+func newTestPair(t *testing.T) (*Manager, *Manager, chan *ServerSubscription) {
+	subscriber := newTestManager(t, "34020000002000000001")
+	notifier := newTestManager(t, "34020000001110000001")
+	accepted := make(chan *ServerSubscription, 1)
+	notifier.HandleSubscribe("presence", func(subscription *ServerSubscription, tx *ua.ServerTransaction) int {
+		go func() {
+			if err := subscription.Notify([]byte("<Notify/>"), "Application/MANSCDP+xml"); err != nil {
+				t.Error(err)
+			}
+			accepted <- subscription
+		}()
+		return 200
+	})
+	return subscriber, notifier, accepted
+}
+
+func target(manager *Manager) *header.Uri {
+	userAgent := manager.GetUserAgent()
+	return header.NewUri("sip", userAgent.GetID(), userAgent.GetHost(), userAgent.GetPort(), nil)
+}
+
+func TestManager_Subscribe(t *testing.T) {
+	subscriber, notifier, accepted := newTestPair(t)
+	notifier.SetMaxExpires(1)
+	bodies := make(chan string, 4)
+	subscription, err := subscriber.Subscribe(notifier.GetUserAgent().Addr().String(), target(notifier), header.NewEvent("presence", ""),
+		[]byte("<Query/>"), "Application/MANSCDP+xml", 60, func(subscription *Subscription, tx *ua.ServerTransaction) int {
+			bodies <- string(tx.GetRequest().GetBody())
+			return 200
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscription.GetExpires() != 1 {
+		t.Fatalf("granted %d", subscription.GetExpires())
+	}
+	serverSubscription := <-accepted
+	if body := <-bodies; body != "<Notify/>" {
+		t.Fatalf("unexpected body %q", body)
+	}
+	if subscription.GetState() != header.SubscriptionStateActive {
+		t.Fatalf("unexpected state %q", subscription.GetState())
+	}
+	if n := len(notifier.GetServerSubscriptions("Presence")); n != 1 {
+		t.Fatalf("%d server subscriptions", n)
+	}
+	// outlive the granted second through refreshes
+	time.Sleep(1500 * time.Millisecond)
+	if err := subscription.Err(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-serverSubscription.Done():
+		t.Fatal("the subscription expired despite refreshes")
+	default:
+	}
+
+	if err := subscription.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-serverSubscription.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the notifier kept the subscription")
+	}
+	if serverSubscription.GetReason() != ReasonTimeout {
+		t.Fatalf("unexpected reason %q", serverSubscription.GetReason())
+	}
+	// the final NOTIFY reaches the lingering subscription
+	if body := <-bodies; body != "" {
+		t.Fatalf("unexpected final body %q", body)
+	}
+	if subscription.GetState() != header.SubscriptionStateTerminated {
+		t.Fatalf("unexpected state %q", subscription.GetState())
+	}
+}
+
+func TestManager_Terminate(t *testing.T) {
+	subscriber, notifier, accepted := newTestPair(t)
+	subscription, err := subscriber.Subscribe(notifier.GetUserAgent().Addr().String(), target(notifier), header.NewEvent("presence", ""),
+		nil, "", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverSubscription := <-accepted
+	if remaining := serverSubscription.GetExpires(); remaining == 0 || remaining > DefaultExpires {
+		t.Fatalf("unexpected expires %d", remaining)
+	}
+	if err := serverSubscription.Terminate(ReasonRejected); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-subscription.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the subscription did not end")
+	}
+	if subscription.Err() != ErrTerminated || subscription.GetReason() != ReasonRejected {
+		t.Fatalf("unexpected end %v %q", subscription.Err(), subscription.GetReason())
+	}
+	if err := serverSubscription.Notify(nil, ""); err != ErrClosed {
+		t.Fatalf("expected closed, got %v", err)
+	}
+	if err := subscription.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManager_BadEvent(t *testing.T) {
+	subscriber, notifier, _ := newTestPair(t)
+	userAgent := subscriber.GetUserAgent()
+	request := userAgent.NewRequest("SUBSCRIBE", target(notifier), nil, "")
+	request.GetHeader().Event = header.NewEvent("dialog", "")
+	response, err := userAgent.Request(request, notifier.GetUserAgent().Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowEvents := response.GetHeader().AllowEvents
+	if response.GetStatusCode() != 489 || allowEvents == nil || !allowEvents.Allows("presence") {
+		t.Fatalf("unexpected response %s", response)
+	}
+}
+
+func TestManager_UnmatchedNotify(t *testing.T) {
+	subscriber, notifier, _ := newTestPair(t)
+	userAgent := notifier.GetUserAgent()
+	request := userAgent.NewRequest("NOTIFY", target(subscriber), nil, "")
+	request.GetHeader().Event = header.NewEvent("presence", "")
+	request.GetHeader().SubscriptionState = header.NewSubscriptionState(header.SubscriptionStateActive, 60, "")
+	response, err := userAgent.Request(request, subscriber.GetUserAgent().Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.GetStatusCode() != 481 {
+		t.Fatalf("unexpected response %s", response)
+	}
+}
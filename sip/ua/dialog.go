@@ -0,0 +1,99 @@
+package ua
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/kokutas/gb28181/sip/line"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+)
+
+// Dialog is the client side of a dialog created by a 2xx response to an
+// INVITE or SUBSCRIBE (RFC 3261 12.1.2). It builds the requests sent within
+// the dialog. GB28181 peers do not record-route, so the route set is empty.
+type Dialog struct {
+	callId *header.CallID
+	local  *header.From
+	remote *header.To
+	target *line.RequestUri
+
+	mutex sync.Mutex
+	cseq  uint64
+}
+
+// NewDialog creates the dialog of request and its 2xx response. The remote
+// target is the Contact of the response, or the request URI without one.
+func NewDialog(request *message.Request, response *message.Response) *Dialog {
+	requestHeader := request.GetHeader()
+	dialog := &Dialog{
+		callId: requestHeader.CallID,
+		local:  requestHeader.From,
+		remote: response.GetHeader().To,
+		target: request.GetRequestLine().GetReqUri().Clone(),
+		cseq:   requestHeader.CSeq.GetSequenceNumber(),
+	}
+	if contact := response.GetHeader().Contact; contact != nil && contact.GetUri() != nil {
+		uri := contact.GetUri()
+		dialog.target = uri.Clone()
+	}
+	return dialog
+}
+
+// NewServerDialog creates the server side of the dialog of request and its
+// 2xx response, whose To tag is the local tag. The remote target is the
+// Contact of the request, or its From address without one.
+func NewServerDialog(request *message.Request, response *message.Response) *Dialog {
+	requestHeader := request.GetHeader()
+	to := response.GetHeader().To
+	from := requestHeader.From
+	uri := from.GetAddress()
+	if contact := requestHeader.Contact; contact != nil && contact.GetUri() != nil {
+		uri = contact.GetUri()
+	}
+	return &Dialog{
+		callId: requestHeader.CallID,
+		local:  header.NewFrom(to.GetDisplayName(), to.GetAddress(), to.GetTag()),
+		remote: header.NewTo(from.GetDisplayName(), from.GetAddress(), from.GetTag()),
+		target: uri.Clone(),
+	}
+}
+
+func (dialog *Dialog) GetCallID() string {
+	return dialog.callId.GetId()
+}
+func (dialog *Dialog) GetLocalTag() string {
+	return dialog.local.GetTag()
+}
+func (dialog *Dialog) GetRemoteTag() string {
+	return dialog.remote.GetTag()
+}
+func (dialog *Dialog) GetTarget() *line.RequestUri {
+	return dialog.target
+}
+
+// NewDialogRequest builds the next request of dialog, with a fresh branch
+// and the next CSeq.
+func (userAgent *UserAgent) NewDialogRequest(dialog *Dialog, method string, body []byte, contentType string) *message.Request {
+	method = strings.ToUpper(method)
+	dialog.mutex.Lock()
+	dialog.cseq++
+	cseq := dialog.cseq
+	dialog.mutex.Unlock()
+	head := new(header.Header)
+	head.Via = header.NewVia("SIP", 2.0, strings.ToUpper(userAgent.network), userAgent.host, userAgent.port, 1, message.NewBranch(), "")
+	head.From = dialog.local
+	head.To = dialog.remote
+	head.CallID = dialog.callId
+	head.CSeq = header.NewCSeq(cseq, method)
+	head.MaxForwards = header.NewMaxForwards(70)
+	head.UserAgent = header.NewUserAgent(userAgent.server)
+	if method != "MESSAGE" && method != "BYE" {
+		head.Contact = header.NewContact("", userAgent.GetContactUri(), nil)
+	}
+	if len(body) > 0 {
+		head.ContentType = header.NewContentType(contentType)
+	}
+	target := *dialog.target
+	return message.NewRequest(line.NewRequestLine(method, &target, "SIP", 2.0), head, body)
+}
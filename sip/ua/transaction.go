@@ -0,0 +1,402 @@
+package ua
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kokutas/gb28181/sip/line"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+)
+
+// inviteTimeout bounds an INVITE transaction once it got a provisional
+// response (timer C of RFC 3261 16.6).
+const inviteTimeout = 3 * time.Minute
+
+type clientTransaction struct {
+	responses chan *message.Response
+}
+
+// Request sends request to destination (host:port) over the user agent's
+// transport and waits for the final response. Over UDP the request is
+// retransmitted per RFC 3261 17.1; a non-2xx final response to INVITE is
+// acknowledged here, a 2xx must be acknowledged with Ack.
+func (userAgent *UserAgent) Request(request *message.Request, destination string) (*message.Response, error) {
+	head := request.GetHeader()
+	if head == nil || head.Via == nil || head.CSeq == nil {
+		return nil, errors.New("the request must carry via and cseq")
+	}
+	raw, err := request.Raw()
+	if err != nil {
+		return nil, err
+	}
+	method := request.GetMethod()
+	key := transactionKey(head.Via.GetBranch(), method)
+	tx := &clientTransaction{responses: make(chan *message.Response, 8)}
+	userAgent.mutex.Lock()
+	userAgent.clients[key] = tx
+	userAgent.mutex.Unlock()
+	defer func() {
+		userAgent.mutex.Lock()
+		delete(userAgent.clients, key)
+		userAgent.mutex.Unlock()
+	}()
+
+	to := &peer{network: userAgent.network, address: destination}
+	if err := userAgent.write(to, []byte(raw)); err != nil {
+		return nil, err
+	}
+	deadline := time.NewTimer(64 * userAgent.t1)
+	defer deadline.Stop()
+	interval := userAgent.t1
+	retransmit := time.NewTimer(interval)
+	defer retransmit.Stop()
+	if userAgent.network != "udp" {
+		retransmit.Stop()
+	}
+	for {
+		select {
+		case response := <-tx.responses:
+			code := response.GetStatusCode()
+			if code < 200 {
+				if method == "INVITE" {
+					retransmit.Stop()
+					deadline.Reset(inviteTimeout)
+				} else {
+					interval = userAgent.t2
+				}
+				continue
+			}
+			if method == "INVITE" && code >= 300 {
+				if err := userAgent.write(to, []byte(mustRaw(newAck(request, response, false)))); err != nil {
+					log.Printf("sip ack to %s error : %s", destination, err.Error())
+				}
+			}
+			return response, nil
+		case <-retransmit.C:
+			if err := userAgent.write(to, []byte(raw)); err != nil {
+				return nil, err
+			}
+			interval *= 2
+			if method != "INVITE" && interval > userAgent.t2 {
+				interval = userAgent.t2
+			}
+			retransmit.Reset(interval)
+		case <-deadline.C:
+			return nil, ErrTimeout
+		case <-userAgent.closed:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// Ack acknowledges a 2xx response to invite. The ACK is a new transaction
+// sent to the Contact of the response when it has one.
+func (userAgent *UserAgent) Ack(invite *message.Request, response *message.Response, destination string) error {
+	ack := newAck(invite, response, true)
+	if contact := response.GetHeader().Contact; contact != nil && contact.GetUri() != nil {
+		uri := contact.GetUri()
+		ack.GetRequestLine().SetReqUri(uri.Clone())
+	}
+	raw, err := ack.Raw()
+	if err != nil {
+		return err
+	}
+	return userAgent.write(&peer{network: userAgent.network, address: destination}, []byte(raw))
+}
+
+// Cancel cancels invite, a request still waiting for its final response,
+// and returns the response to the CANCEL (RFC 3261 9.1). The final response
+// to invite, 487 when the cancel took effect, is returned by its Request.
+func (userAgent *UserAgent) Cancel(invite *message.Request, destination string) (*message.Response, error) {
+	inviteHeader := invite.GetHeader()
+	head := new(header.Header)
+	head.Via = inviteHeader.Via.Clone()
+	head.From = inviteHeader.From
+	head.To = inviteHeader.To
+	head.CallID = inviteHeader.CallID
+	head.CSeq = header.NewCSeq(inviteHeader.CSeq.GetSequenceNumber(), "CANCEL")
+	head.MaxForwards = header.NewMaxForwards(70)
+	head.Route = inviteHeader.Route
+	head.UserAgent = inviteHeader.UserAgent
+	cancel := message.NewRequest(line.NewRequestLine("CANCEL", invite.GetRequestLine().GetReqUri().Clone(), "SIP", 2.0), head, nil)
+	return userAgent.Request(cancel, destination)
+}
+
+// newAck builds the ACK of RFC 3261 17.1.1.3 (same branch, for non-2xx) or
+// 13.2.2.4 (new branch, for 2xx).
+func newAck(invite *message.Request, response *message.Response, newBranch bool) *message.Request {
+	inviteHeader := invite.GetHeader()
+	head := new(header.Header)
+	via := inviteHeader.Via.Clone()
+	if newBranch {
+		via.SetBranch(message.NewBranch())
+	}
+	head.Via = via
+	head.From = inviteHeader.From
+	head.To = response.GetHeader().To
+	head.CallID = inviteHeader.CallID
+	head.CSeq = header.NewCSeq(inviteHeader.CSeq.GetSequenceNumber(), "ACK")
+	head.MaxForwards = header.NewMaxForwards(70)
+	head.Route = inviteHeader.Route
+	head.UserAgent = inviteHeader.UserAgent
+	return message.NewRequest(line.NewRequestLine("ACK", invite.GetRequestLine().GetReqUri().Clone(), "SIP", 2.0), head, nil)
+}
+
+func mustRaw(msg message.Message) string {
+	raw, err := msg.Raw()
+	if err != nil {
+		log.Printf("sip message encode error : %s", err.Error())
+	}
+	return raw
+}
+
+func (userAgent *UserAgent) receiveResponse(response *message.Response) {
+	head := response.GetHeader()
+	key := transactionKey(head.Via.GetBranch(), head.CSeq.GetMethod())
+	userAgent.mutex.Lock()
+	tx, ok := userAgent.clients[key]
+	userAgent.mutex.Unlock()
+	if !ok {
+		// a retransmitted final response after the transaction ended
+		return
+	}
+	select {
+	case tx.responses <- response:
+	default:
+	}
+}
+
+// ServerTransaction is the server side of a transaction: it absorbs
+// request retransmissions by resending the last response.
+type ServerTransaction struct {
+	userAgent *UserAgent
+	request   *message.Request
+	from      *peer
+	key       string
+
+	mutex     sync.Mutex
+	last      []byte // last response sent
+	final     bool
+	acked     chan struct{}
+	cancelled chan struct{}
+}
+
+func (tx *ServerTransaction) GetRequest() *message.Request {
+	return tx.request
+}
+
+// GetSource returns the host:port the request came from.
+func (tx *ServerTransaction) GetSource() string {
+	return tx.from.address
+}
+
+// GetNetwork returns the transport the request came over.
+func (tx *ServerTransaction) GetNetwork() string {
+	return tx.from.network
+}
+
+// Respond sends response. Via gets the received and rport parameters when
+// the request asked for them (RFC 3581). Final responses to INVITE are
+// retransmitted over UDP until the ACK arrives.
+func (tx *ServerTransaction) Respond(response *message.Response) error {
+	if via := response.GetHeader().Via; via != nil && via.GetRPort() == 1 {
+		host, port, err := net.SplitHostPort(tx.from.address)
+		if err == nil {
+			portNumber, _ := strconv.Atoi(port)
+			via.SetRPort(uint16(portNumber))
+			via.SetReceived(host)
+		}
+	}
+	if response.GetHeader().UserAgent == nil {
+		response.GetHeader().UserAgent = header.NewUserAgent(tx.userAgent.server)
+	}
+	raw, err := response.Raw()
+	if err != nil {
+		return err
+	}
+	code := response.GetStatusCode()
+	tx.mutex.Lock()
+	if tx.final {
+		tx.mutex.Unlock()
+		return fmt.Errorf("the transaction of %s is already answered", tx.request.String())
+	}
+	tx.last = []byte(raw)
+	tx.final = code >= 200
+	tx.mutex.Unlock()
+	if err := tx.userAgent.write(tx.from, []byte(raw)); err != nil {
+		return err
+	}
+	if tx.final && tx.request.GetMethod() == "INVITE" {
+		// the ACK finds the transaction until 64*T1 after its final response
+		time.AfterFunc(64*tx.userAgent.t1, tx.forget)
+		if tx.from.network == "udp" {
+			go tx.retransmit([]byte(raw))
+		}
+	}
+	return nil
+}
+
+// Cancelled is closed when a CANCEL ended the INVITE transaction with 487
+// before it got a final response; the handler must not answer it then.
+func (tx *ServerTransaction) Cancelled() <-chan struct{} {
+	return tx.cancelled
+}
+
+// WaitAck waits for the ACK of the final response to INVITE, at most 64*T1
+// (RFC 3261 13.3.1.4), and reports whether it arrived.
+func (tx *ServerTransaction) WaitAck() bool {
+	deadline := time.NewTimer(64 * tx.userAgent.t1)
+	defer deadline.Stop()
+	select {
+	case <-tx.acked:
+		return true
+	case <-deadline.C:
+		return false
+	case <-tx.userAgent.closed:
+		return false
+	}
+}
+
+// RespondCode answers with a body-less response of statusCode.
+func (tx *ServerTransaction) RespondCode(statusCode int) error {
+	return tx.Respond(message.NewResponseTo(tx.request, statusCode))
+}
+
+func (tx *ServerTransaction) retransmit(raw []byte) {
+	interval := tx.userAgent.t1
+	deadline := time.NewTimer(64 * tx.userAgent.t1)
+	defer deadline.Stop()
+	for {
+		select {
+		case <-tx.acked:
+			return
+		case <-deadline.C:
+			return
+		case <-tx.userAgent.closed:
+			return
+		case <-time.After(interval):
+			if err := tx.userAgent.write(tx.from, raw); err != nil {
+				return
+			}
+			interval *= 2
+			if interval > tx.userAgent.t2 {
+				interval = tx.userAgent.t2
+			}
+		}
+	}
+}
+
+func (userAgent *UserAgent) receiveRequest(request *message.Request, from *peer) {
+	head := request.GetHeader()
+	method := request.GetMethod()
+	if method == "ACK" {
+		if tx := userAgent.inviteTransaction(head.CallID.String(), head.CSeq.GetSequenceNumber()); tx != nil {
+			tx.ack()
+			tx.mutex.Lock()
+			last := tx.last
+			tx.mutex.Unlock()
+			// the ACK of a non-2xx response belongs to the transaction
+			if !strings.HasPrefix(string(last), "SIP/2.0 2") {
+				return
+			}
+		}
+		userAgent.mutex.Lock()
+		handler := userAgent.handlers[method]
+		userAgent.mutex.Unlock()
+		if handler != nil {
+			go handler(&ServerTransaction{userAgent: userAgent, request: request, from: from, acked: make(chan struct{}), cancelled: make(chan struct{})})
+		}
+		return
+	}
+	key := transactionKey(head.Via.GetBranch(), method)
+	userAgent.mutex.Lock()
+	if tx, ok := userAgent.servers[key]; ok {
+		userAgent.mutex.Unlock()
+		tx.mutex.Lock()
+		last := tx.last
+		tx.mutex.Unlock()
+		if last != nil {
+			_ = userAgent.write(from, last)
+		}
+		return
+	}
+	tx := &ServerTransaction{userAgent: userAgent, request: request, from: from, key: key, acked: make(chan struct{}), cancelled: make(chan struct{})}
+	userAgent.servers[key] = tx
+	handler := userAgent.handlers[method]
+	userAgent.mutex.Unlock()
+	if method != "INVITE" {
+		time.AfterFunc(64*userAgent.t1, tx.forget)
+	}
+	if method == "CANCEL" {
+		go userAgent.serveCancel(tx)
+		return
+	}
+	if handler == nil {
+		if err := tx.RespondCode(405); err != nil {
+			log.Printf("sip response to %s error : %s", request.String(), err.Error())
+		}
+		return
+	}
+	go handler(tx)
+}
+
+// forget drops the transaction, whose retransmissions are new requests
+// from then on.
+func (tx *ServerTransaction) forget() {
+	tx.userAgent.mutex.Lock()
+	defer tx.userAgent.mutex.Unlock()
+	if tx.userAgent.servers[tx.key] == tx {
+		delete(tx.userAgent.servers, tx.key)
+	}
+}
+
+// serveCancel answers a CANCEL and ends the INVITE transaction of its
+// branch with 487 when it has no final response yet (RFC 3261 9.2).
+func (userAgent *UserAgent) serveCancel(tx *ServerTransaction) {
+	userAgent.mutex.Lock()
+	invite, ok := userAgent.servers[transactionKey(tx.request.GetHeader().Via.GetBranch(), "INVITE")]
+	userAgent.mutex.Unlock()
+	if !ok {
+		if err := tx.RespondCode(481); err != nil {
+			log.Printf("sip response to %s error : %s", tx.request.String(), err.Error())
+		}
+		return
+	}
+	if err := tx.RespondCode(200); err != nil {
+		log.Printf("sip response to %s error : %s", tx.request.String(), err.Error())
+	}
+	// an INVITE already answered is not affected
+	if err := invite.RespondCode(487); err == nil {
+		close(invite.cancelled)
+	}
+}
+
+// inviteTransaction finds the INVITE server transaction an ACK belongs to.
+func (userAgent *UserAgent) inviteTransaction(callId string, sequenceNumber uint64) *ServerTransaction {
+	userAgent.mutex.Lock()
+	defer userAgent.mutex.Unlock()
+	for _, tx := range userAgent.servers {
+		head := tx.request.GetHeader()
+		if tx.request.GetMethod() == "INVITE" && head.CallID.String() == callId && head.CSeq.GetSequenceNumber() == sequenceNumber {
+			return tx
+		}
+	}
+	return nil
+}
+
+func (tx *ServerTransaction) ack() {
+	tx.mutex.Lock()
+	defer tx.mutex.Unlock()
+	select {
+	case <-tx.acked:
+	default:
+		close(tx.acked)
+	}
+}
@@ -0,0 +1,115 @@
+package ua
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/kokutas/gb28181/sip/message"
+)
+
+// peer is the remote end a message came from or goes to. Stream
+// transports keep the connection so responses and later requests reuse it.
+type peer struct {
+	network string   // udp or tcp
+	address string   // remote host:port
+	conn    net.Conn // tcp only
+}
+
+func (userAgent *UserAgent) serveUDP(conn net.PacketConn) {
+	defer userAgent.wg.Done()
+	buffer := make([]byte, message.MaxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if userAgent.isClosed() {
+				return
+			}
+			log.Printf("sip udp read error : %s", err.Error())
+			continue
+		}
+		raw := make([]byte, n)
+		copy(raw, buffer[:n])
+		userAgent.receive(raw, &peer{network: "udp", address: addr.String()})
+	}
+}
+
+func (userAgent *UserAgent) serveTCP(listener net.Listener) {
+	defer userAgent.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if userAgent.isClosed() {
+				return
+			}
+			log.Printf("sip tcp accept error : %s", err.Error())
+			continue
+		}
+		userAgent.addConn(conn)
+	}
+}
+
+// addConn registers a stream connection under its remote address and reads
+// messages from it until it closes.
+func (userAgent *UserAgent) addConn(conn net.Conn) {
+	address := conn.RemoteAddr().String()
+	userAgent.mutex.Lock()
+	userAgent.conns[address] = conn
+	userAgent.mutex.Unlock()
+	userAgent.wg.Add(1)
+	go func() {
+		defer userAgent.wg.Done()
+		defer func() {
+			userAgent.mutex.Lock()
+			if userAgent.conns[address] == conn {
+				delete(userAgent.conns, address)
+			}
+			userAgent.mutex.Unlock()
+			conn.Close()
+		}()
+		reader := bufio.NewReader(conn)
+		for {
+			raw, err := message.ReadMessage(reader)
+			if err != nil {
+				return
+			}
+			userAgent.receive(raw, &peer{network: "tcp", address: address, conn: conn})
+		}
+	}()
+}
+
+// write sends raw to a peer, dialing a stream connection when none is
+// open to it yet.
+func (userAgent *UserAgent) write(to *peer, raw []byte) error {
+	if userAgent.isClosed() {
+		return ErrClosed
+	}
+	if strings.EqualFold(to.network, "udp") {
+		addr, err := net.ResolveUDPAddr("udp", to.address)
+		if err != nil {
+			return err
+		}
+		_, err = userAgent.packetConn.WriteTo(raw, addr)
+		return err
+	}
+	conn := to.conn
+	if conn == nil {
+		userAgent.mutex.Lock()
+		conn = userAgent.conns[to.address]
+		userAgent.mutex.Unlock()
+	}
+	if conn == nil {
+		dialed, err := net.DialTimeout("tcp", to.address, userAgent.t1*64)
+		if err != nil {
+			return err
+		}
+		userAgent.addConn(dialed)
+		conn = dialed
+	}
+	if _, err := conn.Write(raw); err != nil {
+		return fmt.Errorf("sip tcp write error : %s", err.Error())
+	}
+	return nil
+}
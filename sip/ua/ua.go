@@ -0,0 +1,257 @@
+package ua
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kokutas/gb28181/sip/line"
+	"github.com/kokutas/gb28181/sip/message"
+	"github.com/kokutas/gb28181/sip/message/header"
+)
+
+// RFC 3261 17.1.1.1 timer values.
+const (
+	DefaultT1 = 500 * time.Millisecond
+	DefaultT2 = 4 * time.Second
+)
+
+var (
+	ErrTimeout = errors.New("the sip transaction timed out")
+	ErrClosed  = errors.New("the user agent is closed")
+)
+
+// Handler serves the server transaction of an incoming request. It runs in
+// its own goroutine and must answer through the transaction, except for ACK.
+type Handler func(tx *ServerTransaction)
+
+// UserAgent is a SIP endpoint on one transport: it sends requests through
+// client transactions and hands incoming requests to the handler of their
+// method.
+type UserAgent struct {
+	id      string // SIP id, e.g. 34020000002000000001
+	realm   string // SIP domain, e.g. 3402000000
+	network string // udp or tcp
+	address string // listen address
+	host    string // advertised host
+	port    uint16 // advertised port
+	server  string // User-Agent header value
+	t1      time.Duration
+	t2      time.Duration
+	cseq    uint64
+
+	packetConn net.PacketConn
+	listener   net.Listener
+
+	mutex    sync.Mutex
+	conns    map[string]net.Conn
+	handlers map[string]Handler
+	clients  map[string]*clientTransaction
+	servers  map[string]*ServerTransaction
+	closed   chan struct{}
+	wg       sync.WaitGroup
+}
+
+func (userAgent *UserAgent) GetID() string {
+	return userAgent.id
+}
+func (userAgent *UserAgent) GetRealm() string {
+	return userAgent.realm
+}
+func (userAgent *UserAgent) GetNetwork() string {
+	return userAgent.network
+}
+
+// SetHost sets the host and port written in Via and Contact, e.g. a public
+// address when listening on 0.0.0.0.
+func (userAgent *UserAgent) SetHost(host string, port uint16) {
+	userAgent.host = host
+	userAgent.port = port
+}
+func (userAgent *UserAgent) GetHost() string {
+	return userAgent.host
+}
+func (userAgent *UserAgent) GetPort() uint16 {
+	return userAgent.port
+}
+func (userAgent *UserAgent) SetServer(server string) {
+	userAgent.server = server
+}
+func (userAgent *UserAgent) GetServer() string {
+	return userAgent.server
+}
+
+// SetTimers overrides T1 and T2; tests shorten them.
+func (userAgent *UserAgent) SetTimers(t1, t2 time.Duration) {
+	userAgent.t1 = t1
+	userAgent.t2 = t2
+}
+
+func NewUserAgent(id, realm, network, address string) *UserAgent {
+	return &UserAgent{
+		id:       id,
+		realm:    realm,
+		network:  strings.ToLower(network),
+		address:  address,
+		server:   "gb28181",
+		t1:       DefaultT1,
+		t2:       DefaultT2,
+		conns:    make(map[string]net.Conn),
+		handlers: make(map[string]Handler),
+		clients:  make(map[string]*clientTransaction),
+		servers:  make(map[string]*ServerTransaction),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Listen opens the transport. The advertised host and port default to the
+// bound address unless SetHost was called.
+func (userAgent *UserAgent) Listen() error {
+	var addr net.Addr
+	switch userAgent.network {
+	case "udp":
+		conn, err := net.ListenPacket("udp", userAgent.address)
+		if err != nil {
+			return err
+		}
+		userAgent.packetConn = conn
+		addr = conn.LocalAddr()
+		userAgent.wg.Add(1)
+		go userAgent.serveUDP(conn)
+	case "tcp":
+		listener, err := net.Listen("tcp", userAgent.address)
+		if err != nil {
+			return err
+		}
+		userAgent.listener = listener
+		addr = listener.Addr()
+		userAgent.wg.Add(1)
+		go userAgent.serveTCP(listener)
+	default:
+		return fmt.Errorf("unsupported sip transport %s", userAgent.network)
+	}
+	if len(userAgent.host) == 0 {
+		host, port, _ := net.SplitHostPort(addr.String())
+		if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+			host = "127.0.0.1"
+		}
+		portNumber, _ := strconv.Atoi(port)
+		userAgent.host = host
+		userAgent.port = uint16(portNumber)
+	}
+	return nil
+}
+
+// Addr returns the bound local address.
+func (userAgent *UserAgent) Addr() net.Addr {
+	if userAgent.packetConn != nil {
+		return userAgent.packetConn.LocalAddr()
+	}
+	if userAgent.listener != nil {
+		return userAgent.listener.Addr()
+	}
+	return nil
+}
+
+// Close stops the transport and fails pending client transactions.
+func (userAgent *UserAgent) Close() error {
+	userAgent.mutex.Lock()
+	select {
+	case <-userAgent.closed:
+		userAgent.mutex.Unlock()
+		return nil
+	default:
+	}
+	close(userAgent.closed)
+	for _, conn := range userAgent.conns {
+		conn.Close()
+	}
+	userAgent.mutex.Unlock()
+	var err error
+	if userAgent.packetConn != nil {
+		err = userAgent.packetConn.Close()
+	}
+	if userAgent.listener != nil {
+		err = userAgent.listener.Close()
+	}
+	userAgent.wg.Wait()
+	return err
+}
+
+func (userAgent *UserAgent) isClosed() bool {
+	select {
+	case <-userAgent.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Handle registers the handler of a request method. Requests without a
+// handler are answered 405.
+func (userAgent *UserAgent) Handle(method string, handler Handler) {
+	userAgent.mutex.Lock()
+	defer userAgent.mutex.Unlock()
+	userAgent.handlers[strings.ToUpper(method)] = handler
+}
+
+// GetUri returns the address of record sip:id@realm.
+func (userAgent *UserAgent) GetUri() *header.Uri {
+	return header.NewUri("sip", userAgent.id, userAgent.realm, 0, nil)
+}
+
+// GetContactUri returns sip:id@host:port.
+func (userAgent *UserAgent) GetContactUri() *header.Uri {
+	return header.NewUri("sip", userAgent.id, userAgent.host, userAgent.port, nil)
+}
+
+// NewRequest builds an out-of-dialog request to target with a fresh
+// branch, From tag, Call-ID and CSeq.
+func (userAgent *UserAgent) NewRequest(method string, target *header.Uri, body []byte, contentType string) *message.Request {
+	method = strings.ToUpper(method)
+	head := new(header.Header)
+	head.Via = header.NewVia("SIP", 2.0, strings.ToUpper(userAgent.network), userAgent.host, userAgent.port, 1, message.NewBranch(), "")
+	head.From = header.NewFrom("", userAgent.GetUri(), message.NewTag())
+	head.To = header.NewTo("", header.NewUri(target.GetSchema(), target.GetUser(), target.GetHost(), target.GetPort(), nil), "")
+	head.CallID = header.NewCallID(message.NewCallID(), "")
+	head.CSeq = header.NewCSeq(atomic.AddUint64(&userAgent.cseq, 1), method)
+	head.MaxForwards = header.NewMaxForwards(70)
+	head.UserAgent = header.NewUserAgent(userAgent.server)
+	if method != "MESSAGE" {
+		head.Contact = header.NewContact("", userAgent.GetContactUri(), nil)
+	}
+	if len(body) > 0 {
+		head.ContentType = header.NewContentType(contentType)
+	}
+	requestLine := line.NewRequestLine(method, target.Clone(), "SIP", 2.0)
+	return message.NewRequest(requestLine, head, body)
+}
+
+// receive parses and dispatches a message read from the transport.
+func (userAgent *UserAgent) receive(raw []byte, from *peer) {
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		// keep-alive
+		return
+	}
+	msg, err := message.Parse(raw)
+	if err != nil {
+		log.Printf("sip message from %s/%s parse error : %s", from.network, from.address, err.Error())
+		return
+	}
+	switch msg := msg.(type) {
+	case *message.Response:
+		userAgent.receiveResponse(msg)
+	case *message.Request:
+		userAgent.receiveRequest(msg, from)
+	}
+}
+
+func transactionKey(branch, method string) string {
+	return branch + "/" + strings.ToUpper(method)
+}
@@ -0,0 +1,160 @@
+package ua
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kokutas/gb28181/sip/message/header"
+)
+
+func newTestPair(t *testing.T, network string) (*UserAgent, *UserAgent) {
+	platform := NewUserAgent("34020000002000000001", "3402000000", network, "127.0.0.1:0")
+	device := NewUserAgent("34020000001320000001", "3402000000", network, "127.0.0.1:0")
+	for _, userAgent := range []*UserAgent{platform, device} {
+		userAgent.SetTimers(20*time.Millisecond, 80*time.Millisecond)
+		if err := userAgent.Listen(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		platform.Close()
+		device.Close()
+	})
+	return platform, device
+}
+
+func testRequest(t *testing.T, network string) {
+	platform, device := newTestPair(t, network)
+	var calls int32
+	device.Handle("MESSAGE", func(tx *ServerTransaction) {
+		atomic.AddInt32(&calls, 1)
+		if string(tx.GetRequest().GetBody()) != "<Query/>" {
+			t.Errorf("unexpected body %q", tx.GetRequest().GetBody())
+		}
+		// late enough for UDP retransmissions to reach the transaction
+		time.Sleep(70 * time.Millisecond)
+		if err := tx.RespondCode(200); err != nil {
+			t.Error(err)
+		}
+	})
+	target := header.NewUri("sip", device.GetID(), device.GetHost(), device.GetPort(), nil)
+	request := platform.NewRequest("MESSAGE", target, []byte("<Query/>"), "Application/MANSCDP+xml")
+	response, err := platform.Request(request, device.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.GetStatusCode() != 200 {
+		t.Fatalf("unexpected response %s", response)
+	}
+	via := response.GetHeader().Via
+	// over TCP the source port is the ephemeral port of the connection
+	if via.GetReceived() != "127.0.0.1" || (network == "udp" && via.GetRPort() != platform.GetPort()) {
+		t.Fatalf("unexpected via %s", via)
+	}
+	if response.GetHeader().To.GetTag() == "" {
+		t.Fatal("the response has no to tag")
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("handler called %d times", n)
+	}
+}
+
+func TestUserAgent_RequestUDP(t *testing.T) {
+	testRequest(t, "udp")
+}
+
+func TestUserAgent_RequestTCP(t *testing.T) {
+	testRequest(t, "tcp")
+}
+
+func TestUserAgent_MethodNotAllowed(t *testing.T) {
+	platform, device := newTestPair(t, "udp")
+	target := header.NewUri("sip", device.GetID(), device.GetHost(), device.GetPort(), nil)
+	response, err := platform.Request(platform.NewRequest("OPTIONS", target, nil, ""), device.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.GetStatusCode() != 405 {
+		t.Fatalf("unexpected response %s", response)
+	}
+}
+
+func TestUserAgent_Timeout(t *testing.T) {
+	platform, device := newTestPair(t, "udp")
+	target := header.NewUri("sip", device.GetID(), device.GetHost(), device.GetPort(), nil)
+	device.Handle("MESSAGE", func(tx *ServerTransaction) {})
+	if _, err := platform.Request(platform.NewRequest("MESSAGE", target, nil, ""), device.Addr().String()); err != ErrTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestUserAgent_Cancel(t *testing.T) {
+	platform, device := newTestPair(t, "udp")
+	invited := make(chan struct{}, 1)
+	cancelled := make(chan error, 1)
+	device.Handle("INVITE", func(tx *ServerTransaction) {
+		tx.RespondCode(100)
+		invited <- struct{}{}
+		select {
+		case <-tx.Cancelled():
+			cancelled <- tx.RespondCode(200)
+		case <-time.After(2 * time.Second):
+			t.Error("the invite was not cancelled")
+			tx.RespondCode(500)
+		}
+	})
+	target := header.NewUri("sip", device.GetID(), device.GetHost(), device.GetPort(), nil)
+	invite := platform.NewRequest("INVITE", target, nil, "")
+	responses := make(chan int, 1)
+	go func() {
+		response, err := platform.Request(invite, device.Addr().String())
+		if err != nil {
+			t.Error(err)
+			responses <- 0
+			return
+		}
+		responses <- response.GetStatusCode()
+	}()
+	<-invited
+	response, err := platform.Cancel(invite, device.Addr().String())
+	if err != nil || response.GetStatusCode() != 200 {
+		t.Fatalf("unexpected cancel response %v %v", response, err)
+	}
+	if code := <-responses; code != 487 {
+		t.Fatalf("the invite must be answered 487, got %d", code)
+	}
+	if err := <-cancelled; err == nil {
+		t.Fatal("a cancelled invite must not be answered again")
+	}
+	// a cancel of an invite never sent matches no transaction
+	other := platform.NewRequest("INVITE", target, nil, "")
+	if response, err := platform.Cancel(other, device.Addr().String()); err != nil || response.GetStatusCode() != 481 {
+		t.Fatalf("unexpected cancel response %v %v", response, err)
+	}
+}
+
+func TestUserAgent_WaitAck(t *testing.T) {
+	platform, device := newTestPair(t, "udp")
+	acked := make(chan bool, 1)
+	device.Handle("INVITE", func(tx *ServerTransaction) {
+		tx.RespondCode(200)
+		acked <- tx.WaitAck()
+	})
+	target := header.NewUri("sip", device.GetID(), device.GetHost(), device.GetPort(), nil)
+	for _, ack := range []bool{true, false} {
+		invite := platform.NewRequest("INVITE", target, nil, "")
+		response, err := platform.Request(invite, device.Addr().String())
+		if err != nil || response.GetStatusCode() != 200 {
+			t.Fatalf("unexpected response %v %v", response, err)
+		}
+		if ack {
+			if err := platform.Ack(invite, response, device.Addr().String()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := <-acked; got != ack {
+			t.Fatalf("acked %v, expected %v", got, ack)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/kokutas/gb28181/manscdp"
+)
+
+// Buckets of the BoltDB file; channels holds a bucket per device.
+var (
+	bucketMeta          = []byte("meta")
+	bucketDevices       = []byte("devices")
+	bucketChannels      = []byte("channels")
+	bucketRegistrations = []byte("registrations")
+	bucketUpstreams     = []byte("upstreams")
+	keyVersion          = []byte("version")
+)
+
+// migrations upgrade the file from the version of their index to the
+// next one; the version is the number applied. Append, never edit.
+var migrations = []func(tx *bolt.Tx) error{
+	// 1: the buckets
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketDevices, bucketChannels, bucketRegistrations, bucketUpstreams} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// Bolt is a Repository in a BoltDB file, which one process at a time may
+// open.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates a BoltDB file and migrates it to the latest
+// version.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("store %s error : %s", path, err.Error())
+	}
+	store := &Bolt{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("store %s migration error : %s", path, err.Error())
+	}
+	return store, nil
+}
+
+// Version returns the version of the file.
+func (store *Bolt) Version() (int, error) {
+	version := 0
+	err := store.db.View(func(tx *bolt.Tx) error {
+		version = readVersion(tx)
+		return nil
+	})
+	return version, err
+}
+
+func readVersion(tx *bolt.Tx) int {
+	meta := tx.Bucket(bucketMeta)
+	if meta == nil {
+		return 0
+	}
+	raw := meta.Get(keyVersion)
+	if len(raw) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(raw))
+}
+
+// migrate applies the migrations the file lacks in one transaction.
+func (store *Bolt) migrate() error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		version := readVersion(tx)
+		if version > len(migrations) {
+			return fmt.Errorf("version %d is newer than %d", version, len(migrations))
+		}
+		if version == len(migrations) {
+			return nil
+		}
+		for i := version; i < len(migrations); i++ {
+			if err := migrations[i](tx); err != nil {
+				return fmt.Errorf("version %d : %s", i+1, err.Error())
+			}
+		}
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		raw := make([]byte, 8)
+		binary.BigEndian.PutUint64(raw, uint64(len(migrations)))
+		return meta.Put(keyVersion, raw)
+	})
+}
+
+func put(tx *bolt.Tx, bucket []byte, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucket).Put([]byte(key), raw)
+}
+
+func (store *Bolt) PutDevice(device *Device) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, bucketDevices, device.ID, device)
+	})
+}
+
+func (store *Bolt) GetDevice(deviceID string) (*Device, error) {
+	device := new(Device)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucketDevices).Get([]byte(deviceID))
+		if raw == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(raw, device)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+func (store *Bolt) GetDevices() ([]*Device, error) {
+	devices := []*Device{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketDevices).ForEach(func(key, raw []byte) error {
+			device := new(Device)
+			if err := json.Unmarshal(raw, device); err != nil {
+				return fmt.Errorf("device %s error : %s", key, err.Error())
+			}
+			devices = append(devices, device)
+			return nil
+		})
+	})
+	return devices, err
+}
+
+func (store *Bolt) DeleteDevice(deviceID string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(deviceID)
+		if err := tx.Bucket(bucketDevices).Delete(key); err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketRegistrations).Delete(key); err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketChannels).DeleteBucket(key); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+func (store *Bolt) PutChannel(deviceID string, channel *manscdp.CatalogItem) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		channels, err := tx.Bucket(bucketChannels).CreateBucketIfNotExists([]byte(deviceID))
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(channel)
+		if err != nil {
+			return err
+		}
+		return channels.Put([]byte(channel.DeviceID), raw)
+	})
+}
+
+func (store *Bolt) DeleteChannel(deviceID, channelID string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		channels := tx.Bucket(bucketChannels).Bucket([]byte(deviceID))
+		if channels == nil {
+			return nil
+		}
+		return channels.Delete([]byte(channelID))
+	})
+}
+
+func (store *Bolt) ReplaceChannels(deviceID string, items []*manscdp.CatalogItem) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		parent := tx.Bucket(bucketChannels)
+		if err := parent.DeleteBucket([]byte(deviceID)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		channels, err := parent.CreateBucket([]byte(deviceID))
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			raw, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if err := channels.Put([]byte(item.DeviceID), raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *Bolt) GetChannels(deviceID string) ([]*manscdp.CatalogItem, error) {
+	items := []*manscdp.CatalogItem{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		channels := tx.Bucket(bucketChannels).Bucket([]byte(deviceID))
+		if channels == nil {
+			return nil
+		}
+		return channels.ForEach(func(key, raw []byte) error {
+			item := new(manscdp.CatalogItem)
+			if err := json.Unmarshal(raw, item); err != nil {
+				return fmt.Errorf("channel %s error : %s", key, err.Error())
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	return items, err
+}
+
+func (store *Bolt) PutRegistration(registration *Registration) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, bucketRegistrations, registration.DeviceID, registration)
+	})
+}
+
+func (store *Bolt) DeleteRegistration(deviceID string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketRegistrations).Delete([]byte(deviceID))
+	})
+}
+
+func (store *Bolt) GetRegistrations() ([]*Registration, error) {
+	registrations := []*Registration{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketRegistrations).ForEach(func(key, raw []byte) error {
+			registration := new(Registration)
+			if err := json.Unmarshal(raw, registration); err != nil {
+				return fmt.Errorf("registration %s error : %s", key, err.Error())
+			}
+			registrations = append(registrations, registration)
+			return nil
+		})
+	})
+	return registrations, err
+}
+
+func (store *Bolt) PutUpstream(upstream *Upstream) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, bucketUpstreams, upstream.RemoteID, upstream)
+	})
+}
+
+func (store *Bolt) DeleteUpstream(remoteID string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketUpstreams).Delete([]byte(remoteID))
+	})
+}
+
+func (store *Bolt) GetUpstreams() ([]*Upstream, error) {
+	upstreams := []*Upstream{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketUpstreams).ForEach(func(key, raw []byte) error {
+			upstream := new(Upstream)
+			if err := json.Unmarshal(raw, upstream); err != nil {
+				return fmt.Errorf("upstream %s error : %s", key, err.Error())
+			}
+			upstreams = append(upstreams, upstream)
+			return nil
+		})
+	})
+	return upstreams, err
+}
+
+func (store *Bolt) Close() error {
+	return store.db.Close()
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/kokutas/gb28181/manscdp"
+)
+
+// Memory is a Repository lost on exit, for tests and servers without a
+// store file.
+type Memory struct {
+	mutex         sync.RWMutex
+	devices       map[string]*Device
+	channels      map[string]map[string]*manscdp.CatalogItem
+	registrations map[string]*Registration
+	upstreams     map[string]*Upstream
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		devices:       make(map[string]*Device),
+		channels:      make(map[string]map[string]*manscdp.CatalogItem),
+		registrations: make(map[string]*Registration),
+		upstreams:     make(map[string]*Upstream),
+	}
+}
+
+func (memory *Memory) PutDevice(device *Device) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+	copied := *device
+	memory.devices[device.ID] = &copied
+	return nil
+}
+
+func (memory *Memory) GetDevice(deviceID string) (*Device, error) {
+	memory.mutex.RLock()
+	defer memory.mutex.RUnlock()
+	device, ok := memory.devices[deviceID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *device
+	return &copied, nil
+}
+
+func (memory *Memory) GetDevices() ([]*Device, error) {
+	memory.mutex.RLock()
+	devices := make([]*Device, 0, len(memory.devices))
+	for _, device := range memory.devices {
+		copied := *device
+		devices = append(devices, &copied)
+	}
+	memory.mutex.RUnlock()
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID < devices[j].ID
+	})
+	return devices, nil
+}
+
+func (memory *Memory) DeleteDevice(deviceID string) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+	delete(memory.devices, deviceID)
+	delete(memory.channels, deviceID)
+	delete(memory.registrations, deviceID)
+	return nil
+}
+
+func (memory *Memory) PutChannel(deviceID string, channel *manscdp.CatalogItem) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+	channels, ok := memory.channels[deviceID]
+	if !ok {
+		channels = make(map[string]*manscdp.CatalogItem)
+		memory.channels[deviceID] = channels
+	}
+	channels[channel.DeviceID] = copyItem(channel)
+	return nil
+}
+
+func (memory *Memory) DeleteChannel(deviceID, channelID string) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+	delete(memory.channels[deviceID], channelID)
+	return nil
+}
+
+func (memory *Memory) ReplaceChannels(deviceID string, items []*manscdp.CatalogItem) error {
+	channels := make(map[string]*manscdp.CatalogItem, len(items))
+	for _, item := range items {
+		channels[item.DeviceID] = copyItem(item)
+	}
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+	memory.channels[deviceID] = channels
+	return nil
+}
+
+func (memory *Memory) GetChannels(deviceID string) ([]*manscdp.CatalogItem, error) {
+	memory.mutex.RLock()
+	channels := make([]*manscdp.CatalogItem, 0, len(memory.channels[deviceID]))
+	for _, channel := range memory.channels[deviceID] {
+		channels = append(channels, copyItem(channel))
+	}
+	memory.mutex.RUnlock()
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].DeviceID < channels[j].DeviceID
+	})
+	return channels, nil
+}
+
+func (memory *Memory) PutRegistration(registration *Registration) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+	copied := *registration
+	memory.registrations[registration.DeviceID] = &copied
+	return nil
+}
+
+func (memory *Memory) DeleteRegistration(deviceID string) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+	delete(memory.registrations, deviceID)
+	return nil
+}
+
+func (memory *Memory) GetRegistrations() ([]*Registration, error) {
+	memory.mutex.RLock()
+	registrations := make([]*Registration, 0, len(memory.registrations))
+	for _, registration := range memory.registrations {
+		copied := *registration
+		registrations = append(registrations, &copied)
+	}
+	memory.mutex.RUnlock()
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].DeviceID < registrations[j].DeviceID
+	})
+	return registrations, nil
+}
+
+func (memory *Memory) PutUpstream(upstream *Upstream) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+	copied := *upstream
+	memory.upstreams[upstream.RemoteID] = &copied
+	return nil
+}
+
+func (memory *Memory) DeleteUpstream(remoteID string) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+	delete(memory.upstreams, remoteID)
+	return nil
+}
+
+func (memory *Memory) GetUpstreams() ([]*Upstream, error) {
+	memory.mutex.RLock()
+	upstreams := make([]*Upstream, 0, len(memory.upstreams))
+	for _, upstream := range memory.upstreams {
+		copied := *upstream
+		upstreams = append(upstreams, &copied)
+	}
+	memory.mutex.RUnlock()
+	sort.Slice(upstreams, func(i, j int) bool {
+		return upstreams[i].RemoteID < upstreams[j].RemoteID
+	})
+	return upstreams, nil
+}
+
+func (memory *Memory) Close() error {
+	return nil
+}
+
+// copyItem copies a catalog item with its Info.
+func copyItem(item *manscdp.CatalogItem) *manscdp.CatalogItem {
+	copied := *item
+	if item.Info != nil {
+		info := *item.Info
+		copied.Info = &info
+	}
+	return &copied
+}
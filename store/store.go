@@ -0,0 +1,155 @@
+// Package store keeps the state of a GB28181 server across restarts:
+// the devices seen, their channels, their registrations and the
+// upper-level platforms, in memory or in a BoltDB file.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kokutas/gb28181/cascade"
+	"github.com/kokutas/gb28181/manscdp"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Device is a device or lower-level platform that registered, kept while
+// it is offline.
+type Device struct {
+	ID           string    `json:"id"`
+	Kind         string    `json:"kind"`
+	Name         string    `json:"name,omitempty"`
+	Manufacturer string    `json:"manufacturer,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	Firmware     string    `json:"firmware,omitempty"`
+	Channels     int       `json:"channels"` // as the device reports it
+	Address      string    `json:"address,omitempty"`
+	Network      string    `json:"network,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"` // last registration
+}
+
+// Registration is a registration in force.
+type Registration struct {
+	DeviceID     string    `json:"device_id"`
+	Kind         string    `json:"kind"`
+	Address      string    `json:"address"`
+	Network      string    `json:"network"`
+	Contact      string    `json:"contact,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	CallID       string    `json:"call_id"`
+	RegisteredAt time.Time `json:"registered_at"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// Upstream is an upper-level platform our platform registers to. It keeps
+// no password: PasswordRef tells where to read it, see Secret, or the
+// caller takes it from its config.
+type Upstream struct {
+	LocalID           string        `json:"local_id"`
+	LocalAddress      string        `json:"local_address,omitempty"`
+	RemoteID          string        `json:"remote_id"`
+	Realm             string        `json:"realm,omitempty"`
+	Address           string        `json:"address"`
+	Transport         string        `json:"transport,omitempty"`
+	Username          string        `json:"username,omitempty"`
+	PasswordRef       string        `json:"password_ref,omitempty"`
+	Expires           uint          `json:"expires,omitempty"`
+	KeepaliveInterval time.Duration `json:"keepalive_interval,omitempty"`
+	KeepaliveTimeouts int           `json:"keepalive_timeouts,omitempty"`
+	RetryInterval     time.Duration `json:"retry_interval,omitempty"`
+	MaxRetryInterval  time.Duration `json:"max_retry_interval,omitempty"`
+}
+
+// NewUpstream keeps the configuration of upstream without its password.
+func NewUpstream(upstream *cascade.Upstream, passwordRef string) *Upstream {
+	return &Upstream{
+		LocalID:           upstream.LocalID,
+		LocalAddress:      upstream.LocalAddress,
+		RemoteID:          upstream.RemoteID,
+		Realm:             upstream.Realm,
+		Address:           upstream.Address,
+		Transport:         upstream.Transport,
+		Username:          upstream.Username,
+		PasswordRef:       passwordRef,
+		Expires:           upstream.Expires,
+		KeepaliveInterval: upstream.KeepaliveInterval,
+		KeepaliveTimeouts: upstream.KeepaliveTimeouts,
+		RetryInterval:     upstream.RetryInterval,
+		MaxRetryInterval:  upstream.MaxRetryInterval,
+	}
+}
+
+// Cascade returns the configuration of the client registering to the
+// upstream with password.
+func (upstream *Upstream) Cascade(password string) *cascade.Upstream {
+	return &cascade.Upstream{
+		LocalID:           upstream.LocalID,
+		LocalAddress:      upstream.LocalAddress,
+		RemoteID:          upstream.RemoteID,
+		Realm:             upstream.Realm,
+		Address:           upstream.Address,
+		Transport:         upstream.Transport,
+		Username:          upstream.Username,
+		Password:          password,
+		Expires:           upstream.Expires,
+		KeepaliveInterval: upstream.KeepaliveInterval,
+		KeepaliveTimeouts: upstream.KeepaliveTimeouts,
+		RetryInterval:     upstream.RetryInterval,
+		MaxRetryInterval:  upstream.MaxRetryInterval,
+	}
+}
+
+// Secret reads the secret a reference names: env:NAME is an environment
+// variable and file:PATH the content of a file, trailing newline removed.
+func Secret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		secret, ok := os.LookupEnv(strings.TrimPrefix(ref, "env:"))
+		if !ok {
+			return "", fmt.Errorf("secret %s error : not set", ref)
+		}
+		return secret, nil
+	case strings.HasPrefix(ref, "file:"):
+		raw, err := ioutil.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("secret %s error : %s", ref, err.Error())
+		}
+		return strings.TrimRight(string(raw), "\r\n"), nil
+	default:
+		return "", fmt.Errorf("secret %s error : unknown reference", ref)
+	}
+}
+
+// Repository stores devices, channels, registrations and upstream
+// platforms. Getters return ErrNotFound for unknown keys; lists are sorted
+// by id. Values are copied in and out, so callers keep theirs.
+type Repository interface {
+	PutDevice(device *Device) error
+	GetDevice(deviceID string) (*Device, error)
+	GetDevices() ([]*Device, error)
+	// DeleteDevice deletes a device with its channels and registration.
+	DeleteDevice(deviceID string) error
+
+	PutChannel(deviceID string, channel *manscdp.CatalogItem) error
+	DeleteChannel(deviceID, channelID string) error
+	// ReplaceChannels sets the whole catalog of a device.
+	ReplaceChannels(deviceID string, channels []*manscdp.CatalogItem) error
+	GetChannels(deviceID string) ([]*manscdp.CatalogItem, error)
+
+	PutRegistration(registration *Registration) error
+	DeleteRegistration(deviceID string) error
+	GetRegistrations() ([]*Registration, error)
+
+	// Upstreams are keyed by RemoteID.
+	PutUpstream(upstream *Upstream) error
+	DeleteUpstream(remoteID string) error
+	GetUpstreams() ([]*Upstream, error)
+
+	Close() error
+}
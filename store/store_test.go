@@ -0,0 +1,205 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/kokutas/gb28181/cascade"
+	"github.com/kokutas/gb28181/manscdp"
+)
+
+const (
+	testDeviceID  = "34020000001110000001"
+	testChannelID = "34020000001320000001"
+)
+
+func testRepository(t *testing.T, repository Repository) {
+	now := time.Now().Truncate(time.Second).UTC()
+	device := &Device{ID: testDeviceID, Kind: "device", Name: "nvr", Channels: 2, FirstSeen: now, LastSeen: now}
+	if err := repository.PutDevice(device); err != nil {
+		t.Fatal(err)
+	}
+	device.Name = "changed"
+	stored, err := repository.GetDevice(testDeviceID)
+	if err != nil || stored.Name != "nvr" || !stored.LastSeen.Equal(now) {
+		t.Fatalf("unexpected device %+v %v", stored, err)
+	}
+	if _, err := repository.GetDevice("34020000001110000002"); err != ErrNotFound {
+		t.Fatalf("unexpected error %v of an unknown device", err)
+	}
+	repository.PutDevice(&Device{ID: "34020000001110000000", Kind: "device"})
+	if devices, err := repository.GetDevices(); err != nil || len(devices) != 2 || devices[0].ID != "34020000001110000000" {
+		t.Fatalf("unexpected devices %+v %v", devices, err)
+	}
+
+	channels := []*manscdp.CatalogItem{
+		{DeviceID: "34020000001320000002", Name: "hall", Status: manscdp.StatusOff},
+		{DeviceID: testChannelID, Name: "gate", Info: &manscdp.CatalogItemInfo{PTZType: 1}},
+	}
+	if err := repository.ReplaceChannels(testDeviceID, channels); err != nil {
+		t.Fatal(err)
+	}
+	channels[1].Info.PTZType = 3
+	if err := repository.PutChannel(testDeviceID, &manscdp.CatalogItem{DeviceID: "34020000001320000003", Name: "yard"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.DeleteChannel(testDeviceID, "34020000001320000002"); err != nil {
+		t.Fatal(err)
+	}
+	items, err := repository.GetChannels(testDeviceID)
+	if err != nil || len(items) != 2 || items[0].DeviceID != testChannelID || items[0].Info.PTZType != 1 || items[1].Name != "yard" {
+		t.Fatalf("unexpected channels %+v %v", items, err)
+	}
+	repository.ReplaceChannels(testDeviceID, channels[:1])
+	if items, _ = repository.GetChannels(testDeviceID); len(items) != 1 || items[0].Name != "hall" {
+		t.Fatalf("unexpected replaced channels %+v", items)
+	}
+	if items, err = repository.GetChannels("34020000001110000009"); err != nil || len(items) != 0 {
+		t.Fatalf("unexpected channels %+v %v of an unknown device", items, err)
+	}
+	if err := repository.DeleteChannel("34020000001110000009", testChannelID); err != nil {
+		t.Fatal(err)
+	}
+
+	registration := &Registration{DeviceID: testDeviceID, Kind: "device", Address: "127.0.0.1:5060", Network: "udp",
+		CallID: "abc", RegisteredAt: now, Expiry: now.Add(time.Hour)}
+	if err := repository.PutRegistration(registration); err != nil {
+		t.Fatal(err)
+	}
+	repository.PutRegistration(&Registration{DeviceID: "34020000001110000000", Expiry: now})
+	registrations, err := repository.GetRegistrations()
+	if err != nil || len(registrations) != 2 || registrations[1].CallID != "abc" || !registrations[1].Expiry.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected registrations %+v %v", registrations, err)
+	}
+	repository.DeleteRegistration("34020000001110000000")
+	if registrations, _ = repository.GetRegistrations(); len(registrations) != 1 {
+		t.Fatalf("unexpected registrations %+v", registrations)
+	}
+
+	upstream := NewUpstream(&cascade.Upstream{LocalID: "34020000002000000001", RemoteID: "11010000002000000001",
+		Address: "10.0.0.1:5060", Password: "secret", KeepaliveInterval: time.Minute}, "env:GB28181_UPSTREAM_PASSWORD")
+	if err := repository.PutUpstream(upstream); err != nil {
+		t.Fatal(err)
+	}
+	if upstreams, err := repository.GetUpstreams(); err != nil || len(upstreams) != 1 || *upstreams[0] != *upstream {
+		t.Fatalf("unexpected upstreams %+v %v", upstreams, err)
+	}
+	if config := upstream.Cascade("secret"); config.Password != "secret" || config.KeepaliveInterval != time.Minute {
+		t.Fatalf("unexpected upstream config %+v", config)
+	}
+	repository.DeleteUpstream(upstream.RemoteID)
+	if upstreams, _ := repository.GetUpstreams(); len(upstreams) != 0 {
+		t.Fatalf("unexpected upstreams %+v", upstreams)
+	}
+
+	if err := repository.DeleteDevice(testDeviceID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.GetDevice(testDeviceID); err != ErrNotFound {
+		t.Fatalf("the deleted device is kept : %v", err)
+	}
+	items, _ = repository.GetChannels(testDeviceID)
+	registrations, _ = repository.GetRegistrations()
+	if len(items) != 0 || len(registrations) != 0 {
+		t.Fatalf("the channels %+v or registrations %+v of a deleted device are kept", items, registrations)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testRepository(t, NewMemory())
+}
+
+func TestBolt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gb28181.db")
+	store, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRepository(t, store)
+	store.PutDevice(&Device{ID: testDeviceID, Name: "nvr"})
+	store.Close()
+
+	store, err = OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device, err := store.GetDevice(testDeviceID); err != nil || device.Name != "nvr" {
+		t.Fatalf("unexpected device %+v %v after reopening", device, err)
+	}
+	if version, err := store.Version(); err != nil || version != len(migrations) {
+		t.Fatalf("unexpected version %d %v", version, err)
+	}
+	store.PutUpstream(NewUpstream(&cascade.Upstream{RemoteID: "11010000002000000001", Password: "secret"}, ""))
+	store.db.View(func(tx *bolt.Tx) error {
+		if raw := tx.Bucket(bucketUpstreams).Get([]byte("11010000002000000001")); bytes.Contains(raw, []byte("secret")) {
+			t.Fatalf("the upstream password is stored : %s", raw)
+		}
+		return nil
+	})
+	store.Close()
+}
+
+func TestBolt_Migrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gb28181.db")
+	store, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	db, _ := bolt.Open(path, 0600, nil)
+	db.Update(func(tx *bolt.Tx) error {
+		raw := make([]byte, 8)
+		binary.BigEndian.PutUint64(raw, uint64(len(migrations)+1))
+		return tx.Bucket(bucketMeta).Put(keyVersion, raw)
+	})
+	db.Close()
+	if _, err := OpenBolt(path); err == nil {
+		t.Fatal("a file of a newer version must not open")
+	}
+
+	// a migration failing leaves the file unchanged
+	applied := migrations
+	defer func() { migrations = applied }()
+	migrations = append(append([]func(*bolt.Tx) error(nil), applied...), func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket(bucketDevices)
+		return err
+	})
+	path = filepath.Join(t.TempDir(), "gb28181.db")
+	if _, err := OpenBolt(path); err == nil {
+		t.Fatal("the failing migration was applied")
+	}
+	migrations = applied
+	store, err = OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if version, _ := store.Version(); version != len(migrations) {
+		t.Fatalf("unexpected version %d", version)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	os.Setenv("GB28181_TEST_SECRET", "secret")
+	defer os.Unsetenv("GB28181_TEST_SECRET")
+	if secret, err := Secret("env:GB28181_TEST_SECRET"); err != nil || secret != "secret" {
+		t.Fatalf("unexpected secret %q %v", secret, err)
+	}
+	path := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(path, []byte("file secret\n"), 0600)
+	if secret, err := Secret("file:" + path); err != nil || secret != "file secret" {
+		t.Fatalf("unexpected secret %q %v", secret, err)
+	}
+	for _, ref := range []string{"env:GB28181_TEST_UNSET", "file:" + path + ".missing", "secret"} {
+		if _, err := Secret(ref); err == nil {
+			t.Fatalf("the secret %s must not resolve", ref)
+		}
+	}
+}